@@ -0,0 +1,218 @@
+package crawal
+
+import (
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// ManualGame is the game of adopted files that did not match any known wallpaper
+const ManualGame = "manual"
+
+// imageExts are the file extensions treated as images when scanning folders
+var imageExts = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+	".webp": true,
+	".avif": true,
+	".heic": true,
+	".jxl":  true,
+}
+
+// AdoptResult summarizes the adoption of a folder
+type AdoptResult struct {
+	Known   int // files already registered in the library
+	Matched int // files linked to a known wallpaper by checksum or name
+	Added   int // files registered as manual entries
+
+	Duplicates int   // byte-identical copies of library files stored elsewhere
+	Similar    int   // added files perceptually identical to a library file
+	Saved      int64 // bytes saved by hard linking duplicates
+}
+
+// AdoptFolder registers the images of an existing folder with the library.
+// Files are matched against known wallpapers by checksum, then by file name or
+// URL name, and linked to the ones that have no file on disk. Unmatched files are
+// registered as manual entries of the given game (ManualGame when empty), keyed by checksum.
+// Copies of library files are left out of the library, and hard linked to the library
+// file with DedupeLink.
+func AdoptFolder(db *sql.DB, dir, game, mode string) (AdoptResult, error) {
+	if game == "" {
+		game = ManualGame
+	}
+	if err := CheckDedupeMode(mode); err != nil {
+		return AdoptResult{}, err
+	}
+
+	items, err := FindGalleryItems(db, Filter{})
+	if err != nil {
+		return AdoptResult{}, fmt.Errorf("failed to load library: %w", err)
+	}
+
+	bySum := make(map[string][]int)
+	byName := make(map[string][]int)
+	for i, item := range items {
+		if item.SHA256 != "" {
+			bySum[item.SHA256] = append(bySum[item.SHA256], i)
+		}
+		// file names are stored without extension
+		name := strings.ToLower(norm.NFC.String(SanitizeFileName(item.FileName)))
+		byName[name] = append(byName[name], i)
+		if item.URL != "" {
+			urlName := nameKey(path.Base(item.URL))
+			byName[urlName] = append(byName[urlName], i)
+		}
+	}
+
+	var res AdoptResult
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == revisionsDir || d.Name() == thumbnailsDir || d.Name() == quarantineDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ext := filepath.Ext(p); !imageExts[strings.ToLower(ext)] && !decodedExt(ext) {
+			return nil
+		}
+
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return err
+		}
+		sum, size, err := HashFile(abs)
+		if err != nil {
+			return err
+		}
+
+		// Match by checksum first
+		if idx := bySum[sum]; len(idx) > 0 {
+			i, ok := pickUnlinked(items, idx, abs)
+			switch {
+			case ok:
+				if err := linkGalleryItem(db, &items[i], abs, sum, size); err != nil {
+					return err
+				}
+				res.Matched++
+			case registeredAt(items, idx, abs) || mode == DedupeOff:
+				res.Known++
+			default:
+				res.Duplicates++
+				if mode == DedupeLink {
+					if err := linkDuplicate(abs, items[idx[0]].Path); err == nil {
+						res.Saved += size
+					}
+				}
+			}
+			return nil
+		}
+
+		// Then by name, never relinking a wallpaper that still has its file
+		if i, ok := pickUnlinked(items, byName[nameKey(filepath.Base(abs))], abs); ok {
+			if err := linkGalleryItem(db, &items[i], abs, sum, size); err != nil {
+				return err
+			}
+			bySum[sum] = append(bySum[sum], i)
+			res.Matched++
+			return nil
+		}
+
+		item := GalleryItem{
+			IdGallery: sum,
+			Game:      game,
+			Type:      "wallpaper",
+			FileName:  strings.TrimSuffix(filepath.Base(abs), filepath.Ext(abs)),
+			Path:      abs,
+			SHA256:    sum,
+			Size:      size,
+		}
+		analyzeImage(&item)
+		similar, err := findSimilar(db, item.PHash, item)
+		if err != nil {
+			return err
+		}
+		if similar != nil {
+			item.DuplicateOf = similar.ID
+			res.Similar++
+		}
+		if err := SaveGalleryItem(db, item); err != nil {
+			return err
+		}
+		items = append(items, item)
+		bySum[sum] = append(bySum[sum], len(items)-1)
+		res.Added++
+		return nil
+	})
+	if err != nil {
+		return res, fmt.Errorf("failed to adopt %s: %w", dir, err)
+	}
+
+	return res, nil
+}
+
+// pickUnlinked chooses which of the candidate wallpapers a file at p should be
+// linked to. Wallpapers already stored at p or with their file still on disk are
+// never picked. When both variants of an entry match, the aethergazer folder
+// layout (mobileContentImg) decides between the mobile and desktop image.
+func pickUnlinked(items []GalleryItem, candidates []int, p string) (int, bool) {
+	var unlinked []int
+	for _, i := range candidates {
+		if items[i].Path == p {
+			return 0, false
+		}
+		if items[i].Path != "" {
+			if _, err := os.Stat(items[i].Path); err == nil {
+				continue
+			}
+		}
+		unlinked = append(unlinked, i)
+	}
+
+	if len(unlinked) == 0 {
+		return 0, false
+	}
+	mobile := strings.Contains(strings.ToLower(p), "mobile")
+	for _, i := range unlinked {
+		if (items[i].Type == "mobile") == mobile {
+			return i, true
+		}
+	}
+	return unlinked[0], true
+}
+
+// registeredAt reports whether one of the candidate wallpapers is stored at p
+func registeredAt(items []GalleryItem, candidates []int, p string) bool {
+	for _, i := range candidates {
+		if items[i].Path == p {
+			return true
+		}
+	}
+	return false
+}
+
+// linkGalleryItem records the file at p as the file of a wallpaper
+func linkGalleryItem(db *sql.DB, item *GalleryItem, p, sum string, size int64) error {
+	_, err := db.Exec("UPDATE files SET path = ?, sha256 = ?, size = ?, cataloged = 0 WHERE id = ?", storedPath(p), sum, size, item.ID)
+	if err != nil {
+		return fmt.Errorf("failed to link %s: %w", p, err)
+	}
+	item.Path, item.SHA256, item.Size, item.Cataloged = p, sum, size, false
+	return nil
+}
+
+// nameKey normalizes a file name for matching, ignoring case, extension and the
+// Unicode form
+func nameKey(name string) string {
+	return strings.ToLower(norm.NFC.String(strings.TrimSuffix(name, filepath.Ext(name))))
+}
@@ -0,0 +1,117 @@
+package crawal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// APIStatus is the health of the API of a game, compared with the library
+type APIStatus struct {
+	Game      string     `json:"game"`
+	Region    string     `json:"region,omitempty"`
+	Reachable bool       `json:"reachable"`
+	Error     string     `json:"error,omitempty"`
+	Elapsed   float64    `json:"elapsed"` // seconds taken to list the items
+	Items     int        `json:"items"`   // listed by the API
+	Newest    *time.Time `json:"newest,omitempty"`
+	Local     int        `json:"local"` // items of the game in the library
+	LocalNew  *time.Time `json:"local_newest,omitempty"`
+	Missing   int        `json:"missing"` // images listed by the API but not in the library
+}
+
+// UpToDate reports whether the library has every item listed by the API
+func (s APIStatus) UpToDate() bool {
+	return s.Reachable && s.Missing == 0
+}
+
+// CheckAPI lists the items of game with fetch and compares them with the library,
+// image by image: an item with its desktop image but not its mobile one is missing
+// the latter, as is an image only cataloged. Only the images listed by the API of
+// region count. Items on the skip list are left out. The failure of fetch is reported
+// in the status rather than returned.
+func CheckAPI(db *sql.DB, game, region string, fetch func() ([]Item, error)) (APIStatus, error) {
+	s, err := LocalAPIStatus(db, game)
+	if err != nil {
+		return s, err
+	}
+	s.Region = region
+
+	start := time.Now()
+	items, err := fetch()
+	s.Elapsed = time.Since(start).Seconds()
+	if err != nil {
+		s.Error = err.Error()
+		return s, nil
+	}
+	s.Reachable = true
+	s.Items = len(items)
+
+	local, err := localImages(db, game, region)
+	if err != nil {
+		return s, err
+	}
+	skips, err := loadSkipList(db, game)
+	if err != nil {
+		return s, err
+	}
+	for _, it := range items {
+		if _, ok := skips.match(it); !ok {
+			for _, v := range it.Variants {
+				if v.URL != "" && !local[[2]string{it.ID, v.Kind}] {
+					s.Missing++
+				}
+			}
+		}
+		if !it.PublishedAt.IsZero() && (s.Newest == nil || it.PublishedAt.After(*s.Newest)) {
+			published := it.PublishedAt
+			s.Newest = &published
+		}
+	}
+	return s, nil
+}
+
+// LocalAPIStatus returns the status of game with the counts of the library only, for
+// the games whose API could not be checked
+func LocalAPIStatus(db *sql.DB, game string) (APIStatus, error) {
+	s := APIStatus{Game: game}
+	var newest sql.NullString
+	err := db.QueryRow(`SELECT COUNT(*), MAX(datetime(i.published_at)) FROM items i JOIN games g ON g.id = i.game_id
+		WHERE g.name = ?`, game).Scan(&s.Local, &newest)
+	if err != nil {
+		return s, fmt.Errorf("failed to count items of %s: %w", game, err)
+	}
+	if newest.Valid {
+		if t, err := time.Parse(time.DateTime, newest.String); err == nil {
+			s.LocalNew = &t
+		}
+	}
+	return s, nil
+}
+
+// localImages returns the images of game listed by the API of region and downloaded
+// into the library, by item ID and variant kind
+func localImages(db *sql.DB, game, region string) (map[[2]string]bool, error) {
+	rows, err := db.Query(`SELECT i.id_gallery, f.type FROM files f JOIN items i ON i.id = f.item_id
+		JOIN games g ON g.id = i.game_id WHERE g.name = ? AND i.region = ? AND f.cataloged = 0`, game, regionOrGlobal(region))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list items of %s: %w", game, err)
+	}
+	defer rows.Close()
+	images := make(map[[2]string]bool)
+	for rows.Next() {
+		var id, kind string
+		if err := rows.Scan(&id, &kind); err != nil {
+			return nil, err
+		}
+		images[[2]string{id, kind}] = true
+	}
+	return images, rows.Err()
+}
+
+// WriteAPIStatus writes s as a line of JSON, the output of the crawlers run with --status
+func WriteAPIStatus(w io.Writer, s APIStatus) error {
+	return json.NewEncoder(w).Encode(s)
+}
@@ -0,0 +1,39 @@
+package crawal
+
+import "testing"
+
+// TestCheckAPIMissing checks that the images only cataloged, or downloaded from the
+// API of another region, count as missing
+func TestCheckAPIMissing(t *testing.T) {
+	db := newPageTestDB(t, 0)
+	for _, item := range []GalleryItem{
+		{Game: "arknights", IdGallery: "1", Type: "wallpaper", FileName: "1", URL: "https://cdn.example/1.png"},
+		{Game: "arknights", Region: RegionJP, IdGallery: "1", Type: "mobile", FileName: "1 jp", URL: "https://cdn.example/jp/1.png"},
+		{Game: "arknights", IdGallery: "2", Type: "wallpaper", FileName: "2", URL: "https://cdn.example/2.png", Cataloged: true},
+	} {
+		if err := SaveGalleryItem(db, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	listed := []Item{
+		{Game: "arknights", ID: "1", Variants: []Variant{{Kind: "wallpaper", URL: "https://cdn.example/1.png"}, {Kind: "mobile", URL: "https://cdn.example/1m.png"}}},
+		{Game: "arknights", ID: "2", Variants: []Variant{{Kind: "wallpaper", URL: "https://cdn.example/2.png"}}},
+	}
+	s, err := CheckAPI(db, "arknights", "", func() ([]Item, error) { return listed, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the mobile image of 1, downloaded from the JP API only, and the cataloged 2
+	if s.Missing != 2 {
+		t.Errorf("global: %d missing, want 2", s.Missing)
+	}
+
+	s, err = CheckAPI(db, "arknights", RegionJP, func() ([]Item, error) { return listed, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Missing != 2 {
+		t.Errorf("jp: %d missing, want 2", s.Missing)
+	}
+}
@@ -0,0 +1,84 @@
+package crawal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Artist is an artist credited for gallery entries
+type Artist struct {
+	ID    int64
+	Name  string
+	Items int // number of gallery entries credited to the artist
+}
+
+// ListArtists returns every artist with the number of entries credited to them, by name
+func ListArtists(db *sql.DB) ([]Artist, error) {
+	rows, err := db.Query(`
+		SELECT a.id, a.name, COUNT(i.id)
+		FROM artists a LEFT JOIN items i ON i.artist_id = a.id
+		GROUP BY a.id ORDER BY a.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var artists []Artist
+	for rows.Next() {
+		var a Artist
+		if err := rows.Scan(&a.ID, &a.Name, &a.Items); err != nil {
+			return nil, err
+		}
+		artists = append(artists, a)
+	}
+	return artists, rows.Err()
+}
+
+// RenameArtist renames an artist for all of their entries. When an artist named
+// newName already exists, the two are merged.
+func RenameArtist(db *sql.DB, oldName, newName string) error {
+	if newName == "" {
+		return errors.New("new name is empty")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRow("SELECT id FROM artists WHERE name = ?", oldName).Scan(&id)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("no artist named %q", oldName)
+	}
+	if err != nil {
+		return err
+	}
+
+	var target int64
+	err = tx.QueryRow("SELECT id FROM artists WHERE name = ?", newName).Scan(&target)
+	switch {
+	case err == sql.ErrNoRows:
+		_, err = tx.Exec("UPDATE artists SET name = ? WHERE id = ?", newName, id)
+	case err == nil && target != id:
+		if _, err = tx.Exec("UPDATE items SET artist_id = ? WHERE artist_id = ?", target, id); err == nil {
+			_, err = tx.Exec("DELETE FROM artists WHERE id = ?", id)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to rename artist: %w", err)
+	}
+	return tx.Commit()
+}
+
+// GetArtist returns the artist with this name, with the number of entries credited to them
+func GetArtist(db *sql.DB, name string) (Artist, error) {
+	var a Artist
+	err := db.QueryRow(`
+		SELECT a.id, a.name, COUNT(i.id)
+		FROM artists a LEFT JOIN items i ON i.artist_id = a.id
+		WHERE a.name = ? GROUP BY a.id`, name).Scan(&a.ID, &a.Name, &a.Items)
+	return a, err
+}
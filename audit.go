@@ -0,0 +1,110 @@
+package crawal
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// AuditEntry is an action taken on the library through the web UI or its API
+type AuditEntry struct {
+	ID     int64     `json:"id"`
+	At     time.Time `json:"at"`
+	Source string    `json:"source"`           // address of the client
+	Action string    `json:"action"`           // e.g. download or queue.remove
+	Target string    `json:"target,omitempty"` // what it was taken on, e.g. azurlane/1024/wallpaper
+	Error  string    `json:"error,omitempty"`  // empty when it succeeded
+}
+
+// AuditFilter selects entries of the audit trail. Zero fields match everything.
+type AuditFilter struct {
+	Since  time.Time
+	Source string
+	Action string // exactly, or the actions starting with it and a dot, e.g. queue
+	Limit  int    // newest entries returned, all when 0
+}
+
+// RecordAudit appends an action to the audit trail, timestamped now
+func RecordAudit(db *sql.DB, e AuditEntry) error {
+	_, err := db.Exec("INSERT INTO audit_log(source, action, target, error) VALUES (?, ?, ?, ?)", e.Source, e.Action, e.Target, e.Error)
+	return err
+}
+
+// ListAudit returns the entries of the audit trail matching the filter, newest first
+func ListAudit(db *sql.DB, f AuditFilter) ([]AuditEntry, error) {
+	conds := []string{"1 = 1"}
+	var args []any
+	if !f.Since.IsZero() {
+		conds = append(conds, "at >= ?")
+		args = append(args, f.Since.UTC().Format(sqliteTimeFormat))
+	}
+	if f.Source != "" {
+		conds = append(conds, "source = ?")
+		args = append(args, f.Source)
+	}
+	if f.Action != "" {
+		conds = append(conds, "(action = ? OR action LIKE ? ESCAPE '\\')")
+		args = append(args, f.Action, escapeLike(f.Action)+".%")
+	}
+	query := "SELECT id, at, source, action, target, error FROM audit_log WHERE " + strings.Join(conds, " AND ") + " ORDER BY id DESC"
+	if f.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, f.Limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.ID, &e.At, &e.Source, &e.Action, &e.Target, &e.Error); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Download is a wallpaper of the download history
+type Download struct {
+	At   time.Time
+	Item GalleryItem
+}
+
+// DownloadHistory returns the wallpapers downloaded since the given time, all when
+// zero, newest first and up to limit of them unless 0. Cataloged and adopted
+// wallpapers were not downloaded.
+func DownloadHistory(db *sql.DB, since time.Time, limit int) ([]Download, error) {
+	query := `SELECT ` + galleryColumns + `, downloaded_at FROM gallery
+		JOIN (SELECT id AS file_id, downloaded_at FROM files WHERE downloaded_at IS NOT NULL) d ON d.file_id = gallery.id`
+	var args []any
+	if !since.IsZero() {
+		query += " WHERE downloaded_at >= ?"
+		args = append(args, since.UTC().Format(sqliteTimeFormat))
+	}
+	query += " ORDER BY downloaded_at DESC, id DESC"
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []Download
+	for rows.Next() {
+		var d Download
+		if d.Item, err = scanGalleryItem(extraScanner{rows, []any{&d.At}}); err != nil {
+			return nil, err
+		}
+		history = append(history, d)
+	}
+	return history, rows.Err()
+}
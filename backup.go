@@ -0,0 +1,286 @@
+package crawal
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Names of the files inside a backup archive
+const (
+	backupManifestFile = "manifest.json"
+	backupDatabaseFile = "yostar-gallery.db"
+	backupThumbnailDir = "thumbnails"
+)
+
+// BackupManifest describes the content of a backup archive
+type BackupManifest struct {
+	CreatedAt     time.Time `json:"created_at"`
+	SchemaVersion int       `json:"schema_version"`
+	Wallpapers    int       `json:"wallpapers"`
+	Files         []string  `json:"files"`
+}
+
+// CreateBackup writes a gzipped tar archive at out holding a snapshot of the database
+// and a manifest, plus the thumbnails of the library with thumbnails
+func CreateBackup(db *sql.DB, out string, thumbnails bool) (BackupManifest, error) {
+	manifest := BackupManifest{CreatedAt: time.Now(), Files: []string{}}
+	if err := db.QueryRow("PRAGMA user_version").Scan(&manifest.SchemaVersion); err != nil {
+		return manifest, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM gallery").Scan(&manifest.Wallpapers); err != nil {
+		return manifest, fmt.Errorf("failed to count wallpapers: %w", err)
+	}
+
+	// VACUUM INTO writes a consistent copy even while crawlers are running
+	snapshot, err := os.CreateTemp("", "yostar-backup-*.db")
+	if err != nil {
+		return manifest, fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	snapshot.Close()
+	os.Remove(snapshot.Name())
+	defer os.Remove(snapshot.Name())
+	if _, err = db.Exec("VACUUM INTO ?", snapshot.Name()); err != nil {
+		return manifest, fmt.Errorf("failed to snapshot database: %w", err)
+	}
+
+	file, err := os.Create(out)
+	if err != nil {
+		return manifest, fmt.Errorf("failed to create backup: %w", err)
+	}
+	defer file.Close()
+	gz := gzip.NewWriter(file)
+	w := &tarBundle{tar.NewWriter(gz)}
+
+	if _, err = addBundleFile(w, backupDatabaseFile, snapshot.Name()); err != nil {
+		return manifest, err
+	}
+	manifest.Files = append(manifest.Files, backupDatabaseFile)
+
+	if thumbnails {
+		items, err := FindGalleryItems(db, Filter{})
+		if err != nil {
+			return manifest, fmt.Errorf("failed to query wallpapers: %w", err)
+		}
+		for _, item := range items {
+			if item.Path == "" {
+				continue
+			}
+			// thumbnails are keyed by wallpaper so they can be placed next to the file on restore
+			name := path.Join(backupThumbnailDir, fmt.Sprintf("%d.jpg", item.ID))
+			added, err := addBundleFile(w, name, ThumbnailPath(item.Path))
+			if err != nil {
+				return manifest, err
+			}
+			if added {
+				manifest.Files = append(manifest.Files, name)
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err = w.add(backupManifestFile, int64(len(data)), time.Now(), bytes.NewReader(data)); err != nil {
+		return manifest, fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	if err = w.Close(); err != nil {
+		return manifest, fmt.Errorf("failed to finish backup: %w", err)
+	}
+	if err = gz.Close(); err != nil {
+		return manifest, fmt.Errorf("failed to finish backup: %w", err)
+	}
+	return manifest, nil
+}
+
+// RestoreOptions controls how a backup is restored
+type RestoreOptions struct {
+	Force    bool // replace a library that already has wallpapers
+	Download bool // download the originals missing from disk again
+}
+
+// RestoreResult summarizes a restored backup
+type RestoreResult struct {
+	Manifest   BackupManifest
+	Thumbnails int // thumbnails written next to their wallpaper
+	Downloaded int // originals downloaded again
+	Missing    int // originals missing from disk that were not downloaded
+}
+
+// RestoreBackup replaces the database with the one of a backup archive created by
+// CreateBackup and puts its thumbnails back in place. The replaced database is kept
+// as yostar-gallery.db.bak. The database is restored in place, so db stays usable.
+func RestoreBackup(db *sql.DB, archive string, opts RestoreOptions) (RestoreResult, error) {
+	var res RestoreResult
+
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM gallery").Scan(&n); err != nil {
+		return res, fmt.Errorf("failed to count wallpapers: %w", err)
+	}
+	if n > 0 && !opts.Force {
+		return res, fmt.Errorf("library already has %d wallpapers, restore with force to replace it", n)
+	}
+
+	file, err := os.Open(archive)
+	if err != nil {
+		return res, fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return res, fmt.Errorf("failed to read backup: %w", err)
+	}
+
+	// Extract everything before touching the library, so a broken archive changes nothing
+	tmp, err := os.MkdirTemp("", "yostar-restore-*")
+	if err != nil {
+		return res, fmt.Errorf("failed to create temporary folder: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	var hasManifest, hasDatabase bool
+	thumbnails := make(map[int64]string)
+	r := tar.NewReader(gz)
+	for {
+		hdr, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return res, fmt.Errorf("failed to read backup: %w", err)
+		}
+
+		switch name := path.Clean(hdr.Name); {
+		case name == backupManifestFile:
+			if err := json.NewDecoder(r).Decode(&res.Manifest); err != nil {
+				return res, fmt.Errorf("failed to decode manifest: %w", err)
+			}
+			hasManifest = true
+		case name == backupDatabaseFile:
+			if err := writeFile(filepath.Join(tmp, backupDatabaseFile), r); err != nil {
+				return res, err
+			}
+			hasDatabase = true
+		case path.Dir(name) == backupThumbnailDir:
+			id, err := strconv.ParseInt(strings.TrimSuffix(path.Base(name), ".jpg"), 10, 64)
+			if err != nil {
+				continue
+			}
+			p := filepath.Join(tmp, fmt.Sprintf("%d.jpg", id))
+			if err := writeFile(p, r); err != nil {
+				return res, err
+			}
+			thumbnails[id] = p
+		}
+	}
+	if !hasManifest || !hasDatabase {
+		return res, errors.New("not a backup archive: missing manifest or database")
+	}
+
+	// Keep the replaced database, then copy the restored one over it and bring its
+	// schema up to date
+	if p, err := databaseFile(db); err == nil && p != "" {
+		os.Remove(p + ".bak")
+		if _, err := db.Exec("VACUUM INTO ?", p+".bak"); err != nil {
+			return res, fmt.Errorf("failed to keep the replaced database: %w", err)
+		}
+	}
+	if err = restoreDatabase(db, filepath.Join(tmp, backupDatabaseFile)); err != nil {
+		return res, fmt.Errorf("failed to restore database: %w", err)
+	}
+	if err = migrate(db); err != nil {
+		return res, fmt.Errorf("failed to migrate database: %w", err)
+	}
+	if err = setupSearch(db); err != nil {
+		return res, err
+	}
+	if err = loadLibraryRoot(db); err != nil {
+		return res, err
+	}
+
+	items, err := FindGalleryItems(db, Filter{})
+	if err != nil {
+		return res, fmt.Errorf("failed to query wallpapers: %w", err)
+	}
+	for _, item := range items {
+		if item.Path == "" {
+			continue
+		}
+
+		if _, err := os.Stat(item.Path); os.IsNotExist(err) {
+			if !opts.Download || item.URL == "" {
+				res.Missing++
+			} else if err := redownloadGalleryItem(db, &item); err != nil {
+				res.Missing++
+			} else {
+				res.Downloaded++
+			}
+		}
+
+		if src, ok := thumbnails[item.ID]; ok {
+			dst := ThumbnailPath(item.Path)
+			if err := makeDirs(filepath.Dir(dst)); err != nil {
+				return res, fmt.Errorf("failed to create thumbnail folder: %w", err)
+			}
+			if err := copyFile(src, dst); err != nil {
+				return res, err
+			}
+			res.Thumbnails++
+		}
+	}
+
+	return res, nil
+}
+
+// redownloadGalleryItem downloads the file of a wallpaper again to the path it was
+// stored at, recording its new checksum
+func redownloadGalleryItem(db *sql.DB, item *GalleryItem) error {
+	dir := filepath.Dir(item.Path)
+	if err := makeDirs(dir); err != nil {
+		return fmt.Errorf("failed to create folder: %w", err)
+	}
+	name := strings.TrimSuffix(filepath.Base(item.Path), filepath.Ext(item.Path))
+	p, err := DownloadFile(item.URL, name, dir)
+	if err != nil {
+		return err
+	}
+	sum, size, err := HashFile(p)
+	if err != nil {
+		return err
+	}
+	return linkGalleryItem(db, item, p, sum, size)
+}
+
+// writeFile writes the content of r to a new file at p
+func writeFile(p string, r io.Reader) error {
+	f, err := createFile(p)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", p, err)
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", p, err)
+	}
+	return f.Close()
+}
+
+// databaseFile returns the path of the main database file of db
+func databaseFile(db *sql.DB) (string, error) {
+	var seq int
+	var name, file string
+	err := db.QueryRow("PRAGMA database_list").Scan(&seq, &name, &file)
+	return file, err
+}
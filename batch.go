@@ -0,0 +1,121 @@
+package crawal
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Defaults of the batches the download queue records finished downloads in
+const (
+	defaultBatchSize     = 50
+	defaultBatchInterval = 2 * time.Second
+)
+
+// finished is a download waiting in a batch to be recorded
+type finished struct {
+	job  Job
+	item GalleryItem
+}
+
+// batch records the downloads of a queue in transactions of up to size of them, at
+// least every interval, since committing each image makes sqlite sync the disk for
+// each. Jobs stay running until their batch is committed, so the downloads lost in a
+// crash are queued again once staleJobTimeout has passed.
+type batch struct {
+	db    *sql.DB
+	size  int
+	saved func([]finished) // called with the downloads of each committed batch
+
+	mu      sync.Mutex
+	pending []finished
+}
+
+// add buffers a finished download, committing the batch once it is full
+func (b *batch) add(job Job, item GalleryItem) error {
+	if err := prepareGalleryItem(&item); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.pending = append(b.pending, finished{job: job, item: item})
+	full := len(b.pending) >= b.size
+	b.mu.Unlock()
+	if full {
+		b.flush()
+	}
+	return nil
+}
+
+// has reports whether a download waiting in the batch has the given checksum
+func (b *batch) has(sum string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, f := range b.pending {
+		if f.item.SHA256 == sum {
+			return true
+		}
+	}
+	return false
+}
+
+// flush commits the downloads waiting in the batch
+func (b *batch) flush() {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+
+	saved, err := b.commit(pending)
+	if err != nil {
+		logger.Printf("Error recording %d downloads, they are downloaded again by a later run: %v", len(pending), err)
+		return
+	}
+	if b.saved != nil && len(saved) > 0 {
+		b.saved(saved)
+	}
+}
+
+// commit records the downloads and marks their jobs done in a single transaction.
+// A download that cannot be recorded fails its job without failing the others.
+func (b *batch) commit(pending []finished) ([]finished, error) {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	saved := make([]finished, 0, len(pending))
+	for _, f := range pending {
+		state, msg := JobDone, ""
+		if _, err := tx.Exec("SAVEPOINT download"); err != nil {
+			return nil, err
+		}
+		if err := saveGalleryItem(tx, f.item); err != nil {
+			if _, err := tx.Exec("ROLLBACK TO download"); err != nil {
+				return nil, err
+			}
+			logger.Printf("Error saving %s: %v", f.job.FileName, err)
+			state, msg = JobFailed, fmt.Sprintf("failed to save: %v", err)
+		} else {
+			saved = append(saved, f)
+		}
+		if _, err := tx.Exec("RELEASE download"); err != nil {
+			return nil, err
+		}
+
+		_, err := tx.Exec("UPDATE download_jobs SET state = ?, error = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", state, msg, f.job.ID)
+		if err != nil {
+			return nil, err
+		}
+		if state == JobDone {
+			if _, err := tx.Exec("DELETE FROM dead_links WHERE url = ?", f.job.URL); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return saved, tx.Commit()
+}
@@ -0,0 +1,176 @@
+package crawal
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// Bundle formats supported by CreateBundle
+const (
+	BundleZip = "zip"
+	BundleTar = "tar"
+)
+
+// bundleMetadataFile is the name of the metadata file inside a bundle
+const bundleMetadataFile = "metadata.json"
+
+// BundleEntry describes a wallpaper in the metadata of a bundle
+type BundleEntry struct {
+	Game      string    `json:"game"`
+	IdGallery string    `json:"id_gallery"`
+	Type      string    `json:"type"`
+	FileName  string    `json:"file_name"`
+	URL       string    `json:"url"`
+	File      string    `json:"file"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BundleResult summarizes a created bundle
+type BundleResult struct {
+	Entries []BundleEntry
+	Skipped int // matching wallpapers whose file is not on disk
+	Size    int64
+}
+
+// bundleWriter adds files to an archive
+type bundleWriter interface {
+	add(name string, size int64, modTime time.Time, r io.Reader) error
+	Close() error
+}
+
+// CreateBundle packages the wallpapers matching the filter into a zip or tar archive
+// at out, with their files stored as <game>/<type>/<file> and a metadata.json describing them
+func CreateBundle(db *sql.DB, f Filter, out, format string) (BundleResult, error) {
+	items, err := FindGalleryItems(db, f)
+	if err != nil {
+		return BundleResult{}, fmt.Errorf("failed to query wallpapers: %w", err)
+	}
+
+	file, err := os.Create(out)
+	if err != nil {
+		return BundleResult{}, fmt.Errorf("failed to create bundle: %w", err)
+	}
+	defer file.Close()
+
+	var w bundleWriter
+	switch format {
+	case BundleZip:
+		w = &zipBundle{zip.NewWriter(file)}
+	case BundleTar:
+		w = &tarBundle{tar.NewWriter(file)}
+	default:
+		return BundleResult{}, fmt.Errorf("unknown bundle format %q", format)
+	}
+
+	res := BundleResult{Entries: make([]BundleEntry, 0, len(items))}
+	for _, item := range items {
+		entry := BundleEntry{
+			Game:      item.Game,
+			IdGallery: item.IdGallery,
+			Type:      item.Type,
+			FileName:  item.FileName,
+			URL:       item.URL,
+			File:      path.Join(item.Game, item.Type, filepath.Base(item.Path)),
+			CreatedAt: item.CreatedAt,
+		}
+
+		if item.Path == "" {
+			res.Skipped++
+			continue
+		}
+		added, err := addBundleFile(w, entry.File, item.Path)
+		if err != nil {
+			return BundleResult{}, err
+		}
+		if !added {
+			res.Skipped++
+			continue
+		}
+		res.Entries = append(res.Entries, entry)
+	}
+
+	metadata, err := json.MarshalIndent(res.Entries, "", "  ")
+	if err != nil {
+		return BundleResult{}, fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	if err = w.add(bundleMetadataFile, int64(len(metadata)), time.Now(), bytes.NewReader(metadata)); err != nil {
+		return BundleResult{}, fmt.Errorf("failed to write metadata: %w", err)
+	}
+
+	if err = w.Close(); err != nil {
+		return BundleResult{}, fmt.Errorf("failed to finish bundle: %w", err)
+	}
+	if info, err := file.Stat(); err == nil {
+		res.Size = info.Size()
+	}
+
+	return res, nil
+}
+
+// addBundleFile copies the file at src into the bundle, reporting false if it no longer exists
+func addBundleFile(w bundleWriter, name, src string) (bool, error) {
+	f, err := os.Open(src)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return false, fmt.Errorf("failed to stat %s: %w", src, err)
+	}
+	if err = w.add(name, info.Size(), info.ModTime(), f); err != nil {
+		return false, fmt.Errorf("failed to add %s: %w", src, err)
+	}
+	return true, nil
+}
+
+// zipBundle writes bundles as zip archives. Images are already compressed,
+// so files are stored rather than deflated.
+type zipBundle struct {
+	*zip.Writer
+}
+
+func (b *zipBundle) add(name string, size int64, modTime time.Time, r io.Reader) error {
+	w, err := b.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Store,
+		Modified: modTime,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// tarBundle writes bundles as tar archives
+type tarBundle struct {
+	*tar.Writer
+}
+
+func (b *tarBundle) add(name string, size int64, modTime time.Time, r io.Reader) error {
+	err := b.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: modTime,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(b.Writer, r)
+	return err
+}
@@ -0,0 +1,29 @@
+package crawal
+
+import (
+	"errors"
+)
+
+// URLCandidates returns the alternate URLs a game CDN may serve an image at, such
+// as higher resolution files at predictable paths, best first
+type URLCandidates func(url string) []string
+
+// downloadCandidates downloads the first of candidates the server has, falling back
+// to url. It returns the path of the file, the candidate it came from, empty when it
+// came from url, and the normalized URL it was served from once redirected.
+func downloadCandidates(candidates []string, url, fileName, dir string, progress progressFunc) (string, string, string, error) {
+	for _, candidate := range candidates {
+		p, resolved, err := downloadResolved(candidate, fileName, dir, progress)
+		if err == nil {
+			logger.Printf(`-> "%s" resolved at %s <-`, fileName, candidate)
+			return p, candidate, resolved, nil
+		}
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) {
+			return "", "", "", err
+		}
+	}
+
+	p, resolved, err := downloadResolved(url, fileName, dir, progress)
+	return p, "", resolved, err
+}
@@ -0,0 +1,54 @@
+package crawal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+// CatalogGalleryItem records a wallpaper listed by the API without downloading its file.
+// Wallpapers already downloaded are left untouched, and it reports whether the item was saved.
+func CatalogGalleryItem(db *sql.DB, item GalleryItem) (bool, error) {
+	existing, err := GetGalleryItem(db, item.Game, item.Region, item.IdGallery, item.Type)
+	if err != nil && err != sql.ErrNoRows {
+		return false, fmt.Errorf("failed to look up wallpaper: %w", err)
+	}
+	if err == nil && !existing.Cataloged {
+		return false, nil
+	}
+
+	item.Path = ""
+	item.Cataloged = true
+	return true, SaveGalleryItem(db, item)
+}
+
+// DownloadGalleryItem downloads the file of a cataloged wallpaper into dir/<game>/<type>,
+// checks it for duplicates according to mode and records it as downloaded
+func DownloadGalleryItem(db *sql.DB, item *GalleryItem, dir, mode string) (*Duplicate, error) {
+	if item.URL == "" {
+		return nil, errors.New("wallpaper has no URL to download")
+	}
+
+	dir = filepath.Join(dir, item.Game, item.Type)
+	if err := makeDirs(dir); err != nil {
+		return nil, fmt.Errorf("failed to create folder: %w", err)
+	}
+	name, err := uniqueFileName(db, *item, dir, nil)
+	if err != nil {
+		return nil, err
+	}
+	p, err := DownloadFile(item.URL, name, dir)
+	if err != nil {
+		return nil, err
+	}
+	item.Path = p
+	item.Cataloged = false
+
+	// the file is recorded even when the duplicate check fails
+	dup, dupErr := DedupeItem(db, item, mode)
+	if err := SaveGalleryItem(db, *item); err != nil {
+		return dup, err
+	}
+	return dup, dupErr
+}
@@ -0,0 +1,175 @@
+package crawal
+
+import (
+	"database/sql"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Manifest formats written by WriteChecksums
+const (
+	ChecksumsSHA256 = "sha256" // SHA256SUMS, checked with sha256sum -c SHA256SUMS
+	ChecksumsSFV    = "sfv"    // <game>.sfv of CRC32 checksums, checked with cksfv or most SFV tools
+)
+
+// ChecksumManifest is a manifest written by WriteChecksums
+type ChecksumManifest struct {
+	Game    string
+	Path    string
+	Files   int
+	Skipped int // files of the game not on disk or outside its folder
+}
+
+// WriteChecksums writes a manifest of the downloaded files matching the filter into the
+// folder of each game, the folder all its files are in, listing them relative to it.
+// SHA256SUMS are written from the checksums of the library, SFV files from the files.
+func WriteChecksums(db *sql.DB, f Filter, format string) ([]ChecksumManifest, error) {
+	if format != ChecksumsSHA256 && format != ChecksumsSFV {
+		return nil, fmt.Errorf("unknown checksums format %q", format)
+	}
+	items, err := FindGalleryItems(db, f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query wallpapers: %w", err)
+	}
+
+	games := make(map[string][]GalleryItem)
+	for _, item := range items {
+		if item.Path != "" {
+			games[item.Game] = append(games[item.Game], item)
+		}
+	}
+	names := make([]string, 0, len(games))
+	for game := range games {
+		names = append(names, game)
+	}
+	sort.Strings(names)
+
+	manifests := make([]ChecksumManifest, 0, len(names))
+	for _, game := range names {
+		m, err := writeGameChecksums(game, games[game], format)
+		if err != nil {
+			return manifests, err
+		}
+		manifests = append(manifests, m)
+	}
+	return manifests, nil
+}
+
+// writeGameChecksums writes the manifest of the files of a game
+func writeGameChecksums(game string, items []GalleryItem, format string) (ChecksumManifest, error) {
+	// Duplicates skipped with --dedupe=skip point to a file of another game, so they
+	// don't widen the folder of the game
+	var dir string
+	for _, item := range items {
+		if item.DuplicateOf == 0 {
+			dir = commonDir(dir, filepath.Dir(item.Path))
+		}
+	}
+	if dir == "" {
+		dir = filepath.Dir(items[0].Path)
+	}
+
+	m := ChecksumManifest{Game: game, Path: filepath.Join(dir, "SHA256SUMS")}
+	if format == ChecksumsSFV {
+		m.Path = filepath.Join(dir, game+".sfv")
+	}
+
+	lines := make(map[string]string) // by relative path
+	for _, item := range items {
+		rel, err := filepath.Rel(dir, item.Path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			m.Skipped++
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		if _, ok := lines[rel]; ok {
+			continue
+		}
+
+		var line string
+		switch format {
+		case ChecksumsSHA256:
+			sum := item.SHA256
+			if _, err := os.Stat(item.Path); err != nil {
+				m.Skipped++
+				continue
+			}
+			if sum == "" {
+				if sum, _, err = HashFile(item.Path); err != nil {
+					return m, err
+				}
+			}
+			line = sum + "  " + rel
+		case ChecksumsSFV:
+			crc, err := crc32File(item.Path)
+			if os.IsNotExist(err) {
+				m.Skipped++
+				continue
+			} else if err != nil {
+				return m, err
+			}
+			line = fmt.Sprintf("%s %08X", rel, crc)
+		}
+		lines[rel] = line
+		m.Files++
+	}
+
+	files := make([]string, 0, len(lines))
+	for rel := range lines {
+		files = append(files, rel)
+	}
+	sort.Strings(files)
+
+	var content strings.Builder
+	if format == ChecksumsSFV {
+		fmt.Fprintf(&content, "; %s wallpapers, generated by yostar-wallpaper\n", game)
+	}
+	for _, rel := range files {
+		content.WriteString(lines[rel] + "\n")
+	}
+	if err := os.WriteFile(m.Path, []byte(content.String()), 0644); err != nil {
+		return m, fmt.Errorf("failed to write %s: %w", m.Path, err)
+	}
+	if err := ownFile(m.Path); err != nil {
+		return m, fmt.Errorf("failed to write %s: %w", m.Path, err)
+	}
+	return m, nil
+}
+
+// commonDir returns the deepest folder containing both a and b, b when a is empty
+func commonDir(a, b string) string {
+	if a == "" {
+		return b
+	}
+	for {
+		rel, err := filepath.Rel(a, b)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return a
+		}
+		parent := filepath.Dir(a)
+		if parent == a {
+			return a
+		}
+		a = parent
+	}
+}
+
+// crc32File returns the CRC32 (IEEE) checksum of a file, as listed in SFV files
+func crc32File(p string) (uint32, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, f); err != nil {
+		return 0, fmt.Errorf("failed to hash %s: %w", p, err)
+	}
+	return h.Sum32(), nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// adoptFlags are the flags of adopt
+type adoptFlags struct {
+	game   string
+	dedupe string
+}
+
+// register adds the flags of adopt to the flag set
+func (o *adoptFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.game, "game", ys.ManualGame, "Game recorded for files that match no known wallpaper.")
+	fs.StringVar(&o.dedupe, "dedupe", ys.DedupeLink, "What to do with copies of library files (off, link, skip).")
+}
+
+// runAdopt registers an existing folder of wallpapers with the library
+func runAdopt(db *sql.DB, args []string) error {
+	var o adoptFlags
+	fs := newFlagSet("adopt", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return errors.New("usage: yostar-wallpaper adopt [--game=name] [--dedupe=mode] <dir>")
+	}
+
+	res, err := ys.AdoptFolder(db, fs.Arg(0), o.game, o.dedupe)
+	fmt.Printf("Matched %d, added %d manual entries, %d already in library\n", res.Matched, res.Added, res.Known)
+	if res.Duplicates > 0 || res.Similar > 0 {
+		fmt.Printf("Found %d duplicates of library files (%d bytes saved) and %d similar images\n", res.Duplicates, res.Saved, res.Similar)
+	}
+	return err
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// analyzeFlags are the flags of analyze
+type analyzeFlags struct {
+	filterFlags
+	force bool
+}
+
+// register adds the flags of analyze to the flag set
+func (o *analyzeFlags) register(fs *flag.FlagSet) {
+	o.filterFlags.register(fs)
+	fs.BoolVar(&o.force, "force", false, "Analyze wallpapers again even if already analyzed.")
+}
+
+// runAnalyze computes the image analysis of wallpapers downloaded before it existed
+func runAnalyze(db *sql.DB, args []string) error {
+	var o analyzeFlags
+	fs := newFlagSet("analyze", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	filter, err := o.filter()
+	if err != nil {
+		return err
+	}
+
+	n, err := ys.AnalyzeGalleryItems(db, filter, o.force)
+	fmt.Printf("Analyzed %d wallpapers\n", n)
+	return err
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// artistsFlags are the flags of artists
+type artistsFlags struct {
+	rename string
+	to     string
+}
+
+// register adds the flags of artists to the flag set
+func (o *artistsFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.rename, "rename", "", "Name of the artist to rename.")
+	fs.StringVar(&o.to, "to", "", "New name of the artist given with --rename; an existing artist is merged into.")
+}
+
+// runArtists lists the artists of the library, or renames one of them
+func runArtists(db *sql.DB, args []string) error {
+	var o artistsFlags
+	fs := newFlagSet("artists", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if o.rename != "" {
+		if err := ys.RenameArtist(db, o.rename, o.to); err != nil {
+			return err
+		}
+		fmt.Printf("Renamed %s to %s\n", o.rename, o.to)
+		return nil
+	}
+
+	artists, err := ys.ListArtists(db)
+	if err != nil {
+		return fmt.Errorf("failed to list artists: %w", err)
+	}
+	for _, a := range artists {
+		fmt.Printf("%5d  %s\n", a.Items, a.Name)
+	}
+	return nil
+}
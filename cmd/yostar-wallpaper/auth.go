@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// tokenCookie is the cookie the browser keeps the token of --token in, once the
+// gallery was opened with it as the token parameter
+const tokenCookie = "yostar_token"
+
+// loopbackAddr reports whether addr, as given to --addr, only listens on this machine
+func loopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// rememberToken keeps the token given as the token parameter of a page in a cookie,
+// so that the forms of the web UI carry it, then serves next
+func (s *server) rememberToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := r.URL.Query().Get("token"); s.token != "" && token != "" && s.validToken(token) {
+			http.SetCookie(w, &http.Cookie{Name: tokenCookie, Value: token, Path: "/", HttpOnly: true, SameSite: http.SameSiteStrictMode})
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// protect refuses the requests changing the library that another site made the
+// browser send, and those without the token of --token when it is set. Requests
+// only reading, with GET or HEAD, are served as they are.
+func (s *server) protect(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next(w, r)
+			return
+		}
+		if crossOrigin(r) {
+			http.Error(w, "cross-origin request refused", http.StatusForbidden)
+			return
+		}
+		if s.token != "" && !s.validToken(requestToken(r)) {
+			http.Error(w, "missing or invalid token, open the gallery once with ?token=<token>", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// validToken reports whether token is the one of --token
+func (s *server) validToken(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// requestToken returns the token of a request, sent as a bearer token by scripts or
+// kept in a cookie by the browser
+func requestToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return token
+	}
+	if c, err := r.Cookie(tokenCookie); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+// crossOrigin reports whether a browser sent the request from a page of another
+// site, as told by Sec-Fetch-Site or, for older browsers, by Origin. Clients other
+// than browsers send neither.
+func crossOrigin(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site != "same-origin" && site != "none"
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	u, err := url.Parse(origin)
+	return err != nil || u.Host != r.Host
+}
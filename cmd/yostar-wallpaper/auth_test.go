@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLoopbackAddr(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"127.0.0.1:8080":   true,
+		"localhost:8080":   true,
+		"[::1]:8080":       true,
+		":8080":            false,
+		"0.0.0.0:8080":     false,
+		"192.168.1.2:8080": false,
+		"nas:8080":         false,
+	} {
+		if got := loopbackAddr(addr); got != want {
+			t.Errorf("loopbackAddr(%q) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestProtect(t *testing.T) {
+	s := &server{token: "s3cret"}
+	handler := s.rememberToken(s.protect(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, test := range []struct {
+		name    string
+		method  string
+		target  string
+		headers map[string]string
+		want    int
+	}{
+		{"read without token", http.MethodGet, "/queue", nil, http.StatusOK},
+		{"without token", http.MethodPost, "/queue", nil, http.StatusUnauthorized},
+		{"wrong token", http.MethodPost, "/queue", map[string]string{"Authorization": "Bearer guess"}, http.StatusUnauthorized},
+		{"bearer token", http.MethodPost, "/queue", map[string]string{"Authorization": "Bearer s3cret"}, http.StatusOK},
+		{"cookie", http.MethodPost, "/queue", map[string]string{"Cookie": tokenCookie + "=s3cret"}, http.StatusOK},
+		{"same origin", http.MethodPost, "/queue", map[string]string{"Cookie": tokenCookie + "=s3cret", "Origin": "http://nas:8080", "Sec-Fetch-Site": "same-origin"}, http.StatusOK},
+		{"cross site", http.MethodPost, "/queue", map[string]string{"Cookie": tokenCookie + "=s3cret", "Sec-Fetch-Site": "cross-site"}, http.StatusForbidden},
+		{"other origin", http.MethodPost, "/queue", map[string]string{"Authorization": "Bearer s3cret", "Origin": "http://evil.example"}, http.StatusForbidden},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, "http://nas:8080"+test.target, nil)
+			for k, v := range test.headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != test.want {
+				t.Errorf("status %d, want %d", w.Code, test.want)
+			}
+		})
+	}
+}
+
+func TestRememberToken(t *testing.T) {
+	s := &server{token: "s3cret"}
+	handler := s.rememberToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for target, want := range map[string]bool{"/?token=s3cret": true, "/?token=guess": false, "/": false} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		cookies := w.Result().Cookies()
+		if got := len(cookies) == 1 && cookies[0].Name == tokenCookie && cookies[0].HttpOnly; got != want {
+			t.Errorf("%s: cookie set %v, want %v", target, got, want)
+		}
+	}
+}
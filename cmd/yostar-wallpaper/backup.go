@@ -0,0 +1,76 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// backupFlags are the flags of backup
+type backupFlags struct {
+	out        string
+	thumbnails bool
+}
+
+// register adds the flags of backup to the flag set
+func (o *backupFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.out, "out", "", "Path of the archive to create. Defaults to yostar-backup-<date>.tar.gz.")
+	fs.BoolVar(&o.thumbnails, "thumbnails", false, "Include the thumbnails of the library.")
+}
+
+// runBackup writes the database and optionally the thumbnails into a single archive
+func runBackup(db *sql.DB, args []string) error {
+	var o backupFlags
+	fs := newFlagSet("backup", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if o.out == "" {
+		o.out = fmt.Sprintf("yostar-backup-%s.tar.gz", time.Now().Format("20060102-150405"))
+	}
+
+	manifest, err := ys.CreateBackup(db, o.out, o.thumbnails)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Backed up %d wallpapers (%d files) into %s\n", manifest.Wallpapers, len(manifest.Files), o.out)
+	return nil
+}
+
+// restoreFlags are the flags of restore
+type restoreFlags struct {
+	force    bool
+	download bool
+}
+
+// register adds the flags of restore to the flag set
+func (o *restoreFlags) register(fs *flag.FlagSet) {
+	fs.BoolVar(&o.force, "force", false, "Replace a library that already has wallpapers.")
+	fs.BoolVar(&o.download, "download", false, "Download the originals missing from disk again.")
+}
+
+// runRestore replaces the library database with the one of a backup archive
+func runRestore(db *sql.DB, args []string) error {
+	var o restoreFlags
+	fs := newFlagSet("restore", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return errors.New("usage: restore [flags] <archive>")
+	}
+
+	res, err := ys.RestoreBackup(db, fs.Arg(0), ys.RestoreOptions{Force: o.force, Download: o.download})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored %d wallpapers from a backup of %s\n", res.Manifest.Wallpapers, res.Manifest.CreatedAt.Format(time.DateTime))
+	fmt.Printf("Thumbnails: %d, downloaded: %d, missing: %d\n", res.Thumbnails, res.Downloaded, res.Missing)
+	return nil
+}
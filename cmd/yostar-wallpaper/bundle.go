@@ -0,0 +1,72 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"strings"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// bundleFlags are the flags of bundle
+type bundleFlags struct {
+	filterFlags
+	out      string
+	format   string
+	torrent  bool
+	trackers string
+}
+
+// register adds the flags of bundle to the flag set
+func (o *bundleFlags) register(fs *flag.FlagSet) {
+	o.filterFlags.register(fs)
+	fs.StringVar(&o.out, "out", "yostar-bundle.zip", "Path of the archive to create.")
+	fs.StringVar(&o.format, "format", "", "Archive format (zip, tar). Defaults to the extension of --out.")
+	fs.BoolVar(&o.torrent, "torrent", false, "Also generate a .torrent for the archive.")
+	fs.StringVar(&o.trackers, "trackers", "", "Comma separated tracker announce URLs for the .torrent.")
+}
+
+// runBundle packages a filtered subset of the library into an archive
+func runBundle(db *sql.DB, args []string) error {
+	var o bundleFlags
+	fs := newFlagSet("bundle", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	filter, err := o.filter()
+	if err != nil {
+		return err
+	}
+
+	if o.format == "" {
+		o.format = ys.BundleZip
+		if strings.HasSuffix(o.out, ".tar") {
+			o.format = ys.BundleTar
+		}
+	}
+
+	res, err := ys.CreateBundle(db, filter, o.out, o.format)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Bundled %d wallpapers into %s (%d bytes)\n", len(res.Entries), o.out, res.Size)
+	if res.Skipped > 0 {
+		fmt.Printf("Skipped %d wallpapers whose file is not on disk\n", res.Skipped)
+	}
+
+	if o.torrent {
+		var list []string
+		if o.trackers != "" {
+			list = strings.Split(o.trackers, ",")
+		}
+		torrentPath, err := ys.CreateTorrent(o.out, list)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Torrent written to", torrentPath)
+	}
+
+	return nil
+}
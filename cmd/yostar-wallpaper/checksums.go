@@ -0,0 +1,51 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// checksumsFlags are the flags of checksums
+type checksumsFlags struct {
+	filterFlags
+	format string
+}
+
+// register adds the flags of checksums to the flag set
+func (o *checksumsFlags) register(fs *flag.FlagSet) {
+	o.filterFlags.register(fs)
+	fs.StringVar(&o.format, "format", ys.ChecksumsSHA256, "Manifest format: sha256 (SHA256SUMS) or sfv (<game>.sfv).")
+}
+
+// runChecksums writes checksum manifests into the folder of each game
+func runChecksums(db *sql.DB, args []string) error {
+	var o checksumsFlags
+	fs := newFlagSet("checksums", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	filter, err := o.filter()
+	if err != nil {
+		return err
+	}
+
+	manifests, err := ys.WriteChecksums(db, filter, o.format)
+	if err != nil {
+		return err
+	}
+	if len(manifests) == 0 {
+		fmt.Println("No downloaded wallpapers match")
+	}
+	for _, m := range manifests {
+		fmt.Printf("%s: %d files listed in %s\n", m.Game, m.Files, m.Path)
+		if m.Skipped > 0 {
+			fmt.Printf("%s: skipped %d files not on disk or outside %s\n", m.Game, m.Skipped, filepath.Dir(m.Path))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// collectionFlags are the flags of collection
+type collectionFlags struct {
+	filterFlags
+	rules string
+	ids   string
+	out   string
+	mode  string
+}
+
+// register adds the flags of collection to the flag set
+func (o *collectionFlags) register(fs *flag.FlagSet) {
+	o.filterFlags.register(fs)
+	fs.StringVar(&o.rules, "rules", "", "With create, rules of a smart collection, e.g. \"game=arknight AND artist=X AND aspect>=16:9\", instead of filters.")
+	fs.StringVar(&o.ids, "ids", "", "Comma separated IDs of wallpapers to add or remove, among those matching the filters.")
+	fs.StringVar(&o.out, "out", "", "With export or create, folder the wallpapers of the collection are exported to.")
+	fs.StringVar(&o.mode, "mode", ys.ExportSymlink, "With export or create, how the wallpapers are exported: symlink, hardlink or copy.")
+}
+
+// runCollection manages the collections of the library, named sets of wallpapers
+// exported into folders
+func runCollection(db *sql.DB, args []string) error {
+	var o collectionFlags
+	fs := newFlagSet("collection", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	action, name := fs.Arg(0), fs.Arg(1)
+	// flags are also accepted after the action and the name
+	if fs.NArg() > 2 {
+		fs.Parse(fs.Args()[2:])
+	}
+	if action == "" || action == "list" {
+		return listCollections(db)
+	}
+	if name == "" && action != "update" {
+		fs.Usage()
+		return fmt.Errorf("collection %s expects the name of a collection", action)
+	}
+
+	switch action {
+	case "create":
+		var c ys.Collection
+		var err error
+		if o.rules != "" {
+			if filtered(fs) {
+				return errors.New("collection create takes --rules or filters, not both")
+			}
+			c, err = ys.CreateSmartCollection(db, name, o.rules)
+		} else {
+			var query *ys.Filter
+			if filtered(fs) {
+				filter, err := o.filter()
+				if err != nil {
+					return err
+				}
+				query = &filter
+			}
+			c, err = ys.CreateCollection(db, name, query)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created collection %q with %d wallpapers\n", c.Name, c.Members)
+		if o.out == "" {
+			return nil
+		}
+		update, err := ys.ExportCollection(db, &c, o.out, o.mode)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Exported %d wallpapers into %s\n", update.Exported, o.out)
+		return nil
+
+	case "add", "remove":
+		if !filtered(fs) && o.ids == "" {
+			return fmt.Errorf("collection %s expects filters or --ids", action)
+		}
+		c, err := ys.GetCollection(db, name)
+		if err != nil {
+			return err
+		}
+		items, err := selectItems(db, o.filterFlags, o.ids)
+		if err != nil {
+			return err
+		}
+		if action == "add" {
+			n, err := ys.AddToCollection(db, c, items)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Added %d wallpapers to %q\n", n, c.Name)
+		} else {
+			n, err := ys.RemoveFromCollection(db, c, items)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Removed %d wallpapers from %q\n", n, c.Name)
+		}
+		if c.Folder == "" {
+			return nil
+		}
+		_, err = ys.UpdateCollection(db, &c)
+		return err
+
+	case "show":
+		c, err := ys.GetCollection(db, name)
+		if err != nil {
+			return err
+		}
+		items, err := ys.CollectionItems(db, c)
+		if err != nil {
+			return err
+		}
+		if c.Rules != "" {
+			fmt.Printf("Rules: %s\n", c.Rules)
+		}
+		return printItems(items)
+
+	case "export":
+		if o.out == "" {
+			return errors.New("collection export expects --out")
+		}
+		c, err := ys.GetCollection(db, name)
+		if err != nil {
+			return err
+		}
+		update, err := ys.ExportCollection(db, &c, o.out, o.mode)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Exported %d wallpapers of %q into %s, removed %d files\n", update.Exported, c.Name, o.out, update.Deleted)
+		return nil
+
+	case "update":
+		if name == "" {
+			return ys.UpdateCollections(db)
+		}
+		c, err := ys.GetCollection(db, name)
+		if err != nil {
+			return err
+		}
+		update, err := ys.UpdateCollection(db, &c)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%q: %d added, %d removed, %d files exported, %d deleted\n", c.Name, update.Added, update.Removed, update.Exported, update.Deleted)
+		return nil
+
+	case "delete":
+		c, err := ys.GetCollection(db, name)
+		if err != nil {
+			return err
+		}
+		return ys.DeleteCollection(db, c)
+	}
+	fs.Usage()
+	return fmt.Errorf("unknown collection action %q", action)
+}
+
+// listCollections prints the collections of the library as a table
+func listCollections(db *sql.DB) error {
+	collections, err := ys.ListCollections(db)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tWALLPAPERS\tKIND\tFOLDER")
+	for _, c := range collections {
+		kind := "list"
+		switch {
+		case c.Rules != "":
+			kind = "rules"
+		case c.Query != nil:
+			kind = "query"
+		}
+		folder := c.Folder
+		if folder != "" {
+			folder += " (" + c.Mode + ")"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", c.Name, c.Members, kind, folder)
+	}
+	return w.Flush()
+}
+
+// filtered reports whether filter flags were given
+func filtered(fs *flag.FlagSet) bool {
+	var set bool
+	fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "rules", "ids", "out", "mode", "tolerance":
+		default:
+			set = true
+		}
+	})
+	return set
+}
+
+// selectItems returns the wallpapers matching the filters, only those of ids when
+// not empty
+func selectItems(db *sql.DB, f filterFlags, ids string) ([]ys.GalleryItem, error) {
+	filter, err := f.filter()
+	if err != nil {
+		return nil, err
+	}
+	items, err := ys.FindGalleryItems(db, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query wallpapers: %w", err)
+	}
+	if ids == "" {
+		return items, nil
+	}
+
+	wanted := strings.Split(ids, ",")
+	for i := range wanted {
+		wanted[i] = strings.TrimSpace(wanted[i])
+	}
+	var selected []ys.GalleryItem
+	for _, item := range items {
+		if contains(wanted, item.IdGallery) {
+			selected = append(selected, item)
+		}
+	}
+	return selected, nil
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// completeCommand is the hidden command the completion scripts run to list the
+// candidates of the word being completed
+const completeCommand = "__complete"
+
+// completionScripts are the completion scripts, by shell. They pass the number of
+// words before the one completed, then the words up to it, to __complete.
+var completionScripts = map[string]string{
+	"bash": `# bash completion of yostar-wallpaper, loaded with
+#   source <(yostar-wallpaper completion bash)
+_yostar_wallpaper() {
+	local IFS=$'\n'
+	COMPREPLY=($(yostar-wallpaper __complete "$((COMP_CWORD - 1))" "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -F _yostar_wallpaper yostar-wallpaper
+`,
+	"zsh": `#compdef yostar-wallpaper
+# zsh completion of yostar-wallpaper, loaded with
+#   source <(yostar-wallpaper completion zsh)
+_yostar_wallpaper() {
+	local -a candidates
+	candidates=("${(@f)$(yostar-wallpaper __complete "$((CURRENT - 2))" "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+	if [[ -z ${candidates[1]} ]]; then
+		_files
+		return
+	fi
+	compadd -a candidates
+}
+compdef _yostar_wallpaper yostar-wallpaper
+`,
+	"fish": `# fish completion of yostar-wallpaper, loaded with
+#   yostar-wallpaper completion fish | source
+function __yostar_wallpaper_complete
+	set -l words (commandline -opc)
+	yostar-wallpaper __complete (math (count $words) - 1) $words[2..-1] (commandline -ct) 2>/dev/null
+end
+complete -c yostar-wallpaper -a '(__yostar_wallpaper_complete)'
+`,
+	"powershell": `# PowerShell completion of yostar-wallpaper, loaded with
+#   yostar-wallpaper completion powershell | Out-String | Invoke-Expression
+Register-ArgumentCompleter -Native -CommandName yostar-wallpaper -ScriptBlock {
+	param($wordToComplete, $commandAst, $cursorPosition)
+	$words = @($commandAst.CommandElements | Select-Object -Skip 1 |
+		Where-Object { $_.Extent.EndOffset -le $cursorPosition } | ForEach-Object { $_.ToString() })
+	$count = $words.Count
+	if ($wordToComplete -ne '') { $count-- }
+	yostar-wallpaper __complete $count @words 2>$null | ForEach-Object {
+		[System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+	}
+}
+`,
+}
+
+// runCompletion prints the completion script of a shell
+func runCompletion(db *sql.DB, args []string) error {
+	fs := newFlagSet("completion", nil)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	script, ok := completionScripts[fs.Arg(0)]
+	if !ok {
+		fs.Usage()
+		return fmt.Errorf("unknown shell %q", fs.Arg(0))
+	}
+	fmt.Print(script)
+	return nil
+}
+
+// complete prints the candidates of the word being completed, one per line. args
+// are the number of words before it, those words, then the word unless empty.
+func complete(w io.Writer, args []string) {
+	if len(args) == 0 {
+		return
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 0 || n >= len(args) {
+		return
+	}
+	words, cur := args[1:n+1], ""
+	if len(args) > n+1 {
+		cur = args[n+1]
+	}
+
+	// bash splits --flag=value into --flag, = and value, and completes the value alone
+	bare := ""
+	if cur == "=" && n > 0 {
+		bare = words[n-1] + "="
+		words, cur = words[:n-1], bare
+	} else if n > 1 && words[n-1] == "=" {
+		bare = words[n-2] + "="
+		words, cur = words[:n-2], bare+cur
+	}
+
+	for _, c := range candidates(words, cur) {
+		if strings.HasPrefix(c, cur) {
+			fmt.Fprintln(w, strings.TrimPrefix(c, bare))
+		}
+	}
+}
+
+// candidates returns the words that can follow words: commands, flags, values of
+// flags and arguments, including the games and tags of the library
+func candidates(words []string, cur string) []string {
+	fs := new(globalOptions).register(flag.NewFlagSet(globalSection, flag.ContinueOnError))
+	var cmd *command
+	for i := 0; i < len(words) && cmd == nil; i++ {
+		if takesValue(fs, words[i]) {
+			i++
+			continue
+		}
+		if strings.HasPrefix(words[i], "-") {
+			continue
+		}
+		for j := range commands {
+			if commands[j].name == words[i] {
+				cmd = &commands[j]
+			}
+		}
+		if cmd == nil {
+			return nil
+		}
+		fs = commandFlags(*cmd)
+	}
+
+	if name, value, ok := strings.Cut(cur, "="); ok && strings.HasPrefix(name, "-") {
+		var values []string
+		for _, v := range flagValues(fs, name) {
+			if strings.HasPrefix(v, value) {
+				values = append(values, name+"="+v)
+			}
+		}
+		return values
+	}
+	if len(words) > 0 && takesValue(fs, words[len(words)-1]) {
+		return flagValues(fs, words[len(words)-1])
+	}
+	if strings.HasPrefix(cur, "-") {
+		var names []string
+		fs.VisitAll(func(f *flag.Flag) { names = append(names, "--"+f.Name) })
+		return names
+	}
+	if cmd == nil {
+		var names []string
+		for _, c := range commands {
+			names = append(names, c.name)
+		}
+		return names
+	}
+
+	switch cmd.name {
+	case "completion":
+		return mapKeys(completionScripts)
+	case "config":
+		return []string{"check", "show"}
+	case "low-power":
+		return []string{"on", "off"}
+	case "quarantine":
+		return []string{"list", "delete", "retry"}
+	case "skip":
+		return []string{"list", "add", "remove"}
+	case "service":
+		return []string{"install", "uninstall", "start", "stop", "status"}
+	case "status", "sync":
+		return append([]string{"all"}, mapKeys(crawlers)...)
+	case "collection":
+		actions := []string{"list", "create", "add", "remove", "show", "export", "update", "delete"}
+		if len(words) > 0 && contains(actions[1:], words[len(words)-1]) {
+			return libraryValues(collectionNames)
+		}
+		return actions
+	case "rotation":
+		if len(words) > 0 && words[len(words)-1] == "set" {
+			return libraryValues(collectionNames)
+		}
+		return []string{"set", "off", "watch"}
+	case "help":
+		names := append([]string{"topics"}, helpTopics()...)
+		for _, c := range commands {
+			names = append(names, c.name)
+		}
+		return names
+	}
+	return nil
+}
+
+// takesValue reports whether word is a flag of fs given its value in the next word
+func takesValue(fs *flag.FlagSet, word string) bool {
+	if !strings.HasPrefix(word, "-") || strings.Contains(word, "=") {
+		return false
+	}
+	f := fs.Lookup(strings.TrimLeft(word, "-"))
+	if f == nil {
+		return false
+	}
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return !ok || !b.IsBoolFlag()
+}
+
+// flagValues returns the values of the flag of fs named by word, as far as known
+func flagValues(fs *flag.FlagSet, word string) []string {
+	name := strings.TrimLeft(word, "-")
+	if fs.Lookup(name) == nil {
+		return nil
+	}
+	switch name {
+	case "game":
+		return libraryValues(func(db *sql.DB) ([]string, error) {
+			games, err := ys.ListGames(db)
+			var names []string
+			for _, g := range games {
+				names = append(names, g.Name)
+			}
+			return names, err
+		})
+	case "tag":
+		return libraryValues(ys.ListTags)
+	case "region":
+		return []string{ys.RegionGlobal, ys.RegionJP, ys.RegionKR}
+	case "dedupe":
+		return []string{ys.DedupeOff, ys.DedupeLink, ys.DedupeSkip}
+	case "only", "skip":
+		return mapKeys(crawlers)
+	case "format":
+		// the other commands have formats of their own
+		if fs.Name() == "convert" {
+			return ys.Codecs()
+		}
+	case "collection":
+		return libraryValues(collectionNames)
+	case "mode":
+		return []string{ys.ExportSymlink, ys.ExportHardlink, ys.ExportCopy}
+	case "name-form":
+		return []string{ys.NameFormNFC, ys.NameFormNFD, ys.NameFormNone}
+	case "on-conflict":
+		return []string{ys.ConflictAsk, ys.ConflictSkip, ys.ConflictOverwrite, ys.ConflictRename}
+	case "events":
+		return ys.EventKinds
+	case "action":
+		return auditActions
+	}
+	return nil
+}
+
+// collectionNames returns the names of the collections of the library
+func collectionNames(db *sql.DB) ([]string, error) {
+	collections, err := ys.ListCollections(db)
+	var names []string
+	for _, c := range collections {
+		names = append(names, c.Name)
+	}
+	return names, err
+}
+
+// libraryValues returns the values listed by list from the database, or none when
+// there is no library yet
+func libraryValues(list func(db *sql.DB) ([]string, error)) []string {
+	if _, err := os.Stat(ys.DatabasePath()); err != nil {
+		return nil
+	}
+	db, err := ys.OpenDB()
+	if err != nil {
+		return nil
+	}
+	defer ys.CloseDB(db)
+	values, err := list(db)
+	if err != nil {
+		return nil
+	}
+	sort.Strings(values)
+	return values
+}
+
+// mapKeys returns the keys of m, sorted
+func mapKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
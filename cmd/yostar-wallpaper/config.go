@@ -0,0 +1,175 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+	gamecrawlers "github.com/YukiHime23/go-wallpaper-yostar/crawlers"
+)
+
+// globalSection is the section of the configuration file setting the flags given
+// before the command
+const globalSection = "yostar-wallpaper"
+
+// crawlers are the crawlers of the games, run as commands, by name
+var crawlers = gamecrawlers.ByName()
+
+// config is the configuration file, loaded by main
+var config = &ys.Config{}
+
+// newFlagSet returns the flag set of the command name, with the flags added by
+// register, if any, and the usage of its help
+func newFlagSet(name string, register func(*flag.FlagSet)) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() { printCommandHelp(fs) }
+	if register != nil {
+		register(fs)
+	}
+	return fs
+}
+
+// parseFlags sets the flags of a command to the values of the configuration file,
+// then parses its command line over them
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := config.Apply(fs.Name(), ys.ConfigTarget{Flags: fs}); err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return fs.Parse(args)
+}
+
+// commandFlags returns the flags of a command, without running it
+func commandFlags(cmd command) *flag.FlagSet {
+	fs := newFlagSet(cmd.name, cmd.flags)
+	fs.Init(cmd.name, flag.ContinueOnError)
+	return fs
+}
+
+// configTargets returns the programs and commands the configuration file can have
+// a section for, by section name
+func configTargets() map[string]ys.ConfigTarget {
+	targets := map[string]ys.ConfigTarget{
+		globalSection: {Flags: new(globalOptions).register(flag.NewFlagSet(globalSection, flag.ContinueOnError))},
+	}
+	for _, cmd := range commands {
+		if _, ok := crawlers[cmd.name]; ok {
+			targets[cmd.name] = ys.CrawlerTarget(commandFlags(cmd))
+		} else if cmd.name != "config" {
+			targets[cmd.name] = ys.ConfigTarget{Flags: commandFlags(cmd)}
+		}
+	}
+	return targets
+}
+
+func init() {
+	// registered here, as it looks up the flags of the other commands
+	commands = append(commands, command{name: "config", usage: "Check the configuration file or show the options it sets",
+		flags: new(configFlags).register, run: runConfig, noDB: true})
+}
+
+// configFlags are the flags of config
+type configFlags struct {
+	effective bool
+}
+
+// register adds the flags of config to the flag set
+func (o *configFlags) register(fs *flag.FlagSet) {
+	fs.BoolVar(&o.effective, "effective", false, "With show, list every option of the program or command with its value and whether it comes from a flag default, the file or the environment.")
+}
+
+// runConfig checks the configuration file or shows the options it sets
+func runConfig(db *sql.DB, args []string) error {
+	var o configFlags
+	fs := newFlagSet("config", o.register)
+	// the configuration is not applied to config itself, which must run when it is invalid
+	fs.Parse(args)
+
+	switch fs.Arg(0) {
+	case "check":
+		return checkConfig()
+	case "show":
+		// flags are also accepted after show
+		fs.Parse(fs.Args()[1:])
+		if o.effective {
+			section := globalSection
+			if fs.NArg() > 0 {
+				section = fs.Arg(0)
+			}
+			return showEffectiveConfig(section)
+		}
+		return showConfig()
+	}
+	fs.Usage()
+	return errors.New("config check or config show expected")
+}
+
+// checkConfig reports every error of the configuration file
+func checkConfig() error {
+	c, err := ys.LoadConfig()
+	if c != nil {
+		err = errors.Join(err, c.Check(configTargets()))
+	}
+	if err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	fmt.Printf("%s: OK, %d options, %d set by environment variables\n", c.Path, len(c.Entries), len(ys.EnvOptions()))
+	return nil
+}
+
+// showConfig prints the options set by the configuration file, by section, then
+// those set by environment variables
+func showConfig() error {
+	c, err := ys.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	fmt.Printf("# %s\n", c.Path)
+	section := ""
+	for _, e := range c.Entries {
+		if e.Section != section {
+			fmt.Printf("\n[%s]\n", e.Section)
+			section = e.Section
+		}
+		fmt.Printf("%s = %q\n", e.Key, e.Value)
+	}
+	if envs := ys.EnvOptions(); len(envs) > 0 {
+		fmt.Println("\n# environment, overriding the file")
+		for _, env := range envs {
+			fmt.Printf("%s=%q\n", env, os.Getenv(env))
+		}
+	}
+	return nil
+}
+
+// showEffectiveConfig prints every option of the program or command of section with
+// the value it takes without flags, from the environment, the configuration file or
+// its default
+func showEffectiveConfig(section string) error {
+	c, err := ys.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	targets := configTargets()
+	t, ok := targets[section]
+	if !ok {
+		return fmt.Errorf("unknown command or crawler %q", section)
+	}
+	if err := c.Apply(section, t); err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "OPTION\tVALUE\tSOURCE")
+	t.Flags.VisitAll(func(f *flag.Flag) {
+		source := c.Source(section, f.Name)
+		if source == "" {
+			source = "default"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", f.Name, f.Value, source)
+	})
+	return w.Flush()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// icloudFolder is the folder of iCloud Drive that --icloud converts into
+const icloudFolder = "Yostar Wallpapers"
+
+// convertFlags are the flags of convert
+type convertFlags struct {
+	filterFlags
+	collection string
+	format     string
+	codecCmd   string
+	out        string
+	icloud     bool
+	force      bool
+}
+
+// register adds the flags of convert to the flag set
+func (o *convertFlags) register(fs *flag.FlagSet) {
+	o.filterFlags.register(fs)
+	fs.StringVar(&o.collection, "collection", "", "Convert the wallpapers of this collection instead of those matching the filters.")
+	fs.StringVar(&o.format, "format", "heic", "Format the wallpapers are converted into: heic, jpeg, png, or any with --codec.")
+	fs.StringVar(&o.codecCmd, "codec", "", "Command line of the encoder, e.g. \"cwebp -q 80 {file} -o {out}\", instead of the built-in codec of --format.")
+	fs.StringVar(&o.out, "out", "", "Folder the converted files are written into.")
+	fs.BoolVar(&o.icloud, "icloud", false, "Write into the \""+icloudFolder+"\" folder of iCloud Drive, for iPhones to pick the files up.")
+	fs.BoolVar(&o.force, "force", false, "Convert again the wallpapers converted before from the same file.")
+}
+
+// runConvert converts the wallpapers matching the filter flags, or those of a
+// collection, into another format in a folder, e.g. HEIC in iCloud Drive
+func runConvert(db *sql.DB, args []string) error {
+	var o convertFlags
+	fs := newFlagSet("convert", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	dir := o.out
+	if o.icloud {
+		if dir != "" {
+			return errors.New("--out and --icloud are exclusive")
+		}
+		drive, err := ys.ICloudDrive()
+		if err != nil {
+			return err
+		}
+		dir = filepath.Join(drive, icloudFolder)
+	}
+	if dir == "" {
+		return errors.New("--out or --icloud is required")
+	}
+	codec, err := ys.NewCodec(o.format, o.codecCmd)
+	if err != nil {
+		return fmt.Errorf("invalid --format: %w", err)
+	}
+
+	var items []ys.GalleryItem
+	if o.collection != "" {
+		c, err := ys.GetCollection(db, o.collection)
+		if err != nil {
+			return err
+		}
+		items, err = ys.CollectionItems(db, c)
+		if err != nil {
+			return err
+		}
+	} else {
+		filter, err := o.filter()
+		if err != nil {
+			return err
+		}
+		items, err = ys.FindGalleryItems(db, filter)
+		if err != nil {
+			return fmt.Errorf("failed to query wallpapers: %w", err)
+		}
+	}
+
+	report, err := ys.ConvertItems(context.Background(), db, items, ys.ConvertOptions{Codec: codec, Dir: dir, Force: o.force})
+	fmt.Printf("Converted %d wallpapers into %s, %d unchanged, %d failed\n", report.Converted, dir, report.Unchanged, report.Failed)
+	return err
+}
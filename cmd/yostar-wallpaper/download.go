@@ -0,0 +1,110 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// downloadFlags are the flags of download
+type downloadFlags struct {
+	filterFlags
+	path       string
+	dedupe     string
+	onConflict string
+	queue      bool
+	priority   int
+}
+
+// register adds the flags of download to the flag set
+func (o *downloadFlags) register(fs *flag.FlagSet) {
+	o.filterFlags.register(fs)
+	fs.StringVar(&o.path, "path", ".", "Folder the wallpapers are saved into, under <game>/<type>.")
+	fs.StringVar(&o.dedupe, "dedupe", ys.DedupeLink, "What to do with downloads identical to a file already in the library (off, link, skip).")
+	fs.StringVar(&o.onConflict, "on-conflict", ys.ConflictOverwrite, "What to do when a different file already has the name of a download (ask, skip, overwrite, rename).")
+	fs.BoolVar(&o.queue, "queue", false, "Add the wallpapers to the download queue of serve instead of downloading them now.")
+	fs.IntVar(&o.priority, "priority", 0, "Priority of the wallpapers added with --queue, higher first.")
+}
+
+// runDownload downloads the cataloged wallpapers matching the filter flags
+func runDownload(db *sql.DB, args []string) error {
+	var o downloadFlags
+	fs := newFlagSet("download", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if err := ys.CheckDedupeMode(o.dedupe); err != nil {
+		return err
+	}
+	if err := ys.SetConflictMode(o.onConflict); err != nil {
+		return fmt.Errorf("invalid --on-conflict: %w", err)
+	}
+	filter, err := o.filter()
+	if err != nil {
+		return err
+	}
+
+	items, err := ys.FindGalleryItems(db, filter)
+	if err != nil {
+		return fmt.Errorf("failed to query wallpapers: %w", err)
+	}
+
+	if o.queue {
+		var n int
+		for _, item := range items {
+			if !item.Cataloged {
+				continue
+			}
+			queued, err := ys.EnqueueDownload(db, item.ID, o.priority)
+			if err != nil {
+				return err
+			}
+			if queued {
+				n++
+			}
+		}
+		fmt.Printf("Queued %d wallpapers\n", n)
+		return nil
+	}
+
+	// Ctrl+C stops once the running download is done
+	ctx, release := ys.Graceful()
+	defer release()
+	var n, skipped, failed int
+	for _, item := range items {
+		if ctx.Err() != nil {
+			fmt.Printf("Interrupted after %d wallpapers, %d skipped, %d failed\n", n, skipped, failed)
+			return ys.ErrInterrupted
+		}
+		if !item.Cataloged {
+			continue
+		}
+
+		dup, err := ys.DownloadGalleryItem(db, &item, o.path, o.dedupe)
+		if errors.Is(err, ys.ErrConflictSkipped) {
+			log.Printf(`-> "%s" skipped, a different file already has its name <-`, item.FileName)
+			skipped++
+			continue
+		}
+		if err != nil {
+			log.Printf("Error downloading %s: %v", item.FileName, err)
+			if item.Cataloged {
+				failed++
+				continue
+			}
+		}
+		if dup != nil {
+			log.Printf(`-> "%s" duplicates "%s", saved %d bytes <-`, item.FileName, dup.Of.FileName, dup.Saved)
+		}
+		log.Printf(`-> download done "%s" <-`, item.FileName)
+		n++
+	}
+
+	fmt.Printf("Downloaded %d wallpapers, %d skipped, %d failed\n", n, skipped, failed)
+	return nil
+}
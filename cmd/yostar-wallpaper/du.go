@@ -0,0 +1,79 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// duFlags are the flags of du
+type duFlags struct {
+	filterFlags
+	top    int
+	format string
+}
+
+// register adds the flags of du to the flag set
+func (o *duFlags) register(fs *flag.FlagSet) {
+	o.filterFlags.register(fs)
+	fs.IntVar(&o.top, "top", 10, "Number of the largest files listed.")
+	fs.StringVar(&o.format, "format", "table", "Output format (table, json).")
+}
+
+// runDu reports the disk usage of the library by game and type, and its largest files
+func runDu(db *sql.DB, args []string) error {
+	var o duFlags
+	fs := newFlagSet("du", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if o.format != "table" && o.format != "json" {
+		return fmt.Errorf("unknown format %q", o.format)
+	}
+	filter, err := o.filter()
+	if err != nil {
+		return err
+	}
+
+	du, err := ys.LibraryDiskUsage(db, filter, o.top)
+	if err != nil {
+		return err
+	}
+	if o.format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(du)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "GAME\tTYPE\tFILES\tORIGINALS\tTHUMBNAILS\tTRASH\tTEMP\tTOTAL\t")
+	row := func(game, typ string, u ys.Usage) {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\t\n", game, typ, u.Files, ys.FormatBytes(u.Originals),
+			ys.FormatBytes(u.Thumbnails), ys.FormatBytes(u.Trash), ys.FormatBytes(u.Temp), ys.FormatBytes(u.Total()))
+	}
+	for _, t := range du.Types {
+		row(t.Game, t.Type, t.Usage)
+	}
+	row("total", "", du.Total)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if du.Missing > 0 {
+		fmt.Printf("\n%d files of the library are missing from disk, see maintain\n", du.Missing)
+	}
+
+	if len(du.Largest) > 0 {
+		fmt.Println("\nLargest files:")
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, l := range du.Largest {
+			fmt.Fprintf(w, "%s\t%s/%s\t%s\n", ys.FormatBytes(l.Size), l.Game, l.Type, l.Path)
+		}
+		return w.Flush()
+	}
+	return nil
+}
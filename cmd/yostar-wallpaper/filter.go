@@ -0,0 +1,134 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// dateLayout is the layout of date flags
+const dateLayout = "2006-01-02"
+
+// filterFlags holds the flags that select a subset of the library
+type filterFlags struct {
+	game   string
+	region string
+	typ    string
+	title  string
+	artist string
+	since  string
+	until  string
+
+	publishedSince string
+	publishedUntil string
+
+	color         string
+	minBrightness float64
+	maxBrightness float64
+	aspect        string
+	tolerance     string
+	minAspect     string
+	maxAspect     string
+	tag           string
+	text          string
+	excludeTags   string
+}
+
+// register adds the filter flags to the flag set
+func (f *filterFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.game, "game", "", "Only wallpapers of this game (azurlane, arknight, mahjong_soul, aether_gazer).")
+	fs.StringVar(&f.region, "region", "", "Only wallpapers listed by this region of the game API (global, jp, kr).")
+	fs.StringVar(&f.typ, "type", "", "Only wallpapers of this image type (wallpaper, mobile).")
+	fs.StringVar(&f.title, "title", "", "Only wallpapers whose file name contains this text.")
+	fs.StringVar(&f.artist, "artist", "", "Only wallpapers credited to this artist.")
+	fs.StringVar(&f.since, "since", "", "Only wallpapers downloaded on or after this date (YYYY-MM-DD).")
+	fs.StringVar(&f.until, "until", "", "Only wallpapers downloaded before this date (YYYY-MM-DD).")
+	fs.StringVar(&f.publishedSince, "published-since", "", "Only wallpapers the game published on or after this date (YYYY-MM-DD).")
+	fs.StringVar(&f.publishedUntil, "published-until", "", "Only wallpapers the game published before this date (YYYY-MM-DD).")
+	fs.StringVar(&f.color, "color", "", "Only wallpapers with this dominant color, e.g. dark-blue, or blue for any lightness.")
+	fs.Float64Var(&f.minBrightness, "min-brightness", 0, "Only wallpapers at least this bright (0 to 1).")
+	fs.Float64Var(&f.maxBrightness, "max-brightness", 0, "Only wallpapers at most this bright (0 to 1).")
+	fs.StringVar(&f.aspect, "aspect", "", "Only wallpapers of this aspect ratio, e.g. 21:9 or 2.33.")
+	fs.StringVar(&f.tolerance, "tolerance", "2%", "Relative tolerance of --aspect, e.g. 2% or 0.02.")
+	fs.StringVar(&f.minAspect, "min-aspect", "", "Only wallpapers at least this wide for their height, e.g. 16:9.")
+	fs.StringVar(&f.maxAspect, "max-aspect", "", "Only wallpapers at most this wide for their height, e.g. 9:16 for portrait ones.")
+	fs.StringVar(&f.tag, "tag", "", "Only wallpapers with this tag.")
+	fs.StringVar(&f.text, "text", "", "Only wallpapers whose text recognized by OCR contains this.")
+	fs.StringVar(&f.excludeTags, "exclude-tags", "", "Comma separated tags of the wallpapers left out, e.g. nsfw.")
+}
+
+// filter converts the flags into a library filter
+func (f *filterFlags) filter() (ys.Filter, error) {
+	filter := ys.Filter{
+		Game:   f.game,
+		Region: f.region,
+		Type:   f.typ,
+		Title:  f.title,
+		Artist: f.artist,
+
+		Color:         f.color,
+		MinBrightness: f.minBrightness,
+		MaxBrightness: f.maxBrightness,
+
+		Tag:  f.tag,
+		Text: f.text,
+
+		ExcludeTags: ys.ParseTags(f.excludeTags),
+	}
+
+	var err error
+	if f.since != "" {
+		if filter.Since, err = time.ParseInLocation(dateLayout, f.since, time.Local); err != nil {
+			return ys.Filter{}, fmt.Errorf("invalid --since: %w", err)
+		}
+	}
+	if f.until != "" {
+		if filter.Until, err = time.ParseInLocation(dateLayout, f.until, time.Local); err != nil {
+			return ys.Filter{}, fmt.Errorf("invalid --until: %w", err)
+		}
+	}
+	if f.publishedSince != "" {
+		if filter.PublishedSince, err = time.ParseInLocation(dateLayout, f.publishedSince, time.Local); err != nil {
+			return ys.Filter{}, fmt.Errorf("invalid --published-since: %w", err)
+		}
+	}
+	if f.publishedUntil != "" {
+		if filter.PublishedUntil, err = time.ParseInLocation(dateLayout, f.publishedUntil, time.Local); err != nil {
+			return ys.Filter{}, fmt.Errorf("invalid --published-until: %w", err)
+		}
+	}
+
+	if f.aspect != "" {
+		if filter.Aspect, err = ys.ParseAspect(f.aspect); err != nil {
+			return ys.Filter{}, fmt.Errorf("invalid --aspect: %w", err)
+		}
+		if filter.AspectTolerance, err = parseTolerance(f.tolerance); err != nil {
+			return ys.Filter{}, fmt.Errorf("invalid --tolerance: %w", err)
+		}
+	}
+	if f.minAspect != "" {
+		if filter.MinAspect, err = ys.ParseAspect(f.minAspect); err != nil {
+			return ys.Filter{}, fmt.Errorf("invalid --min-aspect: %w", err)
+		}
+	}
+	if f.maxAspect != "" {
+		if filter.MaxAspect, err = ys.ParseAspect(f.maxAspect); err != nil {
+			return ys.Filter{}, fmt.Errorf("invalid --max-aspect: %w", err)
+		}
+	}
+
+	return filter, nil
+}
+
+// parseTolerance parses a relative tolerance written as a percentage or a fraction
+func parseTolerance(s string) (float64, error) {
+	if p, ok := strings.CutSuffix(s, "%"); ok {
+		v, err := strconv.ParseFloat(p, 64)
+		return v / 100, err
+	}
+	return strconv.ParseFloat(s, 64)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// gamesFlags are the flags of games
+type gamesFlags struct {
+	game          string
+	region        string
+	endpoint      string
+	resetEndpoint bool
+}
+
+// register adds the flags of games to the flag set
+func (o *gamesFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.game, "game", "", "Game whose settings are changed (azurlane, arknight, mahjong_soul, aether_gazer).")
+	fs.StringVar(&o.region, "region", "", "Region of the API to crawl, e.g. jp.")
+	fs.StringVar(&o.endpoint, "endpoint", "", "API URL used instead of the built-in one, e.g. a mirror.")
+	fs.BoolVar(&o.resetEndpoint, "reset-endpoint", false, "Go back to the built-in API URL.")
+}
+
+// runGames lists the settings of the games of the library, or changes those of one
+func runGames(db *sql.DB, args []string) error {
+	var o gamesFlags
+	fs := newFlagSet("games", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if o.region != "" || o.endpoint != "" || o.resetEndpoint {
+		if o.game == "" {
+			return errors.New("--game is required")
+		}
+		if o.region != "" {
+			if err := ys.SetGameRegion(db, o.game, o.region); err != nil {
+				return err
+			}
+		}
+		if o.endpoint != "" || o.resetEndpoint {
+			if err := ys.SetGameEndpoint(db, o.game, o.endpoint); err != nil {
+				return err
+			}
+		}
+	}
+
+	games, err := ys.ListGames(db)
+	if err != nil {
+		return fmt.Errorf("failed to list games: %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "GAME\tREGION\tENDPOINT")
+	for _, g := range games {
+		endpoint := g.Endpoint
+		if endpoint == "" {
+			endpoint = "(built-in)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", g.Name, g.Region, endpoint)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"database/sql"
+	"embed"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// helpFiles are the help of each command, in help/commands/<command>.txt, and the
+// help topics, in help/topics/<topic>.txt. A command help starts with its synopsis
+// and ends with its examples; a topic starts with its summary.
+//
+//go:embed help
+var helpFiles embed.FS
+
+func init() {
+	// registered here, as it looks up the flags of the other commands
+	commands = append(commands, command{name: "help", usage: "Show the help of a command or topic, or write the manual page", flags: new(helpFlags).register, run: runHelp, noDB: true})
+}
+
+// helpFlags are the flags of help
+type helpFlags struct {
+	man bool
+}
+
+// register adds the flags of help to the flag set
+func (o *helpFlags) register(fs *flag.FlagSet) {
+	fs.BoolVar(&o.man, "man", false, "Write the manual page of yostar-wallpaper, with every command and topic, in troff.")
+}
+
+// runHelp prints the help of a command or topic, the list of topics, or the manual page
+func runHelp(db *sql.DB, args []string) error {
+	var o helpFlags
+	fs := newFlagSet("help", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	name := fs.Arg(0)
+	switch {
+	case o.man:
+		return writeManPage(os.Stdout)
+	case name == "":
+		flag.CommandLine.SetOutput(os.Stdout)
+		usage()
+		return nil
+	case name == "topics":
+		for _, topic := range helpTopics() {
+			text, _ := topicHelp(topic)
+			summary, _, _ := strings.Cut(text, "\n")
+			fmt.Printf("  %-14s %s\n", topic, summary)
+		}
+		fmt.Println()
+		fmt.Println(`Run "yostar-wallpaper help <topic>" to read one.`)
+		return nil
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			cmdFlags := commandFlags(cmd)
+			cmdFlags.SetOutput(os.Stdout)
+			cmdFlags.Usage()
+			return nil
+		}
+	}
+	if text, ok := topicHelp(name); ok {
+		fmt.Print(text)
+		return nil
+	}
+	return fmt.Errorf("unknown command or topic %q, see \"yostar-wallpaper help topics\"", name)
+}
+
+// commandHelp returns the synopsis, description and examples of a command
+func commandHelp(name string) (synopsis, text, examples string) {
+	b, err := helpFiles.ReadFile("help/commands/" + name + ".txt")
+	if err != nil {
+		return "yostar-wallpaper " + name + " [flags]", "", ""
+	}
+	synopsis, rest, _ := strings.Cut(string(b), "\n\n")
+	text, examples, _ = strings.Cut(rest, "\nExamples:\n")
+	return synopsis, strings.TrimSpace(text), examples
+}
+
+// printCommandHelp is the usage of the flags of a command, with its description
+// and examples
+func printCommandHelp(fs *flag.FlagSet) {
+	w := fs.Output()
+	synopsis, text, examples := commandHelp(fs.Name())
+	fmt.Fprintf(w, "Usage: %s\n", synopsis)
+	if text != "" {
+		fmt.Fprintf(w, "\n%s\n", text)
+	}
+	if hasFlags(fs) {
+		fmt.Fprintln(w, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	if examples != "" {
+		fmt.Fprintf(w, "\nExamples:\n%s", examples)
+	}
+}
+
+// hasFlags reports whether fs defines any flag
+func hasFlags(fs *flag.FlagSet) bool {
+	found := false
+	fs.VisitAll(func(*flag.Flag) { found = true })
+	return found
+}
+
+// helpTopics returns the names of the help topics, sorted
+func helpTopics() []string {
+	entries, _ := helpFiles.ReadDir("help/topics")
+	var names []string
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".txt"))
+	}
+	return names
+}
+
+// topicHelp returns the text of a help topic
+func topicHelp(name string) (string, bool) {
+	b, err := helpFiles.ReadFile("help/topics/" + name + ".txt")
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+// writeManPage writes the manual page of yostar-wallpaper, made of the help of its
+// commands and topics
+func writeManPage(w io.Writer) error {
+	fmt.Fprintln(w, `.TH YOSTAR-WALLPAPER 1 "" "yostar-wallpaper" "User Commands"`)
+	fmt.Fprintln(w, ".SH NAME")
+	fmt.Fprintln(w, `yostar-wallpaper \- manage the library of wallpapers downloaded from the Yostar games`)
+	fmt.Fprintln(w, ".SH SYNOPSIS")
+	fmt.Fprintln(w, `.B yostar-wallpaper`)
+	fmt.Fprintln(w, `[\fIglobal flags\fR] \fIcommand\fR [\fIflags\fR]`)
+	fmt.Fprintln(w, ".SH OPTIONS")
+	fmt.Fprintln(w, "These flags are given before the command.")
+	writeManFlags(w, new(globalOptions).register(flag.NewFlagSet(globalSection, flag.ContinueOnError)))
+
+	fmt.Fprintln(w, ".SH COMMANDS")
+	for _, cmd := range commands {
+		synopsis, text, examples := commandHelp(cmd.name)
+		fmt.Fprintf(w, ".SS %s\n", manEscape(cmd.name))
+		fmt.Fprintf(w, ".B %s\n", manEscape(synopsis))
+		fmt.Fprintln(w, ".PP")
+		if text == "" {
+			text = cmd.usage + "."
+		}
+		fmt.Fprintln(w, strings.ReplaceAll(manEscape(text), "\n\n", "\n.PP\n"))
+		writeManFlags(w, commandFlags(cmd))
+		if examples != "" {
+			fmt.Fprintln(w, ".PP\nExamples:\n.nf\n.RS")
+			fmt.Fprint(w, manEscape(examples))
+			fmt.Fprintln(w, ".RE\n.fi")
+		}
+	}
+
+	fmt.Fprintln(w, ".SH TOPICS")
+	for _, topic := range helpTopics() {
+		text, _ := topicHelp(topic)
+		summary, body, _ := strings.Cut(text, "\n")
+		fmt.Fprintf(w, ".SS %s\n", manEscape(topic))
+		fmt.Fprintln(w, manEscape(summary)+".")
+		fmt.Fprintln(w, ".nf")
+		fmt.Fprint(w, manEscape(body))
+		fmt.Fprintln(w, ".fi")
+	}
+
+	fmt.Fprintln(w, ".SH ENVIRONMENT")
+	fmt.Fprintln(w, ".TP\n.B YOSTAR_DB\nDatabase of the library, yostar-gallery.db in the current folder by default.")
+	fmt.Fprintln(w, ".TP\n.B YOSTAR_CONFIG\nConfiguration file, yostar.conf next to the database by default.")
+	fmt.Fprintln(w, `.TP`+"\n"+`.B YOSTAR_*`+"\n"+manEscape(`Options, e.g. YOSTAR_DNS or YOSTAR_SERVE_ADDR; see the configuration topic.`))
+	return nil
+}
+
+// writeManFlags writes the flags of fs as a list of the manual page
+func writeManFlags(w io.Writer, fs *flag.FlagSet) {
+	fs.VisitAll(func(f *flag.Flag) {
+		name := `\fB\-\-` + manEscape(f.Name) + `\fR`
+		if f.DefValue != "" && f.DefValue != "false" && f.DefValue != "0" && f.DefValue != "0s" {
+			name += "=" + manEscape(f.DefValue)
+		}
+		fmt.Fprintf(w, ".TP\n%s\n%s\n", name, manEscape(f.Usage))
+	})
+}
+
+// manEscape escapes text for troff: backslashes, dashes and lines starting with
+// a control character
+func manEscape(s string) string {
+	s = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			lines[i] = `\&` + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
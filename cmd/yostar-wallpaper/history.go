@@ -0,0 +1,93 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// auditActions are the actions serve records in the audit trail, with queue for all
+// the changes to the download queue
+var auditActions = []string{"download", "queue", "queue.pause", "queue.resume", "queue.low-power-on", "queue.low-power-off", "queue.pause-item", "queue.resume-item", "queue.remove", "queue.retry", "queue.priority"}
+
+// historyFlags are the flags of history
+type historyFlags struct {
+	audit  bool
+	since  string
+	limit  int
+	source string
+	action string
+}
+
+// register adds the flags of history to the flag set
+func (o *historyFlags) register(fs *flag.FlagSet) {
+	fs.BoolVar(&o.audit, "audit", false, "List the actions taken through serve instead, with the address they came from.")
+	fs.StringVar(&o.since, "since", "", "Only downloads or actions on or after this date (YYYY-MM-DD).")
+	fs.IntVar(&o.limit, "limit", 50, "Most entries listed, newest first; 0 lists all.")
+	fs.StringVar(&o.source, "source", "", "Only the actions from this address, with --audit.")
+	fs.StringVar(&o.action, "action", "", "Only these actions, e.g. download or queue, with --audit.")
+}
+
+// runHistory prints the latest downloads of the library, or the actions taken through
+// the web UI with --audit
+func runHistory(db *sql.DB, args []string) error {
+	var o historyFlags
+	fs := newFlagSet("history", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	var from time.Time
+	if o.since != "" {
+		var err error
+		if from, err = time.ParseInLocation(dateLayout, o.since, time.Local); err != nil {
+			return fmt.Errorf("invalid --since: %w", err)
+		}
+	}
+	if !o.audit {
+		if o.source != "" || o.action != "" {
+			return fmt.Errorf("--source and --action filter the actions of --audit")
+		}
+		history, err := ys.DownloadHistory(db, from, o.limit)
+		if err != nil {
+			return fmt.Errorf("failed to read the download history: %w", err)
+		}
+		return printDownloads(history)
+	}
+
+	entries, err := ys.ListAudit(db, ys.AuditFilter{Since: from, Source: o.source, Action: o.action, Limit: o.limit})
+	if err != nil {
+		return fmt.Errorf("failed to read the audit trail: %w", err)
+	}
+	return printAudit(entries)
+}
+
+// printDownloads prints the download history as a table
+func printDownloads(history []ys.Download) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DOWNLOADED\tGAME\tID\tTYPE\tNAME\tSIZE\tPATH")
+	for _, d := range history {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", d.At.Local().Format("2006-01-02 15:04"), d.Item.Game, d.Item.IdGallery,
+			d.Item.Type, d.Item.FileName, ys.FormatBytes(d.Item.Size), d.Item.Path)
+	}
+	return w.Flush()
+}
+
+// printAudit prints the entries of the audit trail as a table
+func printAudit(entries []ys.AuditEntry) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tSOURCE\tACTION\tTARGET\tRESULT")
+	for _, e := range entries {
+		result := "ok"
+		if e.Error != "" {
+			result = "failed: " + e.Error
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.At.Local().Format("2006-01-02 15:04:05"), e.Source, e.Action, e.Target, result)
+	}
+	return w.Flush()
+}
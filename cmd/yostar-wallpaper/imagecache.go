@@ -0,0 +1,61 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+// imageCache keeps the resized images served by the web UI in memory, dropping the
+// least recently used ones beyond max bytes
+type imageCache struct {
+	mu      sync.Mutex
+	max     int64
+	size    int64
+	order   *list.List // of *cachedImage, most recently used first
+	entries map[string]*list.Element
+}
+
+// cachedImage is an entry of an imageCache
+type cachedImage struct {
+	key  string
+	data []byte
+}
+
+func newImageCache(max int64) *imageCache {
+	return &imageCache{max: max, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// get returns the image cached under key
+func (c *imageCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*cachedImage).data, true
+}
+
+// add caches an image under key, unless larger than the whole cache
+func (c *imageCache) add(key string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if int64(len(data)) > c.max {
+		return
+	}
+	if e, ok := c.entries[key]; ok {
+		c.size -= int64(len(e.Value.(*cachedImage).data))
+		c.order.Remove(e)
+	}
+	c.entries[key] = c.order.PushFront(&cachedImage{key: key, data: data})
+	c.size += int64(len(data))
+
+	for c.size > c.max {
+		e := c.order.Back()
+		img := e.Value.(*cachedImage)
+		c.order.Remove(e)
+		delete(c.entries, img.key)
+		c.size -= int64(len(img.data))
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// listFlags are the flags of list
+type listFlags struct {
+	filterFlags
+	dead bool
+}
+
+// register adds the flags of list to the flag set
+func (o *listFlags) register(fs *flag.FlagSet) {
+	o.filterFlags.register(fs)
+	fs.BoolVar(&o.dead, "dead", false, "List the image URLs marked dead instead, of --game when given.")
+}
+
+// runList prints the wallpapers of the library matching the filter flags, or the dead links
+func runList(db *sql.DB, args []string) error {
+	var o listFlags
+	fs := newFlagSet("list", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if o.dead {
+		links, err := ys.ListDeadLinks(db, o.game)
+		if err != nil {
+			return err
+		}
+		return printDeadLinks(links)
+	}
+
+	filter, err := o.filter()
+	if err != nil {
+		return err
+	}
+
+	items, err := ys.FindGalleryItems(db, filter)
+	if err != nil {
+		return fmt.Errorf("failed to query wallpapers: %w", err)
+	}
+	return printItems(items)
+}
+
+// printItems prints wallpapers as a table
+func printItems(items []ys.GalleryItem) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "GAME\tID\tTYPE\tNAME\tSIZE\tCOLOR\tPATH")
+	for _, item := range items {
+		size := ""
+		if item.Width > 0 {
+			size = fmt.Sprintf("%dx%d", item.Width, item.Height)
+		}
+		path := item.Path
+		if item.Cataloged {
+			path = "(not downloaded)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", item.Game, item.IdGallery, item.Type, item.FileName, size, item.Color, path)
+	}
+	return w.Flush()
+}
+
+// printDeadLinks prints dead links as a table
+func printDeadLinks(links []ys.DeadLink) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "GAME\tID\tTYPE\tNAME\tSTATUS\tATTEMPTS\tLAST SEEN\tURL")
+	for _, l := range links {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\n", l.Game, l.IdGallery, l.Type, l.FileName, l.Status, l.Attempts,
+			l.LastSeen.Local().Format("2006-01-02 15:04"), l.URL)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// localeFlags are the flags of locale
+type localeFlags struct {
+	set   string
+	reset bool
+}
+
+// register adds the flags of locale to the flag set
+func (o *localeFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.set, "set", "", "Locale to show titles and name new files in, e.g. ja.")
+	fs.BoolVar(&o.reset, "reset", false, "Go back to the default title of each API.")
+}
+
+// runLocale prints the preferred locale of titles, or sets it
+func runLocale(db *sql.DB, args []string) error {
+	var o localeFlags
+	fs := newFlagSet("locale", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	switch {
+	case o.reset:
+		return ys.SetPreferredLocale(db, "")
+	case o.set != "":
+		return ys.SetPreferredLocale(db, o.set)
+	}
+
+	locale, err := ys.PreferredLocale(db)
+	if err != nil {
+		return err
+	}
+	if locale == "" {
+		locale = "(default)"
+	}
+	fmt.Println(locale)
+	return nil
+}
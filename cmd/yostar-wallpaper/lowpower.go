@@ -0,0 +1,67 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// lowPowerFlags are the flags of low-power
+type lowPowerFlags struct {
+	rate    int64
+	maxSize int64
+}
+
+// register adds the flags of low-power to the flag set
+func (o *lowPowerFlags) register(fs *flag.FlagSet) {
+	fs.Int64Var(&o.rate, "rate", -1, "Kilobytes per second all the downloads of a process share in low-power mode, 0 for no limit.")
+	fs.Int64Var(&o.maxSize, "max-size", -1, "Megabytes over which files are deferred until low-power mode is off, 0 for no limit.")
+}
+
+// runLowPower prints the low-power mode of the downloads, or turns it on or off
+func runLowPower(db *sql.DB, args []string) error {
+	var o lowPowerFlags
+	fs := newFlagSet("low-power", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	// flags are also accepted after on and off
+	arg := fs.Arg(0)
+	if arg != "" {
+		fs.Parse(fs.Args()[1:])
+	}
+
+	lp, err := ys.GetLowPower(db)
+	if err != nil {
+		return err
+	}
+	switch arg {
+	case "on":
+		lp.On = true
+	case "off":
+		lp.On = false
+	case "":
+	default:
+		return fmt.Errorf("on or off expected, not %q", arg)
+	}
+	if o.rate >= 0 {
+		lp.RateLimit = o.rate << 10
+	}
+	if o.maxSize >= 0 {
+		lp.MaxSize = o.maxSize << 20
+	}
+	if arg != "" || o.rate >= 0 || o.maxSize >= 0 {
+		if err := ys.SetLowPower(db, lp); err != nil {
+			return err
+		}
+	}
+
+	if lp.On {
+		fmt.Printf("Low-power mode on: %s\n", lp)
+	} else {
+		fmt.Printf("Low-power mode off, when on: %s\n", lp)
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// command is a subcommand of yostar-wallpaper
+type command struct {
+	name  string
+	usage string
+	flags func(fs *flag.FlagSet) // adds the flags of the command, nil when it has none
+	run   func(db *sql.DB, args []string) error
+	noDB  bool // runs without opening the database
+}
+
+var commands = []command{
+	{name: "list", usage: "List the wallpapers of the library", flags: new(listFlags).register, run: runList},
+	{name: "search", usage: "Search wallpapers by title, description, artist and tags", flags: new(searchFlags).register, run: runSearch},
+	{name: "stats", usage: "Show the totals of the library and their growth since the last run", flags: new(statsFlags).register, run: runStats},
+	{name: "du", usage: "Show the disk usage of the library by game and type, and its largest files", flags: new(duFlags).register, run: runDu},
+	{name: "download", usage: "Download cataloged wallpapers matching filters", flags: new(downloadFlags).register, run: runDownload},
+	{name: "redownload", usage: "Download wallpapers matching filters again, keeping the replaced files as revisions", flags: new(redownloadFlags).register, run: runRedownload},
+	{name: "analyze", usage: "Compute the dominant color and brightness of wallpapers", flags: new(analyzeFlags).register, run: runAnalyze},
+	{name: "tag", usage: "Tag wallpapers with an external tagger or by hand", flags: new(tagFlags).register, run: runTag},
+	{name: "ocr", usage: "Recognize the text printed on wallpapers", flags: new(ocrFlags).register, run: runOCR},
+	{name: "adopt", usage: "Register an existing folder of wallpapers with the library", flags: new(adoptFlags).register, run: runAdopt},
+	{name: "games", usage: "Show or change the region and API endpoint of each game", flags: new(gamesFlags).register, run: runGames},
+	{name: "locale", usage: "Show or set the preferred locale of titles", flags: new(localeFlags).register, run: runLocale},
+	{name: "artists", usage: "List the artists of the library or rename one", flags: new(artistsFlags).register, run: runArtists},
+	{name: "revisions", usage: "List the archived revisions of a wallpaper", flags: new(wallpaperFlags).register, run: runRevisions},
+	{name: "revert", usage: "Restore an archived revision of a wallpaper", flags: new(revertFlags).register, run: runRevert},
+	{name: "collection", usage: "Manage named collections of wallpapers and export them into folders", flags: new(collectionFlags).register, run: runCollection},
+	{name: "rotation", usage: "Keep the flat folder of a collection that wallpaper rotators point at", flags: new(rotationFlags).register, run: runRotation},
+	{name: "convert", usage: "Convert wallpapers into another format, e.g. HEIC for iCloud Drive", flags: new(convertFlags).register, run: runConvert},
+	{name: "bundle", usage: "Package a filtered subset of the library into an archive", flags: new(bundleFlags).register, run: runBundle},
+	{name: "checksums", usage: "Write SHA256SUMS or SFV manifests into the folder of each game", flags: new(checksumsFlags).register, run: runChecksums},
+	{name: "report", usage: "Write a Markdown or HTML report of the wallpapers published in a month", flags: new(reportFlags).register, run: runReport},
+	{name: "snapshots", usage: "List or extract the archived API responses", flags: new(snapshotsFlags).register, run: runSnapshots},
+	{name: "history", usage: "List the latest downloads, or the actions taken through serve", flags: new(historyFlags).register, run: runHistory},
+	{name: "provenance", usage: "Trace the file of a wallpaper back to the API response that listed it", flags: new(provenanceFlags).register, run: runProvenance},
+	{name: "maintain", usage: "Vacuum the database, refresh thumbnails and verify files", flags: new(maintainFlags).register, run: runMaintain},
+	{name: "verify", usage: "Hash the files of the library in parallel and report those that changed", flags: new(verifyFlags).register, run: runVerify},
+	{name: "remap", usage: "Merge entries downloaded again after their API renumbered them", flags: new(remapFlags).register, run: runRemap},
+	{name: "relocate", usage: "Move the files of the library to a new root and rewrite their paths", flags: new(relocateFlags).register, run: runRelocate},
+	{name: "root", usage: "Show or set the folder the paths of the library are relative to", flags: new(rootFlags).register, run: runRoot},
+	{name: "backup", usage: "Write the database and thumbnails into a backup archive", flags: new(backupFlags).register, run: runBackup},
+	{name: "restore", usage: "Restore the library from a backup archive", flags: new(restoreFlags).register, run: runRestore},
+	{name: "mirror", usage: "Copy the wallpapers missing or changed from another library", flags: new(mirrorFlags).register, run: runMirror},
+	{name: "quarantine", usage: "List the downloads kept out of the library as suspicious, delete or retry them", flags: new(quarantineFlags).register, run: runQuarantine},
+	{name: "skip", usage: "List, add or remove the items never queued, by ID or title pattern", flags: new(skipFlags).register, run: runSkip},
+	{name: "low-power", usage: "Show or toggle the low-power mode of the downloads", flags: new(lowPowerFlags).register, run: runLowPower},
+	{name: "serve", usage: "Serve the web UI of the library", flags: new(serveFlags).register, run: runServe},
+	{name: "service", usage: "Install serve as a Windows service or a macOS launch agent, or control it", flags: new(serviceFlags).register, run: runServiceCommand, noDB: true},
+	{name: "azurlane", usage: "Download the Azur Lane wallpapers missing from the library", flags: crawlerFlags(crawlers["azurlane"]), run: crawlerCommand(crawlers["azurlane"]), noDB: true},
+	{name: "arknight", usage: "Download the Arknights wallpapers missing from the library", flags: crawlerFlags(crawlers["arknight"]), run: crawlerCommand(crawlers["arknight"]), noDB: true},
+	{name: "majhongsoul", usage: "Download the Mahjong Soul wallpapers missing from the library", flags: crawlerFlags(crawlers["majhongsoul"]), run: crawlerCommand(crawlers["majhongsoul"]), noDB: true},
+	{name: "aethergazer", usage: "Download the Aether Gazer wallpapers missing from the library", flags: crawlerFlags(crawlers["aethergazer"]), run: crawlerCommand(crawlers["aethergazer"]), noDB: true},
+	{name: "status", usage: "Check the API of each game at once and compare it with the library", flags: new(statusFlags).register, run: runStatus},
+	{name: "sync", usage: "Run the crawlers of the games one after the other", flags: new(syncFlags).register, run: runSync, noDB: true},
+	{name: "completion", usage: "Print the shell completion script of bash, zsh, fish or powershell", run: runCompletion, noDB: true},
+}
+
+// globalOptions are the flags given before the command
+type globalOptions struct {
+	noHTTP2 bool
+	ipv4    bool
+	dns     string
+	bind    string
+
+	fileMode string
+	dirMode  string
+	owner    string
+	group    string
+	nameForm string
+}
+
+// register adds the global flags to the flag set
+func (o *globalOptions) register(fs *flag.FlagSet) *flag.FlagSet {
+	fs.BoolVar(&o.noHTTP2, "no-http2", false, "Talk HTTP/1.1 only, for networks where the CDN misbehaves over HTTP/2.")
+	fs.BoolVar(&o.ipv4, "ipv4", false, "Connect over IPv4 only, for networks with broken IPv6 routes.")
+	fs.StringVar(&o.dns, "dns", "", "DNS server resolving the API and CDN hosts, e.g. 1.1.1.1, or a DNS-over-HTTPS URL such as https://cloudflare-dns.com/dns-query.")
+	fs.StringVar(&o.bind, "bind", "", "Local IP address or network interface, e.g. tun0 of a VPN, to connect from.")
+	fs.StringVar(&o.fileMode, "file-mode", "", "Octal mode of the files written into the library, e.g. 0644, instead of the umask default.")
+	fs.StringVar(&o.dirMode, "dir-mode", "", "Octal mode of the folders created in the library, e.g. 0755, instead of the umask default.")
+	fs.StringVar(&o.owner, "owner", "", "User owning the files and folders written into the library, by name or ID (Unix only).")
+	fs.StringVar(&o.group, "group", "", "Group owning the files and folders written into the library, by name or ID (Unix only).")
+	fs.StringVar(&o.nameForm, "name-form", ys.NameFormNFC, "Unicode normalization of new file names (nfc, nfd as written by macOS, none), so that synced libraries agree.")
+	return fs
+}
+
+func main() {
+	// Ctrl+C stops the commands that can once their running work is done, twice right away
+	ys.HandleInterrupts()
+	flag.Usage = usage
+	var global globalOptions
+	global.register(flag.CommandLine)
+
+	// the whole configuration is checked, except for config check to report it
+	c, configErr := ys.LoadConfig()
+	if c != nil {
+		config = c
+		configErr = errors.Join(configErr, config.Check(configTargets()))
+		if configErr == nil {
+			configErr = config.Apply(globalSection, ys.ConfigTarget{Flags: flag.CommandLine})
+		}
+	}
+	flag.Parse()
+	// completions are printed whatever the state of the configuration
+	if flag.Arg(0) == completeCommand {
+		complete(os.Stdout, flag.Args()[1:])
+		return
+	}
+	if configErr != nil && flag.Arg(0) != "config" {
+		log.Fatalf("Invalid configuration:\n%v", configErr)
+	}
+	if err := ys.CheckDNSServer(global.dns); err != nil {
+		log.Fatalf("Invalid --dns: %v", err)
+	}
+	if err := ys.CheckBind(global.bind, global.ipv4); err != nil {
+		log.Fatalf("Invalid --bind: %v", err)
+	}
+	ys.SetNetworkOptions(ys.NetworkOptions{DisableHTTP2: global.noHTTP2, ForceIPv4: global.ipv4, DNS: global.dns, Bind: global.bind})
+	fileMode, err := ys.ParseFileMode(global.fileMode)
+	if err != nil {
+		log.Fatalf("Invalid --file-mode: %v", err)
+	}
+	dirMode, err := ys.ParseFileMode(global.dirMode)
+	if err != nil {
+		log.Fatalf("Invalid --dir-mode: %v", err)
+	}
+	if err := ys.SetFileOptions(ys.FileOptions{FileMode: fileMode, DirMode: dirMode, Owner: global.owner, Group: global.group}); err != nil {
+		log.Fatalf("Invalid --owner or --group: %v", err)
+	}
+	if err := ys.SetNameForm(global.nameForm); err != nil {
+		log.Fatalf("Invalid --name-form: %v", err)
+	}
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	name := flag.Arg(0)
+	// crawlers can also be run by alias or game, e.g. arknights or mahjong_soul
+	if crawler, ok := crawlerOf(name); ok {
+		name = crawler
+	}
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+
+		if cmd.noDB {
+			if err := cmd.run(nil, flag.Args()[1:]); err != nil {
+				exitWith(name, err)
+			}
+			return
+		}
+
+		db, err := ys.OpenDB()
+		if err != nil {
+			log.Fatalf("Failed to open database: %v", err)
+		}
+		err = cmd.run(db, flag.Args()[1:])
+		if closeErr := ys.CloseDB(db); closeErr != nil {
+			log.Printf("Error closing database: %v", closeErr)
+		}
+		if err != nil {
+			exitWith(name, err)
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	flag.Usage()
+	os.Exit(2)
+}
+
+// exitWith logs the error of the command name and exits, with 130 when it was
+// interrupted by Ctrl+C
+func exitWith(name string, err error) {
+	log.Printf("%s: %v", name, err)
+	if errors.Is(err, ys.ErrInterrupted) {
+		os.Exit(130)
+	}
+	os.Exit(1)
+}
+
+// usage prints the global flags and the list of available subcommands
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintln(w, "Usage: yostar-wallpaper [global flags] <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Global flags, also set in the [yostar-wallpaper] section of the configuration file:")
+	flag.CommandLine.PrintDefaults()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-12s %s\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "yostar-wallpaper help <command>" for the flags and examples of a command, and`)
+	fmt.Fprintln(w, `"yostar-wallpaper help topics" for filters, placeholders, hooks and configuration.`)
+}
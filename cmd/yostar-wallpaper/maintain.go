@@ -0,0 +1,81 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// maintainFlags are the flags of maintain
+type maintainFlags struct {
+	filterFlags
+	sample       int
+	noVacuum     bool
+	noThumbnails bool
+	every        time.Duration
+}
+
+// register adds the flags of maintain to the flag set
+func (o *maintainFlags) register(fs *flag.FlagSet) {
+	o.filterFlags.register(fs)
+	fs.IntVar(&o.sample, "sample", 50, "Number of random files whose checksum is verified, 0 to skip.")
+	fs.BoolVar(&o.noVacuum, "no-vacuum", false, "Do not VACUUM the database.")
+	fs.BoolVar(&o.noThumbnails, "no-thumbnails", false, "Do not regenerate missing thumbnails.")
+	fs.DurationVar(&o.every, "every", 0, "Run the maintenance repeatedly at this interval, e.g. 24h.")
+}
+
+// runMaintain runs the library maintenance once, or every interval with --every, on
+// the wallpapers matching the filter flags
+func runMaintain(db *sql.DB, args []string) error {
+	var o maintainFlags
+	fs := newFlagSet("maintain", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	filter, err := o.filter()
+	if err != nil {
+		return err
+	}
+	opts := ys.MaintenanceOptions{
+		Vacuum:       !o.noVacuum,
+		Thumbnails:   !o.noThumbnails,
+		VerifySample: o.sample,
+		Filter:       filter,
+	}
+
+	if o.every <= 0 {
+		report, err := ys.Maintain(db, opts)
+		printMaintenanceReport(report)
+		return err
+	}
+
+	for {
+		report, err := ys.Maintain(db, opts)
+		if err != nil {
+			log.Printf("Maintenance failed: %v", err)
+		}
+		printMaintenanceReport(report)
+		time.Sleep(o.every)
+	}
+}
+
+// printMaintenanceReport prints the summary of a maintenance run
+func printMaintenanceReport(r ys.MaintenanceReport) {
+	if r.DBSizeBefore > 0 {
+		fmt.Printf("Database: %d -> %d bytes\n", r.DBSizeBefore, r.DBSizeAfter)
+	}
+	fmt.Printf("Thumbnails: %d created, %d failed\n", r.ThumbnailsCreated, r.ThumbnailsFailed)
+	fmt.Printf("Verified: %d files, %d missing, %d corrupt\n", r.Verified, len(r.Missing), len(r.Corrupt))
+	for _, item := range r.Missing {
+		fmt.Printf("  missing  %s/%s/%s  %s\n", item.Game, item.Type, item.IdGallery, item.Path)
+	}
+	for _, item := range r.Corrupt {
+		fmt.Printf("  corrupt  %s/%s/%s  %s\n", item.Game, item.Type, item.IdGallery, item.Path)
+	}
+	fmt.Printf("Done in %s\n", r.Duration.Round(time.Millisecond))
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// mirrorFlags are the flags of mirror
+type mirrorFlags struct {
+	filterFlags
+	path          string
+	remoteCommand string
+	dryRun        bool
+	verify        bool
+	manifest      bool
+}
+
+// register adds the flags of mirror to the flag set
+func (o *mirrorFlags) register(fs *flag.FlagSet) {
+	o.filterFlags.register(fs)
+	fs.StringVar(&o.path, "path", ".", "Folder new wallpapers are saved into, under <game>/<type>.")
+	fs.StringVar(&o.remoteCommand, "remote-command", "yostar-wallpaper", "yostar-wallpaper command of the ssh remote, e.g. \"YOSTAR_DB=/data/yostar-gallery.db yostar-wallpaper\".")
+	fs.BoolVar(&o.dryRun, "dry-run", false, "Only list the wallpapers that would be copied.")
+	fs.BoolVar(&o.verify, "verify", false, "Hash the local files to find corrupt ones, instead of trusting the checksums of the library.")
+	fs.BoolVar(&o.manifest, "manifest", false, "Print the manifest of this library as JSON, as read by the mirror of another machine over ssh.")
+}
+
+// runMirror copies the wallpapers of a remote library missing or changed in this one,
+// or prints the manifest of this library for the mirror of another machine
+func runMirror(db *sql.DB, args []string) error {
+	var o mirrorFlags
+	fs := newFlagSet("mirror", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	filter, err := o.filter()
+	if err != nil {
+		return err
+	}
+
+	if o.manifest {
+		items, err := ys.MirrorManifest(db, filter)
+		if err != nil {
+			return err
+		}
+		return json.NewEncoder(os.Stdout).Encode(items)
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	// Restrict the manifest of the remote by the same filter flags
+	var filterArgs []string
+	var names filterFlags
+	filterSet := flag.NewFlagSet("filter", flag.ContinueOnError)
+	names.register(filterSet)
+	fs.Visit(func(fl *flag.Flag) {
+		if filterSet.Lookup(fl.Name) != nil {
+			filterArgs = append(filterArgs, fmt.Sprintf("--%s=%s", fl.Name, fl.Value))
+		}
+	})
+
+	src, err := ys.NewMirrorSource(fs.Arg(0), o.remoteCommand, filterArgs)
+	if err != nil {
+		return err
+	}
+
+	ctx, release := ys.Graceful()
+	defer release()
+	report, err := ys.Mirror(ctx, db, src, ys.MirrorOptions{Dir: o.path, DryRun: o.dryRun, Verify: o.verify})
+	if err != nil {
+		return err
+	}
+
+	verb := "Copied"
+	if o.dryRun {
+		verb = "Would copy"
+	}
+	fmt.Printf("Checked %d wallpapers: %d up to date. %s %d missing and %d changed (%d from local copies, %d bytes transferred)\n",
+		report.Checked, report.UpToDate, verb, report.Copied, report.Changed, report.Local, report.Bytes)
+	for _, failed := range report.Failed {
+		fmt.Println("Failed:", failed)
+	}
+	if len(report.Failed) > 0 {
+		return fmt.Errorf("%d wallpapers could not be copied", len(report.Failed))
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// ocrFlags are the flags of ocr
+type ocrFlags struct {
+	filterFlags
+	ocrCmd string
+	redo   bool
+}
+
+// register adds the flags of ocr to the flag set
+func (o *ocrFlags) register(fs *flag.FlagSet) {
+	o.filterFlags.register(fs)
+	fs.StringVar(&o.ocrCmd, "ocr", "", "OCR command run on each image, e.g. \"tesseract {file} stdout -l eng+jpn\".")
+	fs.BoolVar(&o.redo, "redo", false, "Recognize wallpapers that already have text again.")
+}
+
+// runOCR recognizes the text of the wallpapers matching the filter flags
+func runOCR(db *sql.DB, args []string) error {
+	var o ocrFlags
+	fs := newFlagSet("ocr", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if o.ocrCmd == "" {
+		return errors.New("--ocr is required")
+	}
+	ocr, err := ys.NewCommandOCR(o.ocrCmd)
+	if err != nil {
+		return fmt.Errorf("invalid --ocr: %w", err)
+	}
+
+	filter, err := o.filter()
+	if err != nil {
+		return err
+	}
+	items, err := ys.FindGalleryItems(db, filter)
+	if err != nil {
+		return fmt.Errorf("failed to query wallpapers: %w", err)
+	}
+
+	var recognized int
+	for _, item := range items {
+		if item.Path == "" {
+			continue
+		}
+		if !o.redo {
+			text, err := ys.GetOCRText(db, item.ID)
+			if err != nil {
+				return err
+			}
+			if text != "" {
+				continue
+			}
+		}
+
+		text, err := ys.RecognizeGalleryItem(context.Background(), db, ocr, item)
+		if err != nil {
+			log.Printf("Error recognizing text of %s: %v", item.FileName, err)
+			continue
+		}
+		log.Printf(`-> "%s": %q <-`, item.FileName, text)
+		recognized++
+	}
+	fmt.Printf("Recognized text of %d wallpapers\n", recognized)
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// provenanceFlags are the flags of provenance
+type provenanceFlags struct {
+	wallpaperFlags
+	format string
+}
+
+// register adds the flags of provenance to the flag set
+func (o *provenanceFlags) register(fs *flag.FlagSet) {
+	o.wallpaperFlags.register(fs)
+	fs.StringVar(&o.format, "format", "text", "Output format (text, json).")
+}
+
+// runProvenance shows the chain of checksums tracing the file of a wallpaper back
+// to the API response that listed it
+func runProvenance(db *sql.DB, args []string) error {
+	var o provenanceFlags
+	fs := newFlagSet("provenance", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if err := o.validate(); err != nil {
+		return err
+	}
+	item, err := ys.GetGalleryItem(db, o.game, o.region, o.id, o.typ)
+	if err != nil {
+		return fmt.Errorf("failed to look up wallpaper: %w", err)
+	}
+	p, err := ys.GetProvenance(db, item)
+	if err != nil {
+		return fmt.Errorf("failed to look up provenance: %w", err)
+	}
+
+	switch o.format {
+	case "text":
+		printProvenance(p)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(p)
+	default:
+		return fmt.Errorf("unknown format %q", o.format)
+	}
+	return nil
+}
+
+// printProvenance prints the provenance of a file, from the file to the API
+func printProvenance(p ys.Provenance) {
+	fmt.Printf("file        %s\n", p.Path)
+	fmt.Printf("sha256      %s (%s)\n", p.SHA256, ys.FormatBytes(p.Size))
+	if p.DownloadedAt == nil {
+		fmt.Println("downloaded  never, cataloged or adopted")
+	} else {
+		fmt.Printf("downloaded  %s\n", p.DownloadedAt.UTC().Format("2006-01-02 15:04:05Z"))
+	}
+	fmt.Printf("from        %s\n", p.URL)
+	if p.SourceURL != "" {
+		fmt.Printf("alternate   %s\n", p.SourceURL)
+	}
+	if p.ResolvedURL != "" && p.ResolvedURL != ys.NormalizeURL(p.URL) {
+		fmt.Printf("resolved    %s\n", p.ResolvedURL)
+	}
+	if p.Run == "" {
+		fmt.Println("listed by   unknown, downloaded before the API responses were recorded")
+		return
+	}
+	fmt.Printf("listed by   run %s\n", p.Run)
+	for _, r := range p.Responses {
+		archived := ""
+		if r.SnapshotID > 0 {
+			archived = fmt.Sprintf(", snapshot %d", r.SnapshotID)
+		}
+		fmt.Printf("  %s  %s  %d, %s%s\n    %s\n", r.SHA256, r.FetchedAt.UTC().Format("2006-01-02 15:04:05Z"), r.Status, ys.FormatBytes(int64(r.Size)), archived, r.URL)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// quarantineFlags are the flags of quarantine
+type quarantineFlags struct {
+	game string
+}
+
+// register adds the flags of quarantine to the flag set
+func (o *quarantineFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.game, "game", "", "Only quarantined files of this game.")
+}
+
+// runQuarantine lists the downloads kept out of the library as they failed the
+// checks of the images, deletes them, or queues their download again
+func runQuarantine(db *sql.DB, args []string) error {
+	var o quarantineFlags
+	fs := newFlagSet("quarantine", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	action := fs.Arg(0)
+	switch action {
+	case "", "list":
+		list, err := ys.ListQuarantined(db, o.game)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tAT\tGAME\tWALLPAPER\tTYPE\tREASON\tPATH")
+		for _, q := range list {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", q.ID, q.At.Local().Format("2006-01-02 15:04"), q.Game, q.IdGallery, q.Type, q.Reason, q.Path)
+		}
+		return w.Flush()
+	case "delete", "retry":
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown action %q, list, delete or retry expected", action)
+	}
+
+	if fs.NArg() < 2 {
+		return errors.New("IDs of quarantined files, or all, expected")
+	}
+	var ids []int64
+	if fs.Arg(1) == "all" {
+		list, err := ys.ListQuarantined(db, o.game)
+		if err != nil {
+			return err
+		}
+		for _, q := range list {
+			ids = append(ids, q.ID)
+		}
+	} else {
+		for _, arg := range fs.Args()[1:] {
+			id, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid ID %q", arg)
+			}
+			ids = append(ids, id)
+		}
+	}
+
+	var errs []error
+	done := 0
+	for _, id := range ids {
+		var err error
+		if action == "delete" {
+			err = ys.DeleteQuarantined(db, id)
+		} else {
+			err = ys.RetryQuarantined(db, id)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		done++
+	}
+	if action == "delete" {
+		fmt.Printf("Deleted %d quarantined files\n", done)
+	} else {
+		fmt.Printf("Queued %d quarantined files again\n", done)
+	}
+	return errors.Join(errs...)
+}
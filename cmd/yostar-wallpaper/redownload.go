@@ -0,0 +1,101 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// redownloadFlags are the flags of redownload
+type redownloadFlags struct {
+	filterFlags
+	dedupe string
+	all    bool
+	dryRun bool
+}
+
+// register adds the flags of redownload to the flag set
+func (o *redownloadFlags) register(fs *flag.FlagSet) {
+	o.filterFlags.register(fs)
+	fs.StringVar(&o.dedupe, "dedupe", ys.DedupeLink, "What to do with downloads identical to a file already in the library (off, link, skip).")
+	fs.BoolVar(&o.all, "all", false, "Download the whole library again when no filter is given.")
+	fs.BoolVar(&o.dryRun, "dry-run", false, "Only list the wallpapers that would be downloaded again.")
+}
+
+// runRedownload downloads the wallpapers matching the filter flags again, replacing
+// the files that changed and keeping the replaced ones as revisions
+func runRedownload(db *sql.DB, args []string) error {
+	var o redownloadFlags
+	fs := newFlagSet("redownload", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if err := ys.CheckDedupeMode(o.dedupe); err != nil {
+		return err
+	}
+	filtered := false
+	fs.Visit(func(fl *flag.Flag) {
+		if fl.Name != "dedupe" && fl.Name != "all" && fl.Name != "dry-run" {
+			filtered = true
+		}
+	})
+	if !filtered && !o.all {
+		return errors.New("no filter given, pass --all to download the whole library again")
+	}
+	filter, err := o.filter()
+	if err != nil {
+		return err
+	}
+
+	items, err := ys.FindGalleryItems(db, filter)
+	if err != nil {
+		return fmt.Errorf("failed to query wallpapers: %w", err)
+	}
+
+	// Ctrl+C stops once the running download is done
+	ctx, release := ys.Graceful()
+	defer release()
+	var replaced, unchanged, failed int
+	for _, item := range items {
+		if ctx.Err() != nil {
+			fmt.Printf("Interrupted after %d wallpapers replaced, %d unchanged, %d failed\n", replaced, unchanged, failed)
+			return ys.ErrInterrupted
+		}
+		if item.Cataloged || item.Path == "" || item.URL == "" {
+			continue
+		}
+		if o.dryRun {
+			fmt.Printf("%s/%s/%s  %s\n", item.Game, item.Type, item.IdGallery, item.FileName)
+			continue
+		}
+
+		changed, err := ys.RedownloadGalleryItem(db, &item, o.dedupe)
+		switch {
+		case err != nil:
+			log.Printf("Error downloading %s again: %v", item.FileName, err)
+			failed++
+		case changed:
+			log.Printf(`-> "%s" replaced, the previous file kept as a revision <-`, item.FileName)
+			replaced++
+		default:
+			unchanged++
+		}
+	}
+	if o.dryRun {
+		return nil
+	}
+
+	// the replaced files get their thumbnails again
+	if replaced > 0 {
+		if _, _, err := ys.EnsureThumbnails(db, filter); err != nil {
+			log.Printf("Error creating thumbnails: %v", err)
+		}
+	}
+	fmt.Printf("Replaced %d wallpapers, %d unchanged, %d failed\n", replaced, unchanged, failed)
+	return nil
+}
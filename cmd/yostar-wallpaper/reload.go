@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// configWatchInterval is how often serve checks whether the configuration file changed
+const configWatchInterval = 5 * time.Second
+
+// reloadedOptions are the options of serve applied as soon as the configuration file
+// changes; the others take effect when serve restarts. Those of sync are read at
+// each --sync-every.
+var reloadedOptions = []string{"workers", "min-workers", "max-workers", "maintain-every", "sync-every",
+	"quiet-hours", "unmetered-only", "metered-interfaces"}
+
+// liveConfig is the configuration of a running serve: the options of serve and of
+// the syncs it runs, loaded again whenever the configuration file changes
+type liveConfig struct {
+	args []string // command line of serve, taking precedence over the file
+
+	mu    sync.Mutex
+	serve *flag.FlagSet
+	sync  *flag.FlagSet
+}
+
+// newLiveConfig returns the configuration of serve started with args
+func newLiveConfig(args []string) (*liveConfig, error) {
+	l := &liveConfig{args: args}
+	var err error
+	l.serve, l.sync, err = l.load(config)
+	return l, err
+}
+
+// load returns the options of serve and sync set by the configuration c
+func (l *liveConfig) load(c *ys.Config) (serve, syncSet *flag.FlagSet, err error) {
+	if serve, err = configuredFlags(command{name: "serve", flags: new(serveFlags).register, run: runServe}, c, l.args); err != nil {
+		return nil, nil, err
+	}
+	if _, err := downloadWindow(serve); err != nil {
+		return nil, nil, err
+	}
+	if syncSet, err = configuredFlags(command{name: "sync", flags: new(syncFlags).register, run: runSync}, c, nil); err != nil {
+		return nil, nil, err
+	}
+	if _, err := l.crawlersOf(syncSet); err != nil {
+		return nil, nil, err
+	}
+	return serve, syncSet, nil
+}
+
+// configuredFlags returns the flags of cmd set by the configuration c, then args
+func configuredFlags(cmd command, c *ys.Config, args []string) (*flag.FlagSet, error) {
+	fs := commandFlags(cmd)
+	fs.Init(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if err := c.Apply(cmd.name, ys.ConfigTarget{Flags: fs}); err != nil {
+		return nil, err
+	}
+	return fs, fs.Parse(args)
+}
+
+// crawlers returns the crawlers a sync runs, in order
+func (l *liveConfig) crawlers() ([]string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.crawlersOf(l.sync)
+}
+
+func (l *liveConfig) crawlersOf(fs *flag.FlagSet) ([]string, error) {
+	return syncCrawlers(flagValue[string](fs, "order"), flagValue[string](fs, "only"), flagValue[string](fs, "skip"))
+}
+
+// watch loads the configuration file again whenever it changes, checking it every
+// interval until ctx is done. It logs the options that changed, then calls apply with
+// those of serve when one of reloadedOptions did. An invalid file is reported and
+// left out until it changes again.
+func (l *liveConfig) watch(ctx context.Context, interval time.Duration, apply func(serve *flag.FlagSet)) {
+	path := ys.ConfigPath()
+	last := configStamp(path)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		stamp := configStamp(path)
+		if stamp == last {
+			continue
+		}
+		last = stamp
+
+		c, err := ys.LoadConfig()
+		var serve, syncSet *flag.FlagSet
+		if err == nil {
+			serve, syncSet, err = l.load(c)
+		}
+		if err != nil {
+			log.Printf("Configuration not reloaded, %s is invalid:\n%v", path, err)
+			continue
+		}
+
+		l.mu.Lock()
+		reload := logChanges(l.serve, serve, reloadedOptions)
+		logChanges(l.sync, syncSet, nil)
+		l.serve, l.sync = serve, syncSet
+		l.mu.Unlock()
+		if reload {
+			apply(serve)
+		}
+	}
+}
+
+// logChanges logs the flags with a different value in after than in before, and
+// reports whether one of reloaded did. The others are logged as applied at restart,
+// unless reloaded is nil.
+func logChanges(before, after *flag.FlagSet, reloaded []string) bool {
+	changed := false
+	after.VisitAll(func(f *flag.Flag) {
+		old := before.Lookup(f.Name).Value.String()
+		if old == f.Value.String() {
+			return
+		}
+		note := ""
+		switch {
+		case reloaded == nil:
+		case contains(reloaded, f.Name):
+			changed = true
+		default:
+			note = ", applied when serve restarts"
+		}
+		log.Printf("Configuration: %s %s %q -> %q%s", after.Name(), f.Name, old, f.Value, note)
+	})
+	return changed
+}
+
+// fileStamp identifies a version of a file
+type fileStamp struct {
+	mod  time.Time
+	size int64
+}
+
+// configStamp returns the version of the configuration file at path, zero when it
+// is missing
+func configStamp(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{info.ModTime(), info.Size()}
+}
+
+// flagValue returns the value of the flag name of fs
+func flagValue[T any](fs *flag.FlagSet, name string) T {
+	return fs.Lookup(name).Value.(flag.Getter).Get().(T)
+}
+
+// schedule runs a task at an interval that can change while it runs, never while it
+// is 0. A run is never started before the previous one returned.
+type schedule struct {
+	run func()
+
+	mu       sync.Mutex
+	interval time.Duration
+	changed  chan struct{}
+}
+
+// newSchedule starts running run every interval until ctx is done
+func newSchedule(ctx context.Context, interval time.Duration, run func()) *schedule {
+	s := &schedule{run: run, interval: interval, changed: make(chan struct{}, 1)}
+	go s.loop(ctx)
+	return s
+}
+
+// set changes the interval of the schedule, counted from now
+func (s *schedule) set(interval time.Duration) {
+	s.mu.Lock()
+	s.interval = interval
+	s.mu.Unlock()
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (s *schedule) loop(ctx context.Context) {
+	var ticker *time.Ticker
+	var tick <-chan time.Time
+	reset := func() {
+		if ticker != nil {
+			ticker.Stop()
+			ticker, tick = nil, nil
+		}
+		s.mu.Lock()
+		interval := s.interval
+		s.mu.Unlock()
+		if interval > 0 {
+			ticker = time.NewTicker(interval)
+			tick = ticker.C
+		}
+	}
+	reset()
+	defer func() {
+		if ticker != nil {
+			ticker.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.changed:
+			reset()
+		case <-tick:
+			s.run()
+		}
+	}
+}
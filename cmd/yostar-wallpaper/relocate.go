@@ -0,0 +1,61 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// relocateFlags are the flags of relocate
+type relocateFlags struct {
+	to     string
+	from   string
+	dryRun bool
+}
+
+// register adds the flags of relocate to the flag set
+func (o *relocateFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.to, "to", "", "New root folder of the library.")
+	fs.StringVar(&o.from, "from", "", "Current root folder of the library, by default the folder containing every file. Give it to resume an interrupted run.")
+	fs.BoolVar(&o.dryRun, "dry-run", false, "Only count the files that would be moved.")
+}
+
+// runRelocate moves the files of the library to a new root
+func runRelocate(db *sql.DB, args []string) error {
+	var o relocateFlags
+	fs := newFlagSet("relocate", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if o.to == "" {
+		return fmt.Errorf("--to is required")
+	}
+
+	r, err := ys.Relocate(db, ys.RelocateOptions{To: o.to, From: o.from, DryRun: o.dryRun})
+	for _, p := range r.Outside {
+		fmt.Printf("  outside  %s\n", p)
+	}
+	for _, p := range r.Missing {
+		fmt.Printf("  missing  %s\n", p)
+	}
+	for _, p := range r.Corrupt {
+		fmt.Printf("  corrupt  %s\n", p)
+	}
+	if err != nil {
+		return err
+	}
+
+	if o.dryRun {
+		fmt.Printf("Would move %d files (%s) from %s to %s\n", r.Moved, ys.FormatBytes(r.Bytes), r.From, r.To)
+		return nil
+	}
+	fmt.Printf("Moved %d files (%s) from %s to %s\n", r.Moved, ys.FormatBytes(r.Bytes), r.From, r.To)
+	fmt.Printf("Verified: %d files, %d missing, %d corrupt\n", r.Verified, len(r.Missing), len(r.Corrupt))
+	if len(r.Outside) > 0 {
+		fmt.Printf("Left %d files outside %s in place\n", len(r.Outside), r.From)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// remapFlags are the flags of remap
+type remapFlags struct {
+	game   string
+	dryRun bool
+}
+
+// register adds the flags of remap to the flag set
+func (o *remapFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.game, "game", "", "Only entries of this game (azurlane, arknight, mahjong_soul, aether_gazer).")
+	fs.BoolVar(&o.dryRun, "dry-run", false, "Only list the entries that would be remapped.")
+}
+
+// runRemap merges the entries downloaded again under a new ID after their API
+// renumbered them into the entries of the library
+func runRemap(db *sql.DB, args []string) error {
+	var o remapFlags
+	fs := newFlagSet("remap", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	remaps, err := ys.FindRemaps(db, o.game)
+	if err != nil {
+		return err
+	}
+	if len(remaps) == 0 {
+		fmt.Println("No renumbered entries found")
+		return nil
+	}
+	for _, r := range remaps {
+		if !o.dryRun {
+			if err := ys.ApplyRemap(db, r); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("%s: %s -> %s (same %s)\n", r.Game, r.From, r.To, r.By)
+	}
+	if o.dryRun {
+		fmt.Printf("%d entries would be remapped\n", len(remaps))
+	} else {
+		fmt.Printf("Remapped %d entries\n", len(remaps))
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// reportFlags are the flags of report
+type reportFlags struct {
+	filterFlags
+	month  string
+	out    string
+	format string
+}
+
+// register adds the flags of report to the flag set
+func (o *reportFlags) register(fs *flag.FlagSet) {
+	o.filterFlags.register(fs)
+	fs.StringVar(&o.month, "month", "", "Month of publication to report (YYYY-MM), the previous month by default.")
+	fs.StringVar(&o.out, "out", "", "Path of the report, report-<month>.md by default.")
+	fs.StringVar(&o.format, "format", "", "Report format (md, html). Defaults to the extension of --out, else md.")
+}
+
+// runReport writes a report of the wallpapers published in a month
+func runReport(db *sql.DB, args []string) error {
+	var o reportFlags
+	fs := newFlagSet("report", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	filter, err := o.filter()
+	if err != nil {
+		return err
+	}
+
+	start := time.Now().AddDate(0, -1, 0)
+	start = time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.Local)
+	if o.month != "" {
+		if start, err = time.ParseInLocation("2006-01", o.month, time.Local); err != nil {
+			return fmt.Errorf("invalid --month %q, expected YYYY-MM", o.month)
+		}
+	}
+
+	if o.format == "" {
+		o.format = ys.ReportMarkdown
+		if ext := strings.ToLower(filepath.Ext(o.out)); ext == ".html" || ext == ".htm" {
+			o.format = ys.ReportHTML
+		}
+	}
+	if o.out == "" {
+		o.out = fmt.Sprintf("report-%s.%s", start.Format("2006-01"), o.format)
+	}
+
+	n, err := ys.WriteReport(db, filter, start, o.format, o.out)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Reported %d wallpapers published in %s into %s\n", n, start.Format("January 2006"), o.out)
+	return nil
+}
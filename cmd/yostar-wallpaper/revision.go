@@ -0,0 +1,119 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// wallpaperFlags holds the flags that select a single wallpaper
+type wallpaperFlags struct {
+	game   string
+	region string
+	id     string
+	typ    string
+}
+
+// register adds the wallpaper selection flags to the flag set
+func (w *wallpaperFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&w.game, "game", "", "Game of the wallpaper (azurlane, arknight, mahjong_soul, aether_gazer).")
+	fs.StringVar(&w.region, "region", ys.RegionGlobal, "Region of the game API the wallpaper was listed by (global, jp, kr).")
+	fs.StringVar(&w.id, "id", "", "Gallery ID of the wallpaper.")
+	fs.StringVar(&w.typ, "type", "wallpaper", "Image type of the wallpaper (wallpaper, mobile).")
+}
+
+// validate checks that a wallpaper has been selected
+func (w *wallpaperFlags) validate() error {
+	if w.game == "" || w.id == "" {
+		return errors.New("--game and --id are required")
+	}
+	return nil
+}
+
+// runRevisions lists the archived revisions of a wallpaper
+func runRevisions(db *sql.DB, args []string) error {
+	var w wallpaperFlags
+	fs := newFlagSet("revisions", w.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if err := w.validate(); err != nil {
+		return err
+	}
+
+	item, err := ys.GetGalleryItem(db, w.game, w.region, w.id, w.typ)
+	if err != nil {
+		return fmt.Errorf("failed to look up wallpaper: %w", err)
+	}
+
+	revisions, err := ys.ListRevisions(db, item.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list revisions: %w", err)
+	}
+
+	pinned := ""
+	if item.Pinned {
+		pinned = "  (pinned, see revert --unpin)"
+	}
+	fmt.Printf("current  %s  %s%s\n", item.URL, item.Path, pinned)
+	for _, rev := range revisions {
+		path := rev.Path
+		if path == "" {
+			path = "(not archived)"
+		}
+		fmt.Printf("r%-7d %s  %s  %s\n", rev.Revision, rev.CreatedAt.Format("2006-01-02 15:04"), rev.URL, path)
+	}
+	return nil
+}
+
+// revertFlags are the flags of revert
+type revertFlags struct {
+	wallpaperFlags
+	revision int
+	unpin    bool
+}
+
+// register adds the flags of revert to the flag set
+func (o *revertFlags) register(fs *flag.FlagSet) {
+	o.wallpaperFlags.register(fs)
+	fs.IntVar(&o.revision, "revision", 0, "Revision number to restore (see the revisions command).")
+	fs.BoolVar(&o.unpin, "unpin", false, "Unpin the reverted file instead, so that the next sync downloads the upload the API lists.")
+}
+
+// runRevert restores an archived revision of a wallpaper
+func runRevert(db *sql.DB, args []string) error {
+	var o revertFlags
+	fs := newFlagSet("revert", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if err := o.validate(); err != nil {
+		return err
+	}
+	if o.unpin {
+		item, err := ys.GetGalleryItem(db, o.game, o.region, o.id, o.typ)
+		if err != nil {
+			return fmt.Errorf("failed to look up wallpaper: %w", err)
+		}
+		if err := ys.PinFile(db, item.ID, false); err != nil {
+			return err
+		}
+		fmt.Printf("Unpinned %s %s\n", o.game, o.id)
+		return nil
+	}
+	if o.revision <= 0 {
+		return errors.New("--revision is required")
+	}
+
+	if err := ys.RevertRevision(db, o.game, o.region, o.id, o.typ, o.revision); err != nil {
+		return err
+	}
+
+	fmt.Printf("Reverted %s %s to revision %d\n", o.game, o.id, o.revision)
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// rootFlags are the flags of root
+type rootFlags struct {
+	set    string
+	rebase string
+}
+
+// register adds the flags of root to the flag set
+func (o *rootFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.set, "set", "", "Folder the library is mounted at now; the files are looked up under it.")
+	fs.StringVar(&o.rebase, "rebase", "", "Folder to store the paths relative to, without moving the files.")
+}
+
+// runRoot prints the root folder of the library, or sets it
+func runRoot(db *sql.DB, args []string) error {
+	var o rootFlags
+	fs := newFlagSet("root", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	switch {
+	case o.set != "":
+		return ys.SetLibraryRoot(db, o.set)
+	case o.rebase != "":
+		return ys.RebaseLibrary(db, o.rebase)
+	}
+
+	root := ys.LibraryRoot()
+	if root == "" {
+		root = "(none, paths are absolute)"
+	}
+	fmt.Println(root)
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// rotationFlags are the flags of rotation
+type rotationFlags struct {
+	out   string
+	mode  string
+	every time.Duration
+}
+
+// register adds the flags of rotation to the flag set
+func (o *rotationFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.out, "out", "", "With set, folder of the rotation; the current one by default.")
+	fs.StringVar(&o.mode, "mode", ys.ExportCopy, "With set, how the wallpapers are placed into the folder: copy, symlink or hardlink.")
+	fs.DurationVar(&o.every, "every", 10*time.Minute, "With watch, interval between two updates of the folder.")
+}
+
+// runRotation shows, sets or keeps up to date the active rotation folder, the flat
+// folder of a collection that wallpaper rotators point at
+func runRotation(db *sql.DB, args []string) error {
+	var o rotationFlags
+	fs := newFlagSet("rotation", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	action, name := fs.Arg(0), ""
+	rest := fs.Args()[min(fs.NArg(), 1):]
+	if action == "set" && len(rest) > 0 {
+		name, rest = rest[0], rest[1:]
+	}
+	// flags are also accepted after the action and the collection
+	fs.Parse(rest)
+
+	switch action {
+	case "":
+		c, err := ys.Rotation(db)
+		if err != nil {
+			return err
+		}
+		if c == nil {
+			fmt.Println("No rotation, see yostar-wallpaper rotation set")
+			return nil
+		}
+		fmt.Printf("%s: %d wallpapers of %q (%s)\n", c.Folder, c.Members, c.Name, c.Mode)
+		return nil
+
+	case "set":
+		if name == "" {
+			return errors.New("rotation set expects the name of a collection")
+		}
+		c, update, err := ys.SetRotation(db, name, o.out, o.mode)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Rotating %d wallpapers of %q in %s, %d files added, %d removed\n", c.Members, c.Name, c.Folder, update.Exported, update.Deleted)
+		return nil
+
+	case "off":
+		deleted, err := ys.StopRotation(db)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Removed %d files of the rotation\n", deleted)
+		return nil
+
+	case "watch":
+		if o.every <= 0 {
+			return errors.New("--every must be positive")
+		}
+		for {
+			if err := updateRotation(db); err != nil {
+				log.Printf("Error updating the rotation: %v", err)
+			}
+			time.Sleep(o.every)
+		}
+	}
+	fs.Usage()
+	return fmt.Errorf("unknown rotation action %q", action)
+}
+
+// updateRotation updates the collection of the rotation and its folder
+func updateRotation(db *sql.DB) error {
+	c, err := ys.Rotation(db)
+	if err != nil || c == nil {
+		return err
+	}
+	update, err := ys.UpdateCollection(db, c)
+	if err != nil {
+		return err
+	}
+	if update != (ys.CollectionUpdate{}) {
+		log.Printf("Rotation %q: %d files added, %d removed", c.Name, update.Exported, update.Deleted)
+	}
+	return nil
+}
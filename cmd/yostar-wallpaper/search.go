@@ -0,0 +1,41 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// searchFlags are the flags of search
+type searchFlags struct {
+	limit int
+}
+
+// register adds the flags of search to the flag set
+func (o *searchFlags) register(fs *flag.FlagSet) {
+	fs.IntVar(&o.limit, "limit", 50, "Maximum number of results.")
+}
+
+// runSearch prints the wallpapers matching a full-text search
+func runSearch(db *sql.DB, args []string) error {
+	var o searchFlags
+	fs := newFlagSet("search", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	query := strings.Join(fs.Args(), " ")
+	if query == "" {
+		return errors.New("usage: yostar-wallpaper search [--limit=N] <words>")
+	}
+
+	items, err := ys.SearchGalleryItems(db, query, ys.Filter{}, o.limit)
+	if err != nil {
+		return fmt.Errorf("failed to search wallpapers: %w", err)
+	}
+	return printItems(items)
+}
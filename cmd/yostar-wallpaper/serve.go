@@ -0,0 +1,876 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+//go:embed web/*.html
+var webFS embed.FS
+
+var (
+	galleryTemplate = template.Must(template.ParseFS(webFS, "web/gallery.html"))
+	queueTemplate   = template.Must(template.New("queue.html").Funcs(template.FuncMap{
+		"add": func(a, b int) int { return a + b },
+	}).ParseFS(webFS, "web/queue.html"))
+)
+
+// server is the web UI of the library
+type server struct {
+	db      *sql.DB
+	queue   *ys.DownloadQueue
+	metrics *ys.EventMetrics
+	images  *imageCache // resized images
+	graphQL ys.GraphQLLimits
+	hidden  []string // tags of the wallpapers left out unless asked for
+	token   string   // token the requests changing the library carry, none when empty
+}
+
+// libraryWatchInterval is how often the library is checked for the downloads of
+// other processes, to show them live
+const libraryWatchInterval = 2 * time.Second
+
+// resizeWidths are the widths images are resized to on request, rounded up to, so
+// that the cache holds a few variants of each
+var resizeWidths = []int{640, 1280, 1920, 2560}
+
+// serveFlags are the flags of serve
+type serveFlags struct {
+	addr              string
+	path              string
+	dedupe            string
+	workers           int
+	minWorkers        int
+	maxWorkers        int
+	maintainEvery     time.Duration
+	syncEvery         time.Duration
+	peer              string
+	eventHook         string
+	events            string
+	imageCacheMB      int
+	accessLogged      bool
+	graphQL           bool
+	graphQLDepth      int
+	graphQLComplexity int
+	hideTags          string
+	token             string
+}
+
+// register adds the flags of serve to the flag set
+func (o *serveFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.addr, "addr", "127.0.0.1:8080", "Address the web UI listens on.")
+	fs.StringVar(&o.path, "path", ".", "Folder downloaded wallpapers are saved into, under <game>/<type>.")
+	fs.StringVar(&o.dedupe, "dedupe", ys.DedupeLink, "What to do with downloads identical to a file already in the library (off, link, skip).")
+	fs.IntVar(&o.workers, "workers", 5, "Number of concurrent downloads.")
+	fs.IntVar(&o.minWorkers, "min-workers", 1, "Fewest concurrent downloads when they scale with --max-workers.")
+	fs.IntVar(&o.maxWorkers, "max-workers", 0, "Scale the concurrent downloads from --workers up to this many while the throughput holds, and down when the CDN throttles.")
+	fs.DurationVar(&o.maintainEvery, "maintain-every", 0, "Run the library maintenance at this interval, e.g. 24h.")
+	fs.DurationVar(&o.syncEvery, "sync-every", 0, "Sync the library at this interval, e.g. 6h, running the crawlers sync runs with the options of its section of the configuration file.")
+	fs.String("quiet-hours", "", "Comma separated times of day downloads wait for, e.g. 09:00-18:00; scheduled syncs are skipped during them.")
+	fs.Bool("unmetered-only", false, "Hold downloads and scheduled syncs back while the network is metered (Linux): a mobile or tethered interface of --metered-interfaces, or metered for NetworkManager.")
+	fs.String("metered-interfaces", strings.Join(ys.DefaultMeteredInterfaces, ","), "Comma separated patterns of the network interfaces --unmetered-only counts as metered.")
+	fs.StringVar(&o.peer, "peer", "", "URL of the yostar-wallpaper serve of another machine to copy the images it has from, instead of the CDN.")
+	fs.StringVar(&o.eventHook, "event-hook", "", "Command run on the events of the downloads, e.g. \"notify-send {event} {name}\".")
+	fs.StringVar(&o.events, "events", "", "Comma separated events --event-hook runs on, all by default.")
+	fs.IntVar(&o.imageCacheMB, "image-cache", 64, "Megabytes of resized images kept in memory.")
+	fs.BoolVar(&o.accessLogged, "access-log", false, "Log every request, with the address of its client.")
+	fs.BoolVar(&o.graphQL, "graphql", false, "Serve a GraphQL endpoint of the library at /graphql.")
+	fs.IntVar(&o.graphQLDepth, "graphql-depth", 8, "Deepest nesting of the selections of a GraphQL query.")
+	fs.IntVar(&o.graphQLComplexity, "graphql-complexity", 10000, "Most fields a GraphQL query selects, times the length of the lists they are in.")
+	fs.StringVar(&o.token, "token", "", "Token the requests queuing or changing downloads must carry, as a bearer token or from opening the gallery once with ?token=<token>; required when --addr is not a loopback address.")
+	fs.StringVar(&o.hideTags, "hide-tags", "", "Comma separated tags of the wallpapers left out of the gallery, /api/wallpapers, /api/search and /graphql unless hidden=show is asked, e.g. nsfw.")
+}
+
+// runServe serves the web UI of the library and downloads the wallpapers enqueued from it
+func runServe(db *sql.DB, args []string) error {
+	var o serveFlags
+	fs := newFlagSet("serve", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := ys.CheckPeer(o.peer); err != nil {
+		return err
+	}
+	if o.token == "" && !loopbackAddr(o.addr) {
+		return fmt.Errorf("serve on %s takes a --token, as other machines can reach it; set it in the [serve] section of the configuration file", o.addr)
+	}
+	window, err := downloadWindow(fs)
+	if err != nil {
+		return err
+	}
+	live, err := newLiveConfig(args)
+	if err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	if o.eventHook != "" {
+		hook, err := ys.NewEventHook(o.eventHook, o.events, 0)
+		if err != nil {
+			return fmt.Errorf("invalid --event-hook: %w", err)
+		}
+		defer ys.Subscribe(hook.Handle)()
+	}
+	metrics := &ys.EventMetrics{}
+	defer ys.Subscribe(metrics.Handle)()
+
+	queue, err := ys.NewDownloadQueue(db, ys.QueueOptions{Dir: o.path, Dedupe: o.dedupe, Workers: o.workers, MinWorkers: o.minWorkers, MaxWorkers: o.maxWorkers, Window: window, Peer: o.peer})
+	if err != nil {
+		return err
+	}
+	defer queue.Close()
+
+	// Stop on Ctrl+C so that the queue and the database are closed cleanly
+	ctx, release := ys.Graceful()
+	defer release()
+
+	maintenance := newSchedule(ctx, o.maintainEvery, func() {
+		report, err := ys.Maintain(db, ys.MaintenanceOptions{Vacuum: true, Thumbnails: true, VerifySample: 50})
+		if err != nil {
+			log.Printf("Maintenance failed: %v", err)
+			return
+		}
+		log.Printf("Maintenance: %d thumbnails created, %d files verified, %d missing, %d corrupt",
+			report.ThumbnailsCreated, report.Verified, len(report.Missing), len(report.Corrupt))
+	})
+	syncs := newSchedule(ctx, o.syncEvery, func() {
+		if hold := queue.Held(); hold != "" {
+			log.Printf("Sync skipped: %s", hold)
+			return
+		}
+		names, err := live.crawlers()
+		if err == nil {
+			err = syncLibrary(names)
+		}
+		if err != nil {
+			log.Printf("Sync failed: %v", err)
+		}
+	})
+	// Changes of the configuration file to the schedules and the workers apply
+	// without restarting
+	go live.watch(ctx, configWatchInterval, func(fs *flag.FlagSet) {
+		queue.SetWorkers(flagValue[int](fs, "workers"), flagValue[int](fs, "min-workers"), flagValue[int](fs, "max-workers"))
+		maintenance.set(flagValue[time.Duration](fs, "maintain-every"))
+		syncs.set(flagValue[time.Duration](fs, "sync-every"))
+		if window, err := downloadWindow(fs); err == nil {
+			queue.SetWindow(window)
+		}
+	})
+
+	s := &server{db: db, queue: queue, metrics: metrics, images: newImageCache(int64(o.imageCacheMB) << 20),
+		graphQL: ys.GraphQLLimits{MaxDepth: o.graphQLDepth, MaxComplexity: o.graphQLComplexity}, hidden: ys.ParseTags(o.hideTags), token: o.token}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleGallery)
+	mux.HandleFunc("/thumb/", s.handleThumbnail)
+	mux.HandleFunc("/file/", s.handleFile)
+	mux.HandleFunc("/download/", s.protect(s.handleDownload))
+	mux.HandleFunc("/queue", s.protect(s.handleQueue))
+	mux.HandleFunc("/api/search", s.handleSearch)
+	mux.HandleFunc("/api/wallpapers", s.handleWallpapers)
+	mux.HandleFunc("/api/manifest", s.handleManifest)
+	mux.HandleFunc("/api/file", s.handleSharedFile)
+	mux.HandleFunc("/api/events", s.handleEvents)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	if o.graphQL {
+		mux.HandleFunc("/graphql", s.handleGraphQL)
+	}
+
+	go func() {
+		if err := ys.WatchLibrary(ctx, db, libraryWatchInterval); err != nil {
+			log.Printf("Error watching the library: %v", err)
+		}
+	}()
+	handler := s.rememberToken(mux)
+	if o.accessLogged {
+		handler = accessLog(handler)
+	}
+	srv := &http.Server{Addr: o.addr, Handler: handler}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Serving the library on http://%s", o.addr)
+	if !ys.FullTextSearch {
+		log.Printf("Search is running in LIKE mode: build with -tags sqlite_fts5, as make does, for the full-text index")
+	}
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	log.Println("Shutting down")
+	return nil
+}
+
+// downloadWindow returns the download window set by the flags of serve
+func downloadWindow(fs *flag.FlagSet) (ys.DownloadWindow, error) {
+	quiet, err := ys.ParseQuietHours(flagValue[string](fs, "quiet-hours"))
+	if err != nil {
+		return ys.DownloadWindow{}, fmt.Errorf("invalid --quiet-hours: %w", err)
+	}
+	var interfaces []string
+	for _, pattern := range strings.Split(flagValue[string](fs, "metered-interfaces"), ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			interfaces = append(interfaces, pattern)
+		}
+	}
+	return ys.DownloadWindow{QuietHours: quiet, UnmeteredOnly: flagValue[bool](fs, "unmetered-only"), MeteredInterfaces: interfaces}, nil
+}
+
+// handleGallery lists the wallpapers matching the filter given in the query string,
+// which accepts the same names as the filter flags
+func (s *server) handleGallery(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	data := struct {
+		Query  url.Values
+		Items  []ys.GalleryItem
+		Queued map[string]string // state of the pending jobs, keyed by game/region/id/type
+		Hiding bool              // whether --hide-tags leaves wallpapers out
+		Error  string
+	}{Query: r.URL.Query(), Queued: make(map[string]string), Hiding: len(s.hidden) > 0}
+
+	filter, err := s.queryFilter(data.Query)
+	if err == nil {
+		data.Items, err = ys.FindGalleryItems(s.db, filter)
+	}
+	if err == nil {
+		var jobs []ys.Job
+		jobs, err = ys.ListJobs(s.db, ys.JobQueued, ys.JobRunning, ys.JobFailed)
+		for _, job := range jobs {
+			data.Queued[job.Game+"/"+job.Region+"/"+job.IdGallery+"/"+job.Type] = job.State
+		}
+	}
+	if err != nil {
+		data.Error = err.Error()
+	}
+
+	if err := galleryTemplate.Execute(w, data); err != nil {
+		log.Printf("Error rendering gallery: %v", err)
+	}
+}
+
+// handleThumbnail serves the thumbnail of a wallpaper, or its file when it has no thumbnail
+func (s *server) handleThumbnail(w http.ResponseWriter, r *http.Request) {
+	item, ok := s.lookup(w, r, "/thumb/")
+	if !ok {
+		return
+	}
+	if _, err := os.Stat(ys.ThumbnailPath(item.Path)); err == nil {
+		setETag(w, item, "thumb")
+		http.ServeFile(w, r, ys.ThumbnailPath(item.Path))
+		return
+	}
+	setETag(w, item, "")
+	http.ServeFile(w, r, item.Path)
+}
+
+// handleFile serves the file of a wallpaper, or a JPEG of it resized to the width
+// given with the w parameter
+func (s *server) handleFile(w http.ResponseWriter, r *http.Request) {
+	item, ok := s.lookup(w, r, "/file/")
+	if !ok {
+		return
+	}
+	width := variantWidth(r.URL.Query().Get("w"), item.Width)
+	if width == 0 {
+		setETag(w, item, "")
+		http.ServeFile(w, r, item.Path)
+		return
+	}
+
+	variant := fmt.Sprintf("w%d", width)
+	etag := setETag(w, item, variant)
+	key := fmt.Sprintf("%d/%s/%s", item.ID, item.SHA256, variant)
+	data, ok := s.images.get(key)
+	if !ok {
+		// a browser holding the variant needs no resizing
+		if etag != "" && r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		var err error
+		if data, err = ys.ResizedJPEG(item.Path, width); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.images.add(key, data)
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+}
+
+// setETag sets the ETag of the file of a wallpaper, or of a variant of it, derived
+// from its checksum, for browsers to revalidate it with a conditional request. It
+// returns the ETag, empty for files not hashed.
+func setETag(w http.ResponseWriter, item ys.GalleryItem, variant string) string {
+	if item.SHA256 == "" {
+		return ""
+	}
+	etag := `"` + item.SHA256
+	if variant != "" {
+		etag += "-" + variant
+	}
+	etag += `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	return etag
+}
+
+// variantWidth returns the width of the resized variant of an image of the given
+// width to serve for the w parameter, rounded up to one of resizeWidths, or 0 for
+// the original
+func variantWidth(param string, original int) int {
+	requested, err := strconv.Atoi(param)
+	if err != nil || requested <= 0 {
+		return 0
+	}
+	width := resizeWidths[len(resizeWidths)-1]
+	for _, w := range resizeWidths {
+		if w >= requested {
+			width = w
+			break
+		}
+	}
+	if original > 0 && width >= original {
+		return 0
+	}
+	return width
+}
+
+// handleDownload adds a cataloged wallpaper to the download queue
+func (s *server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	item, ok := s.lookup(w, r, "/download/")
+	if !ok {
+		return
+	}
+	_, err := ys.EnqueueDownload(s.db, item.ID, 0)
+	s.audit(r, "download", item.Game+"/"+item.IdGallery+"/"+item.Type, err)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	s.queue.Notify()
+
+	back := r.Referer()
+	if back == "" {
+		back = "/"
+	}
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// handleQueue shows the download queue and applies the actions posted from it
+func (s *server) handleQueue(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		err := s.queueAction(r)
+		target := ""
+		if id := r.FormValue("id"); id != "" {
+			target = "job " + id
+		}
+		if r.FormValue("action") == "priority" {
+			target += " to priority " + r.FormValue("priority")
+		}
+		s.audit(r, "queue."+r.FormValue("action"), target, err)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.queue.Notify()
+		http.Redirect(w, r, "/queue", http.StatusSeeOther)
+		return
+	}
+
+	data := struct {
+		Jobs     []ys.Job
+		Paused   bool
+		Held     string
+		LowPower ys.LowPower
+		Error    string
+	}{Held: s.queue.Held()}
+	var err error
+	if data.Jobs, err = ys.ListJobs(s.db, ys.JobQueued, ys.JobRunning, ys.JobFailed); err == nil {
+		data.Paused, err = ys.JobsPaused(s.db)
+	}
+	if err == nil {
+		data.LowPower, err = ys.GetLowPower(s.db)
+	}
+	if err != nil {
+		data.Error = err.Error()
+	}
+
+	if err := queueTemplate.Execute(w, data); err != nil {
+		log.Printf("Error rendering queue: %v", err)
+	}
+}
+
+// handleSearch answers a full-text search given with the q parameter with at most
+// limit results (50 by default), as JSON in the format of /api/wallpapers. The
+// wallpapers with the tags of --hide-tags are left out as by /api/wallpapers.
+func (s *server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter, err := s.queryFilter(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := 50
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	items, err := ys.SearchGalleryItems(s.db, query.Get("q"), filter, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	results := make([]apiWallpaper, 0, len(items))
+	for _, item := range items {
+		results = append(results, newAPIWallpaper(item))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		log.Printf("Error writing search results: %v", err)
+	}
+}
+
+// handleWallpapers lists the wallpapers matching the filter of the query string as
+// JSON, a page at a time: sort, order (asc or desc), limit and the cursor returned
+// with the previous page select the page, and fields the comma separated fields of
+// each wallpaper, all by default
+func (s *server) handleWallpapers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	page := ys.Page{Sort: query.Get("sort"), Cursor: query.Get("cursor")}
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		page.Desc = true
+	default:
+		http.Error(w, "invalid order", http.StatusBadRequest)
+		return
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		page.Limit = n
+	}
+	fields, err := parseFields(query.Get("fields"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, err := s.queryFilter(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	items, next, err := ys.PageGalleryItems(s.db, filter, page)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ys.ErrInvalidCursor) || errors.Is(err, ys.ErrUnknownSort) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	rows, err := sparseFields(items, fields)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	resp := struct {
+		Items      []map[string]any `json:"items"`
+		NextCursor string           `json:"next_cursor,omitempty"`
+	}{rows, next}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error writing wallpapers: %v", err)
+	}
+}
+
+// apiWallpaper is a wallpaper as /api/wallpapers and /api/search return it. The path
+// of the file on the server and the raw API entry are left out, and so are the fields
+// not known.
+type apiWallpaper struct {
+	ID            int64      `json:"id"`
+	ItemID        int64      `json:"item_id"`
+	IdGallery     string     `json:"id_gallery"`
+	Game          string     `json:"game"`
+	Region        string     `json:"region,omitempty"`
+	Type          string     `json:"type"`
+	FileName      string     `json:"file_name"`
+	URL           string     `json:"url"`
+	SourceURL     string     `json:"source_url,omitempty"`
+	ResolvedURL   string     `json:"resolved_url,omitempty"`
+	SHA256        string     `json:"sha256,omitempty"`
+	Size          int64      `json:"size,omitempty"`
+	OriginalSize  int64      `json:"original_size,omitempty"`
+	PHash         string     `json:"phash,omitempty"`
+	DuplicateOf   int64      `json:"duplicate_of,omitempty"`
+	DominantColor string     `json:"dominant_color,omitempty"`
+	Color         string     `json:"color,omitempty"`
+	Brightness    *float64   `json:"brightness,omitempty"`
+	Width         int        `json:"width,omitempty"`
+	Height        int        `json:"height,omitempty"`
+	Aspect        float64    `json:"aspect,omitempty"`
+	Cataloged     bool       `json:"cataloged"`
+	Title         string     `json:"title,omitempty"`
+	Description   string     `json:"description,omitempty"`
+	Artist        string     `json:"artist,omitempty"`
+	PublishedAt   *time.Time `json:"published_at"` // null when the API does not tell
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// newAPIWallpaper returns item as /api/wallpapers returns it
+func newAPIWallpaper(item ys.GalleryItem) apiWallpaper {
+	w := apiWallpaper{
+		ID: item.ID, ItemID: item.ItemID, IdGallery: item.IdGallery, Game: item.Game, Region: item.Region, Type: item.Type,
+		FileName: item.FileName, URL: item.URL, SourceURL: item.SourceURL, ResolvedURL: item.ResolvedURL,
+		SHA256: item.SHA256, Size: item.Size, OriginalSize: item.OriginalSize, PHash: item.PHash, DuplicateOf: item.DuplicateOf,
+		DominantColor: item.DominantColor, Color: item.Color, Width: item.Width, Height: item.Height, Aspect: item.Aspect,
+		Cataloged: item.Cataloged, Title: item.Title, Description: item.Description, Artist: item.Artist,
+		CreatedAt: item.CreatedAt.UTC(),
+	}
+	if item.Brightness >= 0 {
+		w.Brightness = &item.Brightness
+	}
+	if !item.PublishedAt.IsZero() {
+		published := item.PublishedAt.UTC()
+		w.PublishedAt = &published
+	}
+	return w
+}
+
+// apiWallpaperFields are the names of the fields of apiWallpaper, in order
+var apiWallpaperFields = func() []string {
+	t := reflect.TypeOf(apiWallpaper{})
+	names := make([]string, t.NumField())
+	for i := range names {
+		names[i], _, _ = strings.Cut(t.Field(i).Tag.Get("json"), ",")
+	}
+	return names
+}()
+
+// parseFields returns the comma separated fields of apiWallpaper, matched regardless
+// of case, or nil for all of them when empty
+func parseFields(fields string) ([]string, error) {
+	var keep []string
+	for _, name := range strings.Split(fields, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name == "" {
+			continue
+		}
+		if !slices.Contains(apiWallpaperFields, name) {
+			return nil, fmt.Errorf("unknown field %q, expected one of %s", name, strings.Join(apiWallpaperFields, ", "))
+		}
+		keep = append(keep, name)
+	}
+	return keep, nil
+}
+
+// sparseFields returns the wallpapers as JSON objects with only the fields of keep,
+// or all of them when empty
+func sparseFields(items []ys.GalleryItem, keep []string) ([]map[string]any, error) {
+	rows := make([]map[string]any, 0, len(items))
+	for _, item := range items {
+		body, err := json.Marshal(newAPIWallpaper(item))
+		if err != nil {
+			return nil, err
+		}
+		var row map[string]any
+		if err := json.Unmarshal(body, &row); err != nil {
+			return nil, err
+		}
+		if len(keep) > 0 {
+			for name := range row {
+				if !slices.Contains(keep, name) {
+					delete(row, name)
+				}
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// handleGraphQL runs the GraphQL queries POSTed as JSON, or given as the query,
+// operationName and variables parameters of a GET, and serves the schema to a GET
+// without a query. The wallpapers with the tags of --hide-tags are left out unless
+// the URL has hidden=show.
+func (s *server) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req ys.GraphQLRequest
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		if query.Get("query") == "" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			io.WriteString(w, ys.GraphQLSchema())
+			return
+		}
+		req.Query, req.OperationName = query.Get("query"), query.Get("operationName")
+		if v := query.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				http.Error(w, "invalid variables: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+			http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limits := s.graphQL
+	if r.URL.Query().Get("hidden") != "show" {
+		limits.HiddenTags = s.hidden
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ys.ExecGraphQL(s.db, req, limits)); err != nil {
+		log.Printf("Error writing the GraphQL response: %v", err)
+	}
+}
+
+// handleEvents streams the events of the library as server-sent events, one JSON
+// object each, until the client goes away. Events are dropped for a client too slow
+// to read them, rather than holding up the downloads.
+func (s *server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	events := make(chan ys.Event, 64)
+	defer ys.Subscribe(func(e ys.Event) {
+		select {
+		case events <- e:
+		default:
+		}
+	})()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e := <-events:
+			body, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Kind, body); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// handleMetrics serves the counts of the events in the Prometheus text format
+func (s *server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	io.WriteString(w, s.metrics.Prometheus())
+}
+
+// handleManifest lists the downloaded wallpapers matching the filter given in the query
+// string as JSON, for yostar-wallpaper mirror. Their files are read from /file/<id>.
+func (s *server) handleManifest(w http.ResponseWriter, r *http.Request) {
+	filter, err := queryFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	manifest, err := ys.MirrorManifest(s.db, filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(manifest); err != nil {
+		log.Printf("Error writing the manifest: %v", err)
+	}
+}
+
+// handleSharedFile serves the downloaded file of the image listed at the origin URL
+// given as url, so that other machines copy it from this library instead of the CDN.
+// Range and conditional requests are supported.
+func (s *server) handleSharedFile(w http.ResponseWriter, r *http.Request) {
+	origin := r.URL.Query().Get("url")
+	if origin == "" {
+		http.Error(w, "missing url", http.StatusBadRequest)
+		return
+	}
+	item, err := ys.GetDownloadedItemByURL(s.db, origin)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	f, err := os.Open(item.Path)
+	if os.IsNotExist(err) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if setETag(w, item, "") != "" {
+		w.Header().Set("X-Checksum-SHA256", item.SHA256)
+	}
+	http.ServeContent(w, r, filepath.Base(item.Path), info.ModTime(), f)
+}
+
+// audit records an action taken through the web UI in the audit trail, failed with
+// err unless nil
+func (s *server) audit(r *http.Request, action, target string, err error) {
+	e := ys.AuditEntry{Source: clientAddr(r), Action: action, Target: target}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	if err := ys.RecordAudit(s.db, e); err != nil {
+		log.Printf("Error recording %s in the audit trail: %v", action, err)
+	}
+}
+
+// queueAction applies an action of the queue page to the download queue
+func (s *server) queueAction(r *http.Request) error {
+	action := r.FormValue("action")
+	switch action {
+	case "pause":
+		return ys.PauseJobs(s.db, true)
+	case "resume":
+		return ys.PauseJobs(s.db, false)
+	case "low-power-on", "low-power-off":
+		lp, err := ys.GetLowPower(s.db)
+		if err != nil {
+			return err
+		}
+		lp.On = action == "low-power-on"
+		return ys.SetLowPower(s.db, lp)
+	}
+
+	id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid id: %w", err)
+	}
+	switch action {
+	case "pause-item":
+		return ys.PauseJob(s.db, id, true)
+	case "resume-item":
+		return ys.PauseJob(s.db, id, false)
+	case "remove":
+		return ys.RemoveJob(s.db, id)
+	case "retry":
+		return ys.RetryJob(s.db, id)
+	case "priority":
+		priority, err := strconv.Atoi(r.FormValue("priority"))
+		if err != nil {
+			return fmt.Errorf("invalid priority: %w", err)
+		}
+		return ys.SetJobPriority(s.db, id, priority)
+	}
+	return fmt.Errorf("unknown action %q", action)
+}
+
+// lookup reads the wallpaper whose ID follows prefix in the request path, writing
+// an error response when there is none
+func (s *server) lookup(w http.ResponseWriter, r *http.Request, prefix string) (ys.GalleryItem, bool) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, prefix), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return ys.GalleryItem{}, false
+	}
+	item, err := ys.GetGalleryItemByID(s.db, id)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return item, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return item, false
+	}
+	return item, true
+}
+
+// queryFilter parses the filter of a view of the library, leaving out the wallpapers
+// with the tags of --hide-tags unless the query has hidden=show or its own exclude-tags
+func (s *server) queryFilter(query url.Values) (ys.Filter, error) {
+	filter, err := queryFilter(query)
+	if err == nil && len(filter.ExcludeTags) == 0 && query.Get("hidden") != "show" {
+		filter.ExcludeTags = s.hidden
+	}
+	return filter, err
+}
+
+// queryFilter parses a library filter from query parameters named like the filter flags
+func queryFilter(query url.Values) (ys.Filter, error) {
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var f filterFlags
+	f.register(fs)
+
+	for name, values := range query {
+		if fs.Lookup(name) == nil || values[0] == "" {
+			continue
+		}
+		if err := fs.Set(name, values[0]); err != nil {
+			return ys.Filter{}, fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+	return f.filter()
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// published is the publication date of the even wallpapers of newAPITestServer
+var published = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// newAPITestServer serves a library of n wallpapers, the first downloaded and the
+// others cataloged, the even ones with a publication date
+func newAPITestServer(t *testing.T, n int) *server {
+	t.Helper()
+	dir := t.TempDir()
+	ys.SetLogger(nil)
+	ys.SetDatabasePath(filepath.Join(dir, "yostar-gallery.db"))
+	db, err := ys.OpenDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ys.CloseDB(db) })
+
+	for i := 1; i <= n; i++ {
+		item := ys.GalleryItem{
+			IdGallery: fmt.Sprint(i),
+			Game:      "azur_lane",
+			Type:      "wallpaper",
+			FileName:  fmt.Sprintf("wallpaper %d.png", i),
+			URL:       fmt.Sprintf("https://cdn.example/%d.png", i),
+			Title:     fmt.Sprintf("Wallpaper %d", i),
+			Metadata:  `{"secret":"raw API entry"}`,
+			Cataloged: i > 1,
+		}
+		if i%2 == 0 {
+			item.PublishedAt = published
+		}
+		if i == 1 {
+			item.Path = filepath.Join(dir, item.FileName)
+			if err := os.WriteFile(item.Path, []byte("image"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := ys.SaveGalleryItem(db, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &server{db: db}
+}
+
+// apiPage is a response of /api/wallpapers
+type apiPage struct {
+	Items      []map[string]any `json:"items"`
+	NextCursor string           `json:"next_cursor"`
+}
+
+// getWallpapers requests /api/wallpapers with query, returning the status and the
+// page when it is 200 OK
+func getWallpapers(t *testing.T, s *server, query string) (int, apiPage) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.handleWallpapers(rec, httptest.NewRequest(http.MethodGet, "/api/wallpapers?"+query, nil))
+	var page apiPage
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+			t.Fatalf("invalid response %s: %v", rec.Body, err)
+		}
+	}
+	return rec.Code, page
+}
+
+func TestAPIWallpapersFields(t *testing.T) {
+	s := newAPITestServer(t, 2)
+	status, page := getWallpapers(t, s, "")
+	if status != http.StatusOK || len(page.Items) != 2 {
+		t.Fatalf("status %d, %d wallpapers", status, len(page.Items))
+	}
+
+	downloaded, cataloged := page.Items[0], page.Items[1]
+	for _, name := range []string{"id", "item_id", "id_gallery", "game", "type", "file_name", "url", "sha256", "size", "title", "created_at"} {
+		if _, ok := downloaded[name]; !ok {
+			t.Errorf("downloaded wallpaper has no %s: %v", name, downloaded)
+		}
+	}
+	for _, name := range []string{"path", "Path", "metadata", "Metadata", "ID", "Title"} {
+		if _, ok := downloaded[name]; ok {
+			t.Errorf("wallpaper has %s: %v", name, downloaded)
+		}
+	}
+	if v, ok := downloaded["published_at"]; !ok || v != nil {
+		t.Errorf("published_at of a wallpaper without date is %v, want null", v)
+	}
+	if v := cataloged["published_at"]; v != published.Format(time.RFC3339) {
+		t.Errorf("published_at is %v, want %s", v, published.Format(time.RFC3339))
+	}
+	for _, name := range []string{"sha256", "size", "brightness", "width"} {
+		if _, ok := cataloged[name]; ok {
+			t.Errorf("cataloged wallpaper has %s: %v", name, cataloged)
+		}
+	}
+}
+
+func TestAPIWallpapersSparseFields(t *testing.T) {
+	s := newAPITestServer(t, 2)
+	tests := []struct {
+		fields string
+		want   []string
+		status int
+	}{
+		{"id,title", []string{"id", "title"}, http.StatusOK},
+		{" ID , File_Name ", []string{"id", "file_name"}, http.StatusOK},
+		{"id,published_at", []string{"id", "published_at"}, http.StatusOK},
+		{"id,path", nil, http.StatusBadRequest},
+		{"FileName", nil, http.StatusBadRequest},
+		{"metadata", nil, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		status, page := getWallpapers(t, s, "fields="+strings.ReplaceAll(tt.fields, " ", "+"))
+		if status != tt.status {
+			t.Errorf("fields=%s: status %d, want %d", tt.fields, status, tt.status)
+			continue
+		}
+		for _, row := range page.Items {
+			if len(row) != len(tt.want) {
+				t.Errorf("fields=%s: wallpaper is %v, want only %v", tt.fields, row, tt.want)
+			}
+			for _, name := range tt.want {
+				if _, ok := row[name]; !ok {
+					t.Errorf("fields=%s: wallpaper has no %s: %v", tt.fields, name, row)
+				}
+			}
+		}
+	}
+}
+
+// TestAPIWallpapersCursor pages through the library in both orders, passing the
+// next_cursor of each page as the cursor of the next one
+func TestAPIWallpapersCursor(t *testing.T) {
+	s := newAPITestServer(t, 7)
+	tests := []struct {
+		order string
+		want  []float64
+	}{
+		{"", []float64{1, 2, 3, 4, 5, 6, 7}},
+		{"asc", []float64{1, 2, 3, 4, 5, 6, 7}},
+		{"desc", []float64{7, 6, 5, 4, 3, 2, 1}},
+	}
+	for _, tt := range tests {
+		var ids []float64
+		cursor := ""
+		for pages := 0; pages < 10; pages++ {
+			status, page := getWallpapers(t, s, "fields=id&limit=3&order="+tt.order+"&cursor="+cursor)
+			if status != http.StatusOK {
+				t.Fatalf("order=%s: status %d", tt.order, status)
+			}
+			for _, row := range page.Items {
+				ids = append(ids, row["id"].(float64))
+			}
+			if cursor = page.NextCursor; cursor == "" {
+				break
+			}
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(tt.want) {
+			t.Errorf("order=%s: paged %v, want %v", tt.order, ids, tt.want)
+		}
+	}
+}
+
+func TestAPIWallpapersInvalid(t *testing.T) {
+	s := newAPITestServer(t, 3)
+	_, page := getWallpapers(t, s, "limit=1")
+	if page.NextCursor == "" {
+		t.Fatal("no next_cursor")
+	}
+
+	for _, query := range []string{
+		"cursor=garbage",
+		"cursor=" + page.NextCursor + "&order=desc",
+		"cursor=" + page.NextCursor + "&sort=title",
+		"sort=path",
+		"order=up",
+		"limit=0",
+		"limit=ten",
+		"fields=nope",
+	} {
+		if status, _ := getWallpapers(t, s, query); status != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", query, status)
+		}
+	}
+}
+
+// TestAPISearchFields checks that /api/search returns the wallpapers as
+// /api/wallpapers does, without their path or raw API entry
+func TestAPISearchFields(t *testing.T) {
+	s := newAPITestServer(t, 2)
+	rec := httptest.NewRecorder()
+	s.handleSearch(rec, httptest.NewRequest(http.MethodGet, "/api/search?q=Wallpaper", nil))
+	var items []map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &items); err != nil {
+		t.Fatalf("invalid response %s: %v", rec.Body, err)
+	}
+	if rec.Code != http.StatusOK || len(items) != 2 {
+		t.Fatalf("status %d, %d wallpapers", rec.Code, len(items))
+	}
+	for _, item := range items {
+		for _, name := range []string{"id", "id_gallery", "title"} {
+			if _, ok := item[name]; !ok {
+				t.Errorf("wallpaper has no %s: %v", name, item)
+			}
+		}
+		for _, name := range []string{"path", "Path", "metadata", "Metadata", "ID", "Title"} {
+			if _, ok := item[name]; ok {
+				t.Errorf("wallpaper has %s: %v", name, item)
+			}
+		}
+	}
+}
+
+// TestAPISearchHidden checks that /api/search leaves out the wallpapers with the
+// tags of --hide-tags unless the query has hidden=show
+func TestAPISearchHidden(t *testing.T) {
+	s := newAPITestServer(t, 2)
+	if err := ys.AddTags(s.db, 1, "manual", "nsfw"); err != nil {
+		t.Fatal(err)
+	}
+	s.hidden = []string{"nsfw"}
+
+	for query, want := range map[string]int{"q=Wallpaper": 1, "q=Wallpaper&hidden=show": 2} {
+		rec := httptest.NewRecorder()
+		s.handleSearch(rec, httptest.NewRequest(http.MethodGet, "/api/search?"+query, nil))
+		var items []map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &items); err != nil {
+			t.Fatalf("%s: invalid response %s: %v", query, rec.Body, err)
+		}
+		if rec.Code != http.StatusOK || len(items) != want {
+			t.Errorf("%s: status %d, %d wallpapers, want %d", query, rec.Code, len(items), want)
+		}
+	}
+}
+
+// TestGraphQLHidden checks that /graphql leaves out the wallpapers with the tags
+// of --hide-tags unless the URL has hidden=show
+func TestGraphQLHidden(t *testing.T) {
+	s := newAPITestServer(t, 2)
+	if err := ys.AddTags(s.db, 1, "manual", "nsfw"); err != nil {
+		t.Fatal(err)
+	}
+	s.hidden = []string{"nsfw"}
+
+	body := `{"query": "{ wallpapers { nodes { id } } items { id } }"}`
+	for url, want := range map[string]int{"/graphql": 1, "/graphql?hidden=show": 2} {
+		rec := httptest.NewRecorder()
+		s.handleGraphQL(rec, httptest.NewRequest(http.MethodPost, url, strings.NewReader(body)))
+		var res struct {
+			Data struct {
+				Wallpapers struct {
+					Nodes []map[string]any `json:"nodes"`
+				} `json:"wallpapers"`
+				Items []map[string]any `json:"items"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatalf("%s: invalid response %s: %v", url, rec.Body, err)
+		}
+		if len(res.Data.Wallpapers.Nodes) != want || len(res.Data.Items) != want {
+			t.Errorf("%s: %d wallpapers and %d items, want %d: %s", url, len(res.Data.Wallpapers.Nodes), len(res.Data.Items), want, rec.Body)
+		}
+	}
+}
+
+// TestAPIWallpaperFieldNames checks that every field of apiWallpaper is named in
+// snake case, as fields= asks for them
+func TestAPIWallpaperFieldNames(t *testing.T) {
+	for _, name := range apiWallpaperFields {
+		if name == "" || name != strings.ToLower(name) || strings.ContainsAny(name, " -") {
+			t.Errorf("field %q is not in snake case", name)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// defaultServiceName is the name serve is installed as a service under
+const defaultServiceName = "yostar-wallpaper"
+
+// serviceFlags are the flags of service
+type serviceFlags struct {
+	name       string
+	logPath    string
+	dbPath     string
+	configPath string
+}
+
+// register adds the flags of service to the flag set
+func (o *serviceFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.name, "name", defaultServiceName, "Name of the service, to install several with their own library.")
+	fs.StringVar(&o.logPath, "log", "", "File the service logs into, yostar-wallpaper-service.log next to the database by default.")
+	fs.StringVar(&o.dbPath, "db", "", "Database of the library the service serves, the current one by default.")
+	fs.StringVar(&o.configPath, "config", "", "Configuration file of the service, the current one by default.")
+}
+
+// runServiceCommand installs serve as a Windows service or a macOS launch agent,
+// controls it, or runs it when started by the service manager
+func runServiceCommand(_ *sql.DB, args []string) error {
+	var o serviceFlags
+	fs := newFlagSet("service", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	// flags are also accepted after the action, those after -- going to serve
+	action := fs.Arg(0)
+	if action != "" {
+		fs.Parse(fs.Args()[1:])
+	}
+
+	switch action {
+	case "install":
+		return installServe(o.name, o.dbPath, o.configPath, o.logPath, fs.Args())
+	case "uninstall":
+		if err := removeService(o.name); err != nil {
+			return err
+		}
+		fmt.Printf("Service %s uninstalled\n", o.name)
+		return nil
+	case "start":
+		return startService(o.name)
+	case "stop":
+		return stopService(o.name)
+	case "status":
+		state, err := serviceState(o.name)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Service %s: %s\n", o.name, state)
+		return nil
+	case "run":
+		return runServeService(o.name, o.dbPath, o.configPath, o.logPath, fs.Args())
+	}
+	fs.Usage()
+	return errors.New("service install, uninstall, start, stop or status expected")
+}
+
+// installServe installs serve with the arguments serveArgs as the service name,
+// started at boot on the library at dbPath and with the configuration file at
+// configPath, those of now when empty
+func installServe(name, dbPath, configPath, logPath string, serveArgs []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if dbPath == "" {
+		dbPath = ys.DatabasePath()
+	}
+	if configPath == "" {
+		configPath = ys.ConfigPath()
+	}
+	if dbPath, err = filepath.Abs(dbPath); err != nil {
+		return err
+	}
+	if configPath, err = filepath.Abs(configPath); err != nil {
+		return err
+	}
+	if logPath == "" {
+		logPath = filepath.Join(filepath.Dir(dbPath), "yostar-wallpaper-service.log")
+	}
+	if logPath, err = filepath.Abs(logPath); err != nil {
+		return err
+	}
+
+	// the service runs without the environment of the current user, so the
+	// library and the global flags are given on its command line
+	var args []string
+	flag.CommandLine.Visit(func(f *flag.Flag) {
+		args = append(args, "--"+f.Name+"="+f.Value.String())
+	})
+	args = append(args, "service", "run", "--name="+name, "--db="+dbPath, "--config="+configPath, "--log="+logPath, "--")
+	args = append(args, serveArgs...)
+	if err := installService(name, "Yostar wallpapers", "Serves the wallpaper library "+dbPath+" and downloads its queue.", exe, args); err != nil {
+		return err
+	}
+	fmt.Printf("Service %s installed; it logs into %s\n", name, logPath)
+	return nil
+}
+
+// runServeService runs serve on the library at dbPath, as the service name started
+// by the service manager
+func runServeService(name, dbPath, configPath, logPath string, serveArgs []string) error {
+	if dbPath != "" {
+		ys.SetDatabasePath(dbPath)
+	}
+	if configPath != "" {
+		os.Setenv("YOSTAR_CONFIG", configPath)
+		c, err := ys.LoadConfig()
+		if err != nil {
+			return fmt.Errorf("invalid configuration:\n%w", err)
+		}
+		config = c
+	}
+	if logPath != "" {
+		f, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		log.SetOutput(f)
+	}
+
+	return runAsService(name, func() error {
+		db, err := ys.OpenDB()
+		if err != nil {
+			return fmt.Errorf("failed to open database: %w", err)
+		}
+		defer ys.CloseDB(db)
+		return runServe(db, serveArgs)
+	})
+}
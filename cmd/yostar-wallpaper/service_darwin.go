@@ -0,0 +1,179 @@
+//go:build darwin && !lite
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// launchAgentPrefix prefixes the name of a service into the label of its launch agent
+const launchAgentPrefix = "com.github.yukihime23."
+
+// launchAgent returns the label of the launch agent of the service name, and the
+// path of its plist
+func launchAgent(name string) (label, path string, err error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", "", err
+	}
+	label = launchAgentPrefix + name
+	return label, filepath.Join(home, "Library", "LaunchAgents", label+".plist"), nil
+}
+
+// launchDomain is the launchd domain of the agents of the user
+func launchDomain() string {
+	return fmt.Sprintf("gui/%d", os.Getuid())
+}
+
+// launchctl runs launchctl with args, returning its output
+func launchctl(args ...string) (string, error) {
+	out, err := exec.Command("launchctl", args...).CombinedOutput()
+	if err != nil {
+		return string(out), fmt.Errorf("launchctl %s: %w: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+// installService writes the launch agent of the program exe run with args as the
+// service name, started at login and whenever it exits on an error, and loads it
+func installService(name, displayName, description, exe string, args []string) error {
+	label, path, err := launchAgent(name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("service %s is already installed, at %s", name, path)
+	}
+
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	b.WriteString("<plist version=\"1.0\">\n<dict>\n")
+	plistString(&b, "Label", label)
+	b.WriteString("\t<key>ProgramArguments</key>\n\t<array>\n")
+	for _, arg := range append([]string{exe}, args...) {
+		b.WriteString("\t\t<string>")
+		xml.EscapeText(&b, []byte(arg))
+		b.WriteString("</string>\n")
+	}
+	b.WriteString("\t</array>\n")
+	plistString(&b, "WorkingDirectory", filepath.Dir(exe))
+	plistString(&b, "ProcessType", "Background")
+	b.WriteString("\t<key>RunAtLoad</key>\n\t<true/>\n")
+	b.WriteString("\t<key>KeepAlive</key>\n\t<dict>\n\t\t<key>SuccessfulExit</key>\n\t\t<false/>\n\t</dict>\n")
+	b.WriteString("</dict>\n</plist>\n")
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, b.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write the launch agent %s: %w", path, err)
+	}
+	if _, err := launchctl("bootstrap", launchDomain(), path); err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to load service %s: %w", name, err)
+	}
+	return nil
+}
+
+// plistString writes the string value of key of a plist dict
+func plistString(b *bytes.Buffer, key, value string) {
+	fmt.Fprintf(b, "\t<key>%s</key>\n\t<string>", key)
+	xml.EscapeText(b, []byte(value))
+	b.WriteString("</string>\n")
+}
+
+// removeService unloads the launch agent of the service name, stopping it, and
+// removes it
+func removeService(name string) error {
+	label, path, err := launchAgent(name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("service %s is not installed", name)
+	}
+	if loaded(label) {
+		if _, err := launchctl("bootout", launchDomain()+"/"+label); err != nil {
+			return fmt.Errorf("failed to unload service %s: %w", name, err)
+		}
+	}
+	return os.Remove(path)
+}
+
+// startService starts the service name, loading its launch agent if needed
+func startService(name string) error {
+	label, path, err := launchAgent(name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("service %s is not installed", name)
+	}
+	if !loaded(label) {
+		_, err = launchctl("bootstrap", launchDomain(), path)
+	} else {
+		_, err = launchctl("kickstart", launchDomain()+"/"+label)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to start service %s: %w", name, err)
+	}
+	return nil
+}
+
+// stopService stops the service name as Ctrl+C does, until it is started again or
+// the next login
+func stopService(name string) error {
+	label, _, err := launchAgent(name)
+	if err != nil {
+		return err
+	}
+	if !loaded(label) {
+		return nil
+	}
+	// unloaded rather than killed, so that KeepAlive doesn't restart it
+	if _, err := launchctl("bootout", launchDomain()+"/"+label); err != nil {
+		return fmt.Errorf("failed to stop service %s: %w", name, err)
+	}
+	return nil
+}
+
+// launchState matches the state of a job in the output of launchctl print
+var launchState = regexp.MustCompile(`(?m)^\s*state = (\S+)`)
+
+// serviceState returns the state of the service name
+func serviceState(name string) (string, error) {
+	label, path, err := launchAgent(name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("service %s is not installed", name)
+	}
+	out, err := launchctl("print", launchDomain()+"/"+label)
+	if err != nil {
+		return "stopped", nil
+	}
+	if m := launchState.FindStringSubmatch(out); m != nil {
+		return m[1], nil
+	}
+	return "loaded", nil
+}
+
+// loaded reports whether the launch agent label is loaded
+func loaded(label string) bool {
+	_, err := launchctl("print", launchDomain()+"/"+label)
+	return err == nil
+}
+
+// runAsService runs run, launchd stopping it with SIGTERM as Ctrl+C does
+func runAsService(name string, run func() error) error {
+	return run()
+}
@@ -0,0 +1,33 @@
+//go:build (!windows && !darwin) || lite
+
+package main
+
+import "errors"
+
+// errNoService is returned by the service commands outside Windows and macOS, and
+// by the lite build
+var errNoService = errors.New("services are only supported by the Windows and macOS builds; run serve from the init system instead, such as a systemd unit or an OpenWrt procd script")
+
+func installService(name, displayName, description, exe string, args []string) error {
+	return errNoService
+}
+
+func removeService(name string) error {
+	return errNoService
+}
+
+func startService(name string) error {
+	return errNoService
+}
+
+func stopService(name string) error {
+	return errNoService
+}
+
+func serviceState(name string) (string, error) {
+	return "", errNoService
+}
+
+func runAsService(name string, run func() error) error {
+	return errNoService
+}
@@ -0,0 +1,311 @@
+//go:build windows && !lite
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// Service control manager APIs of advapi32.dll
+var (
+	advapi32                         = syscall.NewLazyDLL("advapi32.dll")
+	procOpenSCManagerW               = advapi32.NewProc("OpenSCManagerW")
+	procCreateServiceW               = advapi32.NewProc("CreateServiceW")
+	procOpenServiceW                 = advapi32.NewProc("OpenServiceW")
+	procDeleteService                = advapi32.NewProc("DeleteService")
+	procStartServiceW                = advapi32.NewProc("StartServiceW")
+	procControlService               = advapi32.NewProc("ControlService")
+	procQueryServiceStatus           = advapi32.NewProc("QueryServiceStatus")
+	procCloseServiceHandle           = advapi32.NewProc("CloseServiceHandle")
+	procChangeServiceConfig2W        = advapi32.NewProc("ChangeServiceConfig2W")
+	procStartServiceCtrlDispatcherW  = advapi32.NewProc("StartServiceCtrlDispatcherW")
+	procRegisterServiceCtrlHandlerEx = advapi32.NewProc("RegisterServiceCtrlHandlerExW")
+	procSetServiceStatus             = advapi32.NewProc("SetServiceStatus")
+)
+
+// Constants of the service control manager APIs
+const (
+	scManagerConnect      = 0x0001
+	scManagerCreate       = 0x0002
+	serviceQueryStatus    = 0x0004
+	serviceStart          = 0x0010
+	serviceStop           = 0x0020
+	serviceAllAccess      = 0xF01FF
+	deleteAccess          = 0x10000
+	serviceWin32Own       = 0x00000010
+	serviceAutoStart      = 0x00000002
+	serviceErrorNormal    = 0x00000001
+	serviceConfigDesc     = 1
+	serviceControlStop    = 1
+	serviceControlInterro = 4
+	serviceControlShut    = 5
+	serviceAcceptStop     = 1
+	serviceAcceptShutdown = 4
+
+	serviceStopped      = 1
+	serviceStartPending = 2
+	serviceStopPending  = 3
+	serviceRunning      = 4
+
+	errorServiceDoesNotExist      = syscall.Errno(1060)
+	errorServiceNotActive         = syscall.Errno(1062)
+	errorFailedServiceCtrlConnect = syscall.Errno(1063)
+)
+
+// serviceStopTimeout is how long stopService waits for the service to stop
+const serviceStopTimeout = 40 * time.Second
+
+// serviceStatus is SERVICE_STATUS
+type serviceStatus struct {
+	ServiceType             uint32
+	CurrentState            uint32
+	ControlsAccepted        uint32
+	Win32ExitCode           uint32
+	ServiceSpecificExitCode uint32
+	CheckPoint              uint32
+	WaitHint                uint32
+}
+
+// serviceTableEntry is SERVICE_TABLE_ENTRYW
+type serviceTableEntry struct {
+	ServiceName *uint16
+	ServiceProc uintptr
+}
+
+// call calls proc, returning its error when it returns 0
+func call(proc *syscall.LazyProc, args ...uintptr) (uintptr, error) {
+	r, _, err := proc.Call(args...)
+	if r == 0 {
+		return 0, err
+	}
+	return r, nil
+}
+
+func utf16Ptr(s string) *uint16 {
+	p, _ := syscall.UTF16PtrFromString(s)
+	return p
+}
+
+// openService opens the service name with access, and the manager it is opened
+// from, to close after it
+func openService(name string, managerAccess, access uint32) (manager, service uintptr, err error) {
+	manager, err = call(procOpenSCManagerW, 0, 0, uintptr(managerAccess))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to connect to the service control manager: %w", err)
+	}
+	if name == "" {
+		return manager, 0, nil
+	}
+	service, err = call(procOpenServiceW, manager, uintptr(unsafe.Pointer(utf16Ptr(name))), uintptr(access))
+	if err != nil {
+		procCloseServiceHandle.Call(manager)
+		if errors.Is(err, errorServiceDoesNotExist) {
+			return 0, 0, fmt.Errorf("service %s is not installed", name)
+		}
+		return 0, 0, fmt.Errorf("failed to open service %s: %w", name, err)
+	}
+	return manager, service, nil
+}
+
+// closeService closes the handles of openService
+func closeService(manager, service uintptr) {
+	if service != 0 {
+		procCloseServiceHandle.Call(service)
+	}
+	procCloseServiceHandle.Call(manager)
+}
+
+// installService registers the program exe run with args as the service name,
+// started at boot as LocalSystem
+func installService(name, displayName, description, exe string, args []string) error {
+	manager, _, err := openService("", scManagerConnect|scManagerCreate, 0)
+	if err != nil {
+		return err
+	}
+	defer closeService(manager, 0)
+
+	command := []string{syscall.EscapeArg(exe)}
+	for _, arg := range args {
+		command = append(command, syscall.EscapeArg(arg))
+	}
+	service, err := call(procCreateServiceW, manager,
+		uintptr(unsafe.Pointer(utf16Ptr(name))), uintptr(unsafe.Pointer(utf16Ptr(displayName))),
+		serviceAllAccess, serviceWin32Own, serviceAutoStart, serviceErrorNormal,
+		uintptr(unsafe.Pointer(utf16Ptr(strings.Join(command, " ")))), 0, 0, 0, 0, 0)
+	if err != nil {
+		return fmt.Errorf("failed to install service %s: %w", name, err)
+	}
+	defer procCloseServiceHandle.Call(service)
+
+	desc := struct{ Description *uint16 }{utf16Ptr(description)}
+	call(procChangeServiceConfig2W, service, serviceConfigDesc, uintptr(unsafe.Pointer(&desc)))
+	return nil
+}
+
+// removeService stops the service name and removes it
+func removeService(name string) error {
+	stopService(name)
+	manager, service, err := openService(name, scManagerConnect, deleteAccess)
+	if err != nil {
+		return err
+	}
+	defer closeService(manager, service)
+	if _, err := call(procDeleteService, service); err != nil {
+		return fmt.Errorf("failed to uninstall service %s: %w", name, err)
+	}
+	return nil
+}
+
+// startService starts the service name
+func startService(name string) error {
+	manager, service, err := openService(name, scManagerConnect, serviceStart)
+	if err != nil {
+		return err
+	}
+	defer closeService(manager, service)
+	if _, err := call(procStartServiceW, service, 0, 0); err != nil {
+		return fmt.Errorf("failed to start service %s: %w", name, err)
+	}
+	return nil
+}
+
+// stopService stops the service name, waiting for it to stop
+func stopService(name string) error {
+	manager, service, err := openService(name, scManagerConnect, serviceStop|serviceQueryStatus)
+	if err != nil {
+		return err
+	}
+	defer closeService(manager, service)
+
+	var status serviceStatus
+	if _, err := call(procControlService, service, serviceControlStop, uintptr(unsafe.Pointer(&status))); err != nil {
+		if errors.Is(err, errorServiceNotActive) {
+			return nil
+		}
+		return fmt.Errorf("failed to stop service %s: %w", name, err)
+	}
+	deadline := time.Now().Add(serviceStopTimeout)
+	for status.CurrentState != serviceStopped {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("service %s did not stop within %s", name, serviceStopTimeout)
+		}
+		time.Sleep(500 * time.Millisecond)
+		if _, err := call(procQueryServiceStatus, service, uintptr(unsafe.Pointer(&status))); err != nil {
+			return fmt.Errorf("failed to query service %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// serviceState returns the state of the service name
+func serviceState(name string) (string, error) {
+	manager, service, err := openService(name, scManagerConnect, serviceQueryStatus)
+	if err != nil {
+		return "", err
+	}
+	defer closeService(manager, service)
+
+	var status serviceStatus
+	if _, err := call(procQueryServiceStatus, service, uintptr(unsafe.Pointer(&status))); err != nil {
+		return "", fmt.Errorf("failed to query service %s: %w", name, err)
+	}
+	switch status.CurrentState {
+	case serviceStopped:
+		return "stopped", nil
+	case serviceStartPending:
+		return "starting", nil
+	case serviceStopPending:
+		return "stopping", nil
+	case serviceRunning:
+		return "running", nil
+	}
+	return fmt.Sprintf("state %d", status.CurrentState), nil
+}
+
+// service is the state of the service run by runAsService
+var service struct {
+	name   string
+	run    func() error
+	handle uintptr
+	mu     sync.Mutex
+	status serviceStatus
+}
+
+// runAsService runs run as the service name, reporting it running to the service
+// control manager until it returns. Stopping the service stops run as Ctrl+C does.
+func runAsService(name string, run func() error) error {
+	service.name, service.run = name, run
+	table := []serviceTableEntry{
+		{ServiceName: utf16Ptr(name), ServiceProc: syscall.NewCallback(serviceMain)},
+		{},
+	}
+	if _, err := call(procStartServiceCtrlDispatcherW, uintptr(unsafe.Pointer(&table[0]))); err != nil {
+		if errors.Is(err, errorFailedServiceCtrlConnect) {
+			return errors.New("service run is started by the service control manager, see service start")
+		}
+		return fmt.Errorf("failed to run as service %s: %w", name, err)
+	}
+	return nil
+}
+
+// serviceMain is the ServiceMain of the service, called on its own thread
+func serviceMain(argc, argv uintptr) uintptr {
+	handle, err := call(procRegisterServiceCtrlHandlerEx, uintptr(unsafe.Pointer(utf16Ptr(service.name))), syscall.NewCallback(serviceHandler), 0)
+	if err != nil {
+		return 0
+	}
+	service.handle = handle
+	setServiceState(serviceRunning, 0)
+
+	var exitCode uint32
+	if err := service.run(); err != nil {
+		log.Printf("%s: %v", service.name, err)
+		exitCode = 1
+	}
+	setServiceState(serviceStopped, exitCode)
+	return 0
+}
+
+// serviceHandler is the HandlerEx of the service
+func serviceHandler(control, eventType, eventData, context uintptr) uintptr {
+	switch control {
+	case serviceControlStop, serviceControlShut:
+		setServiceState(serviceStopPending, 0)
+		ys.Stop()
+	case serviceControlInterro:
+		setServiceState(0, 0)
+	}
+	return 0
+}
+
+// setServiceState reports the state of the service, or its current one again when 0
+func setServiceState(state, exitCode uint32) {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+	s := &service.status
+	s.ServiceType = serviceWin32Own
+	if state != 0 {
+		s.CurrentState = state
+		s.Win32ExitCode = exitCode
+		s.CheckPoint = 0
+		s.WaitHint = 0
+	}
+	s.ControlsAccepted = 0
+	switch s.CurrentState {
+	case serviceRunning:
+		s.ControlsAccepted = serviceAcceptStop | serviceAcceptShutdown
+	case serviceStopPending:
+		s.CheckPoint++
+		s.WaitHint = uint32(serviceStopTimeout / time.Millisecond)
+	}
+	procSetServiceStatus.Call(service.handle, uintptr(unsafe.Pointer(s)))
+}
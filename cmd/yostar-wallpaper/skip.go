@@ -0,0 +1,90 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// skipFlags are the flags of skip
+type skipFlags struct {
+	game   string
+	title  bool
+	reason string
+}
+
+// register adds the flags of skip to the flag set
+func (o *skipFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.game, "game", "", "Game of the entries added, or listed; entries without one apply to every game.")
+	fs.BoolVar(&o.title, "title", false, "Add title patterns, e.g. \"*collab*\", instead of item IDs.")
+	fs.StringVar(&o.reason, "reason", "", "Why the items are skipped, shown by list.")
+}
+
+// runSkip lists, adds or removes the entries of the skip list, the items the syncs
+// never queue
+func runSkip(db *sql.DB, args []string) error {
+	var o skipFlags
+	fs := newFlagSet("skip", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	// flags are also accepted after the action
+	action := fs.Arg(0)
+	if action != "" {
+		fs.Parse(fs.Args()[1:])
+	}
+	switch action {
+	case "", "list":
+		entries, err := ys.ListSkips(db, o.game)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tADDED\tGAME\tKIND\tPATTERN\tREASON")
+		for _, e := range entries {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", e.ID, e.At.Local().Format("2006-01-02 15:04"), orDash(e.Game), e.Kind, e.Pattern, e.Reason)
+		}
+		return w.Flush()
+	case "add":
+		if fs.NArg() == 0 {
+			return errors.New("item IDs or title patterns expected")
+		}
+		kind := ys.SkipID
+		if o.title {
+			kind = ys.SkipTitle
+		} else if o.game == "" {
+			return errors.New("--game is required with item IDs, which are only unique within a game")
+		}
+		for _, pattern := range fs.Args() {
+			id, err := ys.AddSkip(db, ys.SkipEntry{Game: o.game, Kind: kind, Pattern: pattern, Reason: o.reason})
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Added %s %q to the skip list as %d\n", kind, pattern, id)
+		}
+		return nil
+	case "remove":
+		if fs.NArg() == 0 {
+			return errors.New("IDs of skip list entries expected")
+		}
+		for _, arg := range fs.Args() {
+			id, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid ID %q", arg)
+			}
+			if err := ys.RemoveSkip(db, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	fs.Usage()
+	return fmt.Errorf("unknown action %q, list, add or remove expected", action)
+}
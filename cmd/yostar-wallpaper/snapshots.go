@@ -0,0 +1,58 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// snapshotsFlags are the flags of snapshots
+type snapshotsFlags struct {
+	game    string
+	extract int64
+	out     string
+}
+
+// register adds the flags of snapshots to the flag set
+func (o *snapshotsFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.game, "game", "", "Only snapshots of this game.")
+	fs.Int64Var(&o.extract, "extract", 0, "ID of a snapshot to decompress.")
+	fs.StringVar(&o.out, "out", "", "File the extracted snapshot is written to, standard output by default.")
+}
+
+// runSnapshots lists the API responses archived in the database, or extracts one
+func runSnapshots(db *sql.DB, args []string) error {
+	var o snapshotsFlags
+	fs := newFlagSet("snapshots", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if o.extract > 0 {
+		body, err := ys.ReadSnapshot(db, o.extract)
+		if err != nil {
+			return fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		if o.out == "" {
+			_, err = os.Stdout.Write(body)
+			return err
+		}
+		return os.WriteFile(o.out, body, 0644)
+	}
+
+	snapshots, err := ys.ListSnapshots(db, o.game)
+	if err != nil {
+		return fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tGAME\tREGION\tFETCHED\tSIZE\tURL")
+	for _, s := range snapshots {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\n", s.ID, s.Game, s.Region, s.FetchedAt.Local().Format("2006-01-02 15:04"), s.Size, s.URL)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// statsFlags are the flags of stats
+type statsFlags struct {
+	format string
+	top    int
+	record bool
+}
+
+// register adds the flags of stats to the flag set
+func (o *statsFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.format, "format", "table", "Output format (table, json).")
+	fs.IntVar(&o.top, "top", 10, "Number of artists listed in the table, 0 for all.")
+	fs.BoolVar(&o.record, "record", true, "Remember these stats to show the growth of the next run.")
+}
+
+// runStats prints the totals of the library and their growth since the last run
+func runStats(db *sql.DB, args []string) error {
+	var o statsFlags
+	fs := newFlagSet("stats", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	stats, err := ys.LibraryStats(db)
+	if err != nil {
+		return err
+	}
+
+	switch o.format {
+	case "table":
+		err = printStats(os.Stdout, stats, o.top)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(stats)
+	default:
+		return fmt.Errorf("unknown format %q", o.format)
+	}
+	if err != nil {
+		return err
+	}
+
+	if o.record {
+		return ys.RecordStats(db, stats)
+	}
+	return nil
+}
+
+// printStats prints stats as tables
+func printStats(out io.Writer, stats ys.Stats, top int) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "GAME\tITEMS\tFILES\tCATALOGED\tON DISK")
+	for _, g := range append(stats.Games, withName(stats.Total, "total")) {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\n", g.Game, g.Items, g.Files, g.Cataloged, ys.FormatBytes(g.Bytes))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if g := stats.Growth; g != nil {
+		fmt.Fprintf(out, "\nGrowth since %s\n", g.Since.Format("2006-01-02 15:04"))
+		w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "GAME\tITEMS\tFILES\tCATALOGED\tON DISK")
+		for _, d := range append(g.Games, withName(g.Total, "total")) {
+			fmt.Fprintf(w, "%s\t%+d\t%+d\t%+d\t%s\n", d.Game, d.Items, d.Files, d.Cataloged, signedBytes(d.Bytes))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	artists := stats.Artists
+	if top > 0 && len(artists) > top {
+		artists = artists[:top]
+	}
+	if len(artists) > 0 {
+		fmt.Fprintf(out, "\nTop artists (%d credited)\n", len(stats.Artists))
+		if err := printCounts(out, "ARTIST", artists); err != nil {
+			return err
+		}
+	}
+	if len(stats.Months) > 0 {
+		fmt.Fprintln(out, "\nAdded per month")
+		return printCounts(out, "MONTH", stats.Months)
+	}
+	return nil
+}
+
+// printCounts prints a table of counts
+func printCounts(out io.Writer, header string, counts []ys.Count) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\tITEMS\n", header)
+	for _, c := range counts {
+		fmt.Fprintf(w, "%s\t%d\n", c.Name, c.Items)
+	}
+	return w.Flush()
+}
+
+// withName returns g named name
+func withName(g ys.GameStats, name string) ys.GameStats {
+	g.Game = name
+	return g
+}
+
+// signedBytes prints a size difference with its sign, e.g. +1.2 MiB
+func signedBytes(n int64) string {
+	if n < 0 {
+		return "-" + ys.FormatBytes(-n)
+	}
+	return "+" + ys.FormatBytes(n)
+}
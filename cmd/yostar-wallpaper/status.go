@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// statusFlags are the flags of status
+type statusFlags struct {
+	format  string
+	skip    string
+	timeout time.Duration
+}
+
+// register adds the flags of status to the flag set
+func (o *statusFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.format, "format", "table", "Output format (table, json).")
+	fs.StringVar(&o.skip, "skip", "", "Comma separated crawlers or games not to check.")
+	fs.DurationVar(&o.timeout, "timeout", 2*time.Minute, "Time after which the check of a game is given up.")
+}
+
+// runStatus checks the API of each game at once and compares what it lists with
+// the library
+func runStatus(db *sql.DB, args []string) error {
+	var o statusFlags
+	fs := newFlagSet("status", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if o.format != "table" && o.format != "json" {
+		return fmt.Errorf("unknown format %q", o.format)
+	}
+
+	selected := ""
+	if fs.NArg() > 0 && fs.Arg(0) != "all" {
+		selected = strings.Join(fs.Args(), ",")
+	}
+	names, err := syncCrawlers(defaultSyncOrder, selected, o.skip)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return errors.New("no crawler left to check")
+	}
+	env, err := syncEnv()
+	if err != nil {
+		return err
+	}
+
+	statuses := make([]ys.APIStatus, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			statuses[i] = checkCrawler(db, name, env, o.timeout)
+		}(i, name)
+	}
+	wg.Wait()
+
+	if o.format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(statuses); err != nil {
+			return err
+		}
+	} else if err := printStatus(statuses); err != nil {
+		return err
+	}
+
+	var unreachable []string
+	for _, s := range statuses {
+		if !s.Reachable {
+			unreachable = append(unreachable, s.Game)
+		}
+	}
+	if len(unreachable) > 0 {
+		return fmt.Errorf("API of %s unreachable", strings.Join(unreachable, ", "))
+	}
+	return nil
+}
+
+// checkCrawler runs the crawler name with --status and returns the status it prints,
+// or the counts of the library with the error when it fails
+func checkCrawler(db *sql.DB, name string, env []string, timeout time.Duration) ys.APIStatus {
+	fail := func(err error) ys.APIStatus {
+		s, localErr := ys.LocalAPIStatus(db, crawlers[name].Game)
+		s.Error = err.Error()
+		if localErr != nil {
+			s.Error += "; " + localErr.Error()
+		}
+		return s
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return fail(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, self, append(globalArgs(), name, "--status")...)
+	cmd.Env = env
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return fail(fmt.Errorf("no answer within %s", timeout))
+		}
+		// the last line logged by the crawler tells why it failed
+		lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+		if last := lines[len(lines)-1]; last != "" {
+			return fail(errors.New(last))
+		}
+		return fail(err)
+	}
+
+	var s ys.APIStatus
+	if err := json.Unmarshal(stdout.Bytes(), &s); err != nil {
+		return fail(fmt.Errorf("invalid output of %s --status: %w", name, err))
+	}
+	return s
+}
+
+// printStatus prints the statuses as a table, then the errors of the APIs failing
+func printStatus(statuses []ys.APIStatus) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "GAME\tREGION\tAPI\tLISTED\tNEWEST\tLOCAL\tLOCAL NEWEST\tSTATUS")
+	for _, s := range statuses {
+		api, listed, state := "unreachable", "-", "unknown"
+		if s.Reachable {
+			api = fmt.Sprintf("ok, %.1fs", s.Elapsed)
+			listed = fmt.Sprint(s.Items)
+			state = "up to date"
+			if !s.UpToDate() {
+				state = fmt.Sprintf("%d missing", s.Missing)
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n", s.Game, orDash(s.Region), api, listed, formatDay(s.Newest), s.Local, formatDay(s.LocalNew), state)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	for _, s := range statuses {
+		if s.Error != "" {
+			fmt.Printf("\n%s: %s\n", s.Game, s.Error)
+		}
+	}
+	return nil
+}
+
+// formatDay prints the day of t, or - when nil
+func formatDay(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format("2006-01-02")
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+	gamecrawlers "github.com/YukiHime23/go-wallpaper-yostar/crawlers"
+)
+
+// defaultSyncOrder is the order sync runs the crawlers in, that of gamecrawlers.All
+var defaultSyncOrder = func() string {
+	names := make([]string, len(gamecrawlers.All))
+	for i, c := range gamecrawlers.All {
+		names[i] = c.Name
+	}
+	return strings.Join(names, ",")
+}()
+
+// syncFlags are the flags of sync
+type syncFlags struct {
+	order string
+	only  string
+	skip  string
+}
+
+// register adds the flags of sync to the flag set
+func (o *syncFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.order, "order", defaultSyncOrder, "Comma separated crawlers or games, in the order they are synced; those left out come last, in the default order.")
+	fs.StringVar(&o.only, "only", "", "Comma separated crawlers or games to sync, instead of all.")
+	fs.StringVar(&o.skip, "skip", "", "Comma separated crawlers or games not to sync, e.g. in the configuration file to disable them.")
+}
+
+// runSync runs the crawlers of the games, one after the other, on the library
+func runSync(db *sql.DB, args []string) error {
+	var o syncFlags
+	fs := newFlagSet("sync", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	// the crawlers named on the command line are synced like with --only
+	selected := o.only
+	if fs.NArg() > 0 && fs.Arg(0) != "all" {
+		selected = strings.Join(fs.Args(), ",")
+	}
+	names, err := syncCrawlers(o.order, selected, o.skip)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return errors.New("no crawler left to sync")
+	}
+	return syncLibrary(names)
+}
+
+// syncLibrary runs the crawlers names, one after the other, and reports those failing
+func syncLibrary(names []string) error {
+	env, err := syncEnv()
+	if err != nil {
+		return err
+	}
+	// Ctrl+C reaches the crawler running too, which stops after its downloads, and
+	// no other crawler is run
+	ctx, release := ys.Graceful()
+	defer release()
+	var failed []string
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return ys.ErrInterrupted
+		}
+		log.Printf("Syncing %s", name)
+		start := time.Now()
+		if err := runCrawler(name, env); err != nil {
+			log.Printf("Error syncing %s: %v", name, err)
+			failed = append(failed, name)
+			continue
+		}
+		log.Printf("Synced %s in %s", name, time.Since(start).Round(time.Second))
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to sync %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// syncCrawlers returns the crawlers to run, in order: those of only, or all, less
+// those of skip. The lists name crawlers or their games.
+func syncCrawlers(order, only, skip string) ([]string, error) {
+	ordered, err := crawlerList(order)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --order: %w", err)
+	}
+	// those left out keep the default order
+	all, _ := crawlerList(defaultSyncOrder)
+	for _, name := range all {
+		if !contains(ordered, name) {
+			ordered = append(ordered, name)
+		}
+	}
+	selected, err := crawlerList(only)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --only: %w", err)
+	}
+	skipped, err := crawlerList(skip)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --skip: %w", err)
+	}
+
+	var names []string
+	for _, name := range ordered {
+		if (len(selected) == 0 || contains(selected, name)) && !contains(skipped, name) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// crawlerList returns the crawlers of a comma separated list of crawlers or games
+func crawlerList(list string) ([]string, error) {
+	var names []string
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		name, ok := crawlerOf(s)
+		if !ok {
+			return nil, fmt.Errorf("unknown crawler or game %q", s)
+		}
+		if !contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// crawlerOf returns the crawler named s, by name, alias or game
+func crawlerOf(s string) (string, bool) {
+	for name, c := range crawlers {
+		if s == name || s == c.Game || contains(c.Aliases, s) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// syncEnv returns the environment of the crawlers, naming the database and the
+// configuration file of yostar-wallpaper so that they sync the same library
+func syncEnv() ([]string, error) {
+	dbPath, err := filepath.Abs(ys.DatabasePath())
+	if err != nil {
+		return nil, err
+	}
+	configPath, err := filepath.Abs(ys.ConfigPath())
+	if err != nil {
+		return nil, err
+	}
+	return append(os.Environ(), "YOSTAR_DB="+dbPath, "YOSTAR_CONFIG="+configPath), nil
+}
+
+// runCrawler runs the crawler name in a yostar-wallpaper process of its own, so
+// that the options and hooks of one crawler don't carry over to the next, with the
+// global flags given to this one
+func runCrawler(name string, env []string) error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(self, append(globalArgs(), name)...)
+	cmd.Env = env
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+// crawlerFlags returns the function adding the flags of the crawler c to a flag set
+func crawlerFlags(c ys.Crawler) func(*flag.FlagSet) {
+	return func(fs *flag.FlagSet) { c.Flags(fs) }
+}
+
+// crawlerCommand returns the command running the crawler c, main having applied
+// the global flags given to yostar-wallpaper before its own
+func crawlerCommand(c ys.Crawler) func(db *sql.DB, args []string) error {
+	return func(db *sql.DB, args []string) error {
+		var run func() error
+		fs := newFlagSet(c.Name, func(fs *flag.FlagSet) { run = c.Flags(fs) })
+		if err := config.Apply(c.Name, ys.CrawlerTarget(fs)); err != nil {
+			return fmt.Errorf("invalid configuration:\n%w", err)
+		}
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		return run()
+	}
+}
+
+// globalArgs returns the global flags given to yostar-wallpaper, passed on to the
+// crawlers run in processes of their own
+func globalArgs() []string {
+	var args []string
+	flag.CommandLine.Visit(func(f *flag.Flag) {
+		args = append(args, "--"+f.Name+"="+f.Value.String())
+	})
+	return args
+}
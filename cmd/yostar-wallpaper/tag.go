@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// tagFlags are the flags of tag
+type tagFlags struct {
+	filterFlags
+	taggerCmd string
+	add       string
+	retag     bool
+}
+
+// register adds the flags of tag to the flag set
+func (o *tagFlags) register(fs *flag.FlagSet) {
+	o.filterFlags.register(fs)
+	fs.StringVar(&o.taggerCmd, "tagger", "", "Command run on each image to tag it, e.g. \"python wd14.py {file}\".")
+	fs.StringVar(&o.add, "add", "", "Comma separated tags to add by hand.")
+	fs.BoolVar(&o.retag, "retag", false, "Run the tagger on wallpapers that already have tags.")
+}
+
+// runTag tags the wallpapers matching the filter flags, with an external tagger or by hand
+func runTag(db *sql.DB, args []string) error {
+	var o tagFlags
+	fs := newFlagSet("tag", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if o.taggerCmd == "" && o.add == "" {
+		return errors.New("--tagger or --add is required")
+	}
+
+	filter, err := o.filter()
+	if err != nil {
+		return err
+	}
+	items, err := ys.FindGalleryItems(db, filter)
+	if err != nil {
+		return fmt.Errorf("failed to query wallpapers: %w", err)
+	}
+
+	if o.add != "" {
+		tags := strings.Split(o.add, ",")
+		for _, item := range items {
+			if err := ys.AddTags(db, item.ID, "manual", tags...); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("Added %d tags to %d wallpapers\n", len(tags), len(items))
+	}
+
+	if o.taggerCmd == "" {
+		return nil
+	}
+	tagger, err := ys.NewCommandTagger(o.taggerCmd)
+	if err != nil {
+		return fmt.Errorf("invalid --tagger: %w", err)
+	}
+
+	var tagged int
+	for _, item := range items {
+		if item.Path == "" {
+			continue
+		}
+		if !o.retag {
+			existing, err := ys.GetTags(db, item.ID)
+			if err != nil {
+				return err
+			}
+			if len(existing) > 0 {
+				continue
+			}
+		}
+
+		tags, err := ys.TagGalleryItem(context.Background(), db, tagger, item)
+		if err != nil {
+			log.Printf("Error tagging %s: %v", item.FileName, err)
+			continue
+		}
+		log.Printf(`-> tagged "%s": %s <-`, item.FileName, strings.Join(tags, ", "))
+		tagged++
+	}
+	fmt.Printf("Tagged %d wallpapers\n", tagged)
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// progressWidth is the number of characters of the progress bar
+const progressWidth = 30
+
+// verifyFlags are the flags of verify
+type verifyFlags struct {
+	filterFlags
+	workers int
+	report  string
+}
+
+// register adds the flags of verify to the flag set
+func (o *verifyFlags) register(fs *flag.FlagSet) {
+	o.filterFlags.register(fs)
+	fs.IntVar(&o.workers, "workers", runtime.NumCPU(), "Number of files hashed at a time.")
+	fs.StringVar(&o.report, "report", "", "File the JSON report is written to, - for standard output.")
+}
+
+// runVerify hashes the files of the wallpapers matching the filter flags and compares
+// them with their checksums
+func runVerify(db *sql.DB, args []string) error {
+	var o verifyFlags
+	fs := newFlagSet("verify", o.register)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	filter, err := o.filter()
+	if err != nil {
+		return err
+	}
+	items, err := ys.FindGalleryItems(db, filter)
+	if err != nil {
+		return fmt.Errorf("failed to query wallpapers: %w", err)
+	}
+
+	var progress ys.VerifyProgress
+	if isTerminal(os.Stderr) {
+		progress = newProgressBar(time.Now()).update
+	}
+	r := ys.VerifyItems(items, o.workers, progress)
+	if progress != nil {
+		fmt.Fprintln(os.Stderr)
+	}
+
+	if o.report != "" {
+		if err := writeVerifyReport(o.report, r); err != nil {
+			return err
+		}
+	}
+	// the summary does not mix with a report on standard output
+	if o.report != "-" {
+		for _, p := range r.Problems {
+			fmt.Printf("  %-8s %s/%s/%s  %s %s\n", p.Status, p.Game, p.Type, p.IdGallery, p.Path, p.Error)
+		}
+		fmt.Printf("Verified %d files (%s) in %s: %d ok, %d problems\n", r.Checked, ys.FormatBytes(r.Bytes),
+			r.Duration.Round(time.Millisecond), r.OK, len(r.Problems))
+	}
+	if len(r.Problems) > 0 {
+		return fmt.Errorf("%d files did not verify", len(r.Problems))
+	}
+	return nil
+}
+
+// writeVerifyReport writes the report as JSON into the file p, or to standard
+// output for -
+func writeVerifyReport(p string, r ys.VerifyReport) error {
+	body, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	body = append(body, '\n')
+	if p == "-" {
+		_, err = os.Stdout.Write(body)
+		return err
+	}
+	return os.WriteFile(p, body, 0644)
+}
+
+// isTerminal reports whether f is a terminal, where a progress bar can be redrawn
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// progressBar redraws a progress bar on standard error
+type progressBar struct {
+	mu    sync.Mutex
+	start time.Time
+	last  time.Time
+}
+
+func newProgressBar(start time.Time) *progressBar {
+	return &progressBar{start: start}
+}
+
+// update redraws the bar, at most ten times a second and for the last file
+func (b *progressBar) update(done, total int, bytes int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if done < total && now.Sub(b.last) < 100*time.Millisecond {
+		return
+	}
+	b.last = now
+
+	filled := progressWidth * done / max(total, 1)
+	elapsed := now.Sub(b.start)
+	rate := float64(bytes) / max(elapsed.Seconds(), 0.001)
+	eta := time.Duration(float64(elapsed) * float64(total-done) / float64(max(done, 1)))
+	fmt.Fprintf(os.Stderr, "\r[%s%s] %d/%d files, %s, %s/s, %s left ", strings.Repeat("#", filled), strings.Repeat(".", progressWidth-filled),
+		done, total, ys.FormatBytes(bytes), ys.FormatBytes(int64(rate)), eta.Round(time.Second))
+}
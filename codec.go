@@ -0,0 +1,157 @@
+package crawal
+
+import (
+	"context"
+	"fmt"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Codec converts the image files of the library into one format
+type Codec interface {
+	// Ext returns the extension of the files it writes, with its dot
+	Ext() string
+	// Convert writes the image at src into the file dst
+	Convert(ctx context.Context, src, dst string) error
+}
+
+// codecs are the codecs registered by format name
+var (
+	codecsMu sync.Mutex
+	codecs   = map[string]func() (Codec, error){
+		"jpeg": func() (Codec, error) { return jpegCodec{quality: 90}, nil },
+		"png":  func() (Codec, error) { return pngCodec{}, nil },
+		"heic": heicCodec,
+	}
+)
+
+// heicEncoders are the command lines of the HEIC encoders looked up in the PATH,
+// in order of preference: libheif, macOS and ImageMagick
+var heicEncoders = []string{
+	"heif-enc --quality 90 --output {out} {file}",
+	"sips --setProperty format heic {file} --out {out}",
+	"magick {file} -quality 90 {out}",
+}
+
+// RegisterCodec makes a codec available under the name of a format, replacing the
+// one registered with that name. newCodec is called each time the codec is used.
+func RegisterCodec(format string, newCodec func() (Codec, error)) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[strings.ToLower(format)] = newCodec
+}
+
+// Codecs returns the names of the registered formats, in alphabetical order
+func Codecs() []string {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	var names []string
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewCodec returns the codec of a format: the registered one, or one running the
+// command line with the {file} and {out} placeholders when command is not empty,
+// e.g. `cwebp -q 80 {file} -o {out}` for webp
+func NewCodec(format, command string) (Codec, error) {
+	format = strings.ToLower(strings.TrimPrefix(format, "."))
+	if format == "" {
+		return nil, fmt.Errorf("no format")
+	}
+	if command != "" {
+		if _, err := splitCommand(command); err != nil {
+			return nil, err
+		}
+		return commandCodec{command: command, ext: "." + format}, nil
+	}
+
+	codecsMu.Lock()
+	newCodec, ok := codecs[format]
+	codecsMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no codec for %s, give the command line of an encoder", format)
+	}
+	return newCodec()
+}
+
+// jpegCodec encodes with the standard library, losing the transparency
+type jpegCodec struct {
+	quality int
+}
+
+func (jpegCodec) Ext() string { return ".jpg" }
+
+func (c jpegCodec) Convert(ctx context.Context, src, dst string) error {
+	img, err := decodeImage(src)
+	if err != nil {
+		return err
+	}
+	out, err := createFile(dst)
+	if err != nil {
+		return err
+	}
+	if err := jpeg.Encode(out, img, &jpeg.Options{Quality: c.quality}); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to encode %s: %w", dst, err)
+	}
+	return out.Close()
+}
+
+// pngCodec encodes with the standard library
+type pngCodec struct{}
+
+func (pngCodec) Ext() string { return ".png" }
+
+func (pngCodec) Convert(ctx context.Context, src, dst string) error {
+	img, err := decodeImage(src)
+	if err != nil {
+		return err
+	}
+	out, err := createFile(dst)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(out, img); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to encode %s: %w", dst, err)
+	}
+	return out.Close()
+}
+
+// heicCodec returns a codec running the first HEIC encoder found, as the standard
+// library has none
+func heicCodec() (Codec, error) {
+	for _, command := range heicEncoders {
+		program, _, _ := strings.Cut(command, " ")
+		if _, err := exec.LookPath(program); err == nil {
+			return commandCodec{command: command, ext: ".heic"}, nil
+		}
+	}
+	return nil, fmt.Errorf("no HEIC encoder found, install libheif (heif-enc) or ImageMagick, or give the command line of one")
+}
+
+// commandCodec runs an external encoder
+type commandCodec struct {
+	command string
+	ext     string
+}
+
+func (c commandCodec) Ext() string { return c.ext }
+
+func (c commandCodec) Convert(ctx context.Context, src, dst string) error {
+	if _, err := runCommand(ctx, c.command, defaultCommandTimeout, map[string]string{"file": src, "out": dst}); err != nil {
+		return fmt.Errorf("encoder failed: %w", err)
+	}
+	if _, err := os.Stat(dst); err != nil {
+		return fmt.Errorf("encoder wrote no %s", dst)
+	}
+	return ownFile(dst)
+}
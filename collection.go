@@ -0,0 +1,494 @@
+package crawal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Ways of exporting the wallpapers of a collection into its folder
+const (
+	ExportSymlink  = "symlink"  // symbolic links to the files of the library
+	ExportHardlink = "hardlink" // hard links, on the file system of the library only
+	ExportCopy     = "copy"     // copies, e.g. for a folder synced to another device
+)
+
+// Sources of the members of a collection
+const (
+	memberQuery    = "query"    // matched by the query of the collection
+	memberManual   = "manual"   // added by hand
+	memberExcluded = "excluded" // removed by hand, not added back by the query
+)
+
+// ErrNoCollection is returned for a collection name not in the library
+var ErrNoCollection = errors.New("no such collection")
+
+// Collection is a named set of wallpapers, like a virtual album: the wallpapers
+// matching its query, if any, and those added by hand
+type Collection struct {
+	ID        int64
+	Name      string
+	Query     *Filter // nil for collections of wallpapers added by hand only
+	Rules     string  // rules the query of a smart collection is parsed from
+	Folder    string  // folder the wallpapers are exported to, none when empty
+	Mode      string  // how they are exported to Folder
+	Members   int
+	CreatedAt time.Time
+}
+
+// CollectionUpdate tells what updating a collection changed
+type CollectionUpdate struct {
+	Added    int // members matching the query since the last update
+	Removed  int // members no longer matching it
+	Exported int // files added to the folder
+	Deleted  int // files removed from the folder
+}
+
+// CheckExportMode returns an error if mode is not one of the export modes
+func CheckExportMode(mode string) error {
+	switch mode {
+	case ExportSymlink, ExportHardlink, ExportCopy:
+		return nil
+	}
+	return fmt.Errorf("unknown export mode %q", mode)
+}
+
+// CreateCollection creates a collection, of the wallpapers matching query when it
+// is not nil, which are added right away
+func CreateCollection(db *sql.DB, name string, query *Filter) (Collection, error) {
+	return createCollection(db, name, query, "")
+}
+
+// CreateSmartCollection creates a collection of the wallpapers matching rules, see
+// ParseRules, which gains the new matches each time the crawlers sync
+func CreateSmartCollection(db *sql.DB, name, rules string) (Collection, error) {
+	query, err := ParseRules(rules)
+	if err != nil {
+		return Collection{}, err
+	}
+	return createCollection(db, name, &query, rules)
+}
+
+func createCollection(db *sql.DB, name string, query *Filter, rules string) (Collection, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Collection{}, errors.New("empty collection name")
+	}
+	var encoded string
+	if query != nil {
+		b, err := json.Marshal(query)
+		if err != nil {
+			return Collection{}, err
+		}
+		encoded = string(b)
+	}
+	if _, err := db.Exec("INSERT INTO collections(name, query, rules) VALUES (?, ?, ?)", name, encoded, rules); err != nil {
+		return Collection{}, fmt.Errorf("failed to create collection %q: %w", name, err)
+	}
+	c, err := GetCollection(db, name)
+	if err != nil {
+		return Collection{}, err
+	}
+	if query != nil {
+		if _, err := UpdateCollection(db, &c); err != nil {
+			return Collection{}, err
+		}
+	}
+	return c, nil
+}
+
+const collectionColumns = `c.id, c.name, c.query, c.rules, c.folder, c.export_mode, c.created_at,
+	(SELECT COUNT(*) FROM collection_items m WHERE m.collection_id = c.id AND m.source != '` + memberExcluded + `')`
+
+func scanCollection(row rowScanner) (Collection, error) {
+	var c Collection
+	var query string
+	if err := row.Scan(&c.ID, &c.Name, &query, &c.Rules, &c.Folder, &c.Mode, &c.CreatedAt, &c.Members); err != nil {
+		return Collection{}, err
+	}
+	if query != "" {
+		c.Query = new(Filter)
+		if err := json.Unmarshal([]byte(query), c.Query); err != nil {
+			return Collection{}, fmt.Errorf("invalid query of collection %q: %w", c.Name, err)
+		}
+	}
+	return c, nil
+}
+
+// GetCollection returns the collection with this name
+func GetCollection(db *sql.DB, name string) (Collection, error) {
+	c, err := scanCollection(db.QueryRow("SELECT "+collectionColumns+" FROM collections c WHERE c.name = ?", name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Collection{}, fmt.Errorf("%w %q", ErrNoCollection, name)
+	}
+	return c, err
+}
+
+// ListCollections returns the collections of the library by name
+func ListCollections(db *sql.DB) ([]Collection, error) {
+	rows, err := db.Query("SELECT " + collectionColumns + " FROM collections c ORDER BY c.name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var collections []Collection
+	for rows.Next() {
+		c, err := scanCollection(rows)
+		if err != nil {
+			return nil, err
+		}
+		collections = append(collections, c)
+	}
+	return collections, rows.Err()
+}
+
+// DeleteCollection deletes a collection, and the files exported to its folder
+func DeleteCollection(db *sql.DB, c Collection) error {
+	if _, err := removeExported(db, c, nil); err != nil {
+		return err
+	}
+	_, err := db.Exec("DELETE FROM collections WHERE id = ?", c.ID)
+	return err
+}
+
+// CollectionItems returns the wallpapers of a collection, oldest first
+func CollectionItems(db *sql.DB, c Collection) ([]GalleryItem, error) {
+	rows, err := db.Query(`SELECT `+galleryColumns+` FROM gallery WHERE id IN (
+		SELECT gallery_id FROM collection_items WHERE collection_id = ? AND source != ?
+	) ORDER BY id`, c.ID, memberExcluded)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []GalleryItem
+	for rows.Next() {
+		item, err := scanGalleryItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// AddToCollection adds wallpapers to a collection by hand, including those removed
+// from it before, and returns how many were not in it. The query of the collection
+// does not remove them.
+func AddToCollection(db *sql.DB, c Collection, items []GalleryItem) (int, error) {
+	var added int
+	for _, item := range items {
+		member, err := isMember(db, c, item)
+		if err != nil {
+			return added, err
+		}
+		_, err = db.Exec(`INSERT INTO collection_items(collection_id, gallery_id, source) VALUES (?, ?, ?)
+			ON CONFLICT(collection_id, gallery_id) DO UPDATE SET source = excluded.source`,
+			c.ID, item.ID, memberManual)
+		if err != nil {
+			return added, fmt.Errorf("failed to add %q to collection: %w", item.FileName, err)
+		}
+		if !member {
+			added++
+		}
+	}
+	return added, nil
+}
+
+// RemoveFromCollection removes wallpapers from a collection, for good: the query
+// does not add them back. It returns how many were in it.
+func RemoveFromCollection(db *sql.DB, c Collection, items []GalleryItem) (int, error) {
+	var removed int
+	for _, item := range items {
+		member, err := isMember(db, c, item)
+		if err != nil {
+			return removed, err
+		}
+		// only the query could add them back
+		if c.Query == nil {
+			_, err = db.Exec("DELETE FROM collection_items WHERE collection_id = ? AND gallery_id = ?", c.ID, item.ID)
+		} else {
+			_, err = db.Exec(`INSERT INTO collection_items(collection_id, gallery_id, source) VALUES (?, ?, ?)
+				ON CONFLICT(collection_id, gallery_id) DO UPDATE SET source = excluded.source`,
+				c.ID, item.ID, memberExcluded)
+		}
+		if err != nil {
+			return removed, fmt.Errorf("failed to remove %q from collection: %w", item.FileName, err)
+		}
+		if member {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// isMember reports whether a wallpaper is in a collection
+func isMember(db *sql.DB, c Collection, item GalleryItem) (bool, error) {
+	var source string
+	err := db.QueryRow("SELECT source FROM collection_items WHERE collection_id = ? AND gallery_id = ?", c.ID, item.ID).Scan(&source)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil && source != memberExcluded, err
+}
+
+// UpdateCollection adds the wallpapers matching the query of a collection since
+// the last update and removes those no longer matching it, then updates the files
+// of its folder
+func UpdateCollection(db *sql.DB, c *Collection) (CollectionUpdate, error) {
+	var update CollectionUpdate
+	if c.Query != nil {
+		items, err := FindGalleryItems(db, *c.Query)
+		if err != nil {
+			return update, fmt.Errorf("failed to query wallpapers: %w", err)
+		}
+		matches := make(map[int64]bool, len(items))
+		for _, item := range items {
+			matches[item.ID] = true
+			res, err := db.Exec("INSERT OR IGNORE INTO collection_items(collection_id, gallery_id, source) VALUES (?, ?, ?)",
+				c.ID, item.ID, memberQuery)
+			if err != nil {
+				return update, err
+			}
+			if n, _ := res.RowsAffected(); n > 0 {
+				update.Added++
+			}
+		}
+
+		ids, err := memberIDs(db, c.ID, memberQuery)
+		if err != nil {
+			return update, err
+		}
+		for _, id := range ids {
+			if matches[id] {
+				continue
+			}
+			if _, err := db.Exec("DELETE FROM collection_items WHERE collection_id = ? AND gallery_id = ?", c.ID, id); err != nil {
+				return update, err
+			}
+			update.Removed++
+		}
+	}
+
+	if c.Folder != "" {
+		exported, deleted, err := exportCollection(db, *c)
+		update.Exported, update.Deleted = exported, deleted
+		if err != nil {
+			return update, err
+		}
+	}
+
+	updated, err := GetCollection(db, c.Name)
+	if err != nil {
+		return update, err
+	}
+	*c = updated
+	return update, nil
+}
+
+// UpdateCollections updates every collection of the library
+func UpdateCollections(db *sql.DB) error {
+	collections, err := ListCollections(db)
+	if err != nil {
+		return err
+	}
+	for _, c := range collections {
+		update, err := UpdateCollection(db, &c)
+		if err != nil {
+			return fmt.Errorf("collection %q: %w", c.Name, err)
+		}
+		if update != (CollectionUpdate{}) {
+			logger.Printf("Collection %q: %d added, %d removed, %d files exported, %d deleted", c.Name, update.Added, update.Removed, update.Exported, update.Deleted)
+		}
+	}
+	return nil
+}
+
+func memberIDs(db *sql.DB, collectionID int64, source string) ([]int64, error) {
+	rows, err := db.Query("SELECT gallery_id FROM collection_items WHERE collection_id = ? AND source = ?", collectionID, source)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ExportCollection exports the wallpapers of a collection into folder and remembers
+// it, so that updating the collection adds and removes files as its members change.
+// The files exported before to another folder are removed.
+func ExportCollection(db *sql.DB, c *Collection, folder, mode string) (CollectionUpdate, error) {
+	if err := CheckExportMode(mode); err != nil {
+		return CollectionUpdate{}, err
+	}
+	folder, err := filepath.Abs(folder)
+	if err != nil {
+		return CollectionUpdate{}, err
+	}
+
+	var update CollectionUpdate
+	if c.Folder != storedPath(folder) || c.Mode != mode {
+		if update.Deleted, err = removeExported(db, *c, nil); err != nil {
+			return update, err
+		}
+		if _, err := db.Exec("UPDATE collections SET folder = ?, export_mode = ? WHERE id = ?", storedPath(folder), mode, c.ID); err != nil {
+			return update, err
+		}
+		c.Folder, c.Mode = storedPath(folder), mode
+	}
+	exported, deleted, err := exportCollection(db, *c)
+	update.Exported, update.Deleted = exported, update.Deleted+deleted
+	return update, err
+}
+
+// exportCollection adds the files of the members of a collection missing from its
+// folder, and removes those of the wallpapers no longer in it. The files are named
+// after the files of the library, numbered "name_(2).ext" when two have the same
+// name.
+func exportCollection(db *sql.DB, c Collection) (int, int, error) {
+	items, err := CollectionItems(db, c)
+	if err != nil {
+		return 0, 0, err
+	}
+	members := make(map[int64]bool, len(items))
+	for _, item := range items {
+		members[item.ID] = true
+	}
+	deleted, err := removeExported(db, c, members)
+	if err != nil {
+		return 0, deleted, err
+	}
+
+	folder := resolvePath(c.Folder)
+	if err := makeDirs(folder); err != nil {
+		return 0, deleted, err
+	}
+	exported, err := exportedFiles(db, c.ID)
+	if err != nil {
+		return 0, deleted, err
+	}
+	used := make(map[string]bool, len(exported))
+	for _, name := range exported {
+		used[strings.ToLower(name)] = true
+	}
+
+	var added int
+	for _, item := range items {
+		if item.Path == "" {
+			continue // cataloged only
+		}
+		if name, ok := exported[item.ID]; ok {
+			if _, err := os.Lstat(filepath.Join(folder, name)); err == nil {
+				continue
+			}
+			delete(used, strings.ToLower(name))
+		}
+
+		name := exportName(folder, filepath.Base(item.Path), used)
+		if err := exportFile(item.Path, filepath.Join(folder, name), c.Mode); err != nil {
+			return added, deleted, fmt.Errorf("failed to export %q: %w", item.FileName, err)
+		}
+		used[strings.ToLower(name)] = true
+		if _, err := db.Exec("INSERT OR REPLACE INTO collection_files(collection_id, gallery_id, name) VALUES (?, ?, ?)", c.ID, item.ID, name); err != nil {
+			return added, deleted, err
+		}
+		added++
+	}
+	return added, deleted, nil
+}
+
+// exportedFiles returns the names of the files exported to the folder of a
+// collection, by wallpaper
+func exportedFiles(db *sql.DB, collectionID int64) (map[int64]string, error) {
+	rows, err := db.Query("SELECT gallery_id, name FROM collection_files WHERE collection_id = ?", collectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		files[id] = name
+	}
+	return files, rows.Err()
+}
+
+// removeExported removes the files exported to the folder of a collection for the
+// wallpapers not in keep, leaving the other files of the folder alone
+func removeExported(db *sql.DB, c Collection, keep map[int64]bool) (int, error) {
+	exported, err := exportedFiles(db, c.ID)
+	if err != nil {
+		return 0, err
+	}
+	var removed int
+	for id, name := range exported {
+		if keep[id] {
+			continue
+		}
+		p := filepath.Join(resolvePath(c.Folder), name)
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return removed, fmt.Errorf("failed to remove %s: %w", p, err)
+		}
+		if _, err := db.Exec("DELETE FROM collection_files WHERE collection_id = ? AND gallery_id = ?", c.ID, id); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// exportName returns name, numbered when used by another exported file or by a
+// file of the folder that is not one
+func exportName(folder, name string, used map[string]bool) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for n := 2; ; n++ {
+		if !used[strings.ToLower(name)] {
+			if _, err := os.Lstat(filepath.Join(folder, name)); errors.Is(err, os.ErrNotExist) {
+				return name
+			}
+		}
+		name = fmt.Sprintf("%s_(%d)%s", base, n, ext)
+	}
+}
+
+// exportFile places the file at src as dst, the way mode tells
+func exportFile(src, dst, mode string) error {
+	switch mode {
+	case ExportSymlink:
+		target, err := filepath.Abs(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, dst)
+	case ExportHardlink:
+		return os.Link(src, dst)
+	}
+	// copied under a hidden name first, so that the rotators watching the folder
+	// never pick up a partial file
+	tmp := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".part")
+	if err := copyFile(src, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
@@ -0,0 +1,96 @@
+package crawal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// defaultCommandTimeout bounds a single run of an external command
+const defaultCommandTimeout = 60 * time.Second
+
+// runCommand runs a command line with its {name} placeholders expanded and returns its output
+func runCommand(ctx context.Context, command string, timeout time.Duration, vars map[string]string) ([]byte, error) {
+	args, err := splitCommand(command)
+	if err != nil {
+		return nil, err
+	}
+	args = expandArgs(args, vars)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// splitCommand splits a command line into arguments, honoring single and double quotes
+func splitCommand(command string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	var quote rune
+	inArg := false
+
+	for _, r := range command {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in command %q", command)
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	if len(args) == 0 {
+		return nil, errors.New("empty command")
+	}
+	return args, nil
+}
+
+// expandArgs replaces {name} placeholders in the arguments. When the {file}
+// placeholder is not used, the file is appended as the last argument.
+func expandArgs(args []string, vars map[string]string) []string {
+	expanded := make([]string, 0, len(args)+1)
+	usedFile := false
+	for _, arg := range args {
+		if strings.Contains(arg, "{file}") {
+			usedFile = true
+		}
+		for name, value := range vars {
+			arg = strings.ReplaceAll(arg, "{"+name+"}", value)
+		}
+		expanded = append(expanded, arg)
+	}
+	if !usedFile {
+		expanded = append(expanded, vars["file"])
+	}
+	return expanded
+}
@@ -0,0 +1,464 @@
+package crawal
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// configFile is the configuration file read next to the database, unless the
+// YOSTAR_CONFIG environment variable names another file
+const configFile = "yostar.conf"
+
+// envPrefix starts the environment variables setting options, e.g. YOSTAR_DNS for
+// every program and command, or YOSTAR_SERVE_ADDR for the --addr of serve
+const envPrefix = "YOSTAR_"
+
+// reservedEnv are the environment variables that are not options
+var reservedEnv = map[string]bool{"YOSTAR_DB": true, "YOSTAR_CONFIG": true}
+
+// folderOptions are the options naming a folder files are written into
+var folderOptions = []string{"path"}
+
+// ConfigPath returns the path of the configuration file
+func ConfigPath() string {
+	if p := os.Getenv("YOSTAR_CONFIG"); p != "" {
+		return p
+	}
+	return filepath.Join(filepath.Dir(dbPath), configFile)
+}
+
+// ConfigEntry is a "key = value" line of the configuration file, or an environment
+// variable. Entries without a section apply to every program and command with
+// that flag.
+type ConfigEntry struct {
+	Section string
+	Key     string
+	Value   string
+	Line    int    // line of the file, 0 for environment variables
+	Env     string // environment variable the entry comes from, if any
+}
+
+// Config is the configuration file, setting the defaults of the flags of the
+// crawlers and of the commands of yostar-wallpaper, overridden by environment
+// variables. Flags given on the command line override both.
+type Config struct {
+	Path    string
+	Entries []ConfigEntry
+
+	sections map[string]int // line of each [section] header
+}
+
+// ConfigError is an error at a line of the configuration file, or in an environment
+// variable named by Path when Line is 0
+type ConfigError struct {
+	Path string
+	Line int
+	Err  error
+}
+
+func (e *ConfigError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %v", e.Path, e.Err)
+	}
+	return fmt.Sprintf("%s:%d: %v", e.Path, e.Line, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// ConfigTarget is a program or command whose flags the configuration file sets
+type ConfigTarget struct {
+	Flags *flag.FlagSet
+	Base  string // folder the relative paths of folder options are under, the working directory when empty
+}
+
+// CrawlerTarget returns the target of the flags of a crawler, whose --path is
+// created under the home folder
+func CrawlerTarget(fs *flag.FlagSet) ConfigTarget {
+	home, _ := os.UserHomeDir()
+	return ConfigTarget{Flags: fs, Base: home}
+}
+
+// LoadConfig reads the configuration file. A missing file is an empty configuration.
+func LoadConfig() (*Config, error) {
+	p := ConfigPath()
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Config{Path: p}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration: %w", err)
+	}
+	defer f.Close()
+	return ParseConfig(p, f)
+}
+
+// ParseConfig parses a configuration file made of "key = value" lines, grouped
+// under [section] headers naming a crawler or a command, with # comments. Every
+// malformed line is reported.
+func ParseConfig(path string, r io.Reader) (*Config, error) {
+	c := &Config{Path: path, sections: make(map[string]int)}
+	var errs []error
+	fail := func(line int, format string, args ...any) {
+		errs = append(errs, &ConfigError{Path: path, Line: line, Err: fmt.Errorf(format, args...)})
+	}
+
+	set := make(map[string]int) // line of each section and key
+	section := ""
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if n == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			name, ok := strings.CutSuffix(line, "]")
+			name = strings.TrimSpace(name[1:])
+			if !ok || name == "" || strings.ContainsAny(name, "[] \t") {
+				fail(n, "malformed section header %q, expected [name]", line)
+				continue
+			}
+			if prev, ok := c.sections[name]; ok {
+				fail(n, "section [%s] already started on line %d", name, prev)
+			} else {
+				c.sections[name] = n
+			}
+			section = name
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimLeft(strings.TrimSpace(key), "-")
+		if !ok || key == "" {
+			fail(n, "expected key = value, got %q", line)
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if strings.HasPrefix(value, `"`) {
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				fail(n, "malformed quoted value %s", value)
+				continue
+			}
+			value = unquoted
+		}
+		if prev, ok := set[section+"\x00"+key]; ok {
+			fail(n, "%s already set on line %d", key, prev)
+			continue
+		}
+		set[section+"\x00"+key] = n
+		c.Entries = append(c.Entries, ConfigEntry{Section: section, Key: key, Value: value, Line: n})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read configuration: %w", err)
+	}
+	return c, errors.Join(errs...)
+}
+
+// Apply sets the flags of the target to the values of the configuration: the
+// top-level entries of the file for the flags it has, then those of section, which
+// must all be flags of the target, then the environment variables the same way.
+// It is called before parsing the command line, so that flags given there take
+// precedence. Values are checked as when given as flags, and folders to be writable.
+func (c *Config) Apply(section string, t ConfigTarget) error {
+	var errs []error
+	entries := append([]ConfigEntry(nil), c.Entries...)
+	for _, e := range append(entries, envEntries(section, t.Flags)...) {
+		if e.Section != "" && e.Section != section {
+			continue
+		}
+		if e.Section == "" && t.Flags.Lookup(e.Key) == nil {
+			continue
+		}
+		if err := c.set(t, e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// set sets the flag of the entry e in the target
+func (c *Config) set(t ConfigTarget, e ConfigEntry) error {
+	fail := func(err error) error {
+		if e.Env != "" {
+			return &ConfigError{Path: e.Env, Err: err}
+		}
+		return &ConfigError{Path: c.Path, Line: e.Line, Err: err}
+	}
+	if t.Flags.Lookup(e.Key) == nil {
+		var names []string
+		t.Flags.VisitAll(func(f *flag.Flag) { names = append(names, f.Name) })
+		return fail(fmt.Errorf("unknown option %s in [%s]%s", e.Key, e.Section, suggest(e.Key, names)))
+	}
+	if err := t.Flags.Set(e.Key, e.Value); err != nil {
+		if hint := expectedValue(t.Flags.Lookup(e.Key)); hint != "" {
+			return fail(fmt.Errorf("invalid %s %q, %s", e.Key, e.Value, hint))
+		}
+		return fail(fmt.Errorf("invalid %s %q: %w", e.Key, e.Value, err))
+	}
+	for _, name := range folderOptions {
+		if e.Key != name || e.Value == "" {
+			continue
+		}
+		dir := e.Value
+		if !filepath.IsAbs(dir) && t.Base != "" {
+			dir = filepath.Join(t.Base, dir)
+		}
+		if err := checkWritable(dir); err != nil {
+			return fail(fmt.Errorf("invalid %s %q: %w", e.Key, e.Value, err))
+		}
+	}
+	return nil
+}
+
+// Check validates the whole configuration against the targets, by section name:
+// every section must name a target, every top-level key a flag of one of them, and
+// every value be valid for each target it applies to. YOSTAR_* environment
+// variables naming no flag are only logged, as the environment of containers and CI
+// jobs is shared with other tools. The flags of the targets are set along the way.
+func (c *Config) Check(targets map[string]ConfigTarget) error {
+	var errs []error
+	envNames := make(map[string]bool)
+	for name, line := range c.sections {
+		if _, ok := targets[name]; !ok {
+			errs = append(errs, &ConfigError{Path: c.Path, Line: line, Err: fmt.Errorf("unknown section [%s]%s", name, suggest(name, mapKeys(targets)))})
+		}
+	}
+
+	var names []string
+	for _, name := range mapKeys(targets) {
+		if err := c.Apply(name, targets[name]); err != nil {
+			errs = append(errs, err)
+		}
+		targets[name].Flags.VisitAll(func(f *flag.Flag) {
+			names = append(names, f.Name)
+			envNames[EnvName("", f.Name)], envNames[EnvName(name, f.Name)] = true, true
+		})
+	}
+	for _, env := range EnvOptions() {
+		if !envNames[env] {
+			logger.Printf("Ignoring %s: unknown option%s", env, suggest(env, mapKeys(envNames)))
+		}
+	}
+	for _, e := range c.Entries {
+		if e.Section != "" {
+			continue
+		}
+		known := false
+		for _, t := range targets {
+			if t.Flags.Lookup(e.Key) != nil {
+				known = true
+				break
+			}
+		}
+		if !known {
+			errs = append(errs, &ConfigError{Path: c.Path, Line: e.Line, Err: fmt.Errorf("unknown option %s%s", e.Key, suggest(e.Key, names))})
+		}
+	}
+
+	// a top-level entry applying to several targets is reported once
+	var unique []error
+	seen := make(map[string]bool)
+	for _, err := range errs {
+		for _, err := range unjoin(err) {
+			if !seen[err.Error()] {
+				seen[err.Error()] = true
+				unique = append(unique, err)
+			}
+		}
+	}
+	sort.SliceStable(unique, func(i, j int) bool { return errorLine(unique[i]) < errorLine(unique[j]) })
+	return errors.Join(unique...)
+}
+
+// Source returns where the configuration sets the flag name of section, as the
+// environment variable or as path:line, or "" when it does not
+func (c *Config) Source(section, name string) string {
+	for _, env := range []string{EnvName(section, name), EnvName("", name)} {
+		if _, ok := os.LookupEnv(env); ok {
+			return env
+		}
+	}
+	var source string
+	for _, e := range c.Entries {
+		if e.Key != name {
+			continue
+		}
+		if e.Section == section {
+			return fmt.Sprintf("%s:%d", c.Path, e.Line)
+		}
+		if e.Section == "" {
+			source = fmt.Sprintf("%s:%d", c.Path, e.Line)
+		}
+	}
+	return source
+}
+
+// EnvName returns the environment variable setting the option key of section, or
+// of every program and command when section is empty
+func EnvName(section, key string) string {
+	name := key
+	if section != "" {
+		name = section + "_" + key
+	}
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// EnvOptions returns the environment variables set that are meant to set options,
+// sorted
+func EnvOptions() []string {
+	var names []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if strings.HasPrefix(name, envPrefix) && !reservedEnv[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// envEntries returns the entries of the environment variables set for the flags of
+// section, those for every program and command first
+func envEntries(section string, fs *flag.FlagSet) []ConfigEntry {
+	var entries []ConfigEntry
+	for _, s := range []string{"", section} {
+		fs.VisitAll(func(f *flag.Flag) {
+			env := EnvName(s, f.Name)
+			if value, ok := os.LookupEnv(env); ok {
+				entries = append(entries, ConfigEntry{Section: s, Key: f.Name, Value: value, Env: env})
+			}
+		})
+	}
+	return entries
+}
+
+// checkWritable checks that files can be written into the folder dir, or into the
+// nearest existing folder above it when it is yet to be created
+func checkWritable(dir string) error {
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a folder", dir)
+			}
+			break
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return err
+		}
+		dir = parent
+	}
+	f, err := os.CreateTemp(dir, ".yostar-check-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable", dir)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// expectedValue describes the values a flag takes, for the errors of values it rejects
+func expectedValue(f *flag.Flag) string {
+	if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+		return "expected true or false"
+	}
+	getter, ok := f.Value.(flag.Getter)
+	if !ok {
+		return ""
+	}
+	switch getter.Get().(type) {
+	case time.Duration:
+		return "expected a duration such as 90s, 5m or 1h30m"
+	case int, int64, uint, uint64:
+		return "expected a whole number"
+	case float64:
+		return "expected a number"
+	}
+	return ""
+}
+
+// suggest returns a "did you mean" hint naming the closest of names to s, or ""
+// when none is close
+func suggest(s string, names []string) string {
+	best, bestDist := "", len(s)/2+1
+	for _, name := range names {
+		if d := editDistance(s, name); d < bestDist {
+			best, bestDist = name, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean %s?", best)
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// mapKeys returns the keys of m, sorted
+func mapKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// unjoin returns the errors joined in err
+func unjoin(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var errs []error
+		for _, err := range joined.Unwrap() {
+			errs = append(errs, unjoin(err)...)
+		}
+		return errs
+	}
+	return []error{err}
+}
+
+// errorLine returns the line of a configuration error, 0 for other errors
+func errorLine(err error) int {
+	var configErr *ConfigError
+	if errors.As(err, &configErr) {
+		return configErr.Line
+	}
+	return 0
+}
@@ -0,0 +1,141 @@
+package crawal
+
+import (
+	"flag"
+	"strings"
+	"testing"
+)
+
+// configTargets returns a serve and a sync target, with a flag in common
+func configTargets() map[string]ConfigTarget {
+	serve := flag.NewFlagSet("serve", flag.ContinueOnError)
+	serve.String("addr", "127.0.0.1:8080", "")
+	serve.Int("workers", 5, "")
+	sync := flag.NewFlagSet("sync", flag.ContinueOnError)
+	sync.String("skip", "", "")
+	sync.Int("workers", 5, "")
+	return map[string]ConfigTarget{"serve": {Flags: serve}, "sync": {Flags: sync}}
+}
+
+func TestParseConfig(t *testing.T) {
+	c, err := ParseConfig("yostar.conf", strings.NewReader("\ufeff# comment\nworkers = 3\n; comment\n\n[serve]\n--addr = \"0.0.0.0:8080\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ConfigEntry{
+		{Key: "workers", Value: "3", Line: 2},
+		{Section: "serve", Key: "addr", Value: "0.0.0.0:8080", Line: 6},
+	}
+	if len(c.Entries) != len(want) {
+		t.Fatalf("entries %+v, want %+v", c.Entries, want)
+	}
+	for i, e := range c.Entries {
+		if e != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, e, want[i])
+		}
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		config string
+		want   string
+	}{
+		{"[serve\n", `yostar.conf:1: malformed section header "[serve", expected [name]`},
+		{"[]\n", `yostar.conf:1: malformed section header "[]", expected [name]`},
+		{"[serve]\n[sync]\n[serve]\n", "yostar.conf:3: section [serve] already started on line 1"},
+		{"workers 3\n", `yostar.conf:1: expected key = value, got "workers 3"`},
+		{"= 3\n", `yostar.conf:1: expected key = value, got "= 3"`},
+		{"skip = \"azurlane\n", `yostar.conf:1: malformed quoted value "azurlane`},
+		{"workers = 3\n\nworkers = 4\n", "yostar.conf:3: workers already set on line 1"},
+	}
+	for _, tt := range tests {
+		_, err := ParseConfig("yostar.conf", strings.NewReader(tt.config))
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("ParseConfig(%q) = %v, want %s", tt.config, err, tt.want)
+		}
+	}
+
+	// every malformed line is reported
+	_, err := ParseConfig("yostar.conf", strings.NewReader("workers 3\n[serve\naddr\n"))
+	if err == nil || len(unjoin(err)) != 3 {
+		t.Errorf("ParseConfig with 3 malformed lines = %v, want 3 errors", err)
+	}
+}
+
+func TestConfigCheck(t *testing.T) {
+	SetLogger(nil)
+	tests := []struct {
+		config string
+		want   string // error, none when empty
+	}{
+		{"workers = 3\n[serve]\naddr = :8080\n[sync]\nskip = arknight\n", ""},
+		{"[serv]\n", "yostar.conf:1: unknown section [serv], did you mean serve?"},
+		{"worker = 3\n", "yostar.conf:1: unknown option worker, did you mean workers?"},
+		{"[sync]\naddr = :8080\n", "yostar.conf:2: unknown option addr in [sync]"},
+		{"[serve]\nworkers = many\n", `yostar.conf:2: invalid workers "many"`},
+	}
+	for _, tt := range tests {
+		c, err := ParseConfig("yostar.conf", strings.NewReader(tt.config))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = c.Check(configTargets())
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("Check(%q) = %v, want no error", tt.config, err)
+		case tt.want != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.want)):
+			t.Errorf("Check(%q) = %v, want %s", tt.config, err, tt.want)
+		}
+	}
+}
+
+// TestConfigCheckUnknownEnv checks that YOSTAR_ variables naming no option are
+// ignored, and those with an invalid value reported
+func TestConfigCheckUnknownEnv(t *testing.T) {
+	SetLogger(nil)
+	c := &Config{Path: "yostar.conf"}
+	t.Setenv("YOSTAR_SERVE_WORKER", "3")
+	if err := c.Check(configTargets()); err != nil {
+		t.Errorf("Check with an unknown variable = %v, want no error", err)
+	}
+	t.Setenv("YOSTAR_SERVE_WORKERS", "many")
+	if err := c.Check(configTargets()); err == nil || !strings.HasPrefix(err.Error(), `YOSTAR_SERVE_WORKERS: invalid workers "many"`) {
+		t.Errorf("Check with an invalid variable = %v, want it reported", err)
+	}
+}
+
+// TestConfigPrecedence checks that the environment wins over the file, and a
+// section over the top level in each
+func TestConfigPrecedence(t *testing.T) {
+	tests := []struct {
+		config string
+		env    map[string]string
+		want   string
+	}{
+		{"", nil, "5"},
+		{"workers = 2\n", nil, "2"},
+		{"workers = 2\n[serve]\nworkers = 3\n", nil, "3"},
+		{"workers = 2\n[serve]\nworkers = 3\n", map[string]string{"YOSTAR_WORKERS": "4"}, "4"},
+		{"workers = 2\n[serve]\nworkers = 3\n", map[string]string{"YOSTAR_WORKERS": "4", "YOSTAR_SERVE_WORKERS": "6"}, "6"},
+		{"[sync]\nworkers = 3\n", map[string]string{"YOSTAR_SYNC_WORKERS": "4"}, "5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			c, err := ParseConfig("yostar.conf", strings.NewReader(tt.config))
+			if err != nil {
+				t.Fatal(err)
+			}
+			serve := configTargets()["serve"]
+			if err := c.Apply("serve", serve); err != nil {
+				t.Fatal(err)
+			}
+			if got := serve.Flags.Lookup("workers").Value.String(); got != tt.want {
+				t.Errorf("workers = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package crawal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Conflict modes, deciding what happens to a download whose file name is taken by
+// a different file
+const (
+	ConflictAsk       = "ask"       // prompt on the terminal, optionally for all conflicts
+	ConflictSkip      = "skip"      // keep the existing file and drop the download
+	ConflictOverwrite = "overwrite" // replace the existing file
+	ConflictRename    = "rename"    // save the download as "name (2).ext", "name (3).ext"...
+)
+
+// ErrConflictSkipped is returned by DownloadFile when the file name is taken by a
+// different file and the conflict mode skips the download
+var ErrConflictSkipped = errors.New("a different file already has its name")
+
+// conflicts resolves the conflicts of all downloads. Its mode is only changed under
+// its lock, so that SetConflictMode can be called while downloads run.
+var conflicts = &conflictResolver{mode: ConflictOverwrite}
+
+// conflictResolver places downloaded files, one at a time so that workers renaming
+// theirs do not pick the same name, and asks the user when the mode is ask
+type conflictResolver struct {
+	mu     sync.Mutex // held while deciding and renaming, not while hashing or asking
+	mode   string
+	prompt sync.Mutex // held while asking, one conflict at a time
+	input  *bufio.Reader
+}
+
+// CheckConflictMode returns an error if mode is not one of the conflict modes
+func CheckConflictMode(mode string) error {
+	switch mode {
+	case ConflictAsk, ConflictSkip, ConflictOverwrite, ConflictRename:
+		return nil
+	}
+	return fmt.Errorf("unknown conflict mode %q", mode)
+}
+
+// SetConflictMode sets what the downloads of the library do when their file name is
+// taken by a different file, overwrite by default. ask needs a terminal to prompt
+// on. The files placed from then on follow mode.
+func SetConflictMode(mode string) error {
+	if err := CheckConflictMode(mode); err != nil {
+		return err
+	}
+	if mode == ConflictAsk {
+		fi, err := os.Stdin.Stat()
+		if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+			return errors.New("ask needs a terminal to prompt on")
+		}
+	}
+	conflicts.mu.Lock()
+	defer conflicts.mu.Unlock()
+	conflicts.mode = mode
+	if conflicts.input == nil {
+		conflicts.input = bufio.NewReader(os.Stdin)
+	}
+	return nil
+}
+
+// place moves the downloaded file at tmp to p, resolving the conflict when p is
+// already taken. A file identical to the download is not a conflict and is kept.
+// It returns the path the file ends up at.
+func (r *conflictResolver) place(tmp, p string) (string, error) {
+	// the files are hashed without the lock, so that the other downloads are placed
+	// meanwhile, and again if one of them changed p
+	existing, err := os.Stat(p)
+	same := false
+	if err == nil {
+		same, _ = sameContent(tmp, p)
+	}
+
+	r.mu.Lock()
+	current, err := os.Stat(p)
+	if err != nil {
+		defer r.mu.Unlock()
+		return p, os.Rename(tmp, p)
+	}
+	if existing == nil || !unchanged(existing, current) {
+		r.mu.Unlock()
+		return r.place(tmp, p)
+	}
+	if same {
+		defer r.mu.Unlock()
+		return p, os.Remove(tmp)
+	}
+
+	mode := r.mode
+	if mode == ConflictAsk {
+		// the other downloads are placed while the user answers
+		r.mu.Unlock()
+		mode = r.ask(p)
+		r.mu.Lock()
+	}
+	defer r.mu.Unlock()
+	switch mode {
+	case ConflictSkip:
+		os.Remove(tmp)
+		return "", ErrConflictSkipped
+	case ConflictRename:
+		p = freePath(p)
+	}
+	return p, os.Rename(tmp, p)
+}
+
+// ask prompts the user for the mode of the conflict at p, remembering the answers
+// applying to all conflicts. It is called without the lock, which it takes to
+// change the mode.
+func (r *conflictResolver) ask(p string) string {
+	r.prompt.Lock()
+	defer r.prompt.Unlock()
+	// an answer for all conflicts may have been given while this one waited
+	if mode := r.currentMode(); mode != ConflictAsk {
+		return mode
+	}
+	for {
+		fmt.Fprintf(os.Stderr, "%s already exists with a different content.\n"+
+			"[s]kip, [o]verwrite, [r]ename, or S, O, R for all conflicts? ", p)
+		answer, err := r.input.ReadString('\n')
+		if err != nil {
+			// nothing left to read, keep the existing files
+			fmt.Fprintln(os.Stderr)
+			r.setMode(ConflictSkip)
+			return ConflictSkip
+		}
+
+		answer = strings.TrimSpace(answer)
+		modes := map[string]string{"s": ConflictSkip, "o": ConflictOverwrite, "r": ConflictRename}
+		if mode, ok := modes[answer]; ok {
+			return mode
+		}
+		if mode, ok := modes[strings.ToLower(answer)]; ok {
+			r.setMode(mode)
+			return mode
+		}
+	}
+}
+
+// currentMode returns the mode of the resolver
+func (r *conflictResolver) currentMode() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.mode
+}
+
+// setMode changes the mode of the resolver, for the conflicts resolved from then on
+func (r *conflictResolver) setMode(mode string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mode = mode
+}
+
+// unchanged reports whether before and after describe the same file, not written
+// in between
+func unchanged(before, after os.FileInfo) bool {
+	return os.SameFile(before, after) && before.Size() == after.Size() && before.ModTime().Equal(after.ModTime())
+}
+
+// freePath returns p, or p numbered "name (2).ext", "name (3).ext"... with the
+// first number that is not taken
+func freePath(p string) string {
+	ext := filepath.Ext(p)
+	base := strings.TrimSuffix(p, ext)
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, n, ext)
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
+
+// sameContent reports whether the files at a and b have the same checksum
+func sameContent(a, b string) (bool, error) {
+	sumA, sizeA, err := HashFile(a)
+	if err != nil {
+		return false, err
+	}
+	sumB, sizeB, err := HashFile(b)
+	if err != nil {
+		return false, err
+	}
+	return sizeA == sizeB && sumA == sumB, nil
+}
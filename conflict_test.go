@@ -0,0 +1,117 @@
+package crawal
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// placeDownload writes content as a download and places it at name in dir,
+// returning where it ends up
+func placeDownload(t *testing.T, r *conflictResolver, dir, name, content string) (string, error) {
+	t.Helper()
+	tmp, err := os.CreateTemp(dir, ".download-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tmp.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	tmp.Close()
+	p, err := r.place(tmp.Name(), filepath.Join(dir, name))
+	if _, statErr := os.Stat(tmp.Name()); !os.IsNotExist(statErr) {
+		t.Errorf("download left at %s", tmp.Name())
+	}
+	return p, err
+}
+
+// checkContent fails when the file at p does not hold content
+func checkContent(t *testing.T, p, content string) {
+	t.Helper()
+	b, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != content {
+		t.Errorf("%s holds %q, want %q", filepath.Base(p), b, content)
+	}
+}
+
+func TestConflictModes(t *testing.T) {
+	for _, test := range []struct {
+		mode     string
+		content  string
+		wantName string
+		wantErr  error
+	}{
+		{ConflictSkip, "new", "", ErrConflictSkipped},
+		{ConflictOverwrite, "new", "wallpaper.png", nil},
+		{ConflictRename, "new", "wallpaper (2).png", nil},
+		// the same content is no conflict, whatever the mode
+		{ConflictSkip, "old", "wallpaper.png", nil},
+		{ConflictRename, "old", "wallpaper.png", nil},
+	} {
+		t.Run(test.mode+"/"+test.content, func(t *testing.T) {
+			dir := t.TempDir()
+			existing := filepath.Join(dir, "wallpaper.png")
+			if err := os.WriteFile(existing, []byte("old"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			p, err := placeDownload(t, &conflictResolver{mode: test.mode}, dir, "wallpaper.png", test.content)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("error %v, want %v", err, test.wantErr)
+			}
+			want := ""
+			if test.wantName != "" {
+				want = filepath.Join(dir, test.wantName)
+			}
+			if p != want {
+				t.Errorf("placed at %q, want %q", p, want)
+			}
+			if test.mode == ConflictOverwrite {
+				checkContent(t, existing, test.content)
+			} else {
+				checkContent(t, existing, "old")
+			}
+			if p != "" && p != existing {
+				checkContent(t, p, test.content)
+			}
+		})
+	}
+}
+
+// TestConflictAsk checks that lowercase answers apply to one conflict, and
+// uppercase ones to the following conflicts without asking again
+func TestConflictAsk(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.png", "b.png", "c.png"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("old"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the input ends after the uppercase answer, which would skip the next conflicts
+	// if it were asked again
+	r := &conflictResolver{mode: ConflictAsk, input: bufio.NewReader(strings.NewReader("s\nR\n"))}
+
+	if _, err := placeDownload(t, r, dir, "a.png", "new"); !errors.Is(err, ErrConflictSkipped) {
+		t.Fatalf("a.png: error %v, want skipped", err)
+	}
+	if r.mode != ConflictAsk {
+		t.Fatalf("mode %q after a lowercase answer, want ask", r.mode)
+	}
+	for _, name := range []string{"b.png", "c.png"} {
+		p, err := placeDownload(t, r, dir, name, "new")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := strings.TrimSuffix(name, ".png") + " (2).png"; filepath.Base(p) != want {
+			t.Errorf("%s placed at %s, want %s", name, filepath.Base(p), want)
+		}
+	}
+	if r.mode != ConflictRename {
+		t.Errorf("mode %q after an uppercase answer, want rename", r.mode)
+	}
+}
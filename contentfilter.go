@@ -0,0 +1,78 @@
+package crawal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ContentFilter excludes downloaded images by their content, such as NSFW ones:
+// by the tags the Tagger of the queue gives them, or by a command run on the file.
+// Excluded images are deleted and their items put on the skip list.
+type ContentFilter struct {
+	Tags    []string // excluded tags, matched ignoring case
+	Command string   // run with the {file} placeholder, exits with 1 to exclude the image
+	Timeout time.Duration
+}
+
+// NewContentFilter parses the comma separated excluded tags and the command of a
+// content filter, returning nil when both are empty
+func NewContentFilter(tags, command string) (*ContentFilter, error) {
+	f := &ContentFilter{Tags: ParseTags(tags), Command: command, Timeout: defaultCommandTimeout}
+	if command != "" {
+		if _, err := splitCommand(command); err != nil {
+			return nil, err
+		}
+	}
+	if len(f.Tags) == 0 && f.Command == "" {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// ParseTags splits a comma separated list of tags, dropping the empty ones
+func ParseTags(list string) []string {
+	var tags []string
+	for _, tag := range strings.Split(list, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// exclude returns why the image of item is excluded, empty when it is kept. With
+// excluded tags and a tagger, the image is tagged first and its tags returned, to
+// be stored once it is recorded.
+func (f *ContentFilter) exclude(ctx context.Context, t Tagger, item GalleryItem) (string, []string, error) {
+	var tags []string
+	if len(f.Tags) > 0 && t != nil {
+		var err error
+		if tags, err = t.Tag(ctx, item); err != nil {
+			return "", nil, fmt.Errorf("tagger failed: %w", err)
+		}
+		for _, tag := range tags {
+			for _, excluded := range f.Tags {
+				if strings.EqualFold(tag, excluded) {
+					return "tagged " + tag, tags, nil
+				}
+			}
+		}
+	}
+
+	if f.Command != "" {
+		_, err := runCommand(ctx, f.Command, f.Timeout, map[string]string{"file": item.Path})
+		var exitErr *exec.ExitError
+		switch {
+		case err == nil:
+		case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+			return "rejected by " + strings.Fields(f.Command)[0], tags, nil
+		default:
+			return "", tags, fmt.Errorf("content filter failed: %w", err)
+		}
+	}
+	return "", tags, nil
+}
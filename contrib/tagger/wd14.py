@@ -0,0 +1,77 @@
+#!/usr/bin/env python3
+"""Reference tagger for yostar-wallpaper, running a WD14 ONNX model locally.
+
+Prints one tag per line for the given image, as expected by --tagger.
+Character tags look like amiya_(arknights), general tags like 1girl or sky.
+
+Setup:
+    pip install onnxruntime numpy pillow huggingface_hub
+
+Usage:
+    yostar-wallpaper azurlane --tagger "python3 contrib/tagger/wd14.py {file}"
+    yostar-wallpaper tag --tagger "python3 contrib/tagger/wd14.py --character-threshold 0.9 {file}"
+"""
+import argparse
+import csv
+
+import numpy as np
+import onnxruntime as ort
+from huggingface_hub import hf_hub_download
+from PIL import Image
+
+DEFAULT_REPO = "SmilingWolf/wd-vit-tagger-v3"
+
+# categories of selected_tags.csv
+GENERAL = 0
+CHARACTER = 4
+
+
+def load_model(repo):
+    model_path = hf_hub_download(repo, "model.onnx")
+    tags_path = hf_hub_download(repo, "selected_tags.csv")
+    with open(tags_path, newline="", encoding="utf-8") as f:
+        rows = list(csv.DictReader(f))
+
+    session = ort.InferenceSession(model_path, providers=["CPUExecutionProvider"])
+    return session, [r["name"] for r in rows], [int(r["category"]) for r in rows]
+
+
+def prepare(path, size):
+    # flatten transparency on white and pad to a square, as the model was trained
+    img = Image.open(path).convert("RGBA")
+    background = Image.new("RGBA", img.size, (255, 255, 255, 255))
+    background.alpha_composite(img)
+    img = background.convert("RGB")
+
+    side = max(img.size)
+    square = Image.new("RGB", (side, side), (255, 255, 255))
+    square.paste(img, ((side - img.width) // 2, (side - img.height) // 2))
+    square = square.resize((size, size), Image.BICUBIC)
+
+    # the model expects BGR float32 in NHWC layout
+    pixels = np.asarray(square, dtype=np.float32)[:, :, ::-1]
+    return np.expand_dims(pixels, 0)
+
+
+def main():
+    parser = argparse.ArgumentParser(description="Tag an image with a WD14 ONNX model.")
+    parser.add_argument("image")
+    parser.add_argument("--repo", default=DEFAULT_REPO, help="Hugging Face repository of the model")
+    parser.add_argument("--general-threshold", type=float, default=0.35)
+    parser.add_argument("--character-threshold", type=float, default=0.85)
+    args = parser.parse_args()
+
+    session, names, categories = load_model(args.repo)
+    model_input = session.get_inputs()[0]
+    size = model_input.shape[1]
+    probs = session.run(None, {model_input.name: prepare(args.image, size)})[0][0]
+
+    for name, category, prob in zip(names, categories, probs):
+        if category == CHARACTER and prob >= args.character_threshold:
+            print(name)
+        elif category == GENERAL and prob >= args.general_threshold:
+            print(name)
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,139 @@
+package crawal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ConvertOptions configures ConvertItems
+type ConvertOptions struct {
+	Codec Codec
+	Dir   string // folder the converted files are written into, side by side
+	Force bool   // convert again the wallpapers whose file did not change
+}
+
+// ConvertReport tells what ConvertItems did
+type ConvertReport struct {
+	Converted int
+	Unchanged int // converted before, from the same file
+	Failed    int
+}
+
+// ConvertItems converts the files of wallpapers with a codec into a folder, e.g.
+// into HEIC in a folder of iCloud Drive for iPhones to pick them up. The converted
+// files are named after the files of the library, numbered "name_(2).heic" when two
+// have the same name, and are recorded so that a wallpaper is converted again only
+// when its file changed. Wallpapers not downloaded are left out.
+func ConvertItems(ctx context.Context, db *sql.DB, items []GalleryItem, opts ConvertOptions) (ConvertReport, error) {
+	var report ConvertReport
+	dir, err := filepath.Abs(opts.Dir)
+	if err != nil {
+		return report, err
+	}
+	if err := makeDirs(dir); err != nil {
+		return report, err
+	}
+	folder, ext := storedPath(dir), opts.Codec.Ext()
+	converted, err := conversions(db, folder, ext)
+	if err != nil {
+		return report, err
+	}
+	used := make(map[string]bool, len(converted))
+	for _, c := range converted {
+		used[strings.ToLower(c.name)] = true
+	}
+
+	for _, item := range items {
+		if item.Path == "" {
+			continue
+		}
+		prev, ok := converted[item.ID]
+		if ok && !opts.Force && prev.sha256 == item.SHA256 {
+			if _, err := os.Stat(filepath.Join(dir, prev.name)); err == nil {
+				report.Unchanged++
+				continue
+			}
+		}
+
+		name := prev.name
+		if !ok {
+			base := strings.TrimSuffix(filepath.Base(item.Path), filepath.Ext(item.Path))
+			name = exportName(dir, base+ext, used)
+			used[strings.ToLower(name)] = true
+		}
+		if err := convertFile(ctx, opts.Codec, item.Path, filepath.Join(dir, name)); err != nil {
+			logger.Printf("Error converting %s: %v", item.FileName, err)
+			report.Failed++
+			continue
+		}
+		_, err := db.Exec(`INSERT OR REPLACE INTO conversions(gallery_id, folder, ext, name, sha256) VALUES (?, ?, ?, ?, ?)`,
+			item.ID, folder, ext, name, item.SHA256)
+		if err != nil {
+			return report, err
+		}
+		logger.Printf(`-> converted "%s" <-`, name)
+		report.Converted++
+	}
+	return report, nil
+}
+
+// conversion is a file converted into a folder
+type conversion struct {
+	name   string
+	sha256 string // of the file of the library it was converted from
+}
+
+// conversions returns the files converted into folder with the extension, by
+// wallpaper
+func conversions(db *sql.DB, folder, ext string) (map[int64]conversion, error) {
+	rows, err := db.Query("SELECT gallery_id, name, sha256 FROM conversions WHERE folder = ? AND ext = ?", folder, ext)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	converted := make(map[int64]conversion)
+	for rows.Next() {
+		var id int64
+		var c conversion
+		if err := rows.Scan(&id, &c.name, &c.sha256); err != nil {
+			return nil, err
+		}
+		converted[id] = c
+	}
+	return converted, rows.Err()
+}
+
+// convertFile converts the file at src into dst, through a hidden file with the
+// same extension, which encoders pick the format from, so that a synced folder
+// never uploads a partial file
+func convertFile(ctx context.Context, codec Codec, src, dst string) error {
+	tmp := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst))
+	if err := codec.Convert(ctx, src, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// ICloudDrive returns the folder of iCloud Drive, on macOS or on Windows with the
+// iCloud application
+func ICloudDrive() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	for _, dir := range []string{
+		filepath.Join(home, "Library", "Mobile Documents", "com~apple~CloudDocs"),
+		filepath.Join(home, "iCloudDrive"),
+	} {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir, nil
+		}
+	}
+	return "", errors.New("iCloud Drive not found")
+}
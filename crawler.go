@@ -0,0 +1,305 @@
+package crawal
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	crawlerWorkers = 5
+	crawlerTimeout = 30 * time.Second
+)
+
+// Crawler downloads the wallpapers listed by the API of a game into the library.
+// Each game package defines one, run as a command of yostar-wallpaper.
+type Crawler struct {
+	Name    string   // of the command, and of its section of the configuration file
+	Aliases []string // other names of the command, e.g. arknights
+	Game    string
+	Path    string            // default --path
+	APIs    map[string]string // wallpaper list APIs by region
+	// Locales tells whether the API lists the titles of other locales, with --locales
+	Locales bool
+	// Paginate tells whether the API lists everything in one response, whose
+	// truncated listings are fetched page by page with --paginate
+	Paginate   bool
+	KindDirs   map[string]string // subfolder of --path per variant kind, see SyncOptions
+	Candidates URLCandidates
+	// List fetches the items listed by the API at url of region
+	List func(client *http.Client, url, region string, opts ListOptions) ([]Item, error)
+}
+
+// ListOptions are how a crawler lists the items of its API
+type ListOptions struct {
+	Locale   string // of the titles, the default of the API when empty
+	Strict   bool   // fail on a row not matching the expected schema instead of skipping it
+	Paginate bool
+}
+
+// crawlerOptions are the flags of a crawler
+type crawlerOptions struct {
+	path, dedupe, onConflict           string
+	nameTemplate                       string
+	tagger, ocr, optimize, transcode   string
+	filter, excludeTags, contentFilter string
+	hook                               string
+	hookTimeout                        time.Duration
+	eventHook, events                  string
+	catalog, strict, paginate          bool
+	archive, manifest                  string
+	wayback, preflight                 bool
+	firstSyncBatch, firstSyncBatches   int
+	firstSyncPause                     time.Duration
+	minWorkers, maxWorkers             int
+	peer, region, endpoint             string
+	status                             bool
+	locales                            string
+}
+
+// Flags adds the flags of the crawler to fs, and returns the function running it
+// once they are parsed
+func (c Crawler) Flags(fs *flag.FlagSet) func() error {
+	var o crawlerOptions
+	fs.StringVar(&o.path, "path", c.Path, "Path to the directory where wallpapers should be saved.")
+	fs.StringVar(&o.dedupe, "dedupe", DedupeLink, "What to do with downloads identical to a file already in the library (off, link, skip).")
+	fs.StringVar(&o.onConflict, "on-conflict", ConflictOverwrite, "What to do when a different file already has the name of a download (ask, skip, overwrite, rename).")
+	fs.StringVar(&o.nameTemplate, "name-template", "", "Name the new files after this template, e.g. \"{id}_{ascii}\" for ASCII names ({game}, {id}, {title}, {artist}, {romaji}, {ascii}).")
+	fs.StringVar(&o.tagger, "tagger", "", "Command run on each new image to tag it, e.g. \"python wd14.py {file}\".")
+	fs.StringVar(&o.ocr, "ocr", "", "Command run on each new image to recognize its text, e.g. \"tesseract {file} stdout\".")
+	fs.StringVar(&o.optimize, "optimize", "", "Shrink each downloaded file losslessly, with the built-in PNG optimizer (builtin) or a command, e.g. \"oxipng -o 4 {file}\".")
+	fs.StringVar(&o.transcode, "transcode", "", "Convert the AVIF and JPEG XL images downloaded, which older wallpaper tools cannot read, into this format, e.g. jpeg or png.")
+	fs.StringVar(&o.filter, "filter", "", "Script deciding which new images are downloaded: it reads each one as JSON and exits with 0 to download it, 1 to skip it.")
+	fs.StringVar(&o.excludeTags, "exclude-tags", "", "Comma separated tags, given by --tagger, of the new images deleted and put on the skip list, e.g. nsfw.")
+	fs.StringVar(&o.contentFilter, "content-filter", "", "Command run on each new image, e.g. \"python nsfw.py {file}\", exiting with 1 to delete it and put it on the skip list.")
+	fs.StringVar(&o.hook, "hook", "", "Command run on each downloaded file before it is recorded, e.g. \"oxipng {file}\".")
+	fs.DurationVar(&o.hookTimeout, "hook-timeout", time.Minute, "Time after which the --hook command is killed.")
+	fs.StringVar(&o.eventHook, "event-hook", "", "Command run on the events of the sync, e.g. \"notify-send {event} {name}\".")
+	fs.StringVar(&o.events, "events", "", "Comma separated events --event-hook runs on (item_discovered, download_started, download_finished, download_failed, sync_completed), all by default.")
+	fs.BoolVar(&o.catalog, "catalog", false, "Only record the wallpapers listed by the API, without downloading them.")
+	fs.BoolVar(&o.strict, "strict", false, "Fail when a row of the API does not match the expected schema instead of skipping it.")
+	if c.Paginate {
+		fs.BoolVar(&o.paginate, "paginate", false, "Fetch the wallpapers page by page when the API lists fewer than it announces, its response being truncated.")
+	}
+	fs.StringVar(&o.archive, "archive", "", "Keep the raw API responses, gzip-compressed, in the database (db) or in this folder.")
+	fs.StringVar(&o.manifest, "manifest", "", "Folder a JSON manifest of the run is written into: the configuration, the hashes of the API responses and what was done with each image.")
+	fs.BoolVar(&o.wayback, "wayback", false, "Submit the image URLs not seen before to the Internet Archive.")
+	fs.BoolVar(&o.preflight, "preflight", false, "Send HEAD requests for the queued images first, to estimate the download size and skip dead links.")
+	fs.IntVar(&o.firstSyncBatch, "first-sync-batch", 200, "Download the first sync of the game into the library in batches of this many images, 0 for all at once.")
+	fs.DurationVar(&o.firstSyncPause, "first-sync-pause", 0, "Pause between the batches of the first sync, e.g. 1m.")
+	fs.IntVar(&o.firstSyncBatches, "first-sync-batches", 0, "Stop the first sync after this many batches, the next run going on from there; 0 for all.")
+	fs.IntVar(&o.minWorkers, "min-workers", 1, "Fewest concurrent downloads when they scale with --max-workers.")
+	fs.IntVar(&o.maxWorkers, "max-workers", 0, "Scale the concurrent downloads up to this many while the throughput holds, and down when the CDN throttles.")
+	fs.StringVar(&o.peer, "peer", "", "URL of the yostar-wallpaper serve of another machine to copy the images it has from, instead of the CDN.")
+	fs.StringVar(&o.region, "region", "", fmt.Sprintf("Region of the API to crawl (%s), remembered for the next runs.", strings.Join(c.regions(), ", ")))
+	fs.StringVar(&o.endpoint, "endpoint", "", "API URL crawled instead of the built-in one or the one set with yostar-wallpaper games, e.g. a mirror.")
+	fs.BoolVar(&o.status, "status", false, "Only compare the wallpapers listed by the API with the library, printing the result as JSON for yostar-wallpaper status.")
+	if c.Locales {
+		fs.StringVar(&o.locales, "locales", "", "Comma separated locales whose titles are also fetched, e.g. en,ja,zh.")
+	}
+	return func() error { return c.run(fs, o) }
+}
+
+// regions returns the regions of the APIs of the crawler, sorted
+func (c Crawler) regions() []string {
+	var regions []string
+	for r := range c.APIs {
+		regions = append(regions, r)
+	}
+	sort.Strings(regions)
+	return regions
+}
+
+// run checks the options, then lists the items of the API and downloads those
+// missing from the library, or only compares them with it with --status
+func (c Crawler) run(fs *flag.FlagSet, o crawlerOptions) error {
+	if err := CheckDedupeMode(o.dedupe); err != nil {
+		return fmt.Errorf("invalid --dedupe: %w", err)
+	}
+	if err := SetConflictMode(o.onConflict); err != nil {
+		return fmt.Errorf("invalid --on-conflict: %w", err)
+	}
+	names, err := ParseNameTemplate(o.nameTemplate)
+	if err != nil {
+		return fmt.Errorf("invalid --name-template: %w", err)
+	}
+	if err := CheckPeer(o.peer); err != nil {
+		return fmt.Errorf("invalid --peer: %w", err)
+	}
+	if o.endpoint != "" {
+		if u, err := url.Parse(o.endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid --endpoint: %q is not an http or https URL", o.endpoint)
+		}
+	}
+
+	var tagger Tagger
+	if o.tagger != "" {
+		commandTagger, err := NewCommandTagger(o.tagger)
+		if err != nil {
+			return fmt.Errorf("invalid --tagger: %w", err)
+		}
+		tagger = commandTagger
+	}
+
+	var ocr OCR
+	if o.ocr != "" {
+		commandOCR, err := NewCommandOCR(o.ocr)
+		if err != nil {
+			return fmt.Errorf("invalid --ocr: %w", err)
+		}
+		ocr = commandOCR
+	}
+
+	var hook *Hook
+	if o.hook != "" {
+		if hook, err = NewHook(o.hook, o.hookTimeout); err != nil {
+			return fmt.Errorf("invalid --hook: %w", err)
+		}
+	}
+
+	if o.eventHook != "" {
+		eventHook, err := NewEventHook(o.eventHook, o.events, o.hookTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid --event-hook: %w", err)
+		}
+		Subscribe(eventHook.Handle)
+	}
+
+	var optimizer Optimizer
+	if o.optimize != "" {
+		if optimizer, err = NewOptimizer(o.optimize); err != nil {
+			return fmt.Errorf("invalid --optimize: %w", err)
+		}
+	}
+
+	var transcoder Codec
+	if o.transcode != "" {
+		if transcoder, err = NewCodec(o.transcode, ""); err != nil {
+			return fmt.Errorf("invalid --transcode: %w", err)
+		}
+	}
+
+	if o.excludeTags != "" && tagger == nil {
+		return errors.New("invalid --exclude-tags: the images are only tagged with --tagger")
+	}
+	content, err := NewContentFilter(o.excludeTags, o.contentFilter)
+	if err != nil {
+		return fmt.Errorf("invalid --content-filter: %w", err)
+	}
+
+	var filter DownloadFilter
+	if o.filter != "" {
+		commandFilter, err := NewCommandFilter(o.filter)
+		if err != nil {
+			return fmt.Errorf("invalid --filter: %w", err)
+		}
+		filter = commandFilter
+	}
+
+	// Create output directory, unless only the API is checked
+	dir := o.path
+	if !o.status {
+		if dir, err = CreateFolder(o.path); err != nil {
+			return fmt.Errorf("failed to create folder: %w", err)
+		}
+	}
+
+	db, err := OpenDB()
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer CloseDB(db)
+
+	region, apiURL, err := SelectRegion(db, c.Game, o.region, c.APIs)
+	if err != nil {
+		return fmt.Errorf("invalid --region: %w", err)
+	}
+	// --endpoint, from the flags, the environment or the configuration file, wins
+	// over the endpoint of the database
+	if o.endpoint != "" {
+		apiURL = o.endpoint
+	}
+
+	// the global flags set the network options, see SetNetworkOptions
+	client := &http.Client{
+		Timeout:   crawlerTimeout,
+		Transport: NewTransport(*networkOptions.Load()),
+	}
+	list := func(locale string) ([]Item, error) {
+		return c.List(client, apiURL, region, ListOptions{Locale: locale, Strict: o.strict, Paginate: o.paginate})
+	}
+	// --status lists the wallpapers without recording the responses
+	if o.status {
+		status, err := CheckAPI(db, c.Game, region, func() ([]Item, error) { return list("") })
+		if err == nil {
+			err = WriteAPIStatus(os.Stdout, status)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to check the API: %w", err)
+		}
+		return nil
+	}
+	if o.archive != "" {
+		client.Transport = NewResponseArchive(db, o.archive).Transport(client.Transport, c.Game, region)
+	}
+	// the checksums of the responses trace the downloads back to the listing
+	responses := NewResponseLog(db, c.Game, region)
+	client.Transport = responses.Transport(client.Transport)
+	var manifest *RunManifest
+	if o.manifest != "" {
+		manifest = NewRunManifest(c.Game, region, flag.CommandLine, fs)
+		client.Transport = manifest.Transport(client.Transport)
+	}
+
+	items, err := list("")
+	if err != nil {
+		return fmt.Errorf("failed to fetch wallpapers: %w", err)
+	}
+
+	// Record the titles of the other locales, as listed by the API when asked for them
+	for _, locale := range ParseLocales(o.locales) {
+		localized, err := list(locale)
+		if err != nil {
+			logger.Printf("Failed to fetch %s titles: %v", locale, err)
+			continue
+		}
+		MergeTitles(items, locale, localized)
+	}
+
+	// Download the images missing from the library, or only record them with --catalog
+	opts := SyncOptions{
+		Dir:        dir,
+		KindDirs:   c.KindDirs,
+		Catalog:    o.catalog,
+		Filter:     filter,
+		Candidates: c.Candidates,
+		Queue:      QueueOptions{Dedupe: o.dedupe, Workers: crawlerWorkers, MinWorkers: o.minWorkers, MaxWorkers: o.maxWorkers, Tagger: tagger, OCR: ocr, Hook: hook, Optimizer: optimizer, Transcode: transcoder, Content: content, Preflight: o.preflight, Peer: o.peer},
+		FirstSync:  FirstSyncOptions{BatchSize: o.firstSyncBatch, Pause: o.firstSyncPause, MaxBatches: o.firstSyncBatches},
+		Names:      names,
+	}
+	if o.wayback {
+		opts.Wayback = NewWayback()
+	}
+	opts.Manifest, opts.Run = manifest, responses.Run
+	// signed image URLs expire, so each image is looked up again before its download
+	opts.Queue.Resolve = NewItemResolver(items, func() ([]Item, error) { return list("") }, 0)
+	err = SyncItems(db, items, opts)
+	if manifest != nil {
+		if p, err := manifest.Finish(o.manifest, err); err != nil {
+			logger.Printf("Failed to write the run manifest: %v", err)
+		} else {
+			logger.Printf("Run manifest written to %s", p)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download wallpapers: %w", err)
+	}
+	logger.Println("All workers are done, exiting program.")
+	return nil
+}
@@ -0,0 +1,172 @@
+package aethergazer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// Constants for configuration
+const (
+	game               = "aether_gazer"
+	defaultPath        = "AetherGazer_Wallpaper"
+	defaultPageWorkers = 4
+)
+
+// ResponseApi represents the API response structure
+type responseApi struct {
+	Code int     `json:"code"`
+	Data resData `json:"data"`
+	Msg  string  `json:"msg"`
+}
+
+// ResData represents the data structure in the API response
+type resData struct {
+	Count int               `json:"count"`
+	Rows  []json.RawMessage `json:"rows"`
+}
+
+// Wallpaper represents a wallpaper item from the API
+type wallpaper struct {
+	ID                int    `json:"id"`
+	Title             string `json:"title"`
+	Type              string `json:"type"`
+	ContentImg        string `json:"contentImg"`
+	MobileContentImg1 string `json:"mobileContentImg1"`
+	StickerUrl        string `json:"stickerUrl"`
+	Creator           string `json:"creator"`
+}
+
+var (
+	// apiListWallpaperAetherGazer are the wallpaper list APIs by region
+	apiListWallpaperAetherGazer = map[string]string{
+		ys.RegionGlobal: "https://aethergazer.com/api/gallery/list?pageIndex=1&pageNum=12000&type=wallpaper",
+	}
+)
+
+// Crawler downloads the Aether Gazer wallpapers
+var Crawler = ys.Crawler{
+	Name:     "aethergazer",
+	Game:     game,
+	Path:     defaultPath,
+	APIs:     apiListWallpaperAetherGazer,
+	Locales:  true,
+	Paginate: true,
+	// the desktop and mobile images go into folders of their own
+	KindDirs:   map[string]string{"wallpaper": "contentImg", "mobile": "mobileContentImg"},
+	Candidates: urlCandidates,
+	List:       list,
+}
+
+// list fetches the wallpapers of the API and maps them to library items
+func list(client *http.Client, url, region string, opts ys.ListOptions) ([]ys.Item, error) {
+	wallpapers, err := fetchWallpapers(client, url, opts.Locale, opts.Strict, opts.Paginate)
+	if err != nil {
+		return nil, err
+	}
+	return toItems(wallpapers, region), nil
+}
+
+// fetchWallpapers retrieves the list of wallpapers from the API, in the given locale when
+// not empty. With paginate, the wallpapers left out of a truncated response are fetched
+// page by page, defaultPageWorkers at a time.
+func fetchWallpapers(client *http.Client, url, locale string, strict, paginate bool) ([]wallpaper, error) {
+	resBody, err := ys.FetchApiLocale(client, url, locale)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch wallpapers: %w", err)
+	}
+	pages := [][]byte{resBody}
+
+	var resApi responseApi
+	if paginate && json.Unmarshal(resBody, &resApi) == nil && ys.Truncated(resApi.Data.Count, len(resApi.Data.Rows)) {
+		ys.Logf("%s API listed %d of its %d wallpapers, fetching the others page by page", game, len(resApi.Data.Rows), resApi.Data.Count)
+		rest, err := ys.FetchRemainingPages(client, url, locale, "pageIndex", "pageNum", len(resApi.Data.Rows), resApi.Data.Count, defaultPageWorkers)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch wallpapers: %w", err)
+		}
+		pages = append(pages, rest...)
+	}
+	return parseWallpapers(pages, strict)
+}
+
+// parseWallpapers decodes and validates the API response pages, in order, skipping
+// the rows not matching the expected schema unless strict. The count announced by
+// the first page is checked against the rows of all. A wallpaper listed on two pages,
+// moved by one published during the fetch, is kept once.
+func parseWallpapers(pages [][]byte, strict bool) ([]wallpaper, error) {
+	var count int
+	var list []json.RawMessage
+	for i, resBody := range pages {
+		var resApi responseApi
+		if err := json.Unmarshal(resBody, &resApi); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON of page %d: %w", i+1, err)
+		}
+		if i == 0 {
+			count = resApi.Data.Count
+		}
+		list = append(list, resApi.Data.Rows...)
+	}
+
+	schema := ys.RowSchema{
+		Game:      game,
+		Required:  []string{"id", "title", "contentImg"},
+		Strict:    strict,
+		Paginated: len(pages) > 1,
+	}
+	if err := schema.CheckCount(count, len(list)); err != nil {
+		return nil, err
+	}
+	rows, err := ys.DecodeRows[wallpaper](list, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int]bool, len(rows))
+	wallpapers := rows[:0]
+	for _, row := range rows {
+		if !seen[row.ID] {
+			seen[row.ID] = true
+			wallpapers = append(wallpapers, row)
+		}
+	}
+	return wallpapers, nil
+}
+
+// urlCandidates returns the higher resolution files the CDN sometimes keeps next to a
+// gallery image: the original upload, then the image with an _hd suffix
+func urlCandidates(url string) []string {
+	dir, name := path.Split(url)
+	if dir == "" || name == "" {
+		return nil
+	}
+	ext := path.Ext(name)
+	return []string{
+		dir + "original/" + name,
+		dir + strings.TrimSuffix(name, ext) + "_hd" + ext,
+	}
+}
+
+// toItems maps the API rows to library items, with the desktop and mobile images as variants
+func toItems(wallpapers []wallpaper, region string) []ys.Item {
+	items := make([]ys.Item, 0, len(wallpapers))
+	for _, row := range wallpapers {
+		metadata, _ := json.Marshal(row)
+		items = append(items, ys.Item{
+			Game:     game,
+			Region:   region,
+			ID:       fmt.Sprintf("%d", row.ID),
+			Title:    row.Title,
+			Artist:   row.Creator,
+			Metadata: string(metadata),
+			Variants: []ys.Variant{
+				{Kind: "wallpaper", URL: row.ContentImg},
+				{Kind: "mobile", URL: row.MobileContentImg1},
+			},
+		})
+	}
+	return items
+}
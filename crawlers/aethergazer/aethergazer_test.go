@@ -0,0 +1,39 @@
+package aethergazer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// TestMobileVariants checks that the wallpapers of the recorded response come with
+// their mobile version, which only Aether Gazer lists, when they have one
+func TestMobileVariants(t *testing.T) {
+	body, err := os.ReadFile(filepath.Join("testdata", "response.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := parseWallpapers([][]byte{body}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mobile := 0
+	for _, it := range toItems(rows, ys.RegionGlobal) {
+		if len(it.Variants) != 2 || it.Variants[1].Kind != "mobile" {
+			t.Errorf("item %s has no mobile variant: %+v", it.ID, it.Variants)
+			continue
+		}
+		if url := it.Variants[1].URL; url != "" {
+			if !strings.HasPrefix(url, "https://") {
+				t.Errorf("item %s has an invalid mobile URL %q", it.ID, url)
+			}
+			mobile++
+		}
+	}
+	if mobile == 0 {
+		t.Error("no item has a mobile version")
+	}
+}
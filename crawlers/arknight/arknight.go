@@ -0,0 +1,167 @@
+package arknight
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+type responseApi struct {
+	Retcode int     `json:"retcode"`
+	Data    resData `json:"data"`
+}
+
+type resData struct {
+	PageCountNum int               `json:"pageCountNum"`
+	FankitList   []json.RawMessage `json:"fankitList"`
+}
+
+type wallpaper struct {
+	L string `json:"l"`
+	M string `json:"m"`
+	S string `json:"s"`
+}
+
+type Asset struct {
+	Count int    `json:"count"`
+	ID    string `json:"_id"`
+	Index string `json:"index"`
+	URL   string `json:"url"`
+}
+
+type fankit struct {
+	Wallpaper      wallpaper       `json:"wallpaper"`
+	WallpaperCount int             `json:"wallpaperCount"`
+	ZipCount       int             `json:"zipCount"`
+	ID             string          `json:"_id"`
+	Type           string          `json:"type"`
+	Title          string          `json:"title"`
+	Description    string          `json:"description"`
+	ArtistName     string          `json:"artistName"`
+	ArtistLink     string          `json:"artistLink"`
+	Assets         []Asset         `json:"assets"`
+	Zip            string          `json:"zip"`
+	ZipSize        string          `json:"zipSize"`
+	IsPublic       bool            `json:"ispublic"`
+	Index          int             `json:"index"`
+	CreatedAt      json.RawMessage `json:"createdAt"`
+	V              int             `json:"__v"`
+}
+
+var (
+	// apiListWallpaperArknight are the wallpaper list APIs by region. Regions are
+	// added once their API is recorded in testdata, listing the same format.
+	apiListWallpaperArknight = map[string]string{
+		ys.RegionGlobal: "https://arknights.global/api/cms/fankit/queryFankit?pageIndex=1&pageNum=100&type=1",
+	}
+	baseUrlLoadWallpaper = "https://webusstatic.yo-star.com/"
+	defaultPath          = "Arknight_Wallpaper"
+)
+
+const (
+	game               = "arknight"
+	defaultPageWorkers = 4
+)
+
+// Crawler downloads the Arknights wallpapers
+var Crawler = ys.Crawler{
+	Name:    "arknight",
+	Aliases: []string{"arknights"},
+	Game:    game,
+	Path:    defaultPath,
+	APIs:    apiListWallpaperArknight,
+	List:    list,
+}
+
+// list fetches the wallpapers of the API and maps them to library items
+func list(client *http.Client, url, region string, opts ys.ListOptions) ([]ys.Item, error) {
+	wallpapers, err := fetchWallpapers(client, url, opts.Strict)
+	if err != nil {
+		return nil, err
+	}
+	return toItems(wallpapers, region), nil
+}
+
+// fetchWallpapers retrieves the list of wallpapers from the API. The first page
+// announces the page count, the other pages are then fetched defaultPageWorkers at a time.
+func fetchWallpapers(client *http.Client, url string, strict bool) ([]fankit, error) {
+	resBody, err := ys.FetchApi(client, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch wallpapers: %w", err)
+	}
+	var resApi responseApi
+	if err := json.Unmarshal(resBody, &resApi); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+
+	pages, err := ys.FetchPages(client, url, "pageIndex", 2, resApi.Data.PageCountNum, defaultPageWorkers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch wallpapers: %w", err)
+	}
+	return parseWallpapers(append([][]byte{resBody}, pages...), strict)
+}
+
+// parseWallpapers decodes and validates the API response pages, in order, skipping
+// the rows not matching the expected schema unless strict. A wallpaper listed on two
+// pages, moved by one published during the fetch, is kept once.
+func parseWallpapers(pages [][]byte, strict bool) ([]fankit, error) {
+	var list []json.RawMessage
+	for i, resBody := range pages {
+		var resApi responseApi
+		if err := json.Unmarshal(resBody, &resApi); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON of page %d: %w", i+1, err)
+		}
+		list = append(list, resApi.Data.FankitList...)
+	}
+
+	schema := ys.RowSchema{
+		Game:     game,
+		Required: []string{"_id", "title", "wallpaper"},
+		Strict:   strict,
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("%s API listed no rows", game)
+	}
+	rows, err := ys.DecodeRows[fankit](list, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(rows))
+	wallpapers := rows[:0]
+	for _, row := range rows {
+		if !seen[row.ID] {
+			seen[row.ID] = true
+			wallpapers = append(wallpapers, row)
+		}
+	}
+	return wallpapers, nil
+}
+
+// toItems maps the API rows to library items
+func toItems(wallpapers []fankit, region string) []ys.Item {
+	items := make([]ys.Item, 0, len(wallpapers))
+	for _, row := range wallpapers {
+		metadata, _ := json.Marshal(row)
+		item := ys.Item{
+			Game:        game,
+			Region:      region,
+			ID:          row.ID,
+			Title:       row.Title,
+			Description: row.Description,
+			Artist:      row.ArtistName,
+			Metadata:    string(metadata),
+			Variants:    []ys.Variant{{Kind: "wallpaper", URL: baseUrlLoadWallpaper + row.Wallpaper.L}},
+			FileName:    fmt.Sprintf("%s (%s)", row.Title, row.ArtistName),
+		}
+		published, err := ys.ParsePublishTime(row.CreatedAt, ys.RegionLocation(region))
+		if err != nil {
+			ys.Logf("Unknown publication date of %s: %v", row.ID, err)
+		}
+		item.PublishedAt = published
+		items = append(items, item)
+	}
+	return items
+}
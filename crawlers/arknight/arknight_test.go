@@ -0,0 +1,28 @@
+package arknight
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// TestPublicationDates checks that the dates of the recorded response, which the
+// contract test of the crawlers leaves out since not every API has them, are read in UTC
+func TestPublicationDates(t *testing.T) {
+	body, err := os.ReadFile(filepath.Join("testdata", "response.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := parseWallpapers([][]byte{body}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, it := range toItems(rows, ys.RegionGlobal) {
+		if it.PublishedAt.IsZero() || it.PublishedAt.Location() != time.UTC {
+			t.Errorf("item %s has no publication date in UTC: %v", it.ID, it.PublishedAt)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package azurlane
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// Constants for configuration
+const (
+	game               = "azurlane"
+	defaultPath        = "AzurLane_Wallpaper"
+	defaultPageWorkers = 4
+)
+
+// ResponseApi represents the API response structure
+type ResponseApi struct {
+	StatusCode int     `json:"statusCode"`
+	Data       ResData `json:"data"`
+}
+
+// ResData represents the data structure in the API response
+type ResData struct {
+	Count int               `json:"count"`
+	Rows  []json.RawMessage `json:"rows"`
+}
+
+// Wallpaper represents a wallpaper item from the API
+type Wallpaper struct {
+	ID          int             `json:"id"`
+	Title       string          `json:"title"`
+	Artist      string          `json:"artist"`
+	Cover       string          `json:"cover"`
+	Works       string          `json:"works"`
+	Type        int             `json:"type"`
+	Sort        int             `json:"sort_index"`
+	PublishTime json.RawMessage `json:"publish_time"` // epoch seconds, sometimes as a string
+	New         bool            `json:"new"`
+}
+
+var (
+	// apiListWallpaperAzurLane are the wallpaper list APIs by region
+	apiListWallpaperAzurLane = map[string]string{
+		ys.RegionGlobal: "https://azurlane.yo-star.com/api/admin/special/public-list?page_index=1&page_num=12000&type=1",
+	}
+	domainLoadWallpaperAzurLane = "https://webusstatic.yo-star.com/"
+)
+
+// Crawler downloads the Azur Lane wallpapers
+var Crawler = ys.Crawler{
+	Name:     "azurlane",
+	Game:     game,
+	Path:     defaultPath,
+	APIs:     apiListWallpaperAzurLane,
+	Locales:  true,
+	Paginate: true,
+	List:     list,
+}
+
+// list fetches the wallpapers of the API and maps them to library items
+func list(client *http.Client, url, region string, opts ys.ListOptions) ([]ys.Item, error) {
+	wallpapers, err := fetchWallpapers(client, url, opts.Locale, opts.Strict, opts.Paginate)
+	if err != nil {
+		return nil, err
+	}
+	return toItems(wallpapers, region), nil
+}
+
+// fetchWallpapers retrieves the list of wallpapers from the API, in the given locale when
+// not empty. With paginate, the wallpapers left out of a truncated response are fetched
+// page by page, defaultPageWorkers at a time.
+func fetchWallpapers(client *http.Client, url, locale string, strict, paginate bool) ([]Wallpaper, error) {
+	resBody, err := ys.FetchApiLocale(client, url, locale)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch wallpapers: %w", err)
+	}
+	pages := [][]byte{resBody}
+
+	var resApi ResponseApi
+	if paginate && json.Unmarshal(resBody, &resApi) == nil && ys.Truncated(resApi.Data.Count, len(resApi.Data.Rows)) {
+		ys.Logf("%s API listed %d of its %d wallpapers, fetching the others page by page", game, len(resApi.Data.Rows), resApi.Data.Count)
+		rest, err := ys.FetchRemainingPages(client, url, locale, "page_index", "page_num", len(resApi.Data.Rows), resApi.Data.Count, defaultPageWorkers)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch wallpapers: %w", err)
+		}
+		pages = append(pages, rest...)
+	}
+	return parseWallpapers(pages, strict)
+}
+
+// parseWallpapers decodes and validates the API response pages, in order, skipping
+// the rows not matching the expected schema unless strict. The count announced by
+// the first page is checked against the rows of all. A wallpaper listed on two pages,
+// moved by one published during the fetch, is kept once.
+func parseWallpapers(pages [][]byte, strict bool) ([]Wallpaper, error) {
+	var count int
+	var list []json.RawMessage
+	for i, resBody := range pages {
+		var resApi ResponseApi
+		if err := json.Unmarshal(resBody, &resApi); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON of page %d: %w", i+1, err)
+		}
+		if i == 0 {
+			count = resApi.Data.Count
+		}
+		list = append(list, resApi.Data.Rows...)
+	}
+
+	schema := ys.RowSchema{
+		Game:      game,
+		Required:  []string{"id", "title", "works"},
+		Strict:    strict,
+		Paginated: len(pages) > 1,
+	}
+	if err := schema.CheckCount(count, len(list)); err != nil {
+		return nil, err
+	}
+	rows, err := ys.DecodeRows[Wallpaper](list, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int]bool, len(rows))
+	wallpapers := rows[:0]
+	for _, row := range rows {
+		if !seen[row.ID] {
+			seen[row.ID] = true
+			wallpapers = append(wallpapers, row)
+		}
+	}
+	return wallpapers, nil
+}
+
+// toItems maps the API rows to library items
+func toItems(wallpapers []Wallpaper, region string) []ys.Item {
+	items := make([]ys.Item, 0, len(wallpapers))
+	for _, row := range wallpapers {
+		metadata, _ := json.Marshal(row)
+		item := ys.Item{
+			Game:     game,
+			Region:   region,
+			ID:       fmt.Sprintf("%d", row.ID),
+			Title:    row.Title,
+			Artist:   row.Artist,
+			Metadata: string(metadata),
+			Variants: []ys.Variant{{Kind: "wallpaper", URL: domainLoadWallpaperAzurLane + row.Works}},
+		}
+		published, err := ys.ParsePublishTime(row.PublishTime, ys.RegionLocation(region))
+		if err != nil {
+			ys.Logf("Unknown publication date of %d: %v", row.ID, err)
+		}
+		item.PublishedAt = published
+		items = append(items, item)
+	}
+	return items
+}
@@ -0,0 +1,28 @@
+// Package crawlers registers the crawlers of the games, run by yostar-wallpaper
+package crawlers
+
+import (
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+	"github.com/YukiHime23/go-wallpaper-yostar/crawlers/aethergazer"
+	"github.com/YukiHime23/go-wallpaper-yostar/crawlers/arknight"
+	"github.com/YukiHime23/go-wallpaper-yostar/crawlers/azurlane"
+	"github.com/YukiHime23/go-wallpaper-yostar/crawlers/majhongsoul"
+)
+
+// All are the crawlers of the games, in their default sync order. Each lives in the
+// package of the same name, whose testdata holds a recorded response of its API.
+var All = []ys.Crawler{
+	azurlane.Crawler,
+	arknight.Crawler,
+	majhongsoul.Crawler,
+	aethergazer.Crawler,
+}
+
+// ByName returns the crawlers by the name of their command
+func ByName() map[string]ys.Crawler {
+	m := make(map[string]ys.Crawler, len(All))
+	for _, c := range All {
+		m[c.Name] = c
+	}
+	return m
+}
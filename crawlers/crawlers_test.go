@@ -0,0 +1,124 @@
+package crawlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+// TestRecordedResponses lists every crawler against its recorded API response,
+// served for every page, decoding it strictly, so that a change of an API shows up
+// once its recording is refreshed
+func TestRecordedResponses(t *testing.T) {
+	for _, c := range All {
+		t.Run(c.Name, func(t *testing.T) {
+			body, err := os.ReadFile(filepath.Join(c.Name, "testdata", "response.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write(body)
+			}))
+			defer srv.Close()
+
+			region := firstRegion(c)
+			items, err := c.List(srv.Client(), srv.URL, region, ys.ListOptions{Strict: true})
+			if err != nil {
+				t.Fatalf("recorded response does not match the expected schema: %v", err)
+			}
+			checkItems(t, c, region, items)
+		})
+	}
+}
+
+// TestLiveResponses runs the same checks against the live APIs of every region when
+// YOSTAR_LIVE_TESTS is set
+func TestLiveResponses(t *testing.T) {
+	if os.Getenv("YOSTAR_LIVE_TESTS") == "" {
+		t.Skip("set YOSTAR_LIVE_TESTS=1 to check the live APIs")
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	for _, c := range All {
+		for region, url := range c.APIs {
+			t.Run(c.Name+"/"+region, func(t *testing.T) {
+				items, err := c.List(client, url, region, ys.ListOptions{Strict: true})
+				if err != nil {
+					t.Fatalf("API does not match the expected schema: %v", err)
+				}
+				checkItems(t, c, region, items)
+			})
+		}
+	}
+}
+
+// TestRegistry checks that the crawlers can be told apart by command and by game
+func TestRegistry(t *testing.T) {
+	names := map[string]bool{}
+	games := map[string]bool{}
+	for _, c := range All {
+		for _, name := range append([]string{c.Name}, c.Aliases...) {
+			if names[name] {
+				t.Errorf("%s is the name of two crawlers", name)
+			}
+			names[name] = true
+		}
+		if games[c.Game] {
+			t.Errorf("%s is crawled twice", c.Game)
+		}
+		games[c.Game] = true
+		if c.Path == "" || c.List == nil || len(c.APIs) == 0 {
+			t.Errorf("%s has no path, list function or API", c.Name)
+		}
+	}
+	if got := len(ByName()); got != len(All) {
+		t.Errorf("ByName has %d crawlers, want %d", got, len(All))
+	}
+}
+
+// checkItems checks that every item has what is needed to name and download its images
+func checkItems(t *testing.T, c ys.Crawler, region string, items []ys.Item) {
+	t.Helper()
+	if len(items) == 0 {
+		t.Fatal("no items")
+	}
+	ids := map[string]bool{}
+	for _, it := range items {
+		if it.ID == "" || it.Title == "" {
+			t.Errorf("item %+v has no ID or title", it)
+		}
+		if ids[it.ID] {
+			t.Errorf("item %s is listed twice", it.ID)
+		}
+		ids[it.ID] = true
+		if it.Game != c.Game || it.Region != region {
+			t.Errorf("item %s is of %s in %s, want %s in %s", it.ID, it.Game, it.Region, c.Game, region)
+		}
+		if len(it.Variants) == 0 || !strings.HasPrefix(it.Variants[0].URL, "https://") {
+			t.Errorf("item %s has no image URL: %+v", it.ID, it.Variants)
+		}
+		for _, v := range it.Variants {
+			if _, ok := c.KindDirs[v.Kind]; c.KindDirs != nil && !ok {
+				t.Errorf("item %s has a %s variant without a folder", it.ID, v.Kind)
+			}
+		}
+	}
+}
+
+// firstRegion returns the first region of the APIs of c, in alphabetical order
+func firstRegion(c ys.Crawler) string {
+	region := ""
+	for r := range c.APIs {
+		if region == "" || r < region {
+			region = r
+		}
+	}
+	return region
+}
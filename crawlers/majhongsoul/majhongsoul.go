@@ -0,0 +1,145 @@
+package majhongsoul
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	ys "github.com/YukiHime23/go-wallpaper-yostar"
+)
+
+type responseApi struct {
+	Code int     `json:"code"`
+	Data resData `json:"data"`
+	Msg  string  `json:"msg"`
+}
+
+type resData struct {
+	Count int               `json:"count"`
+	Rows  []json.RawMessage `json:"rows"`
+}
+
+type wallpaperRow struct {
+	ID          int    `json:"id"`
+	PC          string `json:"pc"`
+	Mobile1     string `json:"mobile1"`
+	Mobile2     string `json:"mobile2"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+var (
+	// apiListWallpaperMahjongSoul are the wallpaper list APIs by region
+	apiListWallpaperMahjongSoul = map[string]string{
+		ys.RegionGlobal: "https://mahjongsoul.yo-star.com/api/assets/wallpaper?pageIndex=1&pageNum=12000",
+	}
+)
+
+const (
+	game               = "mahjong_soul"
+	defaultPath        = "MahjongSoul_Wallpaper"
+	defaultPageWorkers = 4
+)
+
+// Crawler downloads the Mahjong Soul wallpapers
+var Crawler = ys.Crawler{
+	Name:     "majhongsoul",
+	Game:     game,
+	Path:     defaultPath,
+	APIs:     apiListWallpaperMahjongSoul,
+	Locales:  true,
+	Paginate: true,
+	List:     list,
+}
+
+// list fetches the wallpapers of the API and maps them to library items
+func list(client *http.Client, url, region string, opts ys.ListOptions) ([]ys.Item, error) {
+	wallpapers, err := fetchWallpapers(client, url, opts.Locale, opts.Strict, opts.Paginate)
+	if err != nil {
+		return nil, err
+	}
+	return toItems(wallpapers, region), nil
+}
+
+// fetchWallpapers retrieves the list of wallpapers from the API, in the given locale when
+// not empty. With paginate, the wallpapers left out of a truncated response are fetched
+// page by page, defaultPageWorkers at a time.
+func fetchWallpapers(client *http.Client, url, locale string, strict, paginate bool) ([]wallpaperRow, error) {
+	resBody, err := ys.FetchApiLocale(client, url, locale)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch wallpapers: %w", err)
+	}
+	pages := [][]byte{resBody}
+
+	var resApi responseApi
+	if paginate && json.Unmarshal(resBody, &resApi) == nil && ys.Truncated(resApi.Data.Count, len(resApi.Data.Rows)) {
+		ys.Logf("%s API listed %d of its %d wallpapers, fetching the others page by page", game, len(resApi.Data.Rows), resApi.Data.Count)
+		rest, err := ys.FetchRemainingPages(client, url, locale, "pageIndex", "pageNum", len(resApi.Data.Rows), resApi.Data.Count, defaultPageWorkers)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch wallpapers: %w", err)
+		}
+		pages = append(pages, rest...)
+	}
+	return parseWallpapers(pages, strict)
+}
+
+// parseWallpapers decodes and validates the API response pages, in order, skipping
+// the rows not matching the expected schema unless strict. The count announced by
+// the first page is checked against the rows of all. A wallpaper listed on two pages,
+// moved by one published during the fetch, is kept once.
+func parseWallpapers(pages [][]byte, strict bool) ([]wallpaperRow, error) {
+	var count int
+	var list []json.RawMessage
+	for i, resBody := range pages {
+		var resApi responseApi
+		if err := json.Unmarshal(resBody, &resApi); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON of page %d: %w", i+1, err)
+		}
+		if i == 0 {
+			count = resApi.Data.Count
+		}
+		list = append(list, resApi.Data.Rows...)
+	}
+
+	schema := ys.RowSchema{
+		Game:      game,
+		Required:  []string{"id", "title", "pc"},
+		Strict:    strict,
+		Paginated: len(pages) > 1,
+	}
+	if err := schema.CheckCount(count, len(list)); err != nil {
+		return nil, err
+	}
+	rows, err := ys.DecodeRows[wallpaperRow](list, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int]bool, len(rows))
+	wallpapers := rows[:0]
+	for _, row := range rows {
+		if !seen[row.ID] {
+			seen[row.ID] = true
+			wallpapers = append(wallpapers, row)
+		}
+	}
+	return wallpapers, nil
+}
+
+// toItems maps the API rows to library items
+func toItems(wallpapers []wallpaperRow, region string) []ys.Item {
+	items := make([]ys.Item, 0, len(wallpapers))
+	for _, row := range wallpapers {
+		metadata, _ := json.Marshal(row)
+		items = append(items, ys.Item{
+			Game:        game,
+			Region:      region,
+			ID:          fmt.Sprintf("%d", row.ID),
+			Title:       row.Title,
+			Description: row.Description,
+			Metadata:    string(metadata),
+			Variants:    []ys.Variant{{Kind: "wallpaper", URL: row.PC}},
+		})
+	}
+	return items
+}
@@ -0,0 +1,102 @@
+package crawal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DeadLinkAttempts is the number of 404 or 410 answers after which a URL is dead
+const DeadLinkAttempts = 3
+
+// DeadLink is an image URL the server answered 404 or 410 for
+type DeadLink struct {
+	URL       string
+	Game      string
+	IdGallery string
+	Type      string
+	FileName  string
+	Status    int // last status received
+	Attempts  int
+	Dead      bool // left out of the syncs once Attempts reaches DeadLinkAttempts
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// isGone reports whether a status means the image was removed from the server
+func isGone(status int) bool {
+	return status == http.StatusNotFound || status == http.StatusGone
+}
+
+// goneStatus returns the status of a download error meaning the image was removed, or 0
+func goneStatus(err error) int {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && isGone(statusErr.StatusCode) {
+		return statusErr.StatusCode
+	}
+	return 0
+}
+
+// recordGoneLink counts a 404 or 410 answer for the URL of a job, marking the URL
+// dead once it failed DeadLinkAttempts times
+func recordGoneLink(db *sql.DB, job Job, status int) error {
+	_, err := db.Exec(`
+		INSERT INTO dead_links(url, game, id_gallery, type, file_name, status, attempts, dead)
+		VALUES (?, ?, ?, ?, ?, ?, 1, 1 >= ?)
+		ON CONFLICT(url) DO UPDATE SET
+			status = excluded.status,
+			attempts = attempts + 1,
+			dead = attempts + 1 >= ?,
+			last_seen = CURRENT_TIMESTAMP`,
+		job.URL, job.Game, job.IdGallery, job.Type, job.FileName, status, DeadLinkAttempts, DeadLinkAttempts)
+	if err != nil {
+		return fmt.Errorf("failed to record dead link: %w", err)
+	}
+	return nil
+}
+
+// forgetGoneLink clears the failures of a URL that could be downloaded again
+func forgetGoneLink(db *sql.DB, url string) error {
+	if _, err := db.Exec("DELETE FROM dead_links WHERE url = ?", url); err != nil {
+		return fmt.Errorf("failed to clear dead link: %w", err)
+	}
+	return nil
+}
+
+// IsDeadLink reports whether url is marked dead
+func IsDeadLink(db *sql.DB, url string) (bool, error) {
+	var dead bool
+	err := db.QueryRow("SELECT dead FROM dead_links WHERE url = ?", url).Scan(&dead)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to look up %s: %w", url, err)
+	}
+	return dead, nil
+}
+
+// ListDeadLinks returns the URLs marked dead, of game when not empty, most recently seen first
+func ListDeadLinks(db *sql.DB, game string) ([]DeadLink, error) {
+	rows, err := db.Query(`
+		SELECT url, game, id_gallery, type, file_name, status, attempts, dead, first_seen, last_seen
+		FROM dead_links WHERE dead = 1 AND (? = '' OR game = ?)
+		ORDER BY last_seen DESC, url`, game, game)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query dead links: %w", err)
+	}
+	defer rows.Close()
+
+	var links []DeadLink
+	for rows.Next() {
+		var l DeadLink
+		err := rows.Scan(&l.URL, &l.Game, &l.IdGallery, &l.Type, &l.FileName, &l.Status, &l.Attempts, &l.Dead, &l.FirstSeen, &l.LastSeen)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
@@ -0,0 +1,293 @@
+package crawal
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Decoder decodes the image files of one format, for the dimensions, thumbnails,
+// resized images and conversions of the library
+type Decoder struct {
+	Name string
+	// Magics are the prefixes of its files, "?" matching any byte
+	Magics []string
+	// Exts are the extensions of its files, with their dot, adopted from folders
+	Exts   []string
+	Decode func(io.Reader) (image.Image, error)
+	// DecodeConfig, when set, reads the dimensions of an image from its header
+	DecodeConfig func(io.Reader) (image.Config, error)
+}
+
+// decoders are the registered decoders, in order of registration
+var (
+	decodersMu sync.Mutex
+	decoders   = []Decoder{
+		{Name: "jpeg", Magics: []string{"\xff\xd8"}, Exts: []string{".jpg", ".jpeg"}, Decode: jpeg.Decode, DecodeConfig: jpeg.DecodeConfig},
+		{Name: "png", Magics: []string{"\x89PNG\r\n\x1a\n"}, Exts: []string{".png"}, Decode: png.Decode, DecodeConfig: png.DecodeConfig},
+		{Name: "gif", Magics: []string{"GIF87a", "GIF89a"}, Exts: []string{".gif"}, Decode: gif.Decode, DecodeConfig: gif.DecodeConfig},
+	}
+)
+
+// imageFormat is a format of image files recognized by the library, whether or not
+// the build decodes it
+type imageFormat struct {
+	name   string
+	exts   []string // the first one its files are saved with
+	magics []string
+	tag    string // of the builds decoding it, when it isn't built in
+}
+
+// imageFormats are the formats recognized in the files downloaded, served by some
+// CDNs whatever the extension of their URL
+var imageFormats = []imageFormat{
+	{"jpeg", []string{".jpg", ".jpeg"}, []string{"\xff\xd8"}, ""},
+	{"png", []string{".png"}, []string{"\x89PNG\r\n\x1a\n"}, ""},
+	{"gif", []string{".gif"}, []string{"GIF87a", "GIF89a"}, ""},
+	{"webp", []string{".webp"}, []string{"RIFF????WEBPVP8"}, "webp"},
+	{"heic", []string{".heic", ".heif"}, heicMagics, "heif"},
+	{"avif", []string{".avif"}, avifMagics, "heif"},
+	{"jxl", []string{".jxl"}, jxlMagics, "jxl"},
+}
+
+// Magics of the HEIF files, by the brand of their ftyp box, and of the JPEG XL
+// codestreams and containers
+var (
+	heicMagics = []string{"????ftypheic", "????ftypheix", "????ftyphevc", "????ftypheim", "????ftypmif1", "????ftypmsf1"}
+	avifMagics = []string{"????ftypavif", "????ftypavis"}
+	jxlMagics  = []string{"\xff\x0a", "\x00\x00\x00\x0cJXL \x0d\x0a\x87\x0a"}
+)
+
+// sniffFormat returns the format of the file starting with header
+func sniffFormat(header []byte) (imageFormat, bool) {
+	for _, f := range imageFormats {
+		for _, magic := range f.magics {
+			if matchMagic(header, magic) {
+				return f, true
+			}
+		}
+	}
+	return imageFormat{}, false
+}
+
+// hasExt reports whether ext is an extension of the files of the format
+func (f imageFormat) hasExt(ext string) bool {
+	for _, e := range f.exts {
+		if strings.EqualFold(e, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// imageExt reports whether ext is the extension of a format of imageFormats
+func imageExt(ext string) bool {
+	for _, f := range imageFormats {
+		if f.hasExt(ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// sniffFile returns the format of the file at p
+func sniffFile(p string) (imageFormat, bool) {
+	f, err := os.Open(p)
+	if err != nil {
+		return imageFormat{}, false
+	}
+	defer f.Close()
+	header := make([]byte, 32)
+	n, _ := io.ReadFull(f, header)
+	return sniffFormat(header[:n])
+}
+
+// RegisterDecoder makes a decoder available for the files starting with one of its
+// magics, replacing the one registered with its name
+func RegisterDecoder(d Decoder) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+	for i := range decoders {
+		if decoders[i].Name == d.Name {
+			decoders[i] = d
+			return
+		}
+	}
+	decoders = append(decoders, d)
+}
+
+// Decoders returns the names of the formats decoded, in alphabetical order
+func Decoders() []string {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+	var names []string
+	for _, d := range decoders {
+		names = append(names, d.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// decodedExt reports whether a registered decoder reads the files with the extension ext
+func decodedExt(ext string) bool {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+	for _, d := range decoders {
+		for _, e := range d.Exts {
+			if strings.EqualFold(e, ext) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchMagic reports whether header starts with magic
+func matchMagic(header []byte, magic string) bool {
+	if len(header) < len(magic) {
+		return false
+	}
+	for i := 0; i < len(magic); i++ {
+		if magic[i] != '?' && magic[i] != header[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sniffDecoder returns the decoder of the file starting with header
+func sniffDecoder(header []byte) (Decoder, error) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+	for _, d := range decoders {
+		for _, magic := range d.Magics {
+			if matchMagic(header, magic) {
+				return d, nil
+			}
+		}
+	}
+	if f, ok := sniffFormat(header); ok && f.tag != "" {
+		return Decoder{}, fmt.Errorf("%s images are only decoded by builds with the %s tag", f.name, f.tag)
+	}
+	return Decoder{}, image.ErrFormat
+}
+
+// decodeImage decodes the image file at p with the decoder of its format
+func decodeImage(p string) (image.Image, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	header, _ := r.Peek(32)
+	d, err := sniffDecoder(header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", p, err)
+	}
+	img, err := d.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", p, err)
+	}
+	return img, nil
+}
+
+// maxImagePixels bounds the images checkImage decodes, against files claiming huge
+// dimensions to exhaust the memory of the decoder
+const maxImagePixels = 1 << 28
+
+// checkImage decodes the whole image file at p, reporting an error when it is
+// truncated or corrupt. Decoders panicking on malformed data and images over
+// maxImagePixels are reported too. Files of formats the build cannot decode, or
+// that are no images, pass.
+func checkImage(p string) (err error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	header, _ := r.Peek(32)
+	d, sniffErr := sniffDecoder(header)
+	if sniffErr != nil {
+		return nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s decoder panicked: %v", d.Name, r)
+		}
+	}()
+	if d.DecodeConfig != nil {
+		config, err := d.DecodeConfig(r)
+		if err != nil {
+			return err
+		}
+		if int64(config.Width)*int64(config.Height) > maxImagePixels {
+			return fmt.Errorf("%dx%d pixels, over the limit of %d", config.Width, config.Height, maxImagePixels)
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		r.Reset(f)
+	}
+	_, err = d.Decode(r)
+	return err
+}
+
+// commandDecoder returns a decoder of the files with the extension ext running the
+// first of commands found in the PATH, with the {file} and {out} placeholders, to
+// convert them into PNG. install names what to install when none is found.
+func commandDecoder(ext string, commands []string, install string) func(io.Reader) (image.Image, error) {
+	return func(r io.Reader) (image.Image, error) {
+		command := ""
+		for _, c := range commands {
+			program, _, _ := strings.Cut(c, " ")
+			if _, err := exec.LookPath(program); err == nil {
+				command = c
+				break
+			}
+		}
+		if command == "" {
+			return nil, fmt.Errorf("no %s decoder found, install %s", strings.TrimPrefix(ext, "."), install)
+		}
+
+		f, err := os.CreateTemp("", "yostar-decode-*"+ext)
+		if err != nil {
+			return nil, err
+		}
+		src, out := f.Name(), strings.TrimSuffix(f.Name(), ext)+".png"
+		defer os.Remove(src)
+		defer trackTemp(src)()
+		defer os.Remove(out)
+		defer trackTemp(out)()
+		_, err = io.Copy(f, r)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := runCommand(context.Background(), command, defaultCommandTimeout, map[string]string{"file": src, "out": out}); err != nil {
+			return nil, fmt.Errorf("decoder failed: %w", err)
+		}
+		decoded, err := os.Open(out)
+		if err != nil {
+			return nil, fmt.Errorf("decoder wrote no image: %w", err)
+		}
+		defer decoded.Close()
+		return png.Decode(decoded)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build heif
+
+package crawal
+
+// heifDecoders are the command lines of the HEIF decoders looked up in the PATH, in
+// order of preference: libheif, its older name, and ImageMagick. libheif decodes
+// AVIF too when built with an AV1 decoder.
+var heifDecoders = []string{
+	"heif-dec {file} {out}",
+	"heif-convert {file} {out}",
+	"magick {file} {out}",
+}
+
+func init() {
+	RegisterDecoder(Decoder{Name: "heic", Magics: heicMagics, Exts: []string{".heic", ".heif"}, Decode: commandDecoder(".heic", heifDecoders, "libheif (heif-dec) or ImageMagick")})
+	RegisterDecoder(Decoder{Name: "avif", Magics: avifMagics, Exts: []string{".avif"}, Decode: commandDecoder(".avif", heifDecoders, "libheif (heif-dec) or ImageMagick")})
+}
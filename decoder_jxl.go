@@ -0,0 +1,14 @@
+//go:build jxl
+
+package crawal
+
+// jxlDecoders are the command lines of the JPEG XL decoders looked up in the PATH,
+// in order of preference: libjxl and ImageMagick
+var jxlDecoders = []string{
+	"djxl {file} {out}",
+	"magick {file} {out}",
+}
+
+func init() {
+	RegisterDecoder(Decoder{Name: "jxl", Magics: jxlMagics, Exts: []string{".jxl"}, Decode: commandDecoder(".jxl", jxlDecoders, "libjxl (djxl) or ImageMagick")})
+}
@@ -0,0 +1,9 @@
+//go:build webp
+
+package crawal
+
+import "golang.org/x/image/webp"
+
+func init() {
+	RegisterDecoder(Decoder{Name: "webp", Magics: []string{"RIFF????WEBPVP8"}, Exts: []string{".webp"}, Decode: webp.Decode, DecodeConfig: webp.DecodeConfig})
+}
@@ -0,0 +1,149 @@
+package crawal
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+)
+
+// Dedupe modes for files that are byte-identical to a file already in the library
+const (
+	DedupeOff  = "off"  // keep the duplicate as a separate file
+	DedupeLink = "link" // replace the duplicate with a hard link to the library file
+	DedupeSkip = "skip" // delete the duplicate and record the library file instead
+)
+
+// perceptualThreshold is the maximum Hamming distance between the perceptual
+// hashes of two images considered identical
+const perceptualThreshold = 4
+
+// Duplicate describes a library file that a new file duplicates
+type Duplicate struct {
+	Of        GalleryItem
+	Identical bool  // byte-identical rather than only perceptually identical
+	Saved     int64 // bytes saved by linking or skipping the new file
+}
+
+// DedupeItem fills the checksum, size and image analysis of a downloaded wallpaper and
+// checks it against the rest of the library. Byte-identical files are handled according
+// to mode; perceptually identical ones are only recorded with DuplicateOf, since they may
+// differ in resolution. It returns the duplicate found, if any.
+func DedupeItem(db *sql.DB, item *GalleryItem, mode string) (*Duplicate, error) {
+	if err := CheckDedupeMode(mode); err != nil {
+		return nil, err
+	}
+
+	sum, size, err := HashFile(item.Path)
+	if err != nil {
+		return nil, err
+	}
+	item.SHA256, item.Size = sum, size
+	// files that cannot be decoded are only deduplicated by checksum
+	analyzeImage(item)
+
+	of, err := findIdentical(db, sum, item.Path, *item)
+	if err != nil {
+		return nil, err
+	}
+	if of != nil {
+		dup := &Duplicate{Of: *of, Identical: true}
+		item.DuplicateOf = of.ID
+
+		switch mode {
+		case DedupeLink:
+			if err := linkDuplicate(item.Path, of.Path); err == nil {
+				dup.Saved = size
+			}
+		case DedupeSkip:
+			if err := os.Remove(item.Path); err != nil {
+				return nil, fmt.Errorf("failed to remove duplicate: %w", err)
+			}
+			os.Remove(ThumbnailPath(item.Path))
+			item.Path = of.Path
+			dup.Saved = size
+		}
+		return dup, nil
+	}
+
+	of, err = findSimilar(db, item.PHash, *item)
+	if err != nil || of == nil {
+		return nil, err
+	}
+	item.DuplicateOf = of.ID
+	return &Duplicate{Of: *of}, nil
+}
+
+// CheckDedupeMode returns an error if mode is not one of the dedupe modes
+func CheckDedupeMode(mode string) error {
+	switch mode {
+	case DedupeOff, DedupeLink, DedupeSkip:
+		return nil
+	}
+	return fmt.Errorf("unknown dedupe mode %q", mode)
+}
+
+// findIdentical returns another wallpaper of the library whose file on disk has the given
+// checksum, ignoring the file at p and the wallpaper self, by game, region, gallery ID and type
+func findIdentical(db *sql.DB, sum, p string, self GalleryItem) (*GalleryItem, error) {
+	rows, err := db.Query(`
+		SELECT `+galleryColumns+` FROM gallery
+		WHERE sha256 = ? AND path != '' AND path != ? AND NOT (game = ? AND region = ? AND id_gallery = ? AND type = ?)
+		ORDER BY id`, sum, storedPath(p), self.Game, regionOrGlobal(self.Region), self.IdGallery, self.Type)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up duplicates: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item, err := scanGalleryItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(item.Path); err == nil {
+			return &item, nil
+		}
+	}
+	return nil, rows.Err()
+}
+
+// findSimilar returns another wallpaper of the library whose perceptual hash is within
+// perceptualThreshold of phash, ignoring the wallpaper self, by game, region, gallery ID and type
+func findSimilar(db *sql.DB, phash string, self GalleryItem) (*GalleryItem, error) {
+	if phash == "" {
+		return nil, nil
+	}
+
+	rows, err := db.Query(`
+		SELECT `+galleryColumns+` FROM gallery
+		WHERE phash != '' AND NOT (game = ? AND region = ? AND id_gallery = ? AND type = ?)
+		ORDER BY id`, self.Game, regionOrGlobal(self.Region), self.IdGallery, self.Type)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up similar images: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item, err := scanGalleryItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		if d := hashDistance(phash, item.PHash); d >= 0 && d <= perceptualThreshold {
+			return &item, nil
+		}
+	}
+	return nil, rows.Err()
+}
+
+// linkDuplicate atomically replaces the file at dup with a hard link to target.
+// It fails, leaving dup untouched, when both are on different file systems.
+func linkDuplicate(dup, target string) error {
+	tmp := dup + ".dedupe"
+	if err := os.Link(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dup); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
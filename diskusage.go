@@ -0,0 +1,179 @@
+package crawal
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Usage is the space taken on disk by the files of a game and type, or of the whole
+// library, in bytes
+type Usage struct {
+	Files      int   `json:"files"`      // originals on disk
+	Originals  int64 `json:"originals"`  // the downloaded images, hard links counted once
+	Thumbnails int64 `json:"thumbnails"` // their thumbnails
+	Trash      int64 `json:"trash"`      // replaced files kept as revisions and quarantined downloads
+	Temp       int64 `json:"temp"`       // partial downloads left by interrupted runs
+}
+
+// Total returns the bytes of every kind of file
+func (u Usage) Total() int64 {
+	return u.Originals + u.Thumbnails + u.Trash + u.Temp
+}
+
+func (u *Usage) add(o Usage) {
+	u.Files += o.Files
+	u.Originals += o.Originals
+	u.Thumbnails += o.Thumbnails
+	u.Trash += o.Trash
+	u.Temp += o.Temp
+}
+
+// TypeUsage is the usage of the files of a game and type
+type TypeUsage struct {
+	Game string `json:"game"`
+	Type string `json:"type"`
+	Usage
+}
+
+// LargeFile is an original of the library and its size on disk
+type LargeFile struct {
+	Game string `json:"game"`
+	Type string `json:"type"`
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// DiskUsage is the space taken on disk by the library
+type DiskUsage struct {
+	Types   []TypeUsage `json:"types"`
+	Total   Usage       `json:"total"`
+	Largest []LargeFile `json:"largest"` // largest first
+	Missing int         `json:"missing"` // files recorded but not on disk
+}
+
+// LibraryDiskUsage measures the files of the wallpapers matching the filter on disk,
+// by game and type: their originals and thumbnails, their revisions and quarantined
+// downloads, and the partial downloads left in their folders. It lists the top
+// largest originals.
+func LibraryDiskUsage(db *sql.DB, f Filter, top int) (DiskUsage, error) {
+	var du DiskUsage
+	items, err := FindGalleryItems(db, f)
+	if err != nil {
+		return du, fmt.Errorf("failed to query wallpapers: %w", err)
+	}
+
+	usage := make(map[[2]string]*Usage)
+	of := func(game, typ string) *Usage {
+		key := [2]string{game, typ}
+		if usage[key] == nil {
+			usage[key] = &Usage{}
+		}
+		return usage[key]
+	}
+	seen := make(map[[2]uint64]bool)
+	// size returns the size of the file at p and the bytes it adds to the usage, 0
+	// when it was already counted as another hard link
+	size := func(p string) (int64, int64, bool) {
+		info, err := os.Stat(p)
+		if err != nil || !info.Mode().IsRegular() {
+			return 0, 0, false
+		}
+		if key, ok := fileKey(info); ok {
+			if seen[key] {
+				return info.Size(), 0, true
+			}
+			seen[key] = true
+		}
+		return info.Size(), info.Size(), true
+	}
+
+	ids := make(map[int64]bool)
+	dirs := make(map[string][2]string)
+	for _, item := range items {
+		if item.Cataloged || item.Path == "" {
+			continue
+		}
+		ids[item.ID] = true
+		u := of(item.Game, item.Type)
+		n, counted, ok := size(item.Path)
+		if !ok {
+			du.Missing++
+			continue
+		}
+		u.Files++
+		u.Originals += counted
+		_, thumb, _ := size(ThumbnailPath(item.Path))
+		u.Thumbnails += thumb
+		du.Largest = append(du.Largest, LargeFile{Game: item.Game, Type: item.Type, Name: item.FileName, Path: item.Path, Size: n})
+		if _, ok := dirs[filepath.Dir(item.Path)]; !ok {
+			dirs[filepath.Dir(item.Path)] = [2]string{item.Game, item.Type}
+		}
+	}
+
+	// Revisions and quarantined downloads
+	rows, err := db.Query(`SELECT r.path, g.id, g.game, g.type FROM revisions r
+		JOIN gallery g ON g.id = r.gallery_id WHERE r.path != ''`)
+	if err != nil {
+		return du, fmt.Errorf("failed to list revisions: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p, game, typ string
+		var id int64
+		if err := rows.Scan(&p, &id, &game, &typ); err != nil {
+			return du, err
+		}
+		if ids[id] {
+			_, n, _ := size(resolvePath(p))
+			of(game, typ).Trash += n
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return du, err
+	}
+	quarantined, err := ListQuarantined(db, f.Game)
+	if err != nil {
+		return du, err
+	}
+	for _, q := range quarantined {
+		if f.Type == "" || q.Type == f.Type {
+			_, n, _ := size(q.Path)
+			of(q.Game, q.Type).Trash += n
+		}
+	}
+
+	// Partial downloads, found next to the originals
+	for dir, key := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			name := e.Name()
+			if e.Type().IsRegular() && (strings.HasSuffix(name, ".part") ||
+				strings.Contains(name, redownloadSuffix+".") || strings.HasSuffix(name, redownloadSuffix)) {
+				_, n, _ := size(filepath.Join(dir, name))
+				of(key[0], key[1]).Temp += n
+			}
+		}
+	}
+
+	for key, u := range usage {
+		du.Types = append(du.Types, TypeUsage{Game: key[0], Type: key[1], Usage: *u})
+		du.Total.add(*u)
+	}
+	sort.Slice(du.Types, func(i, j int) bool {
+		a, b := du.Types[i], du.Types[j]
+		return a.Game < b.Game || a.Game == b.Game && a.Type < b.Type
+	})
+	sort.SliceStable(du.Largest, func(i, j int) bool { return du.Largest[i].Size > du.Largest[j].Size })
+	if top >= 0 && len(du.Largest) > top {
+		du.Largest = du.Largest[:top]
+	}
+	return du, nil
+}
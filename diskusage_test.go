@@ -0,0 +1,65 @@
+package crawal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLibraryDiskUsage(t *testing.T) {
+	db := newPageTestDB(t, 0)
+	dir := t.TempDir()
+	write := func(name string, size int) string {
+		t.Helper()
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(strings.Repeat(name[:1], size)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	save := func(id, typ, p string) {
+		t.Helper()
+		if err := SaveGalleryItem(db, GalleryItem{Game: "azur_lane", IdGallery: id, Type: typ, FileName: filepath.Base(p), Path: p}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	save("1", "wallpaper", write("a.png", 100))
+	linked := filepath.Join(dir, "a-linked.png")
+	if err := os.Link(filepath.Join(dir, "a.png"), linked); err != nil {
+		t.Skipf("no hard links: %v", err)
+	}
+	save("2", "wallpaper", linked)
+	save("3", "skin", write("c.png", 300))
+	save("4", "skin", write("gone.png", 10))
+	os.Remove(filepath.Join(dir, "gone.png"))
+	write(".download-1.part", 50)
+
+	du, err := LibraryDiskUsage(db, Filter{}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the hard link is counted once, and the partial download as the type of the
+	// first file of its folder
+	want := Usage{Files: 3, Originals: 400, Temp: 50}
+	if du.Total != want {
+		t.Errorf("total %+v, want %+v", du.Total, want)
+	}
+	if du.Missing != 1 {
+		t.Errorf("%d files missing, want 1", du.Missing)
+	}
+	if len(du.Types) != 2 || du.Types[0].Type != "skin" || du.Types[0].Originals != 300 || du.Types[1].Originals != 100 {
+		t.Errorf("types %+v, want skin with 300 bytes then wallpaper with 100", du.Types)
+	}
+	if len(du.Largest) != 2 || du.Largest[0].Name != "c.png" || du.Largest[1].Size != 100 {
+		t.Errorf("largest %+v, want c.png then a file of 100 bytes", du.Largest)
+	}
+
+	du, err = LibraryDiskUsage(db, Filter{Type: "skin"}, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if du.Total.Files != 1 || du.Total.Originals != 300 {
+		t.Errorf("skin total %+v, want the 300 bytes of c.png", du.Total)
+	}
+}
@@ -0,0 +1,271 @@
+package crawal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dnsCacheTTL is how long resolved addresses are kept, and the longest a DNS-over-HTTPS
+// answer is kept whatever its TTL
+const dnsCacheTTL = 5 * time.Minute
+
+// lookupFunc resolves the addresses of host and returns how long they may be cached
+type lookupFunc func(ctx context.Context, host string) ([]net.IP, time.Duration, error)
+
+// dnsCache resolves each host once for all the connections of a transport, since
+// bulk downloads would otherwise look the CDN up for each file
+type dnsCache struct {
+	lookup lookupFunc
+
+	mu      sync.Mutex
+	entries map[string]*dnsEntry
+}
+
+// dnsEntry is a cached lookup, ready once its addresses are resolved
+type dnsEntry struct {
+	ready   chan struct{}
+	ips     []net.IP
+	err     error
+	expires time.Time
+}
+
+// CheckDNSServer reports whether server can be used as NetworkOptions.DNS
+func CheckDNSServer(server string) error {
+	if server == "" {
+		return nil
+	}
+	if strings.Contains(server, "://") {
+		u, err := url.Parse(server)
+		if err != nil {
+			return err
+		}
+		if u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("DNS-over-HTTPS URL %q must start with https://", server)
+		}
+		return nil
+	}
+	host, _, err := net.SplitHostPort(dnsServerAddr(server))
+	if err != nil || net.ParseIP(host) == nil {
+		return fmt.Errorf("DNS server %q must be an IP address with an optional port", server)
+	}
+	return nil
+}
+
+// newDNSCache returns a cache resolving with server, as checked by CheckDNSServer,
+// or with the system resolver when empty. The queries to server are sent from local
+// unless nil; those of the system resolver cannot be.
+func newDNSCache(server string, local net.IP) *dnsCache {
+	var lookup lookupFunc
+	switch {
+	case server == "":
+		lookup = resolverLookup(net.DefaultResolver)
+	case strings.Contains(server, "://"):
+		lookup = dohLookup(server, local)
+	default:
+		addr := dnsServerAddr(server)
+		lookup = resolverLookup(&net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				dialer := &net.Dialer{Timeout: 10 * time.Second}
+				if local != nil && strings.HasPrefix(network, "udp") {
+					dialer.LocalAddr = &net.UDPAddr{IP: local}
+				} else if local != nil {
+					dialer.LocalAddr = &net.TCPAddr{IP: local}
+				}
+				return dialer.DialContext(ctx, network, addr)
+			},
+		})
+	}
+	return &dnsCache{lookup: lookup, entries: make(map[string]*dnsEntry)}
+}
+
+// dnsServerAddr adds the default DNS port to server when it has none
+func dnsServerAddr(server string) string {
+	if _, _, err := net.SplitHostPort(server); err == nil {
+		return server
+	}
+	return net.JoinHostPort(strings.Trim(server, "[]"), "53")
+}
+
+// resolve returns the addresses of host, looked up once until they expire. Concurrent
+// callers wait for the same lookup.
+func (c *dnsCache) resolve(ctx context.Context, host string) ([]net.IP, error) {
+	c.mu.Lock()
+	e, ok := c.entries[host]
+	if ok {
+		select {
+		case <-e.ready:
+			if e.err != nil || time.Now().After(e.expires) {
+				ok = false
+			}
+		default:
+		}
+	}
+	if !ok {
+		e = &dnsEntry{ready: make(chan struct{})}
+		c.entries[host] = e
+		c.mu.Unlock()
+
+		// Failed lookups are not cached, the next dial tries again
+		ips, ttl, err := c.lookup(ctx, host)
+		e.ips, e.err, e.expires = ips, err, time.Now().Add(ttl)
+		close(e.ready)
+		return ips, err
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-e.ready:
+		return e.ips, e.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// dialContext dials addr through the cached addresses of its host, only those of
+// family, tcp4 or tcp6, unless empty
+func (c *dnsCache) dialContext(dialer *net.Dialer, family string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if family != "" && network == "tcp" {
+			network = family
+		}
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return dialer.DialContext(ctx, network, addr)
+		}
+
+		ips, err := c.resolve(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		var lastErr error
+		for _, ip := range ips {
+			if family != "" && ipFamily(ip) != family {
+				continue
+			}
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no usable address for %s", host)
+		}
+		return nil, lastErr
+	}
+}
+
+// resolverLookup looks hosts up with r. It does not tell the TTL of the records, so
+// they are kept dnsCacheTTL.
+func resolverLookup(r *net.Resolver) lookupFunc {
+	return func(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+		addrs, err := r.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, 0, err
+		}
+		ips := make([]net.IP, len(addrs))
+		for i, a := range addrs {
+			ips[i] = a.IP
+		}
+		return ips, dnsCacheTTL, nil
+	}
+}
+
+// dohResponse is an answer of a DNS-over-HTTPS JSON API
+type dohResponse struct {
+	Status int `json:"Status"`
+	Answer []struct {
+		Type int    `json:"type"`
+		TTL  int    `json:"TTL"`
+		Data string `json:"data"`
+	} `json:"Answer"`
+}
+
+// DNS record types asked to DNS-over-HTTPS servers
+const (
+	dnsTypeA    = 1
+	dnsTypeAAAA = 28
+)
+
+// dohLookup looks hosts up with the DNS-over-HTTPS JSON API at server, such as
+// https://cloudflare-dns.com/dns-query or https://dns.google/resolve, connecting from
+// local unless nil. The server itself is resolved by the system resolver, unless
+// given by IP address.
+func dohLookup(server string, local net.IP) lookupFunc {
+	client := &http.Client{Timeout: 10 * time.Second}
+	if local != nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.DialContext = (&net.Dialer{Timeout: 10 * time.Second, LocalAddr: &net.TCPAddr{IP: local}}).DialContext
+		client.Transport = t
+	}
+	return func(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+		var ips []net.IP
+		ttl := dnsCacheTTL
+		var errs []error
+		for _, qtype := range []int{dnsTypeA, dnsTypeAAAA} {
+			answer, err := dohQuery(ctx, client, server, host, qtype)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			for _, a := range answer.Answer {
+				ip := net.ParseIP(a.Data)
+				if a.Type != qtype || ip == nil {
+					continue // CNAME records leading to the addresses
+				}
+				ips = append(ips, ip)
+				ttl = min(ttl, time.Duration(a.TTL)*time.Second)
+			}
+		}
+		if len(ips) == 0 {
+			if err := errors.Join(errs...); err != nil {
+				return nil, 0, err
+			}
+			return nil, 0, fmt.Errorf("no address for %s", host)
+		}
+		return ips, ttl, nil
+	}
+}
+
+// dohQuery asks server for the records of type qtype of host
+func dohQuery(ctx context.Context, client *http.Client, server, host string, qtype int) (dohResponse, error) {
+	var answer dohResponse
+	u, err := url.Parse(server)
+	if err != nil {
+		return answer, err
+	}
+	q := u.Query()
+	q.Set("name", host)
+	q.Set("type", fmt.Sprint(qtype))
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return answer, err
+	}
+	req.Header.Set("Accept", "application/dns-json")
+	res, err := client.Do(req)
+	if err != nil {
+		return answer, fmt.Errorf("DNS-over-HTTPS lookup of %s failed: %w", host, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return answer, fmt.Errorf("DNS-over-HTTPS lookup of %s failed: %s", host, res.Status)
+	}
+	if err := json.NewDecoder(res.Body).Decode(&answer); err != nil {
+		return answer, fmt.Errorf("DNS-over-HTTPS lookup of %s failed: %w", host, err)
+	}
+	if answer.Status != 0 {
+		return answer, fmt.Errorf("DNS-over-HTTPS lookup of %s failed with status %d", host, answer.Status)
+	}
+	return answer, nil
+}
@@ -0,0 +1,257 @@
+package crawal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// dohRecord is an answer served by newDoHServer
+type dohRecord struct {
+	Type int    `json:"type"`
+	TTL  int    `json:"TTL"`
+	Data string `json:"data"`
+}
+
+// newDoHServer serves the DNS-over-HTTPS JSON API, answering with the records of
+// answers by name and type, an HTTP error for the types of fail, and NXDOMAIN for
+// the rest. It counts the queries into queries.
+func newDoHServer(t *testing.T, answers map[string][]dohRecord, fail map[int]int, queries *int32) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(queries, 1)
+		if r.Header.Get("Accept") != "application/dns-json" {
+			t.Errorf("query accepts %q", r.Header.Get("Accept"))
+		}
+		name, qtype := r.URL.Query().Get("name"), r.URL.Query().Get("type")
+		for typ, status := range fail {
+			if qtype == strconv.Itoa(typ) {
+				http.Error(w, "upstream failure", status)
+				return
+			}
+		}
+		var res struct {
+			Status int         `json:"Status"`
+			Answer []dohRecord `json:"Answer"`
+		}
+		for _, a := range answers[name] {
+			if qtype == strconv.Itoa(a.Type) || a.Type == 5 {
+				res.Answer = append(res.Answer, a)
+			}
+		}
+		if res.Answer == nil {
+			res.Status = 3
+		}
+		w.Header().Set("Content-Type", "application/dns-json")
+		json.NewEncoder(w).Encode(res)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestDoHLookup(t *testing.T) {
+	answers := map[string][]dohRecord{
+		"cdn.example": {
+			{Type: 5, TTL: 600, Data: "edge.example."}, // CNAME, skipped
+			{Type: dnsTypeA, TTL: 120, Data: "192.0.2.1"},
+			{Type: dnsTypeA, TTL: 60, Data: "192.0.2.2"},
+			{Type: dnsTypeAAAA, TTL: 90, Data: "2001:db8::1"},
+		},
+		"long.example": {{Type: dnsTypeA, TTL: 86400, Data: "192.0.2.3"}},
+		"v6.example":   {{Type: dnsTypeAAAA, TTL: 30, Data: "2001:db8::2"}},
+	}
+	var queries int32
+	srv := newDoHServer(t, answers, nil, &queries)
+	lookup := dohLookup(srv.URL, nil)
+
+	tests := []struct {
+		host    string
+		ips     []string
+		ttl     time.Duration
+		wantErr bool
+	}{
+		{host: "cdn.example", ips: []string{"192.0.2.1", "192.0.2.2", "2001:db8::1"}, ttl: 60 * time.Second},
+		{host: "long.example", ips: []string{"192.0.2.3"}, ttl: dnsCacheTTL},
+		{host: "v6.example", ips: []string{"2001:db8::2"}, ttl: 30 * time.Second},
+		{host: "missing.example", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			ips, ttl, err := lookup(context.Background(), tt.host)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("lookup returned %v, want an error", ips)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ips) != len(tt.ips) {
+				t.Fatalf("lookup returned %v, want %v", ips, tt.ips)
+			}
+			for i, ip := range ips {
+				if ip.String() != tt.ips[i] {
+					t.Errorf("address %d is %s, want %s", i, ip, tt.ips[i])
+				}
+			}
+			if ttl != tt.ttl {
+				t.Errorf("TTL is %v, want %v", ttl, tt.ttl)
+			}
+		})
+	}
+}
+
+// TestDoHLookupFailingUpstream checks that the addresses of one type are used when
+// the query of the other fails, and that the lookup fails when both do
+func TestDoHLookupFailingUpstream(t *testing.T) {
+	answers := map[string][]dohRecord{"cdn.example": {{Type: dnsTypeA, TTL: 60, Data: "192.0.2.1"}}}
+	var queries int32
+
+	srv := newDoHServer(t, answers, map[int]int{dnsTypeAAAA: http.StatusBadGateway}, &queries)
+	ips, _, err := dohLookup(srv.URL, nil)(context.Background(), "cdn.example")
+	if err != nil || len(ips) != 1 || ips[0].String() != "192.0.2.1" {
+		t.Errorf("lookup with a failing AAAA query returned %v, %v; want 192.0.2.1", ips, err)
+	}
+
+	srv = newDoHServer(t, answers, map[int]int{dnsTypeA: http.StatusBadGateway, dnsTypeAAAA: http.StatusServiceUnavailable}, &queries)
+	if ips, _, err := dohLookup(srv.URL, nil)(context.Background(), "cdn.example"); err == nil {
+		t.Errorf("lookup with failing queries returned %v, want an error", ips)
+	}
+
+	srv.Close()
+	if ips, _, err := dohLookup(srv.URL, nil)(context.Background(), "cdn.example"); err == nil {
+		t.Errorf("lookup with an unreachable server returned %v, want an error", ips)
+	}
+}
+
+func TestDNSCache(t *testing.T) {
+	var lookups int32
+	fail := false
+	c := &dnsCache{entries: make(map[string]*dnsEntry)}
+	c.lookup = func(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+		atomic.AddInt32(&lookups, 1)
+		if fail {
+			return nil, 0, errors.New("upstream failure")
+		}
+		return []net.IP{net.ParseIP("192.0.2.1")}, time.Hour, nil
+	}
+
+	steps := []struct {
+		name    string
+		expire  bool // the cached entry first
+		fail    bool
+		wantErr bool
+		lookups int32 // in total after the step
+	}{
+		{name: "first lookup", lookups: 1},
+		{name: "cached", lookups: 1},
+		{name: "failing upstream while cached", fail: true, lookups: 1},
+		{name: "expired", expire: true, lookups: 2},
+		{name: "failing upstream once expired", expire: true, fail: true, wantErr: true, lookups: 3},
+		{name: "failure not cached", lookups: 4},
+		{name: "cached again", fail: true, lookups: 4},
+	}
+	for _, s := range steps {
+		fail = s.fail
+		if s.expire {
+			c.entries["cdn.example"].expires = time.Now().Add(-time.Second)
+		}
+		ips, err := c.resolve(context.Background(), "cdn.example")
+		if (err != nil) != s.wantErr {
+			t.Fatalf("%s: resolve returned %v, %v", s.name, ips, err)
+		}
+		if n := atomic.LoadInt32(&lookups); n != s.lookups {
+			t.Fatalf("%s: %d lookups, want %d", s.name, n, s.lookups)
+		}
+	}
+}
+
+// TestDNSCacheDoH resolves through a cache over the DNS-over-HTTPS server, whose
+// answers are kept for their TTL
+func TestDNSCacheDoH(t *testing.T) {
+	answers := map[string][]dohRecord{"cdn.example": {{Type: dnsTypeA, TTL: 0, Data: "192.0.2.1"}}}
+	var queries int32
+	srv := newDoHServer(t, answers, nil, &queries)
+	c := newDNSCache(srv.URL, nil)
+
+	for i := 1; i <= 2; i++ {
+		ips, err := c.resolve(context.Background(), "cdn.example")
+		if err != nil || len(ips) != 1 {
+			t.Fatalf("resolve returned %v, %v", ips, err)
+		}
+		// A TTL of 0 expires right away, each resolve asks for A and AAAA again
+		if n := atomic.LoadInt32(&queries); n != int32(2*i) {
+			t.Fatalf("%d queries after %d lookups, want %d", n, i, 2*i)
+		}
+	}
+
+	answers["cdn.example"][0].TTL = 3600
+	c.resolve(context.Background(), "cdn.example")
+	c.resolve(context.Background(), "cdn.example")
+	if n := atomic.LoadInt32(&queries); n != 6 {
+		t.Errorf("%d queries, want 6 with the answer cached for its TTL", n)
+	}
+}
+
+func TestCheckDNSServer(t *testing.T) {
+	tests := []struct {
+		server string
+		ok     bool
+	}{
+		{"", true},
+		{"1.1.1.1", true},
+		{"1.1.1.1:5353", true},
+		{"[2606:4700:4700::1111]:53", true},
+		{"2606:4700:4700::1111", true},
+		{"https://cloudflare-dns.com/dns-query", true},
+		{"http://cloudflare-dns.com/dns-query", false},
+		{"https://", false},
+		{"dns.example", false},
+	}
+	for _, tt := range tests {
+		if err := CheckDNSServer(tt.server); (err == nil) != tt.ok {
+			t.Errorf("CheckDNSServer(%q) = %v, want ok %v", tt.server, err, tt.ok)
+		}
+	}
+}
+
+// TestDNSCacheDial fetches from a server by a name only the DNS-over-HTTPS server
+// knows, and fails for a name it does not
+func TestDNSCacheDial(t *testing.T) {
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("wallpaper"))
+	}))
+	defer cdn.Close()
+	_, port, _ := net.SplitHostPort(cdn.Listener.Addr().String())
+
+	answers := map[string][]dohRecord{"cdn.example": {
+		{Type: dnsTypeA, TTL: 60, Data: "127.0.0.1"},
+		{Type: dnsTypeAAAA, TTL: 60, Data: "2001:db8::1"},
+	}}
+	var queries int32
+	srv := newDoHServer(t, answers, nil, &queries)
+	c := newDNSCache(srv.URL, nil)
+
+	client := &http.Client{Transport: &http.Transport{DialContext: c.dialContext(&net.Dialer{Timeout: time.Second}, "tcp4")}}
+	res, err := client.Get("http://cdn.example:" + port + "/wallpaper.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("status %s", res.Status)
+	}
+
+	c = newDNSCache(srv.URL, nil)
+	client = &http.Client{Transport: &http.Transport{DialContext: c.dialContext(&net.Dialer{Timeout: time.Second}, "tcp6")}}
+	if _, err := client.Get("http://nowhere.example:" + port + "/"); err == nil {
+		t.Error("fetch from an unknown host succeeded")
+	}
+}
@@ -0,0 +1,96 @@
+package crawal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DownloadFilter decides which images listed by an API are downloaded, for rules
+// the built-in options do not cover
+type DownloadFilter interface {
+	Keep(ctx context.Context, it Item, v Variant) (bool, error)
+}
+
+// CommandFilter runs an external script for each image not downloaded yet, e.g.
+// `python3 keep.py`. The script reads the item as JSON on its standard input and
+// exits with 0 to download the image or 1 to skip it; any other outcome is an error.
+type CommandFilter struct {
+	Command string
+	Timeout time.Duration
+}
+
+// NewCommandFilter parses a filter command line
+func NewCommandFilter(command string) (*CommandFilter, error) {
+	if _, err := splitCommand(command); err != nil {
+		return nil, err
+	}
+	return &CommandFilter{Command: command, Timeout: defaultCommandTimeout}, nil
+}
+
+// filterInput is the JSON a CommandFilter reads
+type filterInput struct {
+	Game        string            `json:"game"`
+	Region      string            `json:"region"`
+	ID          string            `json:"id"`
+	Title       string            `json:"title"`
+	Titles      map[string]string `json:"titles,omitempty"`
+	Description string            `json:"description"`
+	Artist      string            `json:"artist"`
+	PublishedAt *time.Time        `json:"published_at,omitempty"`
+	Type        string            `json:"type"`
+	URL         string            `json:"url"`
+	Metadata    json.RawMessage   `json:"metadata,omitempty"` // the API entry
+}
+
+func (f *CommandFilter) Keep(ctx context.Context, it Item, v Variant) (bool, error) {
+	in := filterInput{
+		Game:        it.Game,
+		Region:      it.Region,
+		ID:          it.ID,
+		Title:       it.Title,
+		Titles:      it.Titles,
+		Description: it.Description,
+		Artist:      it.Artist,
+		Type:        v.Kind,
+		URL:         v.URL,
+	}
+	if !it.PublishedAt.IsZero() {
+		in.PublishedAt = &it.PublishedAt
+	}
+	if json.Valid([]byte(it.Metadata)) {
+		in.Metadata = json.RawMessage(it.Metadata)
+	}
+	data, err := json.Marshal(in)
+	if err != nil {
+		return false, err
+	}
+
+	args, err := splitCommand(f.Command)
+	if err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, f.Timeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+		return false, nil
+	default:
+		return false, fmt.Errorf("filter failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+}
@@ -0,0 +1,60 @@
+//go:build !lite
+
+package crawal
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteDriver is the database/sql driver of the library, the cgo build of sqlite
+const sqliteDriver = "sqlite3"
+
+// databaseDSN returns the data source name opening the library at p, waiting for
+// the locks of other processes, such as a crawler running next to serve
+func databaseDSN(p string) string {
+	return p + "?_busy_timeout=5000&_foreign_keys=1"
+}
+
+// readOnlyDSN returns the data source name opening the database at p read-only
+func readOnlyDSN(p string) string {
+	return "file:" + p + "?mode=ro"
+}
+
+// restoreDatabase replaces the content of db with the database file at src, using
+// the online backup API of sqlite so that the open connections stay valid
+func restoreDatabase(db *sql.DB, src string) error {
+	ctx := context.Background()
+	srcDB, err := sql.Open(sqliteDriver, readOnlyDSN(src))
+	if err != nil {
+		return err
+	}
+	defer srcDB.Close()
+
+	srcConn, err := srcDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+	dstConn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer dstConn.Close()
+
+	return dstConn.Raw(func(dst any) error {
+		return srcConn.Raw(func(src any) error {
+			backup, err := dst.(*sqlite3.SQLiteConn).Backup("main", src.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			if _, err := backup.Step(-1); err != nil {
+				backup.Close()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+}
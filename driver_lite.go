@@ -0,0 +1,56 @@
+//go:build lite
+
+package crawal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"modernc.org/sqlite"
+)
+
+// sqliteDriver is the database/sql driver of the library. The lite build uses the
+// pure Go translation of sqlite, to cross-compile without cgo for the ARM boards
+// and routers of always-on archivers.
+const sqliteDriver = "sqlite"
+
+// databaseDSN returns the data source name opening the library at p, waiting for
+// the locks of other processes, such as a crawler running next to serve. Times are
+// written as the cgo build writes them, so both can open the same library.
+func databaseDSN(p string) string {
+	return "file:" + p + "?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)&_time_format=sqlite"
+}
+
+// readOnlyDSN returns the data source name opening the database at p read-only
+func readOnlyDSN(p string) string {
+	return "file:" + p + "?mode=ro"
+}
+
+// restoreDatabase replaces the content of db with the database file at src, using
+// the online backup API of sqlite so that the open connections stay valid
+func restoreDatabase(db *sql.DB, src string) error {
+	dstConn, err := db.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer dstConn.Close()
+
+	return dstConn.Raw(func(dst any) error {
+		restorer, ok := dst.(interface {
+			NewRestore(string) (*sqlite.Backup, error)
+		})
+		if !ok {
+			return errors.New("the sqlite driver cannot restore backups")
+		}
+		backup, err := restorer.NewRestore(readOnlyDSN(src))
+		if err != nil {
+			return err
+		}
+		if _, err := backup.Step(-1); err != nil {
+			backup.Finish()
+			return err
+		}
+		return backup.Finish()
+	})
+}
@@ -0,0 +1,214 @@
+package crawal
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of the events published while syncing the library
+const (
+	EventItemDiscovered   = "item_discovered"   // an image missing from the library was queued
+	EventDownloadStarted  = "download_started"  // a job started downloading its image
+	EventDownloadProgress = "download_progress" // bytes of the image of a job were downloaded, see progressInterval
+	EventDownloadFinished = "download_finished" // the image of a job was downloaded
+	EventDownloadFailed   = "download_failed"   // the image of a job could not be downloaded
+	EventItemAdded        = "item_added"        // a downloaded image was recorded in the library
+	EventSyncCompleted    = "sync_completed"    // SyncItems queued and ran the jobs of a game
+)
+
+// progressInterval is the most often the progress of a download is published
+const progressInterval = 250 * time.Millisecond
+
+// EventKinds are the kinds of events, in the order they happen
+var EventKinds = []string{EventItemDiscovered, EventDownloadStarted, EventDownloadProgress, EventDownloadFinished, EventDownloadFailed, EventItemAdded, EventSyncCompleted}
+
+// Event is published on the event bus of the library. The fields not relevant to
+// its kind are empty.
+type Event struct {
+	Kind      string    `json:"kind"`
+	Time      time.Time `json:"time"`
+	Game      string    `json:"game,omitempty"`
+	IdGallery string    `json:"id,omitempty"`
+	Type      string    `json:"type,omitempty"`
+	FileName  string    `json:"name,omitempty"`
+	URL       string    `json:"url,omitempty"`
+	Path      string    `json:"path,omitempty"`
+	Size      int64     `json:"size,omitempty"`    // announced by the server for progress, 0 when unknown
+	Written   int64     `json:"written,omitempty"` // bytes downloaded so far, of progress
+	ID        int64     `json:"file_id,omitempty"` // row ID of the wallpaper, once added
+	Error     string    `json:"error,omitempty"`
+
+	// Counts of a completed sync: queued, filtered and dead_links, or cataloged
+	Counts map[string]int `json:"counts,omitempty"`
+}
+
+// jobEvent returns an event about a download job
+func jobEvent(kind string, job Job) Event {
+	return Event{Kind: kind, Game: job.Game, IdGallery: job.IdGallery, Type: job.Type, FileName: job.FileName, URL: job.URL}
+}
+
+// bus holds the subscribers of the events, by subscription
+var bus = struct {
+	mu   sync.RWMutex
+	next int
+	subs map[int]func(Event)
+}{subs: make(map[int]func(Event))}
+
+// Subscribe calls fn with every event published from now on, until the returned
+// function is called. fn is called from the goroutine publishing the event, such as
+// a download worker, so it must not block it for long and must be safe to call
+// concurrently.
+func Subscribe(fn func(Event)) (unsubscribe func()) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	id := bus.next
+	bus.next++
+	bus.subs[id] = fn
+	return func() {
+		bus.mu.Lock()
+		defer bus.mu.Unlock()
+		delete(bus.subs, id)
+	}
+}
+
+// publish sends an event to the subscribers
+func publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	bus.mu.RLock()
+	subs := make([]func(Event), 0, len(bus.subs))
+	for _, fn := range bus.subs {
+		subs = append(subs, fn)
+	}
+	bus.mu.RUnlock()
+	for _, fn := range subs {
+		fn(e)
+	}
+}
+
+// logs the events to the logger of the library
+func init() {
+	Subscribe(logEvent)
+}
+
+func logEvent(e Event) {
+	switch e.Kind {
+	case EventItemDiscovered:
+		logger.Printf("File %s has been enqueued", e.FileName)
+	case EventDownloadFinished:
+		logger.Printf(`-> download done "%s" <-`, e.FileName)
+	case EventDownloadFailed:
+		logger.Printf("Error downloading %s: %s", e.FileName, e.Error)
+	}
+}
+
+// EventHook runs a command on the events of some kinds, e.g. to send a notification.
+// Placeholders are expanded as for Hook, with {event} and {error} too.
+type EventHook struct {
+	Command string
+	Kinds   []string // all but download_progress when empty
+	Timeout time.Duration
+}
+
+// NewEventHook parses the command line of an event hook and the comma separated
+// kinds of events it runs on, all but the frequent download_progress when empty
+func NewEventHook(command, kinds string, timeout time.Duration) (*EventHook, error) {
+	if _, err := splitCommand(command); err != nil {
+		return nil, err
+	}
+	h := &EventHook{Command: command, Timeout: timeout}
+	if h.Timeout <= 0 {
+		h.Timeout = defaultCommandTimeout
+	}
+	for _, kind := range strings.Split(kinds, ",") {
+		kind = strings.TrimSpace(kind)
+		if kind == "" {
+			continue
+		}
+		if !slices.Contains(EventKinds, kind) {
+			return nil, fmt.Errorf("unknown event %q", kind)
+		}
+		h.Kinds = append(h.Kinds, kind)
+	}
+	return h, nil
+}
+
+// Handle runs the command when the event is of one of the kinds of the hook
+func (h *EventHook) Handle(e Event) {
+	if len(h.Kinds) > 0 && !slices.Contains(h.Kinds, e.Kind) {
+		return
+	}
+	if len(h.Kinds) == 0 && e.Kind == EventDownloadProgress {
+		return
+	}
+	vars := map[string]string{
+		"event": e.Kind,
+		"file":  e.Path,
+		"name":  e.FileName,
+		"dir":   filepath.Dir(e.Path),
+		"game":  e.Game,
+		"type":  e.Type,
+		"id":    e.IdGallery,
+		"url":   e.URL,
+		"error": e.Error,
+	}
+	if e.Path == "" {
+		vars["dir"] = ""
+	}
+	if _, err := runCommand(context.Background(), h.Command, h.Timeout, vars); err != nil {
+		logger.Printf("Error running the event hook on %s: %v", e.Kind, err)
+	}
+}
+
+// EventMetrics counts the events by kind and game, as a subscriber
+type EventMetrics struct {
+	mu     sync.Mutex
+	counts map[[2]string]int
+	bytes  int64
+}
+
+// Handle counts the event, but the progress of downloads
+func (m *EventMetrics) Handle(e Event) {
+	if e.Kind == EventDownloadProgress {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.counts == nil {
+		m.counts = make(map[[2]string]int)
+	}
+	m.counts[[2]string{e.Kind, e.Game}]++
+	if e.Kind == EventDownloadFinished {
+		m.bytes += e.Size
+	}
+}
+
+// Prometheus returns the counts in the Prometheus text format
+func (m *EventMetrics) Prometheus() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([][2]string, 0, len(m.counts))
+	for k := range m.counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i][0] < keys[j][0] || (keys[i][0] == keys[j][0] && keys[i][1] < keys[j][1])
+	})
+
+	var b strings.Builder
+	b.WriteString("# HELP yostar_events_total Events published by the library.\n# TYPE yostar_events_total counter\n")
+	for _, k := range keys {
+		fmt.Fprintf(&b, "yostar_events_total{kind=%s,game=%s} %d\n", strconv.Quote(k[0]), strconv.Quote(k[1]), m.counts[k])
+	}
+	b.WriteString("# HELP yostar_downloaded_bytes_total Bytes of the downloaded images.\n# TYPE yostar_downloaded_bytes_total counter\n")
+	fmt.Fprintf(&b, "yostar_downloaded_bytes_total %d\n", m.bytes)
+	return b.String()
+}
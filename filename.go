@@ -0,0 +1,90 @@
+package crawal
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// pendingNames are the file names given to downloads not recorded in the library
+// yet, by folder and name key, with the wallpaper they are given to
+type pendingNames struct {
+	mu    sync.Mutex
+	names map[string]string
+}
+
+// claim reserves the name in dir for item, returning false when it is reserved for
+// another wallpaper
+func (n *pendingNames) claim(item GalleryItem, dir, name string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	key := filepath.Join(dir, strings.ToLower(norm.NFC.String(name)))
+	owner := item.Game + "/" + regionOrGlobal(item.Region) + "/" + item.IdGallery + "/" + item.Type
+	if other, ok := n.names[key]; ok {
+		return other == owner
+	}
+	if n.names == nil {
+		n.names = make(map[string]string)
+	}
+	n.names[key] = owner
+	return true
+}
+
+// uniqueFileName returns the name, without extension, of the file of a wallpaper
+// saved into dir: its sanitized title, numbered "title_(2)", "title_(3)"... when the
+// file of another wallpaper of the library, or of a pending download, already has
+// it. Sanitizing maps different titles to the same name, e.g. "A/B" and "A-B", and
+// the title stays recorded as the file name of the wallpaper while its path holds
+// the name on disk.
+func uniqueFileName(db *sql.DB, item GalleryItem, dir string, pending *pendingNames) (string, error) {
+	base := SanitizeFileName(item.FileName)
+	name := base
+	for n := 2; ; n++ {
+		taken, err := fileNameTaken(db, item, dir, name)
+		if err != nil {
+			return "", err
+		}
+		if !taken && (pending == nil || pending.claim(item, dir, name)) {
+			return name, nil
+		}
+		name = fmt.Sprintf("%s_(%d)", base, n)
+	}
+}
+
+// fileNameTaken reports whether a wallpaper other than item has a file named name,
+// whatever its extension, in dir
+func fileNameTaken(db *sql.DB, item GalleryItem, dir, name string) (bool, error) {
+	// the file may be stored with its name in either normalization form
+	prefix := storedPath(filepath.Join(dir, name))
+	rows, err := db.Query(`SELECT path, game, region, id_gallery, type FROM gallery WHERE path LIKE ? ESCAPE '\' OR path LIKE ? ESCAPE '\'`,
+		escapeLike(norm.NFC.String(prefix))+".%", escapeLike(norm.NFD.String(prefix))+".%")
+	if err != nil {
+		return false, fmt.Errorf("failed to look up file names: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var other GalleryItem
+		if err := rows.Scan(&other.Path, &other.Game, &other.Region, &other.IdGallery, &other.Type); err != nil {
+			return false, err
+		}
+		if other.Game == item.Game && other.Region == regionOrGlobal(item.Region) && other.IdGallery == item.IdGallery && other.Type == item.Type {
+			continue
+		}
+		// LIKE also matches longer names with dots, and ignores the case as some
+		// file systems do
+		if nameKey(filepath.Base(other.Path)) == strings.ToLower(norm.NFC.String(name)) {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// escapeLike escapes the wildcards of s for a LIKE pattern with ESCAPE '\'
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
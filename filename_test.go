@@ -0,0 +1,56 @@
+package crawal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// TestUniqueFileName checks that the names of the files of other wallpapers are
+// numbered whatever their extension, case and normalization form
+func TestUniqueFileName(t *testing.T) {
+	db := newPageTestDB(t, 0)
+	dir := t.TempDir()
+	for id, name := range map[string]string{"1": "Summer.png", "2": norm.NFD.String("café.jpg")} {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte("image "+id), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := SaveGalleryItem(db, GalleryItem{Game: "azur_lane", IdGallery: id, Type: "wallpaper", FileName: name, Path: p}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var pending pendingNames
+	tests := []struct {
+		id       string
+		fileName string
+		want     string
+	}{
+		{"1", "Summer", "Summer"},     // its own file
+		{"3", "summer", "summer_(2)"}, // another case
+		{"4", "Café", "Café_(2)"},     // another form and case
+		{"5", "Winter", "Winter"},     // free
+		{"6", "Winter", "Winter_(2)"}, // pending for 5
+		{"5", "Winter", "Winter"},     // pending for itself
+		{"7", "Spring/Fall", "Spring-Fall"},
+		{"8", "Spring-Fall", "Spring-Fall_(2)"},
+	}
+	for _, tt := range tests {
+		item := GalleryItem{Game: "azur_lane", IdGallery: tt.id, Type: "wallpaper", FileName: tt.fileName}
+		got, err := uniqueFileName(db, item, dir, &pending)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s %q is named %q, want %q", tt.id, tt.fileName, got, tt.want)
+		}
+	}
+
+	// the same ID in another region is another wallpaper
+	item := GalleryItem{Game: "azur_lane", Region: "jp", IdGallery: "1", Type: "wallpaper", FileName: "Summer"}
+	if got, err := uniqueFileName(db, item, dir, nil); err != nil || got != "Summer_(2)" {
+		t.Errorf("1 of jp is named %q (%v), want Summer_(2)", got, err)
+	}
+}
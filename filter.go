@@ -0,0 +1,173 @@
+package crawal
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sqliteTimeFormat is the layout sqlite uses for CURRENT_TIMESTAMP
+const sqliteTimeFormat = "2006-01-02 15:04:05"
+
+// Filter selects wallpapers from the library. Zero fields match everything.
+type Filter struct {
+	Game   string
+	Region string
+	Type   string
+	Title  string // substring of the file name
+	Artist string // name of the credited artist, regardless of case
+	Since  time.Time
+	Until  time.Time
+
+	// PublishedSince and PublishedUntil match the publication date told by the game,
+	// leaving out the entries without one
+	PublishedSince time.Time
+	PublishedUntil time.Time
+
+	// Color matches the dominant color name, either exactly (dark-blue)
+	// or by hue regardless of lightness (blue)
+	Color         string
+	MinBrightness float64 // 0 disables
+	MaxBrightness float64 // 0 disables
+
+	// Aspect matches width/height within a relative AspectTolerance, e.g. 21.0/9 and 0.02
+	Aspect          float64 // 0 disables
+	AspectTolerance float64
+	MinAspect       float64 // 0 disables
+	MaxAspect       float64 // 0 disables
+
+	Tag  string
+	Text string // substring of the text recognized by OCR
+
+	// ExcludeTags leaves out the wallpapers with any of these tags, matched ignoring
+	// case, such as NSFW ones
+	ExcludeTags []string
+}
+
+// where builds the SQL condition and arguments matching the filter
+func (f Filter) where() (string, []any) {
+	conds := []string{"1 = 1"}
+	var args []any
+
+	if f.Game != "" {
+		conds = append(conds, "game = ?")
+		args = append(args, f.Game)
+	}
+	if f.Region != "" {
+		conds = append(conds, "region = ?")
+		args = append(args, f.Region)
+	}
+	if f.Type != "" {
+		conds = append(conds, "type = ?")
+		args = append(args, f.Type)
+	}
+	if f.Title != "" {
+		conds = append(conds, "file_name LIKE ?")
+		args = append(args, "%"+f.Title+"%")
+	}
+	if f.Artist != "" {
+		conds = append(conds, "artist = ? COLLATE NOCASE")
+		args = append(args, f.Artist)
+	}
+	if !f.Since.IsZero() {
+		conds = append(conds, "created_at >= ?")
+		args = append(args, f.Since.UTC().Format(sqliteTimeFormat))
+	}
+	if !f.Until.IsZero() {
+		conds = append(conds, "created_at < ?")
+		args = append(args, f.Until.UTC().Format(sqliteTimeFormat))
+	}
+	if !f.PublishedSince.IsZero() {
+		conds = append(conds, "datetime(published_at) >= ?")
+		args = append(args, f.PublishedSince.UTC().Format(sqliteTimeFormat))
+	}
+	if !f.PublishedUntil.IsZero() {
+		conds = append(conds, "datetime(published_at) < ?")
+		args = append(args, f.PublishedUntil.UTC().Format(sqliteTimeFormat))
+	}
+
+	if f.Color != "" {
+		conds = append(conds, "(color = ? OR color LIKE ?)")
+		args = append(args, f.Color, "%-"+f.Color)
+	}
+	if f.MinBrightness > 0 {
+		conds = append(conds, "brightness >= ?")
+		args = append(args, f.MinBrightness)
+	}
+	if f.MaxBrightness > 0 {
+		conds = append(conds, "brightness >= 0 AND brightness <= ?")
+		args = append(args, f.MaxBrightness)
+	}
+	if f.Aspect > 0 {
+		conds = append(conds, "aspect BETWEEN ? AND ?")
+		args = append(args, f.Aspect*(1-f.AspectTolerance), f.Aspect*(1+f.AspectTolerance))
+	}
+	if f.MinAspect > 0 {
+		conds = append(conds, "aspect >= ?")
+		args = append(args, f.MinAspect)
+	}
+	if f.MaxAspect > 0 {
+		conds = append(conds, "aspect > 0 AND aspect <= ?")
+		args = append(args, f.MaxAspect)
+	}
+	if f.Tag != "" {
+		conds = append(conds, "id IN (SELECT gallery_id FROM tags WHERE tag = ?)")
+		args = append(args, f.Tag)
+	}
+	if f.Text != "" {
+		conds = append(conds, "id IN (SELECT gallery_id FROM ocr_text WHERE text LIKE ?)")
+		args = append(args, "%"+f.Text+"%")
+	}
+	if len(f.ExcludeTags) > 0 {
+		conds = append(conds, "id NOT IN (SELECT gallery_id FROM tags WHERE tag COLLATE NOCASE IN (?"+strings.Repeat(", ?", len(f.ExcludeTags)-1)+"))")
+		for _, tag := range f.ExcludeTags {
+			args = append(args, tag)
+		}
+	}
+
+	return strings.Join(conds, " AND "), args
+}
+
+// FindGalleryItems returns the wallpapers matching the filter, oldest first
+func FindGalleryItems(db *sql.DB, f Filter) ([]GalleryItem, error) {
+	where, args := f.where()
+	rows, err := db.Query(`SELECT `+galleryColumns+` FROM gallery WHERE `+where+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []GalleryItem
+	for rows.Next() {
+		item, err := scanGalleryItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// ParseAspect parses an aspect ratio written as W:H or as a decimal number
+func ParseAspect(s string) (float64, error) {
+	w, h, ok := strings.Cut(s, ":")
+	if !ok {
+		return strconv.ParseFloat(s, 64)
+	}
+
+	width, err := strconv.ParseFloat(w, 64)
+	if err != nil {
+		return 0, err
+	}
+	height, err := strconv.ParseFloat(h, 64)
+	if err != nil {
+		return 0, err
+	}
+	if height <= 0 {
+		return 0, fmt.Errorf("height must be positive")
+	}
+	return width / height, nil
+}
@@ -0,0 +1,126 @@
+package crawal
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// firstSyncSetting prefixes the settings recording the batches of the unfinished
+// first sync of each game
+const firstSyncSetting = "first_sync."
+
+// FirstSyncOptions bound the first sync of a game into the library, which queues
+// every image the API lists at once: they are downloaded in batches, each logged
+// with a summary. The batches done are recorded, so that a first sync stopped
+// after MaxBatches, or interrupted, goes on batch by batch at the next run.
+type FirstSyncOptions struct {
+	BatchSize  int           // images per batch, 0 to download them all at once
+	Pause      time.Duration // between two batches
+	MaxBatches int           // batches per run, 0 for as many as needed
+}
+
+// firstSyncBatch returns the number of batches done by the first sync of game,
+// reporting false when the game had files downloaded before and no first sync of
+// it is unfinished
+func firstSyncBatch(db *sql.DB, game string) (int, bool, error) {
+	value, err := GetSetting(db, firstSyncSetting+game, "")
+	if err != nil {
+		return 0, false, err
+	}
+	if value != "" {
+		done, err := strconv.Atoi(value)
+		return done, err == nil, err
+	}
+
+	var downloaded bool
+	err = db.QueryRow("SELECT EXISTS (SELECT 1 FROM gallery WHERE game = ? AND cataloged = 0)", game).Scan(&downloaded)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to look up the files of %s: %w", game, err)
+	}
+	return 0, !downloaded, nil
+}
+
+// runFirstSync runs the jobs of the first sync of game in batches, starting after
+// the batch done
+func runFirstSync(db *sql.DB, game string, done int, opts SyncOptions) error {
+	// recorded right away, the files of the first batch making the game known
+	if err := SetSetting(db, firstSyncSetting+game, strconv.Itoa(done)); err != nil {
+		return err
+	}
+	first := opts.FirstSync
+	for run := 1; ; run++ {
+		left, err := queuedJobs(db, game)
+		if err != nil {
+			return err
+		}
+		if left == 0 {
+			if done > 0 {
+				logger.Printf("First sync of %s done in %d batches", game, done)
+			}
+			return SetSetting(db, firstSyncSetting+game, "")
+		}
+		if first.MaxBatches > 0 && run > first.MaxBatches {
+			logger.Printf("First sync of %s stopped after %d batches, %d images left; run it again to go on", game, first.MaxBatches, left)
+			return nil
+		}
+		if run > 1 && first.Pause > 0 {
+			time.Sleep(first.Pause)
+		}
+
+		var mu sync.Mutex
+		var downloaded, failed int
+		var bytes int64
+		unsubscribe := Subscribe(func(e Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			if e.Game != game {
+				return
+			}
+			switch e.Kind {
+			case EventDownloadFinished:
+				downloaded++
+				bytes += e.Size
+			case EventDownloadFailed:
+				failed++
+			}
+		})
+		queue := opts.Queue
+		queue.Limit = first.BatchSize
+		queue.Preflight = queue.Preflight && run == 1
+		err = RunJobs(db, queue)
+		unsubscribe()
+		if err != nil {
+			return err
+		}
+
+		done++
+		if err := SetSetting(db, firstSyncSetting+game, strconv.Itoa(done)); err != nil {
+			return err
+		}
+		if left, err = queuedJobs(db, game); err != nil {
+			return err
+		}
+		mu.Lock()
+		logger.Printf("First sync of %s, batch %d: %d images downloaded (%s), %d failed, %d left",
+			game, done, downloaded, FormatBytes(bytes), failed, left)
+		mu.Unlock()
+		if downloaded == 0 && failed == 0 {
+			// the jobs left are held back, by the low-power mode or a pause
+			logger.Printf("First sync of %s stopped, none of the %d images left could be downloaded now", game, left)
+			return nil
+		}
+	}
+}
+
+// queuedJobs returns the number of jobs of game waiting in the queue
+func queuedJobs(db *sql.DB, game string) (int, error) {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM download_jobs WHERE game = ? AND state = ?", game, JobQueued).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count the download jobs of %s: %w", game, err)
+	}
+	return n, nil
+}
@@ -2,7 +2,10 @@ package crawal
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -17,39 +20,139 @@ import (
 const (
 	defaultTimeout = 30 * time.Second
 	defaultPerms   = 0755
+	// apiTimeout bounds an API request whatever the timeout of its client, reading
+	// the body included
+	apiTimeout = 2 * time.Minute
+	// maxApiResponse bounds the body of an API response read into memory
+	maxApiResponse = 64 << 20
 )
 
+// StatusError is returned by DownloadFile when the server does not answer 200
+type StatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("received non-200 response code: %d", e.StatusCode)
+}
+
+// CorruptError is returned by DownloadFile when the file downloaded is no sound
+// image, once downloading it again didn't help: it fails to decode, as when the
+// server truncated it, is an HTML page, or has an implausible size. The file is
+// kept in the quarantine folder next to where it would have been saved.
+type CorruptError struct {
+	URL  string
+	Err  error
+	Path string // of the file in quarantine, empty when it could not be moved there
+}
+
+func (e *CorruptError) Error() string {
+	return fmt.Sprintf("corrupt image: %v", e.Err)
+}
+
+func (e *CorruptError) Unwrap() error {
+	return e.Err
+}
+
+// corruptRetries is how many times a corrupt image is downloaded again, waiting
+// corruptRetryDelay before each
+const corruptRetries = 2
+
+var corruptRetryDelay = 2 * time.Second
+
 // DownloadFile downloads a file from the given URL and saves it to the specified path
 // with the given filename. If the filename is empty, it uses the base name from the URL.
-func DownloadFile(url, fileName string, pathTo string) error {
-	// Create HTTP client with timeout
-	client := &http.Client{Timeout: defaultTimeout}
+// It returns the full path of the written file. When a different file already has
+// that name, what happens depends on SetConflictMode; ErrConflictSkipped is returned
+// when the download is dropped.
+func DownloadFile(url, fileName string, pathTo string) (string, error) {
+	p, _, err := downloadResolved(url, fileName, pathTo, nil)
+	return p, err
+}
+
+// downloadResolved implements DownloadFile, also returning the normalized URL the
+// file was served from once redirected, see NormalizeURL. progress is called with
+// the bytes written as they are, unless nil.
+func downloadResolved(url, fileName string, pathTo string, progress progressFunc) (string, string, error) {
+	// Create HTTP client with timeout, sharing the connections of the other downloads
+	client := &http.Client{Timeout: defaultTimeout, Transport: downloadTransport.Load(), CheckRedirect: checkRedirect}
+	for retry := 1; ; retry++ {
+		p, resolved, err := fetchFile(client, url, fileName, pathTo, nil, progress)
+		var corrupt *CorruptError
+		if !errors.As(err, &corrupt) || retry > corruptRetries || forced() || errors.Is(err, errImplausibleSize) {
+			return p, resolved, err
+		}
+		// only the file of the last attempt is kept in quarantine
+		if corrupt.Path != "" {
+			os.Remove(corrupt.Path)
+		}
+		logger.Printf(`-> "%s" is corrupt, downloading it again (%d/%d): %v <-`, path.Base(url), retry, corruptRetries, corrupt.Err)
+		time.Sleep(corruptRetryDelay)
+	}
+}
+
+// downloadFile implements DownloadFile with the given client, copying the body through
+// buf unless nil. The benchmarks compare clients and buffer sizes through it.
+func downloadFile(client *http.Client, url, fileName string, pathTo string, buf []byte) (string, error) {
+	p, _, err := fetchFile(client, url, fileName, pathTo, buf, nil)
+	return p, err
+}
+
+// progressFunc is called with the bytes of a download written so far and its
+// announced size, 0 when unknown. An error stops the download with it.
+type progressFunc func(written, total int64) error
+
+// progressReader calls fn with the bytes read through it, at most every
+// progressInterval and once at the end
+type progressReader struct {
+	io.Reader
+	fn             progressFunc
+	written, total int64
+	last           time.Time
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.written += int64(n)
+	if err == io.EOF || time.Since(r.last) >= progressInterval {
+		r.last = time.Now()
+		if err := r.fn(r.written, r.total); err != nil {
+			return n, err
+		}
+	}
+	return n, err
+}
 
-	// Create context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+// fetchFile implements downloadFile, also returning the normalized final URL
+func fetchFile(client *http.Client, url, fileName string, pathTo string, buf []byte, progress progressFunc) (string, string, error) {
+	// Create context with timeout, cancelled when the program is forced to stop
+	ctx, cancel := context.WithTimeout(interrupts.forced, defaultTimeout)
 	defer cancel()
 
 	// Create request with context
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return "", "", fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Send request
 	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to download file: %w", err)
+		return "", "", fmt.Errorf("failed to download file: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// Check response status
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("received non-200 response code: %d", resp.StatusCode)
+		return "", "", &StatusError{URL: url, StatusCode: resp.StatusCode}
 	}
 
-	// Determine filename
+	// The file is named after the URL it was served from, without the query of
+	// a signed URL
+	final := resp.Request.URL
 	if fileName == "" {
-		fileName = path.Base(url)
+		fileName = path.Base(final.Path)
 	}
 
 	// Get file extension from URL if not already present
@@ -66,31 +169,104 @@ func DownloadFile(url, fileName string, pathTo string) error {
 			ext = ".gif"
 		case strings.Contains(contentType, "webp"):
 			ext = ".webp"
+		case strings.Contains(contentType, "avif"):
+			ext = ".avif"
+		case strings.Contains(contentType, "heic") || strings.Contains(contentType, "heif"):
+			ext = ".heic"
+		case strings.Contains(contentType, "jxl"):
+			ext = ".jxl"
+		default:
+			ext = path.Ext(final.Path)
 		}
 	}
 
 	// Clean filename
+	fileName = SanitizeFileName(fileName)
+
+	// Create the file next to its final path, which may be taken by another file
+	file, err := createTemp(pathTo, ".download-*.part")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer trackTemp(file.Name())()
+	defer file.Close()
+	if err := ownFile(file.Name()); err != nil {
+		return "", "", fmt.Errorf("failed to create file: %w", err)
+	}
+
+	// Write the bytes to the file, within the bandwidth limit. Hiding the ReadFrom
+	// method of the file makes CopyBuffer actually use buf.
+	var body io.Reader = limitedReader{resp.Body}
+	if progress != nil {
+		body = &progressReader{Reader: body, fn: progress, total: max(resp.ContentLength, 0)}
+	}
+	var written int64
+	if buf != nil {
+		written, err = io.CopyBuffer(struct{ io.Writer }{file}, body, buf)
+	} else {
+		written, err = io.Copy(file, body)
+	}
+	if err == nil {
+		err = file.Close()
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to write file: %w", err)
+	}
+
+	// Content-Length alone misses the files the server truncated, and the status the
+	// error pages of some CDNs, so the image is checked whole before it replaces
+	// anything, the suspicious files being quarantined
+	if ext == "" || imageExt(ext) {
+		if err := suspiciousDownload(file.Name(), resp.Header.Get("Content-Type"), written); err != nil {
+			corrupt := &CorruptError{URL: url, Err: err}
+			if q, qerr := quarantineFile(file.Name(), pathTo, fileName+ext); qerr == nil {
+				corrupt.Path = q
+			} else {
+				logger.Printf("Error quarantining %s: %v", fileName, qerr)
+			}
+			return "", "", corrupt
+		}
+	}
+
+	// CDNs may serve another format than the URL names, such as AVIF or JPEG XL to
+	// the clients accepting it: the file is named after the format it holds
+	if format, ok := sniffFile(file.Name()); ok && (ext == "" || imageExt(ext)) && !format.hasExt(ext) {
+		ext = format.exts[0]
+	}
+	fullPath := filepath.Join(pathTo, fileName+ext)
+
+	p, err := conflicts.place(file.Name(), fullPath)
+	if err != nil && !errors.Is(err, ErrConflictSkipped) {
+		return "", "", fmt.Errorf("failed to save file: %w", err)
+	}
+	return p, NormalizeURL(final.String()), err
+}
+
+// SanitizeFileName replaces the characters of a title that are unsafe in file names
+// and normalizes it to the form set by SetNameForm
+func SanitizeFileName(fileName string) string {
 	fileName = strings.ReplaceAll(fileName, " ", "_")
 	fileName = strings.ReplaceAll(fileName, "/", "-")
 	fileName = strings.ReplaceAll(fileName, "\\", "-")
+	return NormalizeName(fileName)
+}
 
-	// Create full file path
-	fullPath := filepath.Join(pathTo, fileName+ext)
-
-	// Create the file
-	file, err := os.Create(fullPath)
+// HashFile returns the hex encoded SHA-256 checksum and the size of a file
+func HashFile(p string) (string, int64, error) {
+	f, err := os.Open(p)
 	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
+		return "", 0, fmt.Errorf("failed to open file: %w", err)
 	}
-	defer file.Close()
+	defer f.Close()
 
-	// Write the bytes to the file
-	_, err = io.Copy(file, resp.Body)
+	h := sha256.New()
+	size, err := io.Copy(h, f)
 	if err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+		return "", 0, fmt.Errorf("failed to hash file: %w", err)
 	}
 
-	return nil
+	return hex.EncodeToString(h.Sum(nil)), size, nil
 }
 
 // IntInArray checks if an integer exists in an array of integers
@@ -115,27 +291,52 @@ func CreateFolder(path string) (string, error) {
 	newFolderPath := filepath.Join(homeDir, path)
 
 	// Create the directory and all necessary parents
-	err = os.MkdirAll(newFolderPath, defaultPerms)
+	err = makeDirs(newFolderPath)
 	if err != nil {
 		return "", fmt.Errorf("failed to create folder: %w", err)
 	}
 
-	fmt.Println("New folder created at:", newFolderPath)
+	logger.Printf("Saving into %s", newFolderPath)
 	return newFolderPath, nil
 }
 
 // FetchApi fetches data from the API
 func FetchApi(client *http.Client, url string) ([]byte, error) {
-	res, err := client.Get(url)
+	return FetchApiLocale(client, url, "")
+}
+
+// FetchApiLocale fetches data from the API in the given locale, asked with Accept-Language.
+// The request fails after apiTimeout, and when the body is over maxApiResponse.
+func FetchApiLocale(client *http.Client, url, locale string) ([]byte, error) {
+	// Create context with timeout, cancelled when the program is forced to stop
+	ctx, cancel := context.WithTimeout(interrupts.forced, apiTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("API request failed: %w", err)
+	}
+	if locale != "" {
+		req.Header.Set("Accept-Language", locale)
+	}
+
+	res, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("API request failed: %w", err)
 	}
 	defer res.Body.Close()
 
-	resBody, err := io.ReadAll(res.Body)
+	if res.ContentLength > maxApiResponse {
+		return nil, fmt.Errorf("API response of %s is over the limit of %s", FormatBytes(res.ContentLength), FormatBytes(maxApiResponse))
+	}
+	// one byte more than the limit tells a body over it
+	resBody, err := io.ReadAll(io.LimitReader(res.Body, maxApiResponse+1))
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
+	if len(resBody) > maxApiResponse {
+		return nil, fmt.Errorf("API response is over the limit of %s", FormatBytes(maxApiResponse))
+	}
 
 	return resBody, nil
 }
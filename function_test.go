@@ -0,0 +1,134 @@
+package crawal
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// benchFileSize is the size of the image served to the benchmarks, about a 4K wallpaper
+const benchFileSize = 4 << 20
+
+// newBenchServer serves a benchFileSize PNG at any path
+func newBenchServer(b *testing.B) *httptest.Server {
+	body := make([]byte, benchFileSize)
+	for i := range body {
+		body[i] = byte(i * 31)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write(body)
+	}))
+	b.Cleanup(srv.Close)
+	return srv
+}
+
+// BenchmarkDownloadFile measures DownloadFile as the workers call it
+func BenchmarkDownloadFile(b *testing.B) {
+	srv := newBenchServer(b)
+	dir := b.TempDir()
+	b.SetBytes(benchFileSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := DownloadFile(srv.URL+"/wallpaper.png", "wallpaper", dir); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchClient returns the client of a download: one sharing the pooled connections
+// of http.DefaultTransport, as DownloadFile does, or one with a transport of its own
+// that opens a new connection for every file
+func benchClient(pooled bool) *http.Client {
+	if pooled {
+		return &http.Client{Timeout: defaultTimeout}
+	}
+	return &http.Client{Timeout: defaultTimeout, Transport: &http.Transport{}}
+}
+
+// BenchmarkDownloadFileClientReuse compares reusing pooled connections with opening
+// a new one per file
+func BenchmarkDownloadFileClientReuse(b *testing.B) {
+	srv := newBenchServer(b)
+	for _, pooled := range []bool{true, false} {
+		b.Run(fmt.Sprintf("pooled=%t", pooled), func(b *testing.B) {
+			dir := b.TempDir()
+			b.SetBytes(benchFileSize)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				client := benchClient(pooled)
+				if _, err := downloadFile(client, srv.URL+"/wallpaper.png", "wallpaper", dir, nil); err != nil {
+					b.Fatal(err)
+				}
+				if !pooled {
+					client.CloseIdleConnections()
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkDownloadFileBuffer measures the size of the buffer the body is copied through
+func BenchmarkDownloadFileBuffer(b *testing.B) {
+	srv := newBenchServer(b)
+	client := &http.Client{Timeout: defaultTimeout}
+	for _, size := range []int{4 << 10, 32 << 10, 256 << 10, 1 << 20} {
+		b.Run(fmt.Sprintf("buffer=%dK", size>>10), func(b *testing.B) {
+			dir := b.TempDir()
+			buf := make([]byte, size)
+			b.SetBytes(benchFileSize)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := downloadFile(client, srv.URL+"/wallpaper.png", "wallpaper", dir, buf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkDownloadFileWorkers measures concurrent downloads of distinct files, as the
+// download queue runs them, with and without pooled connections
+func BenchmarkDownloadFileWorkers(b *testing.B) {
+	srv := newBenchServer(b)
+	for _, pooled := range []bool{true, false} {
+		for _, workers := range []int{1, 4, 16} {
+			b.Run(fmt.Sprintf("workers=%d/pooled=%t", workers, pooled), func(b *testing.B) {
+				dir := b.TempDir()
+				var next atomic.Int64
+				b.SetBytes(benchFileSize)
+				b.ResetTimer()
+
+				var wg sync.WaitGroup
+				for w := 0; w < workers; w++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						for {
+							i := next.Add(1)
+							if i > int64(b.N) {
+								return
+							}
+							name := fmt.Sprintf("wallpaper-%d", i)
+							client := benchClient(pooled)
+							_, err := downloadFile(client, srv.URL+"/"+name+".png", name, dir, nil)
+							if !pooled {
+								client.CloseIdleConnections()
+							}
+							if err != nil {
+								b.Error(err)
+								return
+							}
+						}
+					}()
+				}
+				wg.Wait()
+			})
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package crawal
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// GalleryItem represents a downloaded or cataloged image: a row of the files table
+// joined with the gallery entry of the items table it belongs to
+type GalleryItem struct {
+	ID           int64 // ID of the file
+	ItemID       int64 // ID of the gallery entry
+	IdGallery    string
+	Game         string
+	Region       string // region of the game API the item was listed by, e.g. global or jp
+	Type         string
+	FileName     string
+	URL          string
+	SourceURL    string // alternate of URL the file was downloaded from, empty when URL itself
+	ResolvedURL  string // normalized URL the file was served from once redirected, see NormalizeURL
+	Path         string
+	SHA256       string
+	Size         int64
+	OriginalSize int64 // size before the file was optimized, 0 when it was not
+	PHash        string
+	DuplicateOf  int64 // ID of the wallpaper this one duplicates, if any
+
+	DominantColor string  // hex encoded, e.g. #1a2b3c
+	Color         string  // name of the dominant color, e.g. dark-blue
+	Brightness    float64 // average luminance from 0 to 1, -1 when not analyzed
+	Width         int
+	Height        int
+	Aspect        float64 // width divided by height, 0 when not analyzed
+
+	Cataloged bool   // listed from the API without downloading its file
+	Pinned    bool   // restored by RevertRevision, kept whatever the API lists, see PinFile
+	Metadata  string // JSON of the API entry
+
+	Title       string
+	Description string
+	Artist      string
+	PublishedAt time.Time // zero when the API does not tell
+
+	CreatedAt time.Time
+}
+
+// galleryColumns are the columns of the gallery view read by scanGalleryItem
+const galleryColumns = "id, item_id, id_gallery, game, region, type, file_name, url, source_url, resolved_url, path, sha256, size, original_size, phash, duplicate_of, dominant_color, color, brightness, width, height, aspect, cataloged, pinned, metadata, title, description, artist, published_at, created_at"
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanGalleryItem reads a row selected with galleryColumns
+func scanGalleryItem(row rowScanner) (GalleryItem, error) {
+	var item GalleryItem
+	var published sql.NullTime
+	err := row.Scan(&item.ID, &item.ItemID, &item.IdGallery, &item.Game, &item.Region, &item.Type, &item.FileName, &item.URL, &item.SourceURL, &item.ResolvedURL, &item.Path, &item.SHA256, &item.Size, &item.OriginalSize, &item.PHash, &item.DuplicateOf,
+		&item.DominantColor, &item.Color, &item.Brightness, &item.Width, &item.Height, &item.Aspect,
+		&item.Cataloged, &item.Pinned, &item.Metadata, &item.Title, &item.Description, &item.Artist, &published, &item.CreatedAt)
+	item.PublishedAt = published.Time
+	item.Path = resolvePath(item.Path)
+	return item, err
+}
+
+// GetWallpaperURLs returns the stored URL of every downloaded wallpaper of the given game and type,
+// keyed by gallery ID. Cataloged wallpapers are left out so that crawlers download them.
+func GetWallpaperURLs(db *sql.DB, game, typ string) (map[string]string, error) {
+	rows, err := db.Query("SELECT id_gallery, url FROM gallery WHERE game = ? AND type = ? AND cataloged = 0", game, typ)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	urls := make(map[string]string)
+	for rows.Next() {
+		var idGallery, url string
+		if err := rows.Scan(&idGallery, &url); err != nil {
+			return nil, err
+		}
+		urls[idGallery] = url
+	}
+
+	return urls, rows.Err()
+}
+
+// GetGalleryItem looks up a single wallpaper by game, region, gallery ID and type.
+// The region is global when empty.
+func GetGalleryItem(db *sql.DB, game, region, idGallery, typ string) (GalleryItem, error) {
+	return scanGalleryItem(db.QueryRow(`
+		SELECT `+galleryColumns+`
+		FROM gallery WHERE game = ? AND region = ? AND id_gallery = ? AND type = ?
+		ORDER BY id DESC LIMIT 1`, game, regionOrGlobal(region), idGallery, typ))
+}
+
+// GetGalleryItemByID looks up a single wallpaper by its row ID
+func GetGalleryItemByID(db *sql.DB, id int64) (GalleryItem, error) {
+	return scanGalleryItem(db.QueryRow("SELECT "+galleryColumns+" FROM gallery WHERE id = ?", id))
+}
+
+// SaveGalleryItem inserts the wallpaper, or updates the existing file with the
+// same game, region, gallery ID and type when the asset has been re-uploaded.
+// The checksum and size of the file at Path are recorded when not set, and the
+// stored title, artist and metadata of the entry are kept when the item has none.
+func SaveGalleryItem(db *sql.DB, item GalleryItem) error {
+	if err := prepareGalleryItem(&item); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := saveGalleryItem(tx, item); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// prepareGalleryItem fills the checksum and size of the file of a wallpaper when not set
+func prepareGalleryItem(item *GalleryItem) error {
+	if item.Path != "" && item.SHA256 == "" {
+		sum, size, err := HashFile(item.Path)
+		if err != nil {
+			return err
+		}
+		item.SHA256, item.Size = sum, size
+	}
+
+	if item.Path == "" || item.DominantColor == "" {
+		item.Brightness = -1
+	}
+	return nil
+}
+
+// newDownload tells, in the upsert of saveGalleryItem, a file downloaded anew from a
+// file only updated, whose download time and listing run are kept
+const newDownload = `excluded.cataloged = 0 AND excluded.path != '' AND (files.cataloged = 1 OR files.sha256 != excluded.sha256 OR files.url != excluded.url)`
+
+// saveGalleryItem records the entry and the file of a prepared wallpaper within tx.
+// A new download is timestamped and linked to the run that last listed its item.
+func saveGalleryItem(tx *sql.Tx, item GalleryItem) error {
+	itemID, err := saveItem(tx, Item{
+		Game:        item.Game,
+		Region:      item.Region,
+		ID:          item.IdGallery,
+		Title:       item.Title,
+		Description: item.Description,
+		Artist:      item.Artist,
+		PublishedAt: item.PublishedAt,
+		Metadata:    item.Metadata,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO files(item_id, type, file_name, url, source_url, resolved_url, path, sha256, size, original_size, phash, duplicate_of,
+			dominant_color, color, brightness, width, height, aspect, cataloged, downloaded_at, listed_run)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?,
+			CASE WHEN ? = 0 AND ? != '' THEN CURRENT_TIMESTAMP END, (SELECT listed_run FROM items WHERE id = ?))
+		ON CONFLICT (item_id, type) DO UPDATE SET
+			file_name = excluded.file_name, url = excluded.url, source_url = excluded.source_url, resolved_url = excluded.resolved_url, path = excluded.path, sha256 = excluded.sha256,
+			size = excluded.size, original_size = excluded.original_size, phash = excluded.phash, duplicate_of = excluded.duplicate_of,
+			dominant_color = excluded.dominant_color, color = excluded.color, brightness = excluded.brightness,
+			width = excluded.width, height = excluded.height, aspect = excluded.aspect, cataloged = excluded.cataloged,
+			downloaded_at = CASE WHEN `+newDownload+` THEN excluded.downloaded_at ELSE downloaded_at END,
+			listed_run = CASE WHEN `+newDownload+` THEN excluded.listed_run ELSE listed_run END`,
+		itemID, item.Type, item.FileName, item.URL, item.SourceURL, item.ResolvedURL, storedPath(item.Path), item.SHA256, item.Size, item.OriginalSize, item.PHash, item.DuplicateOf,
+		item.DominantColor, item.Color, item.Brightness, item.Width, item.Height, item.Aspect, item.Cataloged,
+		item.Cataloged, storedPath(item.Path), itemID)
+	if err != nil {
+		return fmt.Errorf("failed to update wallpaper: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package crawal
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Regions of the game APIs. Not every game has a site in every region.
+const (
+	RegionGlobal = "global"
+	RegionJP     = "jp"
+	RegionKR     = "kr"
+)
+
+// regionOrGlobal returns region, or RegionGlobal when empty
+func regionOrGlobal(region string) string {
+	if region == "" {
+		return RegionGlobal
+	}
+	return region
+}
+
+// Game holds the settings of a game crawled into the library
+type Game struct {
+	ID       int64
+	Name     string
+	Region   string // region of the API crawled
+	Endpoint string // API URL used instead of the built-in one of the region, if any
+}
+
+// ListGames returns the settings of every game known to the library, by name
+func ListGames(db *sql.DB) ([]Game, error) {
+	rows, err := db.Query("SELECT id, name, region, endpoint FROM games ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var games []Game
+	for rows.Next() {
+		var g Game
+		if err := rows.Scan(&g.ID, &g.Name, &g.Region, &g.Endpoint); err != nil {
+			return nil, err
+		}
+		games = append(games, g)
+	}
+	return games, rows.Err()
+}
+
+// GameEndpoint returns the API URL configured to override the built-in one of game,
+// empty when there is none
+func GameEndpoint(db *sql.DB, game string) (string, error) {
+	var endpoint string
+	err := db.QueryRow("SELECT endpoint FROM games WHERE name = ?", game).Scan(&endpoint)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("failed to read endpoint of %s: %w", game, err)
+	}
+	return endpoint, nil
+}
+
+// SetGameEndpoint overrides the API URL of game, for mirrors, archived endpoints or
+// API changes. An empty endpoint goes back to the built-in one.
+func SetGameEndpoint(db *sql.DB, game, endpoint string) error {
+	_, err := db.Exec(`
+		INSERT INTO games(name, endpoint) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET endpoint = excluded.endpoint`, game, endpoint)
+	if err != nil {
+		return fmt.Errorf("failed to set endpoint of %s: %w", game, err)
+	}
+	return nil
+}
+
+// GameRegion returns the region of the API crawled for game, global by default
+func GameRegion(db *sql.DB, game string) (string, error) {
+	var region string
+	err := db.QueryRow("SELECT region FROM games WHERE name = ?", game).Scan(&region)
+	if err == sql.ErrNoRows {
+		return RegionGlobal, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read region of %s: %w", game, err)
+	}
+	return region, nil
+}
+
+// SetGameRegion sets the region of the API crawled for game
+func SetGameRegion(db *sql.DB, game, region string) error {
+	_, err := db.Exec(`
+		INSERT INTO games(name, region) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET region = excluded.region`, game, region)
+	if err != nil {
+		return fmt.Errorf("failed to set region of %s: %w", game, err)
+	}
+	return nil
+}
+
+// SelectRegion picks the region of game to crawl among those with an endpoint and
+// returns it with its API URL, or the endpoint configured for the game instead.
+// A region given explicitly is remembered for the next runs; when empty the
+// remembered one is used.
+func SelectRegion(db *sql.DB, game, region string, endpoints map[string]string) (string, string, error) {
+	remember := region != ""
+	if !remember {
+		var err error
+		if region, err = GameRegion(db, game); err != nil {
+			return "", "", err
+		}
+	}
+
+	url, ok := endpoints[region]
+	if !ok {
+		var regions []string
+		for r := range endpoints {
+			regions = append(regions, r)
+		}
+		sort.Strings(regions)
+		return "", "", fmt.Errorf("%s has no %s region, only %s", game, region, strings.Join(regions, ", "))
+	}
+
+	if remember {
+		if err := SetGameRegion(db, game, region); err != nil {
+			return "", "", err
+		}
+	}
+
+	endpoint, err := GameEndpoint(db, game)
+	if err != nil {
+		return "", "", err
+	}
+	if endpoint != "" {
+		url = endpoint
+	}
+	return region, url, nil
+}
@@ -0,0 +1,918 @@
+package crawal
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// GraphQL limits of a query
+const (
+	defaultGraphQLDepth      = 8
+	defaultGraphQLComplexity = 10000
+)
+
+// GraphQLLimits bound the queries ExecGraphQL runs, so that a single query cannot
+// walk the whole library through the relations of its wallpapers
+type GraphQLLimits struct {
+	MaxDepth      int // nesting of the selections, 8 when 0
+	MaxComplexity int // fields selected, times the length of the lists they are in, 10000 when 0
+
+	// HiddenTags leaves the wallpapers with any of these tags out of the lists of
+	// wallpapers and items, see Filter.ExcludeTags
+	HiddenTags []string
+}
+
+// GraphQLRequest is a query, as POSTed to a GraphQL endpoint
+type GraphQLRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+// GraphQLResponse is the result of a GraphQLRequest
+type GraphQLResponse struct {
+	Data   any            `json:"data"` // nil when the query is invalid
+	Errors []GraphQLError `json:"errors,omitempty"`
+}
+
+// GraphQLError is an error of a GraphQLRequest, with the path of the field it
+// occurred at when the query was run
+type GraphQLError struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+// ExecGraphQL runs a GraphQL query on the library, see GraphQLSchema. Queries with
+// variables, aliases and fragments are supported; mutations, subscriptions,
+// directives and introspection are not. The whole query is checked against the
+// limits before anything is read.
+func ExecGraphQL(db *sql.DB, req GraphQLRequest, limits GraphQLLimits) GraphQLResponse {
+	if limits.MaxDepth <= 0 {
+		limits.MaxDepth = defaultGraphQLDepth
+	}
+	if limits.MaxComplexity <= 0 {
+		limits.MaxComplexity = defaultGraphQLComplexity
+	}
+
+	doc, err := parseGraphQL(req.Query)
+	if err != nil {
+		return graphQLFailure(err)
+	}
+	op, err := doc.operation(req.OperationName)
+	if err != nil {
+		return graphQLFailure(err)
+	}
+	vars, err := op.variables(req.Variables)
+	if err != nil {
+		return graphQLFailure(err)
+	}
+
+	x := &gqlExec{db: db, doc: doc, vars: vars, limits: limits}
+	if _, err := x.check("Query", op.sel, 1); err != nil {
+		return graphQLFailure(err)
+	}
+	data := x.object("Query", nil, op.sel, nil)
+	return GraphQLResponse{Data: data, Errors: x.errors}
+}
+
+// graphQLFailure is the response to a query that could not be run
+func graphQLFailure(err error) GraphQLResponse {
+	return GraphQLResponse{Errors: []GraphQLError{{Message: err.Error()}}}
+}
+
+// GraphQLSchema returns the schema ExecGraphQL runs queries on, in the GraphQL schema
+// language
+func GraphQLSchema() string {
+	types := make([]string, 0, len(graphQLSchema))
+	for name := range graphQLSchema {
+		if name != "Query" {
+			types = append(types, name)
+		}
+	}
+	slices.Sort(types)
+
+	var b strings.Builder
+	for i, name := range append([]string{"Query"}, types...) {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "type %s {\n", name)
+		fields := make([]string, 0, len(graphQLSchema[name]))
+		for field := range graphQLSchema[name] {
+			fields = append(fields, field)
+		}
+		slices.Sort(fields)
+		for _, field := range fields {
+			f := graphQLSchema[name][field]
+			if f.doc != "" {
+				fmt.Fprintf(&b, "  %q\n", f.doc)
+			}
+			b.WriteString("  " + field)
+			if len(f.args) > 0 {
+				args := make([]string, len(f.args))
+				for i, a := range f.args {
+					args[i] = a.name + ": " + a.typ
+					if a.def != nil {
+						def, _ := json.Marshal(a.def)
+						args[i] += " = " + string(def)
+					}
+				}
+				b.WriteString("(" + strings.Join(args, ", ") + ")")
+			}
+			b.WriteString(": " + f.typ + "\n")
+		}
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
+
+// gqlField is a field of a type of the schema
+type gqlField struct {
+	typ  string // of the value, e.g. String, Wallpaper or [Wallpaper]
+	doc  string
+	args []gqlArg
+	list int // length of the list the field returns assumed for the complexity, unless it takes first
+
+	// resolve returns the value of the field of parent: a scalar, the Go value of
+	// an object, []any for lists, or nil
+	resolve func(x *gqlExec, parent any, args map[string]any) (any, error)
+}
+
+// gqlArg is an argument of a field, of type String, Int or Boolean, with ! when required
+type gqlArg struct {
+	name, typ string
+	def       any // nil when none
+}
+
+// Token kinds of a GraphQL document
+const (
+	gqlEOF byte = iota
+	gqlName
+	gqlString
+	gqlInt
+	gqlFloat
+	gqlPunct
+)
+
+type gqlToken struct {
+	kind byte
+	text string // unescaped for strings
+	pos  int
+}
+
+// gqlVariable is a reference to a variable in a value
+type gqlVariable string
+
+// gqlEnum is an enum value, which the schema takes as a string
+type gqlEnum string
+
+type gqlDocument struct {
+	operations []*gqlOperation
+	fragments  map[string]*gqlFragment
+}
+
+type gqlOperation struct {
+	name string
+	vars []gqlVarDef
+	sel  []gqlSelection
+}
+
+type gqlVarDef struct {
+	name, typ string
+	def       any
+}
+
+type gqlFragment struct {
+	on  string
+	sel []gqlSelection
+}
+
+// gqlSelection is a field, a fragment spread or an inline fragment of a selection set
+type gqlSelection struct {
+	alias, name string
+	args        map[string]any
+	sel         []gqlSelection
+
+	spread string // name of the fragment spread
+	inline bool
+	on     string // type condition of an inline fragment, if any
+}
+
+// lexGraphQL splits a GraphQL document into tokens. Commas are ignored, as spaces.
+func lexGraphQL(src string) ([]gqlToken, error) {
+	var toks []gqlToken
+	isName := func(c byte, first bool) bool {
+		return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (!first && c >= '0' && c <= '9')
+	}
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "..."):
+			toks = append(toks, gqlToken{gqlPunct, "...", i})
+			i += 3
+		case strings.IndexByte("!$():=@[]{}|&", c) >= 0:
+			toks = append(toks, gqlToken{gqlPunct, string(c), i})
+			i++
+		case isName(c, true):
+			j := i + 1
+			for j < len(src) && isName(src[j], false) {
+				j++
+			}
+			toks = append(toks, gqlToken{gqlName, src[i:j], i})
+			i = j
+		case c == '-' || (c >= '0' && c <= '9'):
+			j := i + 1
+			for j < len(src) && strings.IndexByte("0123456789.eE+-", src[j]) >= 0 {
+				j++
+			}
+			text := src[i:j]
+			if _, err := strconv.ParseInt(text, 10, 64); err == nil {
+				toks = append(toks, gqlToken{gqlInt, text, i})
+			} else if _, err := strconv.ParseFloat(text, 64); err == nil {
+				toks = append(toks, gqlToken{gqlFloat, text, i})
+			} else {
+				return nil, gqlErrorAt(src, i, "invalid number %q", text)
+			}
+			i = j
+		case strings.HasPrefix(src[i:], `"""`):
+			end := strings.Index(src[i+3:], `"""`)
+			if end < 0 {
+				return nil, gqlErrorAt(src, i, "unterminated string")
+			}
+			toks = append(toks, gqlToken{gqlString, strings.TrimSpace(src[i+3 : i+3+end]), i})
+			i += end + 6
+		case c == '"':
+			j := i + 1
+			for j < len(src) && src[j] != '"' && src[j] != '\n' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			// the escapes of GraphQL strings are those of JSON
+			var s string
+			if j >= len(src) || src[j] != '"' || json.Unmarshal([]byte(src[i:j+1]), &s) != nil {
+				return nil, gqlErrorAt(src, i, "invalid string")
+			}
+			toks = append(toks, gqlToken{gqlString, s, i})
+			i = j + 1
+		default:
+			return nil, gqlErrorAt(src, i, "unexpected character %q", c)
+		}
+	}
+	return append(toks, gqlToken{gqlEOF, "", len(src)}), nil
+}
+
+// gqlErrorAt returns an error at the line and column of offset pos of src
+func gqlErrorAt(src string, pos int, format string, args ...any) error {
+	line := 1 + strings.Count(src[:pos], "\n")
+	col := pos - strings.LastIndex(src[:pos], "\n")
+	return fmt.Errorf("syntax error at %d:%d: %s", line, col, fmt.Sprintf(format, args...))
+}
+
+// gqlParser parses the tokens of a GraphQL document
+type gqlParser struct {
+	src  string
+	toks []gqlToken
+	pos  int
+}
+
+func (p *gqlParser) peek() gqlToken {
+	return p.toks[p.pos]
+}
+
+func (p *gqlParser) next() gqlToken {
+	t := p.toks[p.pos]
+	if t.kind != gqlEOF {
+		p.pos++
+	}
+	return t
+}
+
+// is reports whether the next token is the punctuator text
+func (p *gqlParser) is(text string) bool {
+	t := p.peek()
+	return t.kind == gqlPunct && t.text == text
+}
+
+// skip consumes the next token if it is the punctuator text
+func (p *gqlParser) skip(text string) bool {
+	if p.is(text) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *gqlParser) expect(text string) error {
+	if !p.skip(text) {
+		return p.unexpected()
+	}
+	return nil
+}
+
+func (p *gqlParser) name() (string, error) {
+	if p.peek().kind != gqlName {
+		return "", p.unexpected()
+	}
+	return p.next().text, nil
+}
+
+func (p *gqlParser) unexpected() error {
+	t := p.peek()
+	if t.kind == gqlEOF {
+		return gqlErrorAt(p.src, t.pos, "unexpected end of query")
+	}
+	return gqlErrorAt(p.src, t.pos, "unexpected %q", t.text)
+}
+
+// noDirectives returns an error at a directive, which are not supported
+func (p *gqlParser) noDirectives() error {
+	if p.is("@") {
+		return gqlErrorAt(p.src, p.peek().pos, "directives are not supported")
+	}
+	return nil
+}
+
+// parseGraphQL parses a GraphQL document
+func parseGraphQL(src string) (*gqlDocument, error) {
+	toks, err := lexGraphQL(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &gqlParser{src: src, toks: toks}
+	doc := &gqlDocument{fragments: make(map[string]*gqlFragment)}
+	for p.peek().kind != gqlEOF {
+		t := p.peek()
+		switch {
+		case p.is("{"):
+			sel, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, &gqlOperation{sel: sel})
+		case t.kind == gqlName && t.text == "query":
+			p.next()
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+		case t.kind == gqlName && (t.text == "mutation" || t.text == "subscription"):
+			return nil, fmt.Errorf("%ss are not supported, the library is read-only", t.text)
+		case t.kind == gqlName && t.text == "fragment":
+			p.next()
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			f := &gqlFragment{}
+			if p.peek().text != "on" {
+				return nil, p.unexpected()
+			}
+			p.next()
+			if f.on, err = p.name(); err != nil {
+				return nil, err
+			}
+			if err := p.noDirectives(); err != nil {
+				return nil, err
+			}
+			if f.sel, err = p.selectionSet(); err != nil {
+				return nil, err
+			}
+			if _, ok := doc.fragments[name]; ok {
+				return nil, fmt.Errorf("fragment %s is defined twice", name)
+			}
+			doc.fragments[name] = f
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	if len(doc.operations) == 0 {
+		return nil, errors.New("no query in the document")
+	}
+	return doc, nil
+}
+
+// operation parses a query after its keyword
+func (p *gqlParser) operation() (*gqlOperation, error) {
+	op := &gqlOperation{}
+	if p.peek().kind == gqlName {
+		op.name = p.next().text
+	}
+	if p.skip("(") {
+		for !p.skip(")") {
+			if err := p.expect("$"); err != nil {
+				return nil, err
+			}
+			var v gqlVarDef
+			var err error
+			if v.name, err = p.name(); err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			if v.typ, err = p.typeRef(); err != nil {
+				return nil, err
+			}
+			if p.skip("=") {
+				if v.def, err = p.value(true); err != nil {
+					return nil, err
+				}
+			}
+			op.vars = append(op.vars, v)
+		}
+	}
+	if err := p.noDirectives(); err != nil {
+		return nil, err
+	}
+	var err error
+	op.sel, err = p.selectionSet()
+	return op, err
+}
+
+// typeRef parses the type of a variable, e.g. [String!]!
+func (p *gqlParser) typeRef() (string, error) {
+	var typ string
+	if p.skip("[") {
+		elem, err := p.typeRef()
+		if err != nil {
+			return "", err
+		}
+		if err := p.expect("]"); err != nil {
+			return "", err
+		}
+		typ = "[" + elem + "]"
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return "", err
+		}
+		typ = name
+	}
+	if p.skip("!") {
+		typ += "!"
+	}
+	return typ, nil
+}
+
+func (p *gqlParser) selectionSet() ([]gqlSelection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var sel []gqlSelection
+	for !p.skip("}") {
+		s, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		sel = append(sel, s)
+	}
+	if len(sel) == 0 {
+		return nil, gqlErrorAt(p.src, p.toks[p.pos-1].pos, "empty selection")
+	}
+	return sel, nil
+}
+
+func (p *gqlParser) selection() (gqlSelection, error) {
+	var s gqlSelection
+	var err error
+	if p.skip("...") {
+		if t := p.peek(); t.kind == gqlName && t.text != "on" {
+			s.spread = p.next().text
+			return s, p.noDirectives()
+		}
+		s.inline = true
+		if p.peek().kind == gqlName {
+			p.next()
+			if s.on, err = p.name(); err != nil {
+				return s, err
+			}
+		}
+		if err := p.noDirectives(); err != nil {
+			return s, err
+		}
+		s.sel, err = p.selectionSet()
+		return s, err
+	}
+
+	if s.name, err = p.name(); err != nil {
+		return s, err
+	}
+	if p.skip(":") {
+		s.alias = s.name
+		if s.name, err = p.name(); err != nil {
+			return s, err
+		}
+	}
+	if p.skip("(") {
+		s.args = make(map[string]any)
+		for !p.skip(")") {
+			name, err := p.name()
+			if err != nil {
+				return s, err
+			}
+			if err := p.expect(":"); err != nil {
+				return s, err
+			}
+			if _, ok := s.args[name]; ok {
+				return s, fmt.Errorf("argument %s of %s is given twice", name, s.name)
+			}
+			if s.args[name], err = p.value(false); err != nil {
+				return s, err
+			}
+		}
+	}
+	if err := p.noDirectives(); err != nil {
+		return s, err
+	}
+	if p.is("{") {
+		s.sel, err = p.selectionSet()
+	}
+	return s, err
+}
+
+// value parses a value, without variables when constant
+func (p *gqlParser) value(constant bool) (any, error) {
+	if p.peek().kind == gqlEOF {
+		return nil, p.unexpected()
+	}
+	t := p.next()
+	switch t.kind {
+	case gqlString:
+		return t.text, nil
+	case gqlInt:
+		return strconv.ParseInt(t.text, 10, 64)
+	case gqlFloat:
+		return strconv.ParseFloat(t.text, 64)
+	case gqlName:
+		switch t.text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return gqlEnum(t.text), nil
+	case gqlPunct:
+		switch t.text {
+		case "$":
+			if constant {
+				return nil, gqlErrorAt(p.src, t.pos, "variables are not allowed here")
+			}
+			name, err := p.name()
+			return gqlVariable(name), err
+		case "[":
+			list := []any{}
+			for !p.skip("]") {
+				v, err := p.value(constant)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+			}
+			return list, nil
+		case "{":
+			obj := make(map[string]any)
+			for !p.skip("}") {
+				name, err := p.name()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect(":"); err != nil {
+					return nil, err
+				}
+				if obj[name], err = p.value(constant); err != nil {
+					return nil, err
+				}
+			}
+			return obj, nil
+		}
+	}
+	p.pos--
+	return nil, p.unexpected()
+}
+
+// operation returns the operation of the document to run
+func (d *gqlDocument) operation(name string) (*gqlOperation, error) {
+	if name == "" {
+		if len(d.operations) > 1 {
+			return nil, errors.New("operationName is required for a document of several queries")
+		}
+		return d.operations[0], nil
+	}
+	for _, op := range d.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("no query named %q", name)
+}
+
+// variables returns the values of the variables of the operation, with nil for those
+// neither given nor defaulted
+func (op *gqlOperation) variables(given map[string]any) (map[string]any, error) {
+	vars := make(map[string]any, len(op.vars))
+	for _, v := range op.vars {
+		val, ok := given[v.name]
+		if !ok || val == nil {
+			val = v.def
+		}
+		if val == nil && strings.HasSuffix(v.typ, "!") {
+			return nil, fmt.Errorf("variable $%s of type %s is required", v.name, v.typ)
+		}
+		vars[v.name] = val
+	}
+	return vars, nil
+}
+
+// gqlExec runs a query
+type gqlExec struct {
+	db     *sql.DB
+	doc    *gqlDocument
+	vars   map[string]any
+	limits GraphQLLimits
+	errors []GraphQLError
+}
+
+// gqlCollected is a field selected on an object once its fragments are expanded,
+// with the selections of the fields of the same response key merged
+type gqlCollected struct {
+	key, name string
+	args      map[string]any
+	sel       []gqlSelection
+}
+
+// collect expands the fragments of a selection on typ
+func (x *gqlExec) collect(typ string, sel []gqlSelection, fields []*gqlCollected, spreading map[string]bool) ([]*gqlCollected, error) {
+	var err error
+	for _, s := range sel {
+		switch {
+		case s.spread != "":
+			f, ok := x.doc.fragments[s.spread]
+			if !ok {
+				return nil, fmt.Errorf("no fragment named %s", s.spread)
+			}
+			if spreading[s.spread] {
+				return nil, fmt.Errorf("fragment %s spreads itself", s.spread)
+			}
+			if _, ok := graphQLSchema[f.on]; !ok {
+				return nil, fmt.Errorf("no type named %s", f.on)
+			}
+			if f.on != typ {
+				continue
+			}
+			spreading[s.spread] = true
+			fields, err = x.collect(typ, f.sel, fields, spreading)
+			delete(spreading, s.spread)
+		case s.inline:
+			if s.on != "" {
+				if _, ok := graphQLSchema[s.on]; !ok {
+					return nil, fmt.Errorf("no type named %s", s.on)
+				}
+				if s.on != typ {
+					continue
+				}
+			}
+			fields, err = x.collect(typ, s.sel, fields, spreading)
+		default:
+			key := s.name
+			if s.alias != "" {
+				key = s.alias
+			}
+			i := slices.IndexFunc(fields, func(f *gqlCollected) bool { return f.key == key })
+			if i < 0 {
+				fields = append(fields, &gqlCollected{key: key, name: s.name, args: s.args, sel: s.sel})
+				continue
+			}
+			if fields[i].name != s.name {
+				return nil, fmt.Errorf("fields %s and %s are both selected as %s", fields[i].name, s.name, key)
+			}
+			fields[i].sel = append(slices.Clip(fields[i].sel), s.sel...)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+// check validates a selection on typ against the schema and the limits, and
+// returns its complexity
+func (x *gqlExec) check(typ string, sel []gqlSelection, depth int) (int, error) {
+	if depth > x.limits.MaxDepth {
+		return 0, fmt.Errorf("query is nested more than %d levels deep", x.limits.MaxDepth)
+	}
+	fields, err := x.collect(typ, sel, nil, make(map[string]bool))
+	if err != nil {
+		return 0, err
+	}
+
+	var cost int
+	for _, f := range fields {
+		if f.name == "__typename" {
+			if f.sel != nil {
+				return 0, errors.New("__typename has no fields to select")
+			}
+			cost++
+			continue
+		}
+		def, ok := graphQLSchema[typ][f.name]
+		if !ok {
+			return 0, fmt.Errorf("no field %s on type %s", f.name, typ)
+		}
+		args, err := x.arguments(def, f.args)
+		if err != nil {
+			return 0, fmt.Errorf("%s.%s: %w", typ, f.name, err)
+		}
+
+		elem, isList := gqlElem(def.typ)
+		if _, object := graphQLSchema[elem]; !object {
+			if f.sel != nil {
+				return 0, fmt.Errorf("%s.%s is a %s, with no fields to select", typ, f.name, def.typ)
+			}
+			cost++
+		} else {
+			if f.sel == nil {
+				return 0, fmt.Errorf("%s.%s is a %s, whose fields must be selected", typ, f.name, def.typ)
+			}
+			child, err := x.check(elem, f.sel, depth+1)
+			if err != nil {
+				return 0, err
+			}
+			n := 1
+			if first, ok := args["first"].(int64); ok {
+				n = int(min(max(first, 0), maxPageLimit))
+			} else if isList {
+				n = def.list
+			}
+			cost += 1 + n*child
+		}
+		if cost > x.limits.MaxComplexity {
+			return 0, fmt.Errorf("query is more complex than the limit of %d, select fewer fields or pass a smaller first", x.limits.MaxComplexity)
+		}
+	}
+	return cost, nil
+}
+
+// gqlElem returns the type of the elements of a list type, or the type itself
+func gqlElem(typ string) (string, bool) {
+	if elem, ok := strings.CutPrefix(typ, "["); ok {
+		return strings.TrimSuffix(elem, "]"), true
+	}
+	return typ, false
+}
+
+// arguments returns the arguments given to a field with the variables replaced,
+// defaulted and coerced to their types
+func (x *gqlExec) arguments(def *gqlField, given map[string]any) (map[string]any, error) {
+	for name := range given {
+		if !slices.ContainsFunc(def.args, func(a gqlArg) bool { return a.name == name }) {
+			return nil, fmt.Errorf("unknown argument %s", name)
+		}
+	}
+
+	args := make(map[string]any, len(def.args))
+	for _, a := range def.args {
+		v := given[a.name]
+		if name, ok := v.(gqlVariable); ok {
+			var declared bool
+			if v, declared = x.vars[string(name)]; !declared {
+				return nil, fmt.Errorf("undefined variable $%s", name)
+			}
+		}
+		if v == nil {
+			v = a.def
+		}
+		typ, required := strings.CutSuffix(a.typ, "!")
+		if v == nil {
+			if required {
+				return nil, fmt.Errorf("argument %s of type %s is required", a.name, a.typ)
+			}
+			continue
+		}
+		v, err := coerceGraphQL(v, typ)
+		if err != nil {
+			return nil, fmt.Errorf("argument %s: %w", a.name, err)
+		}
+		args[a.name] = v
+	}
+	return args, nil
+}
+
+// coerceGraphQL converts an argument to the Go type of typ: string, int64 or bool
+func coerceGraphQL(v any, typ string) (any, error) {
+	switch typ {
+	case "String":
+		switch s := v.(type) {
+		case string:
+			return s, nil
+		case gqlEnum:
+			return string(s), nil
+		}
+	case "Int":
+		switch n := v.(type) {
+		case int64:
+			return n, nil
+		case float64: // from the JSON of the variables
+			if n == math.Trunc(n) && math.Abs(n) < 1<<53 {
+				return int64(n), nil
+			}
+		}
+	case "Boolean":
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("expected type %s, got %v", typ, v)
+}
+
+// object returns the fields selected on parent, of type typ. Errors of the fields
+// are recorded, with the field null.
+func (x *gqlExec) object(typ string, parent any, sel []gqlSelection, path []any) gqlObject {
+	fields, _ := x.collect(typ, sel, nil, make(map[string]bool)) // checked already
+	obj := make(gqlObject, 0, len(fields))
+	for _, f := range fields {
+		if f.name == "__typename" {
+			obj = append(obj, gqlEntry{f.key, typ})
+			continue
+		}
+		fieldPath := append(slices.Clip(path), f.key)
+		def := graphQLSchema[typ][f.name]
+		args, _ := x.arguments(def, f.args)
+		v, err := def.resolve(x, parent, args)
+		if err != nil {
+			x.errors = append(x.errors, GraphQLError{Message: err.Error(), Path: fieldPath})
+			obj = append(obj, gqlEntry{f.key, nil})
+			continue
+		}
+		obj = append(obj, gqlEntry{f.key, x.complete(def.typ, v, f.sel, fieldPath)})
+	}
+	return obj
+}
+
+// complete returns the value of a field of type typ for the response
+func (x *gqlExec) complete(typ string, v any, sel []gqlSelection, path []any) any {
+	if v == nil {
+		return nil
+	}
+	elem, isList := gqlElem(typ)
+	if isList {
+		list := v.([]any)
+		values := make([]any, len(list))
+		for i, e := range list {
+			values[i] = x.complete(elem, e, sel, append(slices.Clip(path), i))
+		}
+		return values
+	}
+	if _, object := graphQLSchema[typ]; object {
+		return x.object(typ, v, sel, path)
+	}
+	return v
+}
+
+// gqlObject is an object of a response, with its fields in the order they were selected
+type gqlObject []gqlEntry
+
+type gqlEntry struct {
+	key   string
+	value any
+}
+
+func (o gqlObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, e := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, err := json.Marshal(e.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(e.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
@@ -0,0 +1,305 @@
+package crawal
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// gqlJSON returns the JSON of the data of a response
+func gqlJSON(t *testing.T, res GraphQLResponse) string {
+	t.Helper()
+	body, err := json.Marshal(res.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestParseGraphQLErrors(t *testing.T) {
+	tests := []struct {
+		name, query, want string
+	}{
+		{"unexpected character", "{ id ; }", `syntax error at 1:6: unexpected character ';'`},
+		{"invalid number", "{ wallpaper(id: 1-2) { id } }", `invalid number "1-2"`},
+		{"unterminated block string", `{ artist(name: """Ina) { id } }`, "unterminated string"},
+		{"unterminated string", "{ artist(name: \"Ina\n) { id } }", "syntax error at 1:16: invalid string"},
+		{"invalid escape", `{ artist(name: "\q") { id } }`, "invalid string"},
+		{"position on later lines", "{\n  wallpaper(id: 1) {\n    id ?\n  }\n}", "syntax error at 3:8"},
+		{"unexpected token", "{ wallpaper(id: 1) { id } ) }", `unexpected ")"`},
+		{"unexpected end", "{ wallpaper(id: 1) { id }", "unexpected end of query"},
+		{"unexpected end of arguments", "{ wallpaper(id: ", "unexpected end of query"},
+		{"empty selection", "{ }", "empty selection"},
+		{"empty field selection", "{ wallpaper(id: 1) { } }", "empty selection"},
+		{"directive on field", "{ wallpaper(id: 1) @skip(if: true) { id } }", "directives are not supported"},
+		{"directive on query", "query Q @live { tags { name } }", "directives are not supported"},
+		{"directive on spread", "{ ...F @include(if: true) } fragment F on Query { tags { name } }", "directives are not supported"},
+		{"mutation", "mutation { deleteWallpaper(id: 1) }", "mutations are not supported"},
+		{"subscription", "subscription { wallpapers { nodes { id } } }", "subscriptions are not supported"},
+		{"fragment defined twice", "{ ...F } fragment F on Query { tags { name } } fragment F on Query { artists { name } }", "fragment F is defined twice"},
+		{"fragment without type", "{ ...F } fragment F { tags { name } }", `unexpected "{"`},
+		{"no query", "fragment F on Query { tags { name } }", "no query in the document"},
+		{"empty document", "  # nothing\n", "no query in the document"},
+		{"variable in default", "query Q($a: Int = $b) { tags { name } }", "variables are not allowed here"},
+		{"variable without $", "query Q(a: Int) { tags { name } }", `unexpected "a"`},
+		{"variable without type", "query Q($a) { tags { name } }", `unexpected ")"`},
+		{"unclosed list type", "query Q($a: [Int) { tags { name } }", `unexpected ")"`},
+		{"argument given twice", "{ wallpaper(id: 1, id: 2) { id } }", "argument id of wallpaper is given twice"},
+		{"argument without value", "{ wallpaper(id: ) { id } }", `unexpected ")"`},
+		{"keyword", "query { tags { name } } schema", `unexpected "schema"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseGraphQL(tt.query)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseGraphQL(%q) = %v, want an error with %q", tt.query, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseGraphQLValues(t *testing.T) {
+	doc, err := parseGraphQL(`
+		# the arguments of every kind
+		query Q($n: Int = 3, $s: [String!]! = ["a", "b"]) {
+			alias: field(i: -4, f: 1.5e3, s: "té\"", b: """ block "quoted" """, t: true, n: null, e: ENUM, v: $n, l: [1, [2]], o: {k: "v"}) { id }
+		}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	op := doc.operations[0]
+	if op.name != "Q" || len(op.vars) != 2 || op.vars[0].typ != "Int" || op.vars[1].typ != "[String!]!" || op.vars[0].def != int64(3) {
+		t.Errorf("variables parsed as %+v", op.vars)
+	}
+	s := op.sel[0]
+	if s.alias != "alias" || s.name != "field" || len(s.sel) != 1 {
+		t.Errorf("selection parsed as %+v", s)
+	}
+	want := map[string]any{
+		"i": int64(-4), "f": 1500.0, "s": `té"`, "b": `block "quoted"`, "t": true, "n": nil,
+		"e": gqlEnum("ENUM"), "v": gqlVariable("n"),
+	}
+	for name, v := range want {
+		if s.args[name] != v {
+			t.Errorf("argument %s is %#v, want %#v", name, s.args[name], v)
+		}
+	}
+	if l, _ := json.Marshal(s.args["l"]); string(l) != "[1,[2]]" {
+		t.Errorf("list argument is %s", l)
+	}
+	if o, _ := s.args["o"].(map[string]any); o["k"] != "v" {
+		t.Errorf("object argument is %#v", s.args["o"])
+	}
+}
+
+// TestGraphQLLimits runs queries at and just over the depth and complexity limits
+func TestGraphQLLimits(t *testing.T) {
+	db := newPageTestDB(t, 3)
+
+	// Query > WallpaperPage > Wallpaper > Item > Wallpaper is 5 levels deep. Its
+	// complexity is that of wallpapers, 1 + first × (nodes: 1 + 1 × (id: 1 + item:
+	// 1 + (files: 1 + 4 × id))) = 1 + 10 × 8
+	deep := "{ wallpapers(first: 10) { nodes { id item { files { id } } } } }"
+	// tags lists up to 1000 tags, each with one field
+	wide := "{ tags { name } }"
+
+	tests := []struct {
+		name   string
+		query  string
+		limits GraphQLLimits
+		want   string // error, empty when the query runs
+	}{
+		{"depth at the limit", deep, GraphQLLimits{MaxDepth: 5}, ""},
+		{"depth over the limit", deep, GraphQLLimits{MaxDepth: 4}, "query is nested more than 4 levels deep"},
+		{"default depth", "{ wallpapers { nodes { item { files { item { files { item { files { id } } } } } } } } }", GraphQLLimits{}, "query is nested more than 8 levels deep"},
+		{"complexity at the limit", deep, GraphQLLimits{MaxComplexity: 81}, ""},
+		{"complexity over the limit", deep, GraphQLLimits{MaxComplexity: 80}, "query is more complex than the limit of 80"},
+		{"list length of the schema", wide, GraphQLLimits{MaxComplexity: 1001}, ""},
+		{"list length over the limit", wide, GraphQLLimits{MaxComplexity: 1000}, "more complex than the limit of 1000"},
+		{"smaller first", "{ tags(first: 2) { name } }", GraphQLLimits{MaxComplexity: 3}, ""},
+		{"first capped", "{ tags(first: 100000) { name } }", GraphQLLimits{MaxComplexity: 1001}, ""},
+		{"default complexity", "{ wallpapers(first: 1000) { nodes { id title item { files { id title } } } } }", GraphQLLimits{}, "more complex than the limit of 10000"},
+		{"fragments counted", "{ ...W ...W } fragment W on Query { wallpapers(first: 10) { nodes { id } } }", GraphQLLimits{MaxComplexity: 21}, ""},
+		{"aliases counted", "{ a: tags(first: 5) { name } b: tags(first: 5) { name } }", GraphQLLimits{MaxComplexity: 11}, "more complex than the limit of 11"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ExecGraphQL(db, GraphQLRequest{Query: tt.query}, tt.limits)
+			checkGraphQLError(t, res, tt.want)
+		})
+	}
+}
+
+// checkGraphQLError checks that res failed with the error want before running, or
+// ran without error when want is empty
+func checkGraphQLError(t *testing.T, res GraphQLResponse, want string) {
+	t.Helper()
+	if want == "" {
+		if len(res.Errors) > 0 || res.Data == nil {
+			t.Errorf("query failed: %+v", res.Errors)
+		}
+		return
+	}
+	if res.Data != nil || len(res.Errors) != 1 || !strings.Contains(res.Errors[0].Message, want) {
+		t.Errorf("query returned %+v, %+v; want the error %q", res.Data, res.Errors, want)
+	}
+	if len(res.Errors) == 1 && res.Errors[0].Path != nil {
+		t.Errorf("error of an invalid query has the path %v", res.Errors[0].Path)
+	}
+}
+
+func TestGraphQLValidation(t *testing.T) {
+	db := newPageTestDB(t, 3)
+	tests := []struct {
+		name string
+		req  GraphQLRequest
+		want string
+	}{
+		{"fragment spreading itself", GraphQLRequest{Query: "{ ...A } fragment A on Query { ...A }"}, "fragment A spreads itself"},
+		{"fragment cycle", GraphQLRequest{Query: "{ ...A } fragment A on Query { tags { name } ...B } fragment B on Query { ...A }"}, "fragment A spreads itself"},
+		{"nested fragment cycle", GraphQLRequest{Query: "{ tags { ...T } } fragment T on Tag { name wallpapers { nodes { id } } ...U } fragment U on Tag { ...T }"}, "fragment T spreads itself"},
+		{"unknown fragment", GraphQLRequest{Query: "{ ...Missing }"}, "no fragment named Missing"},
+		{"fragment on unknown type", GraphQLRequest{Query: "{ ...F } fragment F on Nothing { id }"}, "no type named Nothing"},
+		{"inline fragment on unknown type", GraphQLRequest{Query: "{ ... on Nothing { id } }"}, "no type named Nothing"},
+		{"unknown field", GraphQLRequest{Query: "{ wallpaper(id: 1) { path secret } }"}, "no field secret on type Wallpaper"},
+		{"unknown query", GraphQLRequest{Query: "{ files { id } }"}, "no field files on type Query"},
+		{"unknown argument", GraphQLRequest{Query: "{ wallpaper(id: 1, path: \"x\") { id } }"}, "Query.wallpaper: unknown argument path"},
+		{"missing argument", GraphQLRequest{Query: "{ wallpaper { id } }"}, "argument id of type Int! is required"},
+		{"null argument", GraphQLRequest{Query: "{ wallpaper(id: null) { id } }"}, "argument id of type Int! is required"},
+		{"argument of the wrong type", GraphQLRequest{Query: "{ wallpaper(id: \"1\") { id } }"}, "argument id: expected type Int, got 1"},
+		{"float argument", GraphQLRequest{Query: "{ wallpaper(id: 1.5) { id } }"}, "expected type Int"},
+		{"selection of a scalar", GraphQLRequest{Query: "{ wallpaper(id: 1) { id { value } } }"}, "Wallpaper.id is a Int, with no fields to select"},
+		{"object without selection", GraphQLRequest{Query: "{ wallpaper(id: 1) }"}, "Query.wallpaper is a Wallpaper, whose fields must be selected"},
+		{"alias of two fields", GraphQLRequest{Query: "{ wallpaper(id: 1) { x: id x: title } }"}, "fields id and title are both selected as x"},
+		{"selection of __typename", GraphQLRequest{Query: "{ __typename { name } }"}, "__typename has no fields to select"},
+		{"several queries without name", GraphQLRequest{Query: "query A { tags { name } } query B { artists { name } }"}, "operationName is required"},
+		{"unknown operation", GraphQLRequest{Query: "query A { tags { name } }", OperationName: "B"}, `no query named "B"`},
+		{"missing variable", GraphQLRequest{Query: "query Q($id: Int!) { wallpaper(id: $id) { id } }"}, "variable $id of type Int! is required"},
+		{"null variable", GraphQLRequest{Query: "query Q($id: Int!) { wallpaper(id: $id) { id } }", Variables: map[string]any{"id": nil}}, "variable $id of type Int! is required"},
+		{"undefined variable", GraphQLRequest{Query: "{ wallpaper(id: $id) { id } }"}, "undefined variable $id"},
+		{"variable of the wrong type", GraphQLRequest{Query: "query Q($id: Int) { wallpaper(id: $id) { id } }", Variables: map[string]any{"id": "one"}}, "argument id: expected type Int, got one"},
+		{"fractional variable", GraphQLRequest{Query: "query Q($id: Int) { wallpaper(id: $id) { id } }", Variables: map[string]any{"id": 1.5}}, "expected type Int, got 1.5"},
+		{"syntax error", GraphQLRequest{Query: "{ wallpaper(id: 1) { id }"}, "unexpected end of query"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkGraphQLError(t, ExecGraphQL(db, tt.req, GraphQLLimits{}), tt.want)
+		})
+	}
+}
+
+func TestExecGraphQL(t *testing.T) {
+	db := newPageTestDB(t, 3)
+	tests := []struct {
+		name string
+		req  GraphQLRequest
+		want string
+	}{
+		{"field", GraphQLRequest{Query: "{ wallpaper(id: 2) { id title cataloged } }"},
+			`{"wallpaper":{"id":2,"title":"title 2","cataloged":true}}`},
+		{"missing wallpaper", GraphQLRequest{Query: "{ wallpaper(id: 99) { id } }"},
+			`{"wallpaper":null}`},
+		{"aliases in the order selected", GraphQLRequest{Query: "{ b: wallpaper(id: 2) { t: title } a: wallpaper(id: 1) { i: id } }"},
+			`{"b":{"t":"title 2"},"a":{"i":1}}`},
+		{"variables from JSON", GraphQLRequest{Query: "query Q($id: Int!, $order: String = \"desc\") { wallpaper(id: $id) { id } wallpapers(first: 2, order: $order) { nodes { id } } }", Variables: map[string]any{"id": 3.0}},
+			`{"wallpaper":{"id":3},"wallpapers":{"nodes":[{"id":3},{"id":2}]}}`},
+		{"default of a variable over the argument", GraphQLRequest{Query: "query Q($first: Int = 1) { wallpapers(first: $first) { nodes { id } } }"},
+			`{"wallpapers":{"nodes":[{"id":1}]}}`},
+		{"named operation", GraphQLRequest{Query: "query A { wallpaper(id: 1) { id } } query B { wallpaper(id: 2) { id } }", OperationName: "B"},
+			`{"wallpaper":{"id":2}}`},
+		{"fragments merged", GraphQLRequest{Query: "{ wallpaper(id: 1) { id ...F ... on Wallpaper { game } ... on Item { title } } } fragment F on Wallpaper { id type }"},
+			`{"wallpaper":{"id":1,"type":"wallpaper","game":"azur_lane"}}`},
+		{"selections of one key merged", GraphQLRequest{Query: "{ wallpaper(id: 1) { item { id } item { game } } }"},
+			`{"wallpaper":{"item":{"id":1,"game":"azur_lane"}}}`},
+		{"__typename", GraphQLRequest{Query: "{ __typename wallpaper(id: 1) { __typename kind: __typename } }"},
+			`{"__typename":"Query","wallpaper":{"__typename":"Wallpaper","kind":"Wallpaper"}}`},
+		{"enum as string", GraphQLRequest{Query: "{ wallpapers(first: 1, order: desc) { nodes { id } } }"},
+			`{"wallpapers":{"nodes":[{"id":3}]}}`},
+		{"cursor", GraphQLRequest{Query: "{ wallpapers(first: 3) { nodes { id } nextCursor } }"},
+			`{"wallpapers":{"nodes":[{"id":1},{"id":2},{"id":3}],"nextCursor":null}}`},
+		{"null scalars", GraphQLRequest{Query: "{ wallpaper(id: 1) { path publishedAt color } }"},
+			`{"wallpaper":{"path":null,"publishedAt":null,"color":null}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ExecGraphQL(db, tt.req, GraphQLLimits{})
+			if len(res.Errors) > 0 {
+				t.Fatalf("query failed: %+v", res.Errors)
+			}
+			if got := gqlJSON(t, res); got != tt.want {
+				t.Errorf("data is %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestExecGraphQLFieldErrors checks that an error of a field leaves it null, with the
+// path of the field, and the rest of the response is returned
+func TestExecGraphQLFieldErrors(t *testing.T) {
+	db := newPageTestDB(t, 3)
+	res := ExecGraphQL(db, GraphQLRequest{Query: `{
+		ok: wallpaper(id: 1) { id }
+		page: wallpapers(first: 0) { nodes { id } }
+		sorted: wallpapers(sort: "path") { nodes { id } }
+		artist(name: "nobody") { name }
+	}`}, GraphQLLimits{})
+
+	if got, want := gqlJSON(t, res), `{"ok":{"id":1},"page":null,"sorted":null,"artist":null}`; got != want {
+		t.Errorf("data is %s, want %s", got, want)
+	}
+	if len(res.Errors) != 2 {
+		t.Fatalf("errors are %+v, want those of page and sorted", res.Errors)
+	}
+	for i, want := range []struct{ path, message string }{
+		{"page", "first must be from 1 to 1000"},
+		{"sorted", "unknown sort"},
+	} {
+		e := res.Errors[i]
+		if len(e.Path) != 1 || e.Path[0] != want.path || !strings.Contains(e.Message, want.message) {
+			t.Errorf("error %d is %+v, want %q at %s", i, e, want.message, want.path)
+		}
+	}
+
+	body, err := json.Marshal(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), `"errors":[{"message":"first must be from 1 to 1000","path":["page"]}`) {
+		t.Errorf("response is %s", body)
+	}
+
+	invalid, _ := json.Marshal(ExecGraphQL(db, GraphQLRequest{Query: "{"}, GraphQLLimits{}))
+	if got, want := string(invalid), `{"data":null,"errors":[{"message":"syntax error at 1:2: unexpected end of query"}]}`; got != want {
+		t.Errorf("response to an invalid query is %s, want %s", got, want)
+	}
+}
+
+func TestGraphQLSchema(t *testing.T) {
+	schema := GraphQLSchema()
+	if !strings.HasPrefix(schema, "type Query {\n") {
+		t.Errorf("schema does not start with Query:\n%s", schema)
+	}
+	for _, want := range []string{
+		"  wallpaper(id: Int!): Wallpaper\n",
+		`  wallpapers(game: String, region: String, type: String, title: String, artist: String, tag: String, text: String, sort: String = "id", order: String = "asc", first: Int = 100, after: String): WallpaperPage`,
+		"type Wallpaper {\n",
+		"  files: [Wallpaper]\n",
+	} {
+		if !strings.Contains(schema, want) {
+			t.Errorf("schema has no %q", want)
+		}
+	}
+	// every type a field refers to is defined, or a scalar
+	for typ, fields := range graphQLSchema {
+		for name, f := range fields {
+			elem, _ := gqlElem(f.typ)
+			switch elem {
+			case "Int", "Float", "String", "Boolean":
+			default:
+				if _, ok := graphQLSchema[elem]; !ok {
+					t.Errorf("%s.%s is of the unknown type %s", typ, name, f.typ)
+				}
+			}
+		}
+	}
+}
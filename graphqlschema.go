@@ -0,0 +1,371 @@
+package crawal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// graphQLSchema are the types of the schema of ExecGraphQL with their fields, by name.
+// Types not in it are scalars.
+var graphQLSchema = map[string]map[string]*gqlField{
+	"Query": {
+		"wallpaper": {typ: "Wallpaper", args: []gqlArg{{name: "id", typ: "Int!"}},
+			resolve: func(x *gqlExec, _ any, args map[string]any) (any, error) {
+				item, err := GetGalleryItemByID(x.db, args["id"].(int64))
+				if err == sql.ErrNoRows {
+					return nil, nil
+				}
+				return item, err
+			}},
+		"wallpapers": {typ: "WallpaperPage", args: wallpaperArgs,
+			doc: "Wallpapers matching the filters, a page at a time: pass the nextCursor of a page as after for the next one",
+			resolve: func(x *gqlExec, _ any, args map[string]any) (any, error) {
+				return gqlWallpapers(x.db, x.filter(args), args)
+			}},
+		"item": {typ: "Item", args: []gqlArg{{name: "id", typ: "Int!"}},
+			resolve: func(x *gqlExec, _ any, args map[string]any) (any, error) {
+				return gqlItemByID(x.db, args["id"].(int64))
+			}},
+		"items": {typ: "[Item]", args: itemArgs,
+			doc: "Gallery entries with a file matching the filters, by ID: pass the last ID as after for the next ones",
+			resolve: func(x *gqlExec, _ any, args map[string]any) (any, error) {
+				return gqlItems(x.db, x.filter(args), args["first"].(int64), gqlIntArg(args, "after"))
+			}},
+		"tags": {typ: "[Tag]", args: []gqlArg{{name: "first", typ: "Int", def: int64(maxPageLimit)}},
+			resolve: func(x *gqlExec, _ any, args map[string]any) (any, error) {
+				tags, err := ListTags(x.db)
+				return gqlFirst(tags, args), err
+			}},
+		"artists": {typ: "[Artist]", args: []gqlArg{{name: "first", typ: "Int", def: int64(maxPageLimit)}},
+			resolve: func(x *gqlExec, _ any, args map[string]any) (any, error) {
+				artists, err := ListArtists(x.db)
+				return gqlFirst(artists, args), err
+			}},
+		"artist": {typ: "Artist", args: []gqlArg{{name: "name", typ: "String!"}},
+			resolve: func(x *gqlExec, _ any, args map[string]any) (any, error) {
+				return gqlArtist(x.db, args["name"].(string))
+			}},
+		"collections": {typ: "[Collection]", args: []gqlArg{{name: "first", typ: "Int", def: int64(defaultPageLimit)}},
+			resolve: func(x *gqlExec, _ any, args map[string]any) (any, error) {
+				collections, err := ListCollections(x.db)
+				return gqlFirst(collections, args), err
+			}},
+		"collection": {typ: "Collection", args: []gqlArg{{name: "name", typ: "String!"}},
+			resolve: func(x *gqlExec, _ any, args map[string]any) (any, error) {
+				c, err := GetCollection(x.db, args["name"].(string))
+				if errors.Is(err, ErrNoCollection) {
+					return nil, nil
+				}
+				return c, err
+			}},
+	},
+
+	"WallpaperPage": {
+		"nodes":      {typ: "[Wallpaper]", list: 1, resolve: func(_ *gqlExec, p any, _ map[string]any) (any, error) { return gqlList(p.(gqlPage).items), nil }},
+		"nextCursor": gqlGetter("String", func(p gqlPage) any { return gqlOptional(p.next) }),
+	},
+
+	"Wallpaper": {
+		"id":            gqlGetter("Int", func(w GalleryItem) any { return w.ID }),
+		"game":          gqlGetter("String", func(w GalleryItem) any { return w.Game }),
+		"region":        gqlGetter("String", func(w GalleryItem) any { return w.Region }),
+		"idGallery":     gqlGetter("String", func(w GalleryItem) any { return w.IdGallery }),
+		"type":          gqlGetter("String", func(w GalleryItem) any { return w.Type }),
+		"fileName":      gqlGetter("String", func(w GalleryItem) any { return w.FileName }),
+		"url":           gqlGetter("String", func(w GalleryItem) any { return w.URL }),
+		"sourceUrl":     gqlGetter("String", func(w GalleryItem) any { return gqlOptional(w.SourceURL) }),
+		"resolvedUrl":   gqlGetter("String", func(w GalleryItem) any { return gqlOptional(w.ResolvedURL) }),
+		"path":          gqlGetter("String", func(w GalleryItem) any { return gqlOptional(w.Path) }),
+		"sha256":        gqlGetter("String", func(w GalleryItem) any { return gqlOptional(w.SHA256) }),
+		"size":          gqlGetter("Int", func(w GalleryItem) any { return w.Size }),
+		"width":         gqlGetter("Int", func(w GalleryItem) any { return w.Width }),
+		"height":        gqlGetter("Int", func(w GalleryItem) any { return w.Height }),
+		"aspect":        gqlGetter("Float", func(w GalleryItem) any { return w.Aspect }),
+		"color":         gqlGetter("String", func(w GalleryItem) any { return gqlOptional(w.Color) }),
+		"dominantColor": gqlGetter("String", func(w GalleryItem) any { return gqlOptional(w.DominantColor) }),
+		"brightness":    gqlGetter("Float", func(w GalleryItem) any { return w.Brightness }),
+		"cataloged":     gqlGetter("Boolean", func(w GalleryItem) any { return w.Cataloged }),
+		"title":         gqlGetter("String", func(w GalleryItem) any { return gqlOptional(w.Title) }),
+		"description":   gqlGetter("String", func(w GalleryItem) any { return gqlOptional(w.Description) }),
+		"publishedAt":   gqlGetter("String", func(w GalleryItem) any { return gqlTime(w.PublishedAt) }),
+		"createdAt":     gqlGetter("String", func(w GalleryItem) any { return gqlTime(w.CreatedAt) }),
+		"tags": {typ: "[String]", list: 20, resolve: func(x *gqlExec, p any, _ map[string]any) (any, error) {
+			tags, err := GetTags(x.db, p.(GalleryItem).ID)
+			return gqlList(tags), err
+		}},
+		"artist": {typ: "Artist", resolve: func(x *gqlExec, p any, _ map[string]any) (any, error) {
+			return gqlArtist(x.db, p.(GalleryItem).Artist)
+		}},
+		"item": {typ: "Item", resolve: func(x *gqlExec, p any, _ map[string]any) (any, error) {
+			return gqlItemByID(x.db, p.(GalleryItem).ItemID)
+		}},
+		"duplicateOf": {typ: "Wallpaper", resolve: func(x *gqlExec, p any, _ map[string]any) (any, error) {
+			id := p.(GalleryItem).DuplicateOf
+			if id == 0 {
+				return nil, nil
+			}
+			item, err := GetGalleryItemByID(x.db, id)
+			if err == sql.ErrNoRows {
+				return nil, nil
+			}
+			return item, err
+		}},
+	},
+
+	"Item": {
+		"id":          gqlGetter("Int", func(i gqlItem) any { return i.files[0].ItemID }),
+		"game":        gqlGetter("String", func(i gqlItem) any { return i.files[0].Game }),
+		"region":      gqlGetter("String", func(i gqlItem) any { return i.files[0].Region }),
+		"idGallery":   gqlGetter("String", func(i gqlItem) any { return i.files[0].IdGallery }),
+		"title":       gqlGetter("String", func(i gqlItem) any { return gqlOptional(i.files[0].Title) }),
+		"description": gqlGetter("String", func(i gqlItem) any { return gqlOptional(i.files[0].Description) }),
+		"publishedAt": gqlGetter("String", func(i gqlItem) any { return gqlTime(i.files[0].PublishedAt) }),
+		"files": {typ: "[Wallpaper]", list: 4, doc: "The image of each type of the entry",
+			resolve: func(_ *gqlExec, p any, _ map[string]any) (any, error) { return gqlList(p.(gqlItem).files), nil }},
+		"artist": {typ: "Artist", resolve: func(x *gqlExec, p any, _ map[string]any) (any, error) {
+			return gqlArtist(x.db, p.(gqlItem).files[0].Artist)
+		}},
+	},
+
+	"Artist": {
+		"id":        gqlGetter("Int", func(a Artist) any { return a.ID }),
+		"name":      gqlGetter("String", func(a Artist) any { return a.Name }),
+		"itemCount": gqlGetter("Int", func(a Artist) any { return a.Items }),
+		"wallpapers": {typ: "WallpaperPage", args: gqlArgsWithout(wallpaperArgs, "artist"),
+			resolve: func(x *gqlExec, p any, args map[string]any) (any, error) {
+				f := x.filter(args)
+				f.Artist = p.(Artist).Name
+				return gqlWallpapers(x.db, f, args)
+			}},
+	},
+
+	"Tag": {
+		"name": gqlGetter("String", func(tag string) any { return tag }),
+		"wallpapers": {typ: "WallpaperPage", args: gqlArgsWithout(wallpaperArgs, "tag"),
+			resolve: func(x *gqlExec, p any, args map[string]any) (any, error) {
+				f := x.filter(args)
+				f.Tag = p.(string)
+				return gqlWallpapers(x.db, f, args)
+			}},
+	},
+
+	"Collection": {
+		"id":        gqlGetter("Int", func(c Collection) any { return c.ID }),
+		"name":      gqlGetter("String", func(c Collection) any { return c.Name }),
+		"rules":     gqlGetter("String", func(c Collection) any { return gqlOptional(c.Rules) }),
+		"folder":    gqlGetter("String", func(c Collection) any { return gqlOptional(c.Folder) }),
+		"mode":      gqlGetter("String", func(c Collection) any { return gqlOptional(c.Mode) }),
+		"members":   gqlGetter("Int", func(c Collection) any { return c.Members }),
+		"createdAt": gqlGetter("String", func(c Collection) any { return gqlTime(c.CreatedAt) }),
+		"wallpapers": {typ: "[Wallpaper]", args: pageArgs, doc: "Members by ID: pass the last ID as after for the next ones",
+			resolve: func(x *gqlExec, p any, args map[string]any) (any, error) {
+				items, err := CollectionItems(x.db, p.(Collection))
+				if err != nil {
+					return nil, err
+				}
+				after := gqlIntArg(args, "after")
+				items = slices.DeleteFunc(items, func(item GalleryItem) bool { return item.ID <= after })
+				return gqlFirst(items, args), nil
+			}},
+	},
+}
+
+// pageArgs page through a list by ID
+var pageArgs = []gqlArg{
+	{name: "first", typ: "Int", def: int64(defaultPageLimit)},
+	{name: "after", typ: "Int"},
+}
+
+// itemArgs are the filters of the gallery entries
+var itemArgs = append([]gqlArg{
+	{name: "game", typ: "String"},
+	{name: "region", typ: "String"},
+	{name: "title", typ: "String"},
+	{name: "artist", typ: "String"},
+	{name: "tag", typ: "String"},
+}, pageArgs...)
+
+// wallpaperArgs are the filters and the page of the wallpapers, see PageGalleryItems
+var wallpaperArgs = []gqlArg{
+	{name: "game", typ: "String"},
+	{name: "region", typ: "String"},
+	{name: "type", typ: "String"},
+	{name: "title", typ: "String"},
+	{name: "artist", typ: "String"},
+	{name: "tag", typ: "String"},
+	{name: "text", typ: "String"},
+	{name: "sort", typ: "String", def: "id"},
+	{name: "order", typ: "String", def: "asc"},
+	{name: "first", typ: "Int", def: int64(defaultPageLimit)},
+	{name: "after", typ: "String"},
+}
+
+// gqlPage is a page of wallpapers
+type gqlPage struct {
+	items []GalleryItem
+	next  string
+}
+
+// gqlItem is a gallery entry, with its files
+type gqlItem struct {
+	files []GalleryItem // at least one
+}
+
+// gqlGetter returns a field of type typ read from the Go value of its object
+func gqlGetter[T any](typ string, get func(T) any) *gqlField {
+	return &gqlField{typ: typ, resolve: func(_ *gqlExec, parent any, _ map[string]any) (any, error) {
+		return get(parent.(T)), nil
+	}}
+}
+
+// gqlArgsWithout returns args without the argument name
+func gqlArgsWithout(args []gqlArg, name string) []gqlArg {
+	return slices.DeleteFunc(slices.Clone(args), func(a gqlArg) bool { return a.name == name })
+}
+
+// gqlList returns s as a list value
+func gqlList[T any](s []T) []any {
+	list := make([]any, len(s))
+	for i, v := range s {
+		list[i] = v
+	}
+	return list
+}
+
+// gqlFirst returns the list of the first elements of s, as many as the first argument
+func gqlFirst[T any](s []T, args map[string]any) []any {
+	if first := int(args["first"].(int64)); first >= 0 && first < len(s) {
+		s = s[:first]
+	}
+	return gqlList(s)
+}
+
+// gqlOptional returns null for an empty string
+func gqlOptional(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// gqlTime returns a time in RFC 3339, or null for the zero time
+func gqlTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// gqlIntArg returns an optional Int argument, 0 when not given
+func gqlIntArg(args map[string]any, name string) int64 {
+	n, _ := args[name].(int64)
+	return n
+}
+
+// gqlFilter returns the filter of the String arguments named like its fields
+func gqlFilter(args map[string]any) Filter {
+	return Filter{Game: gqlStringArg(args, "game"), Region: gqlStringArg(args, "region"), Type: gqlStringArg(args, "type"),
+		Title: gqlStringArg(args, "title"), Artist: gqlStringArg(args, "artist"), Tag: gqlStringArg(args, "tag"), Text: gqlStringArg(args, "text")}
+}
+
+// filter returns the filter of the String arguments named like its fields, leaving
+// out the wallpapers with the hidden tags of the limits
+func (x *gqlExec) filter(args map[string]any) Filter {
+	f := gqlFilter(args)
+	f.ExcludeTags = x.limits.HiddenTags
+	return f
+}
+
+// gqlWallpapers returns the page of the wallpapers matching f given by args
+func gqlWallpapers(db *sql.DB, f Filter, args map[string]any) (any, error) {
+	p := Page{Cursor: gqlStringArg(args, "after"), Sort: gqlStringArg(args, "sort"), Limit: int(args["first"].(int64))}
+	if p.Limit < 1 || p.Limit > maxPageLimit {
+		return nil, fmt.Errorf("first must be from 1 to %d", maxPageLimit)
+	}
+	switch order := gqlStringArg(args, "order"); order {
+	case "asc":
+	case "desc":
+		p.Desc = true
+	default:
+		return nil, fmt.Errorf("unknown order %q, expected asc or desc", order)
+	}
+	items, next, err := PageGalleryItems(db, f, p)
+	if err != nil {
+		return nil, err
+	}
+	return gqlPage{items: items, next: next}, nil
+}
+
+// gqlStringArg returns an optional String argument, empty when not given
+func gqlStringArg(args map[string]any, name string) string {
+	s, _ := args[name].(string)
+	return s
+}
+
+// gqlArtist returns the artist named name, or nil
+func gqlArtist(db *sql.DB, name string) (any, error) {
+	if name == "" {
+		return nil, nil
+	}
+	a, err := GetArtist(db, name)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return a, err
+}
+
+// gqlItemByID returns the gallery entry with this ID, or nil
+func gqlItemByID(db *sql.DB, id int64) (any, error) {
+	files, err := queryGalleryItems(db, "SELECT "+galleryColumns+" FROM gallery WHERE item_id = ? ORDER BY id", id)
+	if err != nil || len(files) == 0 {
+		return nil, err
+	}
+	return gqlItem{files: files}, nil
+}
+
+// gqlItems returns the first gallery entries after the ID after with a file matching f
+func gqlItems(db *sql.DB, f Filter, first, after int64) (any, error) {
+	if first < 1 || first > maxPageLimit {
+		return nil, fmt.Errorf("first must be from 1 to %d", maxPageLimit)
+	}
+	where, args := f.where()
+	files, err := queryGalleryItems(db, `SELECT `+galleryColumns+` FROM gallery WHERE item_id IN (
+		SELECT DISTINCT item_id FROM gallery WHERE `+where+` AND item_id > ? ORDER BY item_id LIMIT ?
+	) ORDER BY item_id, id`, append(args, after, first)...)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []any{}
+	for i := 0; i < len(files); {
+		j := i + 1
+		for j < len(files) && files[j].ItemID == files[i].ItemID {
+			j++
+		}
+		items = append(items, gqlItem{files: files[i:j]})
+		i = j
+	}
+	return items, nil
+}
+
+// queryGalleryItems returns the wallpapers of a query selecting galleryColumns
+func queryGalleryItems(db *sql.DB, query string, args ...any) ([]GalleryItem, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []GalleryItem
+	for rows.Next() {
+		item, err := scanGalleryItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,44 @@
+package crawal
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// Hook is a command run on each downloaded file, e.g. `oxipng {file}` to compress it or
+// `rclone copy {file} remote:{game}` to upload it. Placeholders are expanded as for
+// CommandTagger, with {file}, {name}, {dir}, {game}, {type}, {id} and {url}.
+type Hook struct {
+	Command string
+	Timeout time.Duration
+}
+
+// NewHook parses a hook command line, run with timeout or defaultCommandTimeout when 0
+func NewHook(command string, timeout time.Duration) (*Hook, error) {
+	if _, err := splitCommand(command); err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		timeout = defaultCommandTimeout
+	}
+	return &Hook{Command: command, Timeout: timeout}, nil
+}
+
+// Run runs the hook on the downloaded file of item
+func (h *Hook) Run(ctx context.Context, item GalleryItem) error {
+	_, err := runCommand(ctx, h.Command, h.Timeout, map[string]string{
+		"file": item.Path,
+		"name": filepath.Base(item.Path),
+		"dir":  filepath.Dir(item.Path),
+		"game": item.Game,
+		"type": item.Type,
+		"id":   item.IdGallery,
+		"url":  item.URL,
+	})
+	if err != nil {
+		return fmt.Errorf("hook failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package crawal
+
+import (
+	"database/sql"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"math/bits"
+	"strconv"
+)
+
+// analyzeImage decodes the file of a wallpaper, fills its perceptual hash,
+// dominant color, brightness and dimensions, and writes its thumbnail
+func analyzeImage(item *GalleryItem) error {
+	img, err := decodeImage(item.Path)
+	if err != nil {
+		return err
+	}
+
+	item.Width, item.Height = img.Bounds().Dx(), img.Bounds().Dy()
+	if item.Height > 0 {
+		item.Aspect = float64(item.Width) / float64(item.Height)
+	}
+
+	item.PHash = PerceptualHash(img)
+	dominant, brightness := colorStats(img)
+	item.DominantColor = fmt.Sprintf("#%02x%02x%02x", dominant.R, dominant.G, dominant.B)
+	item.Color = ColorName(dominant)
+	item.Brightness = brightness
+
+	return writeThumbnail(img, ThumbnailPath(item.Path))
+}
+
+// colorStats samples an image and returns its dominant color, the average of the most
+// common 4-bit-per-channel bucket, and its average relative luminance from 0 to 1
+func colorStats(img image.Image) (color.RGBA, float64) {
+	const samples = 64
+
+	type bucket struct {
+		r, g, b uint64
+		n       uint64
+	}
+	buckets := make(map[uint16]*bucket)
+
+	var luminance float64
+	var n int
+	b := img.Bounds()
+	for y := 0; y < samples; y++ {
+		for x := 0; x < samples; x++ {
+			r, g, bl, _ := img.At(b.Min.X+x*b.Dx()/samples, b.Min.Y+y*b.Dy()/samples).RGBA()
+			luminance += (0.2126*float64(r) + 0.7152*float64(g) + 0.0722*float64(bl)) / 0xffff
+			n++
+
+			key := uint16(r>>12)<<8 | uint16(g>>12)<<4 | uint16(bl>>12)
+			bk := buckets[key]
+			if bk == nil {
+				bk = &bucket{}
+				buckets[key] = bk
+			}
+			bk.r += uint64(r >> 8)
+			bk.g += uint64(g >> 8)
+			bk.b += uint64(bl >> 8)
+			bk.n++
+		}
+	}
+
+	var top *bucket
+	var topKey uint16
+	for key, bk := range buckets {
+		// break ties on the key so the result does not depend on map order
+		if top == nil || bk.n > top.n || (bk.n == top.n && key < topKey) {
+			top, topKey = bk, key
+		}
+	}
+
+	dominant := color.RGBA{uint8(top.r / top.n), uint8(top.g / top.n), uint8(top.b / top.n), 0xff}
+	return dominant, luminance / float64(n)
+}
+
+// ColorName names a color by hue, prefixed with dark- or light- by lightness,
+// e.g. dark-blue, orange or light-gray. Black and white are never prefixed.
+func ColorName(c color.RGBA) string {
+	r, g, b := float64(c.R)/255, float64(c.G)/255, float64(c.B)/255
+	hi, lo := math.Max(r, math.Max(g, b)), math.Min(r, math.Min(g, b))
+	l := (hi + lo) / 2
+
+	var s, h float64
+	if d := hi - lo; d > 0 {
+		s = d / (1 - math.Abs(2*l-1))
+		switch hi {
+		case r:
+			h = math.Mod((g-b)/d, 6)
+		case g:
+			h = (b-r)/d + 2
+		default:
+			h = (r-g)/d + 4
+		}
+		h *= 60
+		if h < 0 {
+			h += 360
+		}
+	}
+
+	switch {
+	case l < 0.12:
+		return "black"
+	case l > 0.92:
+		return "white"
+	}
+
+	var name string
+	switch {
+	case s < 0.15:
+		name = "gray"
+	case h < 15 || h >= 335:
+		name = "red"
+	case h < 45:
+		name = "orange"
+	case h < 70:
+		name = "yellow"
+	case h < 165:
+		name = "green"
+	case h < 195:
+		name = "cyan"
+	case h < 255:
+		name = "blue"
+	case h < 290:
+		name = "purple"
+	default:
+		name = "pink"
+	}
+
+	switch {
+	case l < 0.35:
+		return "dark-" + name
+	case l > 0.7:
+		return "light-" + name
+	}
+	return name
+}
+
+// PerceptualHash computes the 64-bit difference hash (dHash) of an image, hex encoded.
+// Visually identical images have hashes within a small Hamming distance of each other,
+// even after re-encoding or resizing.
+func PerceptualHash(img image.Image) string {
+	// Shrink to 9x8 grayscale cells and compare horizontally adjacent cells
+	const w, h = 9, 8
+	var cells [h][w]float64
+
+	b := img.Bounds()
+	for y := 0; y < h; y++ {
+		y0 := b.Min.Y + y*b.Dy()/h
+		y1 := max(b.Min.Y+(y+1)*b.Dy()/h, y0+1)
+		for x := 0; x < w; x++ {
+			x0 := b.Min.X + x*b.Dx()/w
+			x1 := max(b.Min.X+(x+1)*b.Dx()/w, x0+1)
+
+			// sample a grid inside the cell instead of every pixel
+			var sum float64
+			var n int
+			for sy := y0; sy < y1; sy += max((y1-y0)/8, 1) {
+				for sx := x0; sx < x1; sx += max((x1-x0)/8, 1) {
+					r, g, bl, _ := img.At(sx, sy).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(bl)
+					n++
+				}
+			}
+			cells[y][x] = sum / float64(n)
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w-1; x++ {
+			hash <<= 1
+			if cells[y][x] < cells[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+
+	return fmt.Sprintf("%016x", hash)
+}
+
+// hashDistance returns the Hamming distance between two hex encoded perceptual hashes,
+// or -1 if either cannot be parsed
+func hashDistance(a, b string) int {
+	x, err := strconv.ParseUint(a, 16, 64)
+	if err != nil {
+		return -1
+	}
+	y, err := strconv.ParseUint(b, 16, 64)
+	if err != nil {
+		return -1
+	}
+	return bits.OnesCount64(x ^ y)
+}
+
+// AnalyzeGalleryItems computes the perceptual hash, dominant color, brightness and dimensions of
+// the wallpapers matching the filter that have not been analyzed yet, or of all of
+// them with force. Files that are missing or cannot be decoded are skipped.
+// It returns the number of wallpapers analyzed.
+func AnalyzeGalleryItems(db *sql.DB, f Filter, force bool) (int, error) {
+	items, err := FindGalleryItems(db, f)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query wallpapers: %w", err)
+	}
+
+	var n int
+	for _, item := range items {
+		if item.Path == "" || (item.Brightness >= 0 && item.Aspect > 0 && !force) {
+			continue
+		}
+		if err := analyzeImage(&item); err != nil {
+			continue
+		}
+
+		_, err := db.Exec(`
+			UPDATE files SET phash = ?, dominant_color = ?, color = ?, brightness = ?, width = ?, height = ?, aspect = ?
+			WHERE id = ?`,
+			item.PHash, item.DominantColor, item.Color, item.Brightness, item.Width, item.Height, item.Aspect, item.ID)
+		if err != nil {
+			return n, fmt.Errorf("failed to update %s: %w", item.FileName, err)
+		}
+		n++
+	}
+
+	return n, nil
+}
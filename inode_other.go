@@ -0,0 +1,10 @@
+//go:build !unix
+
+package crawal
+
+import "os"
+
+// fileKey reports false, hard links being counted as separate files here
+func fileKey(info os.FileInfo) ([2]uint64, bool) {
+	return [2]uint64{}, false
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package crawal
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileKey returns the device and inode of a file, the same for its hard links
+func fileKey(info os.FileInfo) ([2]uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return [2]uint64{}, false
+	}
+	return [2]uint64{uint64(st.Dev), uint64(st.Ino)}, true
+}
@@ -0,0 +1,159 @@
+package crawal
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// gracefulTimeout is how long the first Ctrl+C waits for the running work to stop
+// before forcing it
+const gracefulTimeout = 30 * time.Second
+
+// countdownInterval is how often the time left before forcing is logged
+const countdownInterval = 10 * time.Second
+
+// forcedExitDelay is how long the work is given to clean up once forced, before
+// the program exits anyway
+const forcedExitDelay = 2 * time.Second
+
+// ErrInterrupted is returned by the work stopped by Ctrl+C
+var ErrInterrupted = errors.New("interrupted")
+
+// interrupts is the handling of the signals of the program, see HandleInterrupts
+var interrupts struct {
+	once    sync.Once
+	signals chan os.Signal
+
+	graceful context.Context // done at the first signal
+	stop     context.CancelFunc
+	forced   context.Context // done at the second signal
+	force    context.CancelFunc
+
+	mu      sync.Mutex
+	holders int             // work holding a Graceful context
+	idle    chan struct{}   // closed once no work holds a Graceful context after the first signal
+	temp    map[string]bool // temporary files removed when forced
+}
+
+func init() {
+	interrupts.graceful, interrupts.stop = context.WithCancel(context.Background())
+	interrupts.forced, interrupts.force = context.WithCancel(context.Background())
+	interrupts.temp = make(map[string]bool)
+}
+
+// HandleInterrupts handles Ctrl+C and SIGTERM for the whole program. The first
+// stops it gracefully: the work holding a Graceful context, such as the downloads
+// of RunJobs, finishes what it is doing and stops, a countdown being logged until
+// gracefulTimeout forces it. The second, or the first when no such work runs,
+// forces it: downloads are cancelled and queued again, the temporary files are
+// removed and the program exits. Without it, Graceful contexts are never done.
+func HandleInterrupts() {
+	interrupts.once.Do(func() {
+		interrupts.signals = make(chan os.Signal, 2)
+		signal.Notify(interrupts.signals, os.Interrupt, syscall.SIGTERM)
+		go handleInterrupts(interrupts.signals)
+	})
+}
+
+// Stop stops the program as Ctrl+C does, as asked by a service manager
+func Stop() {
+	HandleInterrupts()
+	select {
+	case interrupts.signals <- os.Interrupt:
+	default:
+	}
+}
+
+func handleInterrupts(signals <-chan os.Signal) {
+	<-signals
+	interrupts.mu.Lock()
+	if interrupts.holders == 0 {
+		interrupts.mu.Unlock()
+		forceExit(0)
+	}
+	idle := make(chan struct{})
+	interrupts.idle = idle
+	interrupts.mu.Unlock()
+
+	interrupts.stop()
+	logger.Printf("Stopping once the running work is done, forced in %s; press Ctrl+C again to stop now", gracefulTimeout)
+	deadline := time.Now().Add(gracefulTimeout)
+	ticker := time.NewTicker(countdownInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-idle:
+			// the program exits by itself; a second signal still forces it
+			<-signals
+			forceExit(forcedExitDelay)
+		case <-signals:
+			forceExit(forcedExitDelay)
+		case <-ticker.C:
+			left := time.Until(deadline).Round(time.Second)
+			if left <= 0 {
+				forceExit(forcedExitDelay)
+			}
+			logger.Printf("Stopping, forced in %s", left)
+		}
+	}
+}
+
+// forceExit cancels the downloads, gives them delay to clean up, removes the
+// temporary files left and exits
+func forceExit(delay time.Duration) {
+	if delay > 0 {
+		logger.Printf("Stopping now")
+	}
+	interrupts.force()
+	time.Sleep(delay)
+	interrupts.mu.Lock()
+	for name := range interrupts.temp {
+		os.Remove(name)
+	}
+	interrupts.mu.Unlock()
+	os.Exit(130)
+}
+
+// Graceful returns a context done at the first Ctrl+C when HandleInterrupts was
+// called, for work that can stop cleanly then. release must be called once the
+// work stopped, or is done.
+func Graceful() (ctx context.Context, release func()) {
+	interrupts.mu.Lock()
+	defer interrupts.mu.Unlock()
+	interrupts.holders++
+	var once sync.Once
+	return interrupts.graceful, func() {
+		once.Do(func() {
+			interrupts.mu.Lock()
+			defer interrupts.mu.Unlock()
+			interrupts.holders--
+			if interrupts.holders == 0 && interrupts.idle != nil {
+				close(interrupts.idle)
+				interrupts.idle = nil
+			}
+		})
+	}
+}
+
+// forced reports whether the program is being stopped right away
+func forced() bool {
+	return interrupts.forced.Err() != nil
+}
+
+// trackTemp records a temporary file to remove when the program is forced to stop,
+// until the returned function is called
+func trackTemp(name string) func() {
+	interrupts.mu.Lock()
+	defer interrupts.mu.Unlock()
+	interrupts.temp[name] = true
+	return func() {
+		interrupts.mu.Lock()
+		defer interrupts.mu.Unlock()
+		delete(interrupts.temp, name)
+	}
+}
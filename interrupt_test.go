@@ -0,0 +1,62 @@
+package crawal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestInterruptHelper is the program stopped by TestInterrupts, run in a process of
+// its own as it exits
+func TestInterruptHelper(t *testing.T) {
+	temp := os.Getenv("YOSTAR_TEST_INTERRUPT")
+	if temp == "" {
+		t.Skip("run by TestInterrupts")
+	}
+	HandleInterrupts()
+	ctx, release := Graceful()
+	defer release()
+	trackTemp(temp)
+
+	Stop()
+	select {
+	case <-ctx.Done():
+		fmt.Println("graceful")
+	case <-time.After(5 * time.Second):
+		fmt.Println("still running")
+		os.Exit(1)
+	}
+	if forced() {
+		fmt.Println("forced at the first signal")
+	}
+	// the second forces the exit, removing the temporary files
+	Stop()
+	time.Sleep(time.Minute)
+}
+
+// TestInterrupts checks that the first Ctrl+C stops the work gracefully and the
+// second forces the exit with 130, removing the temporary files
+func TestInterrupts(t *testing.T) {
+	temp := filepath.Join(t.TempDir(), ".download-1.part")
+	if err := os.WriteFile(temp, []byte("partial"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestInterruptHelper$")
+	cmd.Env = append(os.Environ(), "YOSTAR_TEST_INTERRUPT="+temp)
+	out, err := cmd.Output()
+	var exit *exec.ExitError
+	if !errors.As(err, &exit) || exit.ExitCode() != 130 {
+		t.Fatalf("helper exited with %v, want 130; output:\n%s", err, out)
+	}
+	if !strings.HasPrefix(string(out), "graceful\n") || strings.Contains(string(out), "forced") {
+		t.Errorf("helper output %q, want a graceful stop first", out)
+	}
+	if _, err := os.Stat(temp); !os.IsNotExist(err) {
+		t.Errorf("temporary file left after the forced exit: %v", err)
+	}
+}
@@ -0,0 +1,412 @@
+package crawal
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Item is a gallery entry of a game as listed by its API, independent of the game
+type Item struct {
+	Game        string
+	Region      string // region of the game API, global when empty
+	ID          string
+	Title       string
+	Titles      map[string]string // title by locale, e.g. ja, when the API lists several
+	Description string
+	Artist      string
+	PublishedAt time.Time // zero when the API does not tell
+	Metadata    string    // JSON of the API entry
+	Variants    []Variant
+
+	// FileName is the name of the downloaded images without extension,
+	// Title(Artist) or Title when empty
+	FileName string
+}
+
+// Variant is one image of an item, such as its desktop or mobile wallpaper
+type Variant struct {
+	Kind string // stored as the type of the wallpaper, e.g. wallpaper or mobile
+	URL  string
+}
+
+// localized returns the item with its title in locale, when known
+func (it Item) localized(locale string) Item {
+	if title := it.Titles[locale]; title != "" {
+		it.Title = title
+	}
+	return it
+}
+
+// fileName returns the name of the downloaded images of the item
+func (it Item) fileName() string {
+	switch {
+	case it.FileName != "":
+		return it.FileName
+	case it.Artist != "":
+		return fmt.Sprintf("%s(%s)", it.Title, it.Artist)
+	}
+	return it.Title
+}
+
+// SaveItem inserts the gallery entry of the item, or updates the one stored for its
+// game, region and ID, and returns its row ID. The stored title, description,
+// artist, publication date and metadata are kept when the item has none. Variants
+// are saved as files by SaveGalleryItem.
+func SaveItem(db *sql.DB, it Item) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := saveItem(tx, it)
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// saveItem implements SaveItem within tx
+func saveItem(tx *sql.Tx, it Item) (int64, error) {
+	var published any
+	if !it.PublishedAt.IsZero() {
+		published = it.PublishedAt.UTC().Format(publishedAtFormat)
+	}
+
+	gameID, err := nameID(tx, "games", it.Game)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save game %s: %w", it.Game, err)
+	}
+	var artistID any
+	if it.Artist != "" {
+		if artistID, err = nameID(tx, "artists", it.Artist); err != nil {
+			return 0, fmt.Errorf("failed to save artist %s: %w", it.Artist, err)
+		}
+	}
+
+	var id int64
+	err = tx.QueryRow(`
+		INSERT INTO items(game_id, region, id_gallery, title, description, artist_id, published_at, metadata)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (game_id, region, id_gallery) DO UPDATE SET
+			title = CASE WHEN excluded.title != '' THEN excluded.title ELSE title END,
+			description = CASE WHEN excluded.description != '' THEN excluded.description ELSE description END,
+			artist_id = COALESCE(excluded.artist_id, artist_id),
+			published_at = COALESCE(excluded.published_at, published_at),
+			metadata = CASE WHEN excluded.metadata != '' THEN excluded.metadata ELSE metadata END
+		RETURNING id`,
+		gameID, regionOrGlobal(it.Region), it.ID, it.Title, it.Description, artistID, published, it.Metadata).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save item %s/%s: %w", it.Game, it.ID, err)
+	}
+
+	for locale, title := range it.Titles {
+		_, err = tx.Exec(`
+			INSERT INTO item_titles(item_id, locale, title) VALUES (?, ?, ?)
+			ON CONFLICT (item_id, locale) DO UPDATE SET title = excluded.title`, id, locale, title)
+		if err != nil {
+			return 0, fmt.Errorf("failed to save %s title of %s/%s: %w", locale, it.Game, it.ID, err)
+		}
+	}
+	return id, nil
+}
+
+// nameID returns the ID of the row of table, games or artists, with the given name,
+// inserting it when missing
+func nameID(tx *sql.Tx, table, name string) (int64, error) {
+	var id int64
+	err := tx.QueryRow(`
+		INSERT INTO `+table+`(name) VALUES (?)
+		ON CONFLICT (name) DO UPDATE SET name = excluded.name
+		RETURNING id`, name).Scan(&id)
+	return id, err
+}
+
+// SyncOptions configures SyncItems
+type SyncOptions struct {
+	Dir      string            // folder the images are saved into
+	KindDirs map[string]string // subfolder of Dir per variant kind, Dir itself when missing
+	Catalog  bool              // only record the items, without downloading them
+	Queue    QueueOptions
+
+	// Filter, when set, decides which images not downloaded yet are queued
+	Filter DownloadFilter
+
+	// Candidates, when set, returns the alternate URLs of an image to try before
+	// the one listed by the API
+	Candidates URLCandidates
+
+	// Wayback, when set, is sent the image URLs not seen before so that the
+	// Internet Archive keeps a public copy
+	Wayback *Wayback
+
+	// Manifest, when set, records what is done with each image
+	Manifest *RunManifest
+
+	// Run, when set, is the ID of the crawler run recorded by a ResponseLog, which
+	// the items and the files downloaded are linked to
+	Run string
+
+	// FirstSync bounds the downloads of the first sync of the game
+	FirstSync FirstSyncOptions
+
+	// Names, when set, names the images of the items not downloaded yet
+	Names NameTemplate
+}
+
+// SyncItems brings the library up to date with the items listed by an API: every
+// variant not downloaded yet, or whose URL changed, is queued and downloaded. With
+// Catalog the variants are only recorded. Items on the skip list, URLs marked dead,
+// and images the Filter rejects, are skipped. Signed URLs are recorded without
+// their signature, see QueueOptions.Resolve. Files are named after the title in
+// the preferred locale when the item has one, or by the Names template. Entries
+// the API renumbered are renamed first, see RemapItems. The collections are
+// updated last. The first sync of a game is downloaded in batches, see
+// FirstSyncOptions.
+func SyncItems(db *sql.DB, items []Item, opts SyncOptions) error {
+	locale, err := PreferredLocale(db)
+	if err != nil {
+		return err
+	}
+
+	if err := RemapItems(db, items); err != nil {
+		return err
+	}
+	// whether the game is new to the library, known before its images are queued
+	var batches int
+	var first bool
+	if len(items) > 0 && !opts.Catalog && opts.FirstSync.BatchSize > 0 {
+		if batches, first, err = firstSyncBatch(db, items[0].Game); err != nil {
+			return err
+		}
+	}
+	if opts.Manifest != nil {
+		defer Subscribe(opts.Manifest.Handle)()
+	}
+
+	var skips skipList
+	if len(items) > 0 {
+		if skips, err = loadSkipList(db, items[0].Game); err != nil {
+			return err
+		}
+	}
+
+	var n, skipped, filtered, skipListed int
+	var discovered []string
+	var listed []any
+	for _, it := range items {
+		name := opts.Names.fileName(it.localized(locale))
+		id, err := SaveItem(db, it)
+		if err != nil {
+			logger.Printf("Error saving %s: %v", name, err)
+			continue
+		}
+		listed = append(listed, id)
+
+		// items on the skip list are recorded but none of their images is queued
+		if _, ok := skips.match(it); ok {
+			for _, v := range it.Variants {
+				if v.URL != "" {
+					skipListed++
+					opts.Manifest.decide(Job{Game: it.Game, Region: regionOrGlobal(it.Region), IdGallery: it.ID, Type: v.Kind, FileName: name, URL: storableURL(v.URL)}, DecisionSkipList)
+				}
+			}
+			continue
+		}
+
+		for _, v := range it.Variants {
+			if v.URL == "" {
+				continue
+			}
+			url := storableURL(v.URL)
+			job := Job{
+				Game:      it.Game,
+				Region:    regionOrGlobal(it.Region),
+				IdGallery: it.ID,
+				Type:      v.Kind,
+				FileName:  name,
+				URL:       url,
+				Metadata:  it.Metadata,
+			}
+			if opts.Wayback != nil {
+				known, err := knownURL(db, job)
+				if err != nil {
+					return err
+				}
+				if !known {
+					discovered = append(discovered, url)
+				}
+			}
+
+			if opts.Catalog {
+				saved, err := CatalogGalleryItem(db, GalleryItem{
+					IdGallery: it.ID,
+					Game:      it.Game,
+					Region:    job.Region,
+					Type:      v.Kind,
+					FileName:  name,
+					URL:       url,
+					Metadata:  it.Metadata,
+				})
+				if err != nil {
+					logger.Printf("Error cataloging %s: %v", name, err)
+				} else if saved {
+					n++
+				}
+				opts.Manifest.decide(job, DecisionCataloged)
+				continue
+			}
+
+			// URLs gone for good are not tried again
+			dead, err := IsDeadLink(db, url)
+			if err != nil {
+				return err
+			}
+			if dead {
+				skipped++
+				opts.Manifest.decide(job, DecisionDeadLink)
+				continue
+			}
+
+			if opts.Filter != nil {
+				downloaded, err := downloadedURL(db, job)
+				if err != nil {
+					return err
+				}
+				if !downloaded {
+					keep, err := opts.Filter.Keep(context.Background(), it, v)
+					if err != nil {
+						logger.Printf("Error filtering %s: %v", name, err)
+					}
+					if !keep {
+						filtered++
+						opts.Manifest.decide(job, DecisionFiltered)
+						continue
+					}
+				}
+			}
+
+			dir := opts.Dir
+			if sub, ok := opts.KindDirs[v.Kind]; ok {
+				dir = filepath.Join(dir, sub)
+			}
+			if err := makeDirs(dir); err != nil {
+				return fmt.Errorf("failed to create folder: %w", err)
+			}
+
+			job.Dir = dir
+			if opts.Candidates != nil {
+				job.Candidates = opts.Candidates(url)
+			}
+			queued, err := EnqueueJob(db, job)
+			if err != nil {
+				logger.Printf("Error enqueuing %s: %v", name, err)
+			} else if queued {
+				publish(jobEvent(EventItemDiscovered, job))
+				opts.Manifest.decide(job, DecisionQueued)
+				n++
+			} else {
+				opts.Manifest.decide(job, DecisionPresent)
+			}
+		}
+	}
+
+	if err := markListed(db, listed, opts.Run); err != nil {
+		return err
+	}
+
+	// the archive is rate limited, so its submissions run next to the downloads
+	var wg sync.WaitGroup
+	if len(discovered) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			opts.Wayback.SubmitAll(discovered)
+		}()
+	}
+	defer wg.Wait()
+
+	completed := Event{Kind: EventSyncCompleted, Counts: map[string]int{"queued": n, "filtered": filtered, "dead_links": skipped, "skip_list": skipListed}}
+	if len(items) > 0 {
+		completed.Game = items[0].Game
+	}
+	if opts.Catalog {
+		logger.Printf("Cataloged %d images", n)
+		updateCollections(db)
+		completed.Counts = map[string]int{"cataloged": n}
+		publish(completed)
+		return nil
+	}
+	logger.Printf("Queued %d images", n)
+	if filtered > 0 {
+		logger.Printf("Filtered out %d images", filtered)
+	}
+	if skipped > 0 {
+		logger.Printf("Skipped %d dead links, see yostar-wallpaper list --dead", skipped)
+	}
+	if skipListed > 0 {
+		logger.Printf("Skipped %d images on the skip list, see yostar-wallpaper skip list", skipListed)
+	}
+	if first {
+		err = runFirstSync(db, items[0].Game, batches, opts)
+	} else {
+		err = RunJobs(db, opts.Queue)
+	}
+	if err != nil {
+		return err
+	}
+	updateCollections(db)
+	publish(completed)
+	return nil
+}
+
+// updateCollections updates the collections after a sync, so that smart ones gain
+// the new wallpapers and their folders the files. Failing to is not a failure of
+// the sync.
+func updateCollections(db *sql.DB) {
+	if err := UpdateCollections(db); err != nil {
+		logger.Printf("Error updating collections: %v", err)
+	}
+}
+
+// markListed records that the API listed the items with the IDs, in run when not empty
+func markListed(db *sql.DB, ids []any, run string) error {
+	for len(ids) > 0 {
+		// sqlite limits the number of parameters of a statement
+		chunk := ids[:min(len(ids), 500)]
+		ids = ids[len(chunk):]
+		_, err := db.Exec("UPDATE items SET listed_at = CURRENT_TIMESTAMP, listed_run = COALESCE(NULLIF(?, ''), listed_run) WHERE id IN (?"+strings.Repeat(", ?", len(chunk)-1)+")",
+			append([]any{run}, chunk...)...)
+		if err != nil {
+			return fmt.Errorf("failed to mark items listed: %w", err)
+		}
+	}
+	return nil
+}
+
+// knownURL reports whether the library already has the image of the job at its URL
+func knownURL(db *sql.DB, job Job) (bool, error) {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM gallery WHERE game = ? AND region = ? AND id_gallery = ? AND type = ? AND url = ?",
+		job.Game, job.Region, job.IdGallery, job.Type, job.URL).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up %s: %w", job.URL, err)
+	}
+	return n > 0, nil
+}
+
+// downloadedURL reports whether the image of the job was downloaded from its URL
+func downloadedURL(db *sql.DB, job Job) (bool, error) {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM gallery WHERE game = ? AND region = ? AND id_gallery = ? AND type = ? AND url = ? AND cataloged = 0",
+		job.Game, job.Region, job.IdGallery, job.Type, job.URL).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up %s: %w", job.URL, err)
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,58 @@
+package crawal
+
+import "testing"
+
+// TestSaveItemRegions checks that the same gallery ID listed by the APIs of two
+// regions is recorded as two entries, each with its own files and jobs
+func TestSaveItemRegions(t *testing.T) {
+	db := newPageTestDB(t, 0)
+
+	global := Item{Game: "arknights", ID: "7", Title: "global"}
+	jp := Item{Game: "arknights", Region: RegionJP, ID: "7", Title: "jp"}
+	globalID, err := SaveItem(db, global)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jpID, err := SaveItem(db, jp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if globalID == jpID {
+		t.Fatalf("jp entry saved over the global one, both %d", globalID)
+	}
+
+	for _, it := range []Item{global, jp} {
+		queued, err := EnqueueJob(db, Job{Game: it.Game, Region: it.Region, IdGallery: it.ID, Type: "wallpaper",
+			FileName: it.Title, URL: "https://cdn.example/" + it.Title + ".png"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !queued {
+			t.Errorf("%s job not queued", it.Title)
+		}
+	}
+	jobs, err := ListJobs(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 || jobs[0].Region != RegionGlobal || jobs[1].Region != RegionJP {
+		t.Errorf("got jobs %+v, want one global and one jp", jobs)
+	}
+
+	for _, it := range []Item{global, jp} {
+		err := SaveGalleryItem(db, GalleryItem{Game: it.Game, Region: it.Region, IdGallery: it.ID, Type: "wallpaper",
+			FileName: it.Title, URL: "https://cdn.example/" + it.Title + ".png", Cataloged: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, it := range []Item{global, jp} {
+		item, err := GetGalleryItem(db, it.Game, it.Region, it.ID, "wallpaper")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.Title != it.Title || item.Region != regionOrGlobal(it.Region) {
+			t.Errorf("got %s wallpaper %q, want %q", item.Region, item.Title, it.Title)
+		}
+	}
+}
@@ -0,0 +1,936 @@
+package crawal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// States of download jobs
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// jobsPausedSetting is the setting pausing all download jobs
+const jobsPausedSetting = "jobs_paused"
+
+// jobPollInterval is how often idle workers look for jobs added by other processes
+const jobPollInterval = 5 * time.Second
+
+// staleJobTimeout is how long a job may stay running before it is considered abandoned
+// by a crashed process and queued again
+const staleJobTimeout = 5 * time.Minute
+
+// Job is the download of a wallpaper image, stored in the download_jobs table
+type Job struct {
+	ID        int64
+	Game      string
+	Region    string // region of the game API the item was listed by, global when empty
+	IdGallery string
+	Type      string
+	FileName  string
+	URL       string
+	Dir       string // folder the file is saved into, <folder of the queue>/<game>/<type> when empty
+	Metadata  string // JSON of the API entry
+	Size      int64  // size announced by the server before downloading, 0 when unknown
+
+	// Candidates are alternate URLs of the image, such as higher resolution files,
+	// tried in order before URL
+	Candidates []string
+
+	Priority int // higher priorities are downloaded first
+	Paused   bool
+	State    string
+	Error    string // error of the last attempt when failed
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// jobColumns are the download_jobs columns read by scanJob
+const jobColumns = "id, game, region, id_gallery, type, file_name, url, dir, metadata, size, candidates, priority, paused, state, error, created_at, updated_at"
+
+// scanJob reads a row selected with jobColumns
+func scanJob(row rowScanner) (Job, error) {
+	var job Job
+	var candidates string
+	err := row.Scan(&job.ID, &job.Game, &job.Region, &job.IdGallery, &job.Type, &job.FileName, &job.URL, &job.Dir, &job.Metadata, &job.Size, &candidates,
+		&job.Priority, &job.Paused, &job.State, &job.Error, &job.CreatedAt, &job.UpdatedAt)
+	if candidates != "" {
+		job.Candidates = strings.Split(candidates, "\n")
+	}
+	job.Dir = resolvePath(job.Dir)
+	return job, err
+}
+
+// EnqueueJob adds a download job to the queue. It reports false when the image is
+// already queued or running, already downloaded from the same URL, or its file is
+// pinned by RevertRevision. The checks and the insert are a single statement, so
+// concurrent producers never queue an image twice.
+func EnqueueJob(db *sql.DB, job Job) (bool, error) {
+	res, err := db.Exec(`
+		INSERT INTO download_jobs(game, region, id_gallery, type, file_name, url, dir, metadata, candidates, priority, paused)
+		SELECT ?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10, ?11
+		WHERE NOT EXISTS (
+			SELECT 1 FROM gallery
+			WHERE game = ?1 AND region = ?2 AND id_gallery = ?3 AND type = ?4 AND ((url = ?6 AND cataloged = 0) OR pinned = 1)
+		)
+		ON CONFLICT DO NOTHING`,
+		job.Game, regionOrGlobal(job.Region), job.IdGallery, job.Type, job.FileName, job.URL, storedPath(job.Dir), job.Metadata,
+		strings.Join(job.Candidates, "\n"), job.Priority, job.Paused)
+	if err != nil {
+		return false, fmt.Errorf("failed to enqueue %s: %w", job.FileName, err)
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// EnqueueDownload adds a download job for a cataloged wallpaper with the given priority.
+// It reports false when the wallpaper is already queued.
+func EnqueueDownload(db *sql.DB, id int64, priority int) (bool, error) {
+	item, err := GetGalleryItemByID(db, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up wallpaper: %w", err)
+	}
+	if !item.Cataloged {
+		return false, fmt.Errorf("wallpaper %d is already downloaded", id)
+	}
+
+	return EnqueueJob(db, Job{
+		Game:      item.Game,
+		Region:    item.Region,
+		IdGallery: item.IdGallery,
+		Type:      item.Type,
+		FileName:  item.FileName,
+		URL:       item.URL,
+		Metadata:  item.Metadata,
+		Priority:  priority,
+	})
+}
+
+// ListJobs returns the jobs in the given states, or all of them, in the order they are processed
+func ListJobs(db *sql.DB, states ...string) ([]Job, error) {
+	query := "SELECT " + jobColumns + " FROM download_jobs"
+	var args []any
+	if len(states) > 0 {
+		query += " WHERE state IN (?" + strings.Repeat(", ?", len(states)-1) + ")"
+		for _, state := range states {
+			args = append(args, state)
+		}
+	}
+	query += " ORDER BY priority DESC, id"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list download jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// SetJobPriority changes the priority of a job
+func SetJobPriority(db *sql.DB, id int64, priority int) error {
+	return updateJob(db, id, "priority = ?", priority)
+}
+
+// PauseJob pauses or resumes a single job
+func PauseJob(db *sql.DB, id int64, paused bool) error {
+	return updateJob(db, id, "paused = ?", paused)
+}
+
+// RetryJob queues a failed job again
+func RetryJob(db *sql.DB, id int64) error {
+	res, err := db.Exec("UPDATE download_jobs SET state = ?, error = '' WHERE id = ? AND state = ?", JobQueued, id, JobFailed)
+	if err != nil {
+		return fmt.Errorf("failed to retry download job: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("download job %d has not failed", id)
+	}
+	return nil
+}
+
+// RemoveJob removes a job that is not running from the queue
+func RemoveJob(db *sql.DB, id int64) error {
+	if _, err := db.Exec("DELETE FROM download_jobs WHERE id = ? AND state != ?", id, JobRunning); err != nil {
+		return fmt.Errorf("failed to remove download job: %w", err)
+	}
+	return nil
+}
+
+// PauseJobs pauses or resumes all download jobs
+func PauseJobs(db *sql.DB, paused bool) error {
+	return SetSetting(db, jobsPausedSetting, fmt.Sprint(paused))
+}
+
+// JobsPaused reports whether all download jobs are paused
+func JobsPaused(db *sql.DB) (bool, error) {
+	value, err := GetSetting(db, jobsPausedSetting, "false")
+	return value == "true", err
+}
+
+// updateJob sets a column of a job
+func updateJob(db *sql.DB, id int64, set string, value any) error {
+	res, err := db.Exec("UPDATE download_jobs SET "+set+" WHERE id = ?", value, id)
+	if err != nil {
+		return fmt.Errorf("failed to update download job: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("no such download job %d", id)
+	}
+	return nil
+}
+
+// QueueOptions configures the workers of a DownloadQueue
+type QueueOptions struct {
+	Dir     string // folder of jobs without their own, "." when empty
+	Dedupe  string // dedupe mode of downloaded files
+	Workers int
+	Tagger  Tagger // optional, tags each downloaded image
+	OCR     OCR    // optional, recognizes the text of each downloaded image
+	Hook    *Hook  // optional, run on each downloaded file before it is recorded
+
+	// MaxWorkers, when above MinWorkers, lets the queue scale its workers between
+	// them, starting from Workers: one more at each interval the throughput holds,
+	// half as many when downloads fail, as when the CDN throttles
+	MinWorkers int // 1 when 0
+	MaxWorkers int
+
+	// Optimizer, when set, shrinks each downloaded file losslessly; the size it had
+	// before is recorded as its original size
+	Optimizer Optimizer
+
+	// Transcode, when set, converts the AVIF and JPEG XL files downloaded, which
+	// older wallpaper tools cannot read, replacing them
+	Transcode Codec
+
+	// Content, when set, excludes the images new to the library by their content,
+	// such as NSFW ones, see ContentFilter
+	Content *ContentFilter
+
+	// Preflight sends HEAD requests for all queued jobs before RunJobs downloads them,
+	// to know the total size and leave out dead links
+	Preflight bool
+
+	// Limit, when above 0, makes RunJobs return once it claimed that many jobs
+	Limit int
+
+	// Window holds the downloads back during quiet hours or on a metered network
+	Window DownloadWindow
+
+	// Peer is the URL of the yostar-wallpaper serve of another machine, whose library
+	// the images are copied from when it has them instead of downloaded from the CDN
+	Peer string
+
+	// Resolve, when set, looks the image of each job up through the API right before
+	// it is downloaded, so that the job of a signed URL, recorded without its
+	// signature, is downloaded from a fresh one, even when retried days later
+	Resolve URLResolver
+
+	// Downloads are recorded in transactions of up to BatchSize of them, committed at
+	// least every BatchInterval. 1 records each download on its own.
+	BatchSize     int           // defaultBatchSize when 0
+	BatchInterval time.Duration // defaultBatchInterval when 0
+}
+
+// DownloadQueue runs download jobs with a pool of workers, by priority and
+// skipping paused jobs. Jobs are claimed atomically, so several processes can
+// share the queue.
+type DownloadQueue struct {
+	db    *sql.DB
+	opts  QueueOptions
+	drain bool // stop the workers once no job is left
+
+	scaler    *workerScaler // adapts the workers running jobs, between bounds equal when fixed
+	workersMu sync.Mutex
+	started   int // workers started, of which the scaler allows some to run jobs
+
+	windowMu sync.Mutex
+	window   DownloadWindow
+	holding  string   // why downloads were held at the last claim
+	lowPower LowPower // mode read at the last claim
+	readOnce bool     // whether lowPower was read
+
+	drained   chan struct{} // closed once a worker found no job left when draining
+	drainOnce sync.Once
+	claimed   atomic.Int64 // jobs claimed, up to QueueOptions.Limit
+
+	progress *progress // logged after each job when draining
+
+	batch   *batch
+	flushed chan struct{}  // closed once the last batch is committed
+	names   pendingNames   // file names of the downloads not committed yet
+	post    sync.WaitGroup // tagging and OCR of committed batches
+	tagged  sync.Map       // tags given by the content filter, by job ID, stored by analyze
+
+	wake   chan struct{}
+	done   chan struct{}
+	wg     sync.WaitGroup
+	closed sync.Once
+}
+
+// NewDownloadQueue starts workers running the queued jobs until Close
+func NewDownloadQueue(db *sql.DB, opts QueueOptions) (*DownloadQueue, error) {
+	return startQueue(db, opts, false)
+}
+
+// RunJobs runs the queued jobs and returns once none is left. It fails when all
+// jobs are paused.
+func RunJobs(db *sql.DB, opts QueueOptions) error {
+	if paused, err := JobsPaused(db); err != nil || paused {
+		if err == nil {
+			err = errors.New("download jobs are paused")
+		}
+		return err
+	}
+
+	if opts.Preflight {
+		report, err := Preflight(db, opts.Workers)
+		if err != nil {
+			return err
+		}
+		logger.Printf("Preflight: %d images, %s announced, %d of unknown size, %d dead links, %d error pages",
+			report.Checked, FormatBytes(report.TotalBytes), report.Unknown, len(report.Dead), len(report.ErrorPages))
+		for _, job := range report.Dead {
+			logger.Printf("Dead link: %s (%s)", job.URL, job.FileName)
+		}
+		for _, job := range report.ErrorPages {
+			logger.Printf("Error page: %s (%s)", job.URL, job.FileName)
+		}
+	}
+
+	q, err := startQueue(db, opts, true)
+	if err != nil {
+		return err
+	}
+
+	// Ctrl+C stops the workers once their current download is done
+	ctx, release := Graceful()
+	defer release()
+	go func() {
+		select {
+		case <-ctx.Done():
+			q.closed.Do(func() { close(q.done) })
+		case <-q.flushed:
+		}
+	}()
+	q.wg.Wait()
+	q.Close()
+	if ctx.Err() != nil {
+		return ErrInterrupted
+	}
+	return nil
+}
+
+// startQueue requeues the jobs abandoned by crashed processes and starts the workers
+func startQueue(db *sql.DB, opts QueueOptions, drain bool) (*DownloadQueue, error) {
+	if opts.Dedupe == "" {
+		opts.Dedupe = DedupeLink
+	}
+	if err := CheckDedupeMode(opts.Dedupe); err != nil {
+		return nil, err
+	}
+	if opts.Dir == "" {
+		opts.Dir = "."
+	}
+	opts.Workers = max(opts.Workers, 1)
+	opts.MinWorkers = max(opts.MinWorkers, 1)
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	if opts.BatchInterval <= 0 {
+		opts.BatchInterval = defaultBatchInterval
+	}
+
+	_, err := db.Exec("UPDATE download_jobs SET state = ? WHERE state = ? AND updated_at < datetime('now', ?)",
+		JobQueued, JobRunning, fmt.Sprintf("-%d seconds", int(staleJobTimeout.Seconds())))
+	if err != nil {
+		return nil, fmt.Errorf("failed to recover download jobs: %w", err)
+	}
+
+	q := &DownloadQueue{
+		db:     db,
+		opts:   opts,
+		drain:  drain,
+		window: opts.Window,
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+
+		drained: make(chan struct{}),
+		flushed: make(chan struct{}),
+	}
+	q.batch = &batch{db: db, size: opts.BatchSize, saved: q.saved}
+	if drain {
+		if q.progress, err = newProgress(db); err != nil {
+			return nil, err
+		}
+	}
+	q.scaler = &workerScaler{}
+	q.SetWorkers(opts.Workers, opts.MinWorkers, opts.MaxWorkers)
+	go q.scaler.run(q.flushed)
+	go q.flushEvery(opts.BatchInterval)
+	return q, nil
+}
+
+// SetWindow changes the download window of a running queue
+func (q *DownloadQueue) SetWindow(w DownloadWindow) {
+	q.windowMu.Lock()
+	q.window = w
+	q.windowMu.Unlock()
+	q.Notify()
+}
+
+// Held returns why the download window holds the downloads back now, empty when
+// they may run
+func (q *DownloadQueue) Held() string {
+	q.windowMu.Lock()
+	defer q.windowMu.Unlock()
+	return q.window.Hold(time.Now())
+}
+
+// held reports whether the download window holds the downloads back, logging when
+// it starts or stops doing so
+func (q *DownloadQueue) held() bool {
+	q.windowMu.Lock()
+	defer q.windowMu.Unlock()
+	reason := q.window.Hold(time.Now())
+	if reason != q.holding {
+		if reason != "" {
+			logger.Printf("Downloads held: %s", reason)
+		} else {
+			logger.Printf("Downloads resumed")
+		}
+		q.holding = reason
+	}
+	return reason != ""
+}
+
+// readLowPower reads the low-power mode, applying its bandwidth limit and logging
+// when it is turned on or off. The last mode read is kept when it cannot be read.
+func (q *DownloadQueue) readLowPower() LowPower {
+	lp, err := GetLowPower(q.db)
+	q.windowMu.Lock()
+	defer q.windowMu.Unlock()
+	if err != nil {
+		logger.Printf("Error reading the low-power mode: %v", err)
+		return q.lowPower
+	}
+	if lp != q.lowPower || !q.readOnce {
+		var rate int64
+		switch {
+		case lp.On:
+			logger.Printf("Low-power mode: %s", lp)
+			rate = lp.RateLimit
+		case q.lowPower.On:
+			logger.Printf("Low-power mode off")
+		}
+		rateLimit.set(rate)
+		q.lowPower, q.readOnce = lp, true
+	}
+	return lp
+}
+
+// lowPowerMaxSize returns the size over which downloads are deferred, 0 for none
+func (q *DownloadQueue) lowPowerMaxSize() int64 {
+	q.windowMu.Lock()
+	defer q.windowMu.Unlock()
+	if !q.lowPower.On {
+		return 0
+	}
+	return q.lowPower.MaxSize
+}
+
+// deferJob queues a job again, recording its size, or the bytes it had when its
+// size is unknown, so that it is left out until the low-power mode is off
+func (q *DownloadQueue) deferJob(job Job, size int64) {
+	_, err := q.db.Exec("UPDATE download_jobs SET state = ?, size = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", JobQueued, size, job.ID)
+	if err != nil {
+		logger.Printf("Error deferring the download job of %s: %v", job.FileName, err)
+	}
+}
+
+// SetWorkers changes the concurrent downloads of a running queue, as Workers,
+// MinWorkers and MaxWorkers of QueueOptions do when it starts. Workers are started
+// as needed; the ones no longer needed stop running jobs once their current one
+// is done.
+func (q *DownloadQueue) SetWorkers(workers, low, high int) {
+	workers, low = max(workers, 1), max(low, 1)
+	if high > low {
+		q.scaler.set(workers, low, high)
+		workers = high
+	} else {
+		q.scaler.set(workers, workers, workers)
+	}
+
+	q.workersMu.Lock()
+	defer q.workersMu.Unlock()
+	select {
+	case <-q.done:
+		return
+	case <-q.drained:
+		return
+	default:
+	}
+	for ; q.started < workers; q.started++ {
+		q.wg.Add(1)
+		go q.work(q.started)
+	}
+}
+
+// flushEvery commits the batch of downloads at every interval, and once more after
+// the workers stopped
+func (q *DownloadQueue) flushEvery(interval time.Duration) {
+	defer close(q.flushed)
+	stopped := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(stopped)
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			q.batch.flush()
+		case <-stopped:
+			q.batch.flush()
+			return
+		}
+	}
+}
+
+// saved publishes the images of a committed batch as added, and tags and recognizes
+// their text next to the downloads
+func (q *DownloadQueue) saved(batch []finished) {
+	for _, f := range batch {
+		item, err := GetGalleryItem(q.db, f.job.Game, f.job.Region, f.job.IdGallery, f.job.Type)
+		if err != nil {
+			logger.Printf("Error reading %s back: %v", f.job.FileName, err)
+			continue
+		}
+		e := jobEvent(EventItemAdded, f.job)
+		e.ID, e.Path, e.Size = item.ID, item.Path, item.Size
+		publish(e)
+	}
+	if q.opts.Tagger == nil && q.opts.OCR == nil {
+		return
+	}
+	q.post.Add(1)
+	go func() {
+		defer q.post.Done()
+		for _, f := range batch {
+			q.analyze(f.job, f.item)
+		}
+	}()
+}
+
+// Notify wakes up idle workers after jobs have been added or changed
+func (q *DownloadQueue) Notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops the workers once their current job is done and records the downloads
+// still waiting in a batch. Queued jobs stay in the database for the next run.
+func (q *DownloadQueue) Close() {
+	q.closed.Do(func() { close(q.done) })
+	q.wg.Wait()
+	<-q.flushed
+	q.post.Wait()
+}
+
+// work runs queued jobs as the worker numbered i until the queue is closed, or is
+// empty when draining. It waits while the scaler does not allow it to run jobs.
+func (q *DownloadQueue) work(i int) {
+	defer q.wg.Done()
+
+	for {
+		if !q.scaler.allows(i) {
+			select {
+			case <-q.done:
+				return
+			case <-q.drained:
+				return
+			case <-time.After(jobPollInterval):
+			}
+			continue
+		}
+
+		job, ok, err := q.next(i)
+		if err != nil {
+			logger.Printf("Error claiming a download job: %v", err)
+		}
+		if !ok {
+			if q.drain && err == nil {
+				q.drainOnce.Do(func() { close(q.drained) })
+				return
+			}
+			select {
+			case <-q.done:
+				return
+			case <-q.wake:
+			case <-time.After(jobPollInterval):
+			}
+			continue
+		}
+
+		// Downloaded images are recorded with the next batch, which also finishes
+		// their job; failed and already downloaded ones are finished right away
+		item, err := q.run(job)
+		if err == nil && item != nil {
+			err = q.batch.add(job, *item)
+		}
+		var deferred *deferredError
+		switch {
+		case err != nil && forced():
+			// cancelled, downloaded again at the next run
+			q.finish(job, JobQueued, "")
+		case errors.As(err, &deferred):
+			logger.Printf(`-> "%s" deferred, %v <-`, job.FileName, deferred)
+			q.deferJob(job, deferred.size)
+		case err != nil:
+			var corrupt *CorruptError
+			if errors.As(err, &corrupt) && corrupt.Path != "" {
+				logger.Printf(`-> "%s" quarantined in %s: %v <-`, job.FileName, corrupt.Path, corrupt.Err)
+				if err := quarantineJob(q.db, job, corrupt); err != nil {
+					logger.Printf("Error recording the quarantine of %s: %v", job.FileName, err)
+				}
+			}
+			e := jobEvent(EventDownloadFailed, job)
+			e.Error = err.Error()
+			publish(e)
+			q.finish(job, JobFailed, err.Error())
+			if status := goneStatus(err); status != 0 {
+				if err := recordGoneLink(q.db, job, status); err != nil {
+					logger.Printf("Error recording the dead link of %s: %v", job.FileName, err)
+				}
+			}
+		case item == nil:
+			q.finish(job, JobDone, "")
+			if err := forgetGoneLink(q.db, job.URL); err != nil {
+				logger.Printf("Error clearing the dead link of %s: %v", job.FileName, err)
+			}
+		}
+		if q.progress != nil {
+			q.progress.done(job)
+		}
+		var size int64
+		if item != nil {
+			size = item.Size
+		}
+		// dead links and deferred files say nothing about the load of the CDN
+		q.scaler.record(size, err != nil && goneStatus(err) == 0 && deferred == nil)
+
+		select {
+		case <-q.done:
+			return
+		default:
+		}
+	}
+}
+
+// resolve returns the URL the image of a job is downloaded from: the URL listed by
+// the API now when it is the same image, freshly signed, else the URL of the job
+func (q *DownloadQueue) resolve(job Job) string {
+	if q.opts.Resolve == nil {
+		return job.URL
+	}
+	u, err := q.opts.Resolve(job)
+	if err != nil {
+		logger.Printf("Error resolving %s through the API: %v", job.FileName, err)
+		return job.URL
+	}
+	if u != job.URL && storableURL(u) == job.URL {
+		return u
+	}
+	return job.URL
+}
+
+// finish records the final state of a job
+func (q *DownloadQueue) finish(job Job, state, msg string) {
+	_, err := q.db.Exec("UPDATE download_jobs SET state = ?, error = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", state, msg, job.ID)
+	if err != nil {
+		logger.Printf("Error finishing the download job of %s: %v", job.FileName, err)
+	}
+}
+
+// next claims the next job for the worker numbered i, none once the queue claimed
+// QueueOptions.Limit jobs
+func (q *DownloadQueue) next(i int) (Job, bool, error) {
+	if q.opts.Limit <= 0 {
+		return q.claim(i)
+	}
+	if q.claimed.Add(1) > int64(q.opts.Limit) {
+		return Job{}, false, nil
+	}
+	job, ok, err := q.claim(i)
+	if !ok {
+		q.claimed.Add(-1)
+	}
+	return job, ok, err
+}
+
+// claim marks the next queued job as running for the worker numbered i, unless all
+// jobs are paused or held back, or i is not the first worker in low-power mode,
+// which also leaves out the jobs known to be too large. The single UPDATE
+// statement makes the claim atomic across workers and processes.
+func (q *DownloadQueue) claim(i int) (Job, bool, error) {
+	if paused, err := JobsPaused(q.db); err != nil || paused {
+		return Job{}, false, err
+	}
+	if q.held() {
+		return Job{}, false, nil
+	}
+	lp := q.readLowPower()
+	if lp.On && i > 0 {
+		return Job{}, false, nil
+	}
+	var maxSize int64
+	if lp.On {
+		maxSize = lp.MaxSize
+	}
+
+	job, err := scanJob(q.db.QueryRow(`
+		UPDATE download_jobs SET state = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id FROM download_jobs WHERE state = ? AND paused = 0 AND (? = 0 OR size <= ?)
+			ORDER BY priority DESC, id LIMIT 1
+		)
+		RETURNING `+jobColumns, JobRunning, JobQueued, maxSize, maxSize))
+	if err == sql.ErrNoRows {
+		return Job{}, false, nil
+	}
+	if err != nil {
+		return Job{}, false, err
+	}
+	return job, true, nil
+}
+
+// run downloads the image of a job and returns it, ready to be recorded in the
+// library, or nil when the library already has it
+func (q *DownloadQueue) run(job Job) (*GalleryItem, error) {
+	// Look at the library now rather than when the job was queued, since other
+	// jobs may have downloaded the image in the meantime
+	existing, err := GetGalleryItem(q.db, job.Game, job.Region, job.IdGallery, job.Type)
+	fresh := err == sql.ErrNoRows || (err == nil && existing.Cataloged)
+	// replaced is the file of a wallpaper whose URL changed, kept as a revision once
+	// the new upload is downloaded; empty when it is not on disk
+	replaced := ""
+	switch {
+	case err == sql.ErrNoRows || (err == nil && existing.Cataloged):
+	case err != nil:
+		return nil, fmt.Errorf("failed to look up wallpaper: %w", err)
+	case existing.URL == job.URL:
+		logger.Printf(`-> "%s" is already downloaded <-`, job.FileName)
+		return nil, nil
+	case existing.Pinned:
+		// queued before the file was reverted, which the revert keeps
+		logger.Printf(`-> "%s" is pinned to a reverted revision <-`, job.FileName)
+		return nil, nil
+	case existing.Path != "":
+		if _, err := os.Stat(existing.Path); err == nil {
+			replaced = existing.Path
+		}
+	}
+
+	dir := job.Dir
+	if dir == "" {
+		dir = filepath.Join(q.opts.Dir, job.Game, job.Type)
+	}
+	if err := makeDirs(dir); err != nil {
+		return nil, fmt.Errorf("failed to create folder: %w", err)
+	}
+
+	// Name the file after the title, unless the file of another wallpaper has it
+	self := GalleryItem{Game: job.Game, Region: job.Region, IdGallery: job.IdGallery, Type: job.Type, FileName: job.FileName}
+	name, err := uniqueFileName(q.db, self, dir, &q.names)
+	if err != nil {
+		return nil, err
+	}
+
+	publish(jobEvent(EventDownloadStarted, job))
+
+	// A new upload is downloaded next to the file it replaces, which is only
+	// archived once the download succeeded
+	target := name
+	if replaced != "" {
+		target = name + redownloadSuffix
+	}
+
+	// Download the file from the peer library if it has it, else from the first
+	// alternate URL that resolves if any
+	var source, resolved string
+	filePath, err := downloadPeer(q.opts.Peer, job.URL, target, dir)
+	if err == nil && filePath == "" {
+		maxSize := q.lowPowerMaxSize()
+		filePath, source, resolved, err = downloadCandidates(job.Candidates, q.resolve(job), target, dir, func(written, total int64) error {
+			if maxSize > 0 && max(total, written) > maxSize {
+				return &deferredError{size: max(total, written)}
+			}
+			e := jobEvent(EventDownloadProgress, job)
+			e.Written, e.Size = written, total
+			publish(e)
+			return nil
+		})
+	}
+	if errors.Is(err, ErrConflictSkipped) {
+		logger.Printf(`-> "%s" skipped, a different file already has its name <-`, job.FileName)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if replaced != "" {
+		if _, err := ArchiveRevision(q.db, job.Game, job.Region, job.IdGallery, job.Type); err != nil {
+			os.Remove(filePath)
+			return nil, fmt.Errorf("failed to archive revision: %w", err)
+		}
+		os.Remove(ThumbnailPath(replaced))
+		p := filepath.Join(dir, name+filepath.Ext(filePath))
+		if err := os.Rename(filePath, p); err != nil {
+			return nil, fmt.Errorf("failed to replace file: %w", err)
+		}
+		filePath = p
+	}
+	if q.opts.Transcode != nil {
+		p, err := transcodeFile(context.Background(), q.opts.Transcode, filePath)
+		if err != nil {
+			logger.Printf("Error transcoding %s: %v", job.FileName, err)
+		} else if p != filePath {
+			logger.Printf(`-> transcoded "%s" into %s <-`, job.FileName, filepath.Ext(p))
+			filePath = p
+		}
+	}
+	if q.opts.Content != nil && fresh {
+		excluded, err := q.excludeContent(job, filePath)
+		if err != nil {
+			logger.Printf("Error filtering the content of %s: %v", job.FileName, err)
+		} else if excluded {
+			return nil, nil
+		}
+	}
+	item := GalleryItem{
+		IdGallery:   job.IdGallery,
+		Game:        job.Game,
+		Region:      job.Region,
+		Type:        job.Type,
+		FileName:    job.FileName,
+		URL:         job.URL,
+		SourceURL:   source,
+		ResolvedURL: resolved,
+		Path:        filePath,
+		Metadata:    job.Metadata,
+	}
+	e := jobEvent(EventDownloadFinished, job)
+	e.Path = filePath
+	if info, err := os.Stat(filePath); err == nil {
+		e.Size = info.Size()
+	}
+	publish(e)
+
+	// Optimize the file before it is hashed
+	if q.opts.Optimizer != nil {
+		before, after, err := optimizeFile(context.Background(), q.opts.Optimizer, filePath)
+		if err != nil {
+			logger.Printf("Error optimizing %s: %v", job.FileName, err)
+		} else if after < before {
+			item.OriginalSize = before
+			logger.Printf(`-> optimized "%s": %s -> %s <-`, job.FileName, FormatBytes(before), FormatBytes(after))
+		}
+	}
+
+	// Run the hook before recording the file, since it may rewrite it
+	if q.opts.Hook != nil {
+		if err := q.opts.Hook.Run(context.Background(), item); err != nil {
+			logger.Printf("Error running the hook on %s: %v", job.FileName, err)
+		}
+	}
+
+	// Check for duplicates already in the library, committing the batch first when
+	// an identical file is still waiting in it
+	dup, err := DedupeItem(q.db, &item, q.opts.Dedupe)
+	if err == nil && (dup == nil || !dup.Identical) && q.batch.has(item.SHA256) {
+		q.batch.flush()
+		dup, err = DedupeItem(q.db, &item, q.opts.Dedupe)
+	}
+	if err != nil {
+		logger.Printf("Error checking duplicates of %s: %v", job.FileName, err)
+	} else if dup != nil {
+		logger.Printf(`-> "%s" duplicates "%s", saved %d bytes <-`, job.FileName, dup.Of.FileName, dup.Saved)
+	}
+	return &item, nil
+}
+
+// excludeContent runs the content filter on the file of job, new to the library. An
+// excluded file is deleted and its item put on the skip list, so that it is not
+// downloaded again.
+func (q *DownloadQueue) excludeContent(job Job, filePath string) (bool, error) {
+	item := GalleryItem{IdGallery: job.IdGallery, Game: job.Game, Region: job.Region, Type: job.Type, FileName: job.FileName, URL: job.URL, Path: filePath}
+	reason, tags, err := q.opts.Content.exclude(context.Background(), q.opts.Tagger, item)
+	if err != nil {
+		return false, err
+	}
+	if reason == "" {
+		if tags != nil {
+			q.tagged.Store(job.ID, tags)
+		}
+		return false, nil
+	}
+
+	if err := os.Remove(filePath); err != nil {
+		logger.Printf("Error deleting %s: %v", filePath, err)
+	}
+	if _, err := AddSkip(q.db, SkipEntry{Game: job.Game, Kind: SkipID, Pattern: job.IdGallery, Reason: "content filter: " + reason}); err != nil {
+		logger.Printf("Error putting %s on the skip list: %v", job.FileName, err)
+	}
+	logger.Printf(`-> "%s" excluded by the content filter, %s <-`, job.FileName, reason)
+	return true, nil
+}
+
+// analyze tags and recognizes the text of a recorded image
+func (q *DownloadQueue) analyze(job Job, item GalleryItem) {
+	// Tag the new image, unless the content filter did
+	if tags, ok := q.tagged.LoadAndDelete(job.ID); ok {
+		if err := storeTags(q.db, q.opts.Tagger, item, tags.([]string)); err != nil {
+			logger.Printf("Error tagging %s: %v", job.FileName, err)
+		} else {
+			logger.Printf(`-> tagged "%s": %s <-`, job.FileName, strings.Join(tags.([]string), ", "))
+		}
+	} else if q.opts.Tagger != nil {
+		tags, err := TagGalleryItem(context.Background(), q.db, q.opts.Tagger, item)
+		if err != nil {
+			logger.Printf("Error tagging %s: %v", job.FileName, err)
+		} else {
+			logger.Printf(`-> tagged "%s": %s <-`, job.FileName, strings.Join(tags, ", "))
+		}
+	}
+
+	// Recognize the text of the new image
+	if q.opts.OCR != nil {
+		if _, err := RecognizeGalleryItem(context.Background(), q.db, q.opts.OCR, item); err != nil {
+			logger.Printf("Error recognizing text of %s: %v", job.FileName, err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package crawal
+
+import (
+	"database/sql"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// TestJobsConcurrent checks that the same image enqueued concurrently is queued
+// once, and that queues of two processes sharing the database claim it once
+func TestJobsConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "yostar-gallery.db")
+	dbs := make([]*sql.DB, 2)
+	for i := range dbs {
+		db, err := openDatabase(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		dbs[i] = db
+	}
+
+	job := Job{Game: "azur_lane", IdGallery: "1", Type: "wallpaper", FileName: "wallpaper 1", URL: "https://cdn.example/1.png"}
+	var wg sync.WaitGroup
+	var queued atomic.Int32
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(db *sql.DB) {
+			defer wg.Done()
+			ok, err := EnqueueJob(db, job)
+			if err != nil {
+				t.Error(err)
+			}
+			if ok {
+				queued.Add(1)
+			}
+		}(dbs[i%2])
+	}
+	wg.Wait()
+	jobs, err := ListJobs(dbs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queued.Load() != 1 || len(jobs) != 1 {
+		t.Fatalf("enqueued %d times, %d jobs, want 1", queued.Load(), len(jobs))
+	}
+
+	queues := []*DownloadQueue{{db: dbs[0]}, {db: dbs[1]}}
+	var claimed atomic.Int32
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(q *DownloadQueue, worker int) {
+			defer wg.Done()
+			_, ok, err := q.claim(worker)
+			if err != nil {
+				t.Error(err)
+			}
+			if ok {
+				claimed.Add(1)
+			}
+		}(queues[i%2], i/2)
+	}
+	wg.Wait()
+	if claimed.Load() != 1 {
+		t.Errorf("job claimed %d times, want 1", claimed.Load())
+	}
+	if jobs, err = ListJobs(dbs[1], JobRunning); err != nil || len(jobs) != 1 {
+		t.Errorf("%d running jobs, want 1 (%v)", len(jobs), err)
+	}
+}
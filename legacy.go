@@ -0,0 +1,84 @@
+package crawal
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// legacyDatabases are the per-game databases of earlier versions, merged into the
+// shared database when found next to it
+var legacyDatabases = []string{"data-aether-gazer.db"}
+
+// legacyMergedSuffix is appended to a legacy database once merged, so it is merged once
+const legacyMergedSuffix = ".merged"
+
+// mergeLegacyDatabases imports the wallpapers recorded in the legacy databases found in
+// dir, then renames them. Wallpapers the library already has are kept as they are.
+func mergeLegacyDatabases(db *sql.DB, dir string) error {
+	for _, name := range legacyDatabases {
+		p := filepath.Join(dir, name)
+		if _, err := os.Stat(p); err != nil {
+			continue
+		}
+		n, err := mergeLegacyDatabase(db, p)
+		if err != nil {
+			return fmt.Errorf("failed to merge %s: %w", p, err)
+		}
+		if err := os.Rename(p, p+legacyMergedSuffix); err != nil {
+			return err
+		}
+		logger.Printf("Merged %d wallpapers of %s, renamed to %s", n, p, p+legacyMergedSuffix)
+	}
+	return nil
+}
+
+// mergeLegacyDatabase imports the yostar_gallery rows of the database at p
+func mergeLegacyDatabase(db *sql.DB, p string) (int, error) {
+	legacy, err := sql.Open(sqliteDriver, readOnlyDSN(p))
+	if err != nil {
+		return 0, err
+	}
+	defer legacy.Close()
+
+	rows, err := legacy.Query("SELECT id_gallery, game, type, file_name, url, created_at FROM yostar_gallery ORDER BY id")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var items []GalleryItem
+	for rows.Next() {
+		var item GalleryItem
+		if err := rows.Scan(&item.IdGallery, &item.Game, &item.Type, &item.FileName, &item.URL, &item.CreatedAt); err != nil {
+			return 0, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var n int
+	for _, item := range items {
+		_, err := GetGalleryItem(db, item.Game, RegionGlobal, item.IdGallery, item.Type)
+		if err == nil {
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return n, err
+		}
+		if err := SaveGalleryItem(db, item); err != nil {
+			return n, err
+		}
+		_, err = db.Exec(`UPDATE files SET created_at = ? WHERE id = (
+			SELECT id FROM gallery WHERE game = ? AND region = 'global' AND id_gallery = ? AND type = ?
+		)`, item.CreatedAt.UTC().Format(sqliteTimeFormat), item.Game, item.IdGallery, item.Type)
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,50 @@
+package crawal
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// titleLocaleSetting holds the preferred locale of titles, read by the gallery view
+const titleLocaleSetting = "title_locale"
+
+// PreferredLocale returns the locale titles are shown and files named in, empty for
+// the default title of each API
+func PreferredLocale(db *sql.DB) (string, error) {
+	return GetSetting(db, titleLocaleSetting, "")
+}
+
+// SetPreferredLocale sets the locale titles are shown and new files named in
+func SetPreferredLocale(db *sql.DB, locale string) error {
+	return SetSetting(db, titleLocaleSetting, locale)
+}
+
+// ParseLocales splits a comma separated list of locales, e.g. "en,ja,zh"
+func ParseLocales(s string) []string {
+	var locales []string
+	for _, locale := range strings.Split(s, ",") {
+		if locale = strings.TrimSpace(locale); locale != "" {
+			locales = append(locales, locale)
+		}
+	}
+	return locales
+}
+
+// MergeTitles records the titles of localized, the same items as listed by the API
+// in another locale, as the titles of items in that locale
+func MergeTitles(items []Item, locale string, localized []Item) {
+	titles := make(map[string]string, len(localized))
+	for _, it := range localized {
+		titles[it.ID] = it.Title
+	}
+	for i := range items {
+		title := titles[items[i].ID]
+		if title == "" {
+			continue
+		}
+		if items[i].Titles == nil {
+			items[i].Titles = make(map[string]string)
+		}
+		items[i].Titles[locale] = title
+	}
+}
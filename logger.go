@@ -0,0 +1,26 @@
+package crawal
+
+import (
+	"io"
+	"log"
+)
+
+// logger receives what the library reports without failing, such as the progress of
+// the downloads or the errors of single images in a batch. It is the standard logger
+// unless SetLogger is called.
+var logger = log.Default()
+
+// SetLogger sends the output of the library to l, or discards it when l is nil. Call
+// it before using the library, since it is not synchronized with running downloads.
+func SetLogger(l *log.Logger) {
+	if l == nil {
+		l = log.New(io.Discard, "", 0)
+	}
+	logger = l
+}
+
+// Logf reports through the logger of the library, for the crawlers of the game
+// packages built on it
+func Logf(format string, v ...any) {
+	logger.Printf(format, v...)
+}
@@ -0,0 +1,141 @@
+package crawal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Settings of the low-power mode of the downloads
+const (
+	lowPowerSetting        = "low_power"
+	lowPowerRateSetting    = "low_power_rate"
+	lowPowerMaxSizeSetting = "low_power_max_size"
+)
+
+// DefaultLowPower are the limits of the low-power mode until they are set
+var DefaultLowPower = LowPower{RateLimit: 1 << 20, MaxSize: 10 << 20}
+
+// LowPower is the mode of the downloads for a laptop on battery or a metered
+// network: the queues run a single worker, download at most RateLimit bytes per
+// second, and defer files larger than MaxSize until it is turned off. It is stored
+// in the database, so that it applies to every process of the library.
+type LowPower struct {
+	On        bool
+	RateLimit int64 // bytes per second of all the downloads of a process, 0 for none
+	MaxSize   int64 // bytes, 0 for none
+}
+
+// String describes the limits of the mode
+func (lp LowPower) String() string {
+	limits := []string{"1 worker"}
+	if lp.RateLimit > 0 {
+		limits = append(limits, FormatBytes(lp.RateLimit)+"/s")
+	}
+	if lp.MaxSize > 0 {
+		limits = append(limits, "files over "+FormatBytes(lp.MaxSize)+" deferred")
+	}
+	return strings.Join(limits, ", ")
+}
+
+// GetLowPower returns the low-power mode of the library
+func GetLowPower(db *sql.DB) (LowPower, error) {
+	lp := DefaultLowPower
+	rows, err := db.Query("SELECT key, value FROM settings WHERE key IN (?, ?, ?)", lowPowerSetting, lowPowerRateSetting, lowPowerMaxSizeSetting)
+	if err != nil {
+		return lp, fmt.Errorf("failed to read the low-power mode: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return lp, err
+		}
+		switch key {
+		case lowPowerSetting:
+			lp.On = value == "true"
+		case lowPowerRateSetting:
+			lp.RateLimit, err = strconv.ParseInt(value, 10, 64)
+		case lowPowerMaxSizeSetting:
+			lp.MaxSize, err = strconv.ParseInt(value, 10, 64)
+		}
+		if err != nil {
+			return lp, fmt.Errorf("invalid setting %s: %w", key, err)
+		}
+	}
+	return lp, rows.Err()
+}
+
+// SetLowPower stores the low-power mode of the library. Running queues apply it
+// before their next download.
+func SetLowPower(db *sql.DB, lp LowPower) error {
+	if lp.RateLimit < 0 || lp.MaxSize < 0 {
+		return errors.New("the limits of the low-power mode cannot be negative")
+	}
+	return errors.Join(
+		SetSetting(db, lowPowerSetting, fmt.Sprint(lp.On)),
+		SetSetting(db, lowPowerRateSetting, fmt.Sprint(lp.RateLimit)),
+		SetSetting(db, lowPowerMaxSizeSetting, fmt.Sprint(lp.MaxSize)),
+	)
+}
+
+// deferredError stops the download of a file larger than the low-power mode allows
+type deferredError struct {
+	size int64
+}
+
+func (e *deferredError) Error() string {
+	return fmt.Sprintf("%s is over the size of the low-power mode", FormatBytes(e.size))
+}
+
+// rateLimit is the bandwidth limit of the downloads of the process, shared by its
+// queues since they share the bandwidth. It is only changed under its lock.
+var rateLimit limiter
+
+// limiter spreads the bytes read through it over time to keep under rate bytes
+// per second
+type limiter struct {
+	mu   sync.Mutex
+	rate int64     // 0 for none
+	next time.Time // when the bytes read so far are paid for
+}
+
+// set changes the rate of the limiter, 0 for none
+func (l *limiter) set(rate int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = rate
+}
+
+// wait blocks until n more bytes can be read
+func (l *limiter) wait(n int) {
+	l.mu.Lock()
+	if l.rate <= 0 || n <= 0 {
+		l.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(float64(n) / float64(l.rate) * float64(time.Second)))
+	delay := l.next.Sub(now)
+	l.mu.Unlock()
+	time.Sleep(delay)
+}
+
+// limitedReader reads through rateLimit
+type limitedReader struct {
+	io.Reader
+}
+
+func (r limitedReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	rateLimit.wait(n)
+	return n, err
+}
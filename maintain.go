@@ -0,0 +1,113 @@
+package crawal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// MaintenanceOptions selects the maintenance tasks to run
+type MaintenanceOptions struct {
+	Vacuum       bool
+	Thumbnails   bool
+	VerifySample int // number of random files to verify, 0 disables
+
+	// Filter scopes the thumbnails and the verified files to part of the library
+	Filter Filter
+}
+
+// MaintenanceReport summarizes a maintenance run
+type MaintenanceReport struct {
+	DBSizeBefore int64
+	DBSizeAfter  int64
+
+	ThumbnailsCreated int
+	ThumbnailsFailed  int
+
+	Verified int
+	Missing  []GalleryItem // files that no longer exist
+	Corrupt  []GalleryItem // files whose checksum changed
+
+	Duration time.Duration
+}
+
+// Maintain VACUUMs the database, regenerates missing thumbnails and spot-verifies the
+// checksums of a random sample of files, as selected by the options. VACUUM always
+// covers the whole database.
+func Maintain(db *sql.DB, opts MaintenanceOptions) (MaintenanceReport, error) {
+	start := time.Now()
+	var report MaintenanceReport
+
+	if opts.Vacuum {
+		report.DBSizeBefore = fileSize(dbPath)
+		if _, err := db.Exec("VACUUM"); err != nil {
+			return report, fmt.Errorf("failed to vacuum database: %w", err)
+		}
+		report.DBSizeAfter = fileSize(dbPath)
+	}
+
+	if opts.Thumbnails {
+		created, failed, err := EnsureThumbnails(db, opts.Filter)
+		if err != nil {
+			return report, err
+		}
+		report.ThumbnailsCreated, report.ThumbnailsFailed = created, failed
+	}
+
+	if opts.VerifySample > 0 {
+		items, err := sampleGalleryItems(db, opts.Filter, opts.VerifySample)
+		if err != nil {
+			return report, err
+		}
+		for _, item := range items {
+			sum, _, err := HashFile(item.Path)
+			switch {
+			case errors.Is(err, fs.ErrNotExist):
+				report.Missing = append(report.Missing, item)
+			case err != nil:
+				return report, err
+			case sum != item.SHA256:
+				report.Corrupt = append(report.Corrupt, item)
+			}
+			report.Verified++
+		}
+	}
+
+	report.Duration = time.Since(start)
+	return report, nil
+}
+
+// sampleGalleryItems returns up to n random wallpapers matching the filter that have
+// a file and a checksum
+func sampleGalleryItems(db *sql.DB, f Filter, n int) ([]GalleryItem, error) {
+	where, args := f.where()
+	rows, err := db.Query(`
+		SELECT `+galleryColumns+` FROM gallery
+		WHERE path != '' AND sha256 != '' AND `+where+` ORDER BY RANDOM() LIMIT ?`, append(args, n)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample wallpapers: %w", err)
+	}
+	defer rows.Close()
+
+	var items []GalleryItem
+	for rows.Next() {
+		item, err := scanGalleryItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// fileSize returns the size of the file at p, or 0 if it cannot be read
+func fileSize(p string) int64 {
+	info, err := os.Stat(p)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
@@ -0,0 +1,193 @@
+package crawal
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Decisions a sync makes about each image listed by the API
+const (
+	DecisionQueued    = "queued"    // queued for download
+	DecisionPresent   = "present"   // already downloaded from the same URL, or already queued
+	DecisionFiltered  = "filtered"  // rejected by the download filter
+	DecisionDeadLink  = "dead_link" // its URL is marked dead
+	DecisionCataloged = "cataloged" // only recorded, with --catalog
+	DecisionSkipList  = "skip_list" // its item is on the skip list
+)
+
+// RunManifest records a crawler run, so that it can be audited or replayed: the
+// configuration it ran with, the hashes of the API responses it was given, which
+// match the responses kept by a ResponseArchive, and what it did with each image.
+// It is safe for concurrent use.
+type RunManifest struct {
+	mu sync.Mutex
+
+	Game       string            `json:"game"`
+	Region     string            `json:"region"`
+	StartedAt  time.Time         `json:"started_at"`
+	FinishedAt time.Time         `json:"finished_at"`
+	Error      string            `json:"error,omitempty"`
+	ConfigFile string            `json:"config_file,omitempty"`
+	Config     map[string]string `json:"config"` // value of every flag, defaults included
+	API        []APIResponse     `json:"api"`
+	Items      []ItemDecision    `json:"items"`
+
+	index map[[3]string]int // of Items, by id, type and URL
+}
+
+// APIResponse is a response of a game API fetched during a run
+type APIResponse struct {
+	URL       string    `json:"url"`
+	Status    int       `json:"status"`
+	Size      int       `json:"size"`
+	SHA256    string    `json:"sha256"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// ItemDecision is what a run did with an image listed by the API. Outcome is set
+// for the images downloaded during the run, downloaded or failed.
+type ItemDecision struct {
+	IdGallery string `json:"id"`
+	Type      string `json:"type"`
+	FileName  string `json:"name"`
+	URL       string `json:"url"`
+	Decision  string `json:"decision"`
+	Outcome   string `json:"outcome,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Size      int64  `json:"size,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// NewRunManifest starts the manifest of a run of the crawler of game, with the
+// values of the flags of sets as its configuration, those of the later sets winning
+func NewRunManifest(game, region string, sets ...*flag.FlagSet) *RunManifest {
+	m := &RunManifest{
+		Game:       game,
+		Region:     region,
+		StartedAt:  time.Now().UTC(),
+		ConfigFile: ConfigPath(),
+		Config:     make(map[string]string),
+		API:        []APIResponse{},
+		Items:      []ItemDecision{},
+		index:      make(map[[3]string]int),
+	}
+	if _, err := os.Stat(m.ConfigFile); err != nil {
+		m.ConfigFile = ""
+	}
+	for _, fs := range sets {
+		fs.VisitAll(func(f *flag.Flag) {
+			m.Config[f.Name] = f.Value.String()
+		})
+	}
+	return m
+}
+
+// Transport wraps next so that the hash of every response it passes through is
+// recorded
+func (m *RunManifest) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return manifestTransport{manifest: m, next: next}
+}
+
+// manifestTransport records the responses it passes through into a manifest
+type manifestTransport struct {
+	manifest *RunManifest
+	next     http.RoundTripper
+}
+
+func (t manifestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		return res, err
+	}
+
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	t.manifest.mu.Lock()
+	defer t.manifest.mu.Unlock()
+	t.manifest.API = append(t.manifest.API, APIResponse{
+		URL:       req.URL.String(),
+		Status:    res.StatusCode,
+		Size:      len(body),
+		SHA256:    sha256Hex(body),
+		FetchedAt: time.Now().UTC(),
+	})
+	return res, nil
+}
+
+// decide records what the sync did with an image. It does nothing on a nil manifest.
+func (m *RunManifest) decide(job Job, decision string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.index[[3]string{job.IdGallery, job.Type, job.URL}] = len(m.Items)
+	m.Items = append(m.Items, ItemDecision{
+		IdGallery: job.IdGallery,
+		Type:      job.Type,
+		FileName:  job.FileName,
+		URL:       job.URL,
+		Decision:  decision,
+	})
+}
+
+// Handle records the outcome of the downloads of the images of the run, as a
+// subscriber of the events
+func (m *RunManifest) Handle(e Event) {
+	if e.Game != m.Game || (e.Kind != EventDownloadFinished && e.Kind != EventDownloadFailed) {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i, ok := m.index[[3]string{e.IdGallery, e.Type, e.URL}]
+	if !ok {
+		return
+	}
+	d := &m.Items[i]
+	if e.Kind == EventDownloadFinished {
+		d.Outcome, d.Path, d.Size, d.Error = "downloaded", e.Path, e.Size, ""
+	} else {
+		d.Outcome, d.Error = "failed", e.Error
+	}
+}
+
+// Finish ends the run, failed with runErr when not nil, and writes the manifest
+// as JSON into the folder dir, named after the game and the start of the run. It
+// returns the path of the file.
+func (m *RunManifest) Finish(dir string, runErr error) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.FinishedAt = time.Now().UTC()
+	if runErr != nil {
+		m.Error = runErr.Error()
+	}
+
+	body, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := makeDirs(dir); err != nil {
+		return "", fmt.Errorf("failed to create folder: %w", err)
+	}
+	p := filepath.Join(dir, fmt.Sprintf("%s-%s.json", m.Game, m.StartedAt.Format("20060102T150405Z")))
+	if err := os.WriteFile(p, append(body, '\n'), 0644); err != nil {
+		return "", err
+	}
+	return p, ownFile(p)
+}
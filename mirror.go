@@ -0,0 +1,353 @@
+package crawal
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// MirrorManifest returns the downloaded wallpapers matching the filter, as read by
+// the mirror of another library
+func MirrorManifest(db *sql.DB, f Filter) ([]GalleryItem, error) {
+	items, err := FindGalleryItems(db, f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query wallpapers: %w", err)
+	}
+	manifest := make([]GalleryItem, 0, len(items))
+	for _, item := range items {
+		if item.Path != "" && item.SHA256 != "" {
+			manifest = append(manifest, item)
+		}
+	}
+	return manifest, nil
+}
+
+// MirrorSource is a remote library Mirror copies wallpapers from
+type MirrorSource interface {
+	// Manifest lists the downloaded wallpapers of the library, as MirrorManifest
+	Manifest(ctx context.Context) ([]GalleryItem, error)
+	// Open reads the file of a wallpaper of the manifest
+	Open(ctx context.Context, item GalleryItem) (io.ReadCloser, error)
+}
+
+// NewMirrorSource returns the library at remote: the URL of yostar-wallpaper serve
+// (http://nas:8080), or ssh://[user@]host[:port] to run command, the yostar-wallpaper
+// of the remote machine, over ssh. The manifest is restricted by the filter args,
+// given as flags.
+func NewMirrorSource(remote, command string, args []string) (MirrorSource, error) {
+	u, err := url.Parse(remote)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return &httpMirror{base: strings.TrimSuffix(remote, "/"), args: args, client: &http.Client{Transport: downloadTransport.Load()}}, nil
+	case "ssh":
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid remote %q, expected ssh://[user@]host[:port]", remote)
+		}
+		return &sshMirror{url: u, command: command, args: args}, nil
+	default:
+		return nil, fmt.Errorf("unknown remote %q, expected http(s):// or ssh://", remote)
+	}
+}
+
+// httpMirror reads a library served by yostar-wallpaper serve
+type httpMirror struct {
+	base   string
+	args   []string
+	client *http.Client
+}
+
+func (m *httpMirror) Manifest(ctx context.Context) ([]GalleryItem, error) {
+	query := url.Values{}
+	for _, arg := range m.args {
+		name, value, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		query.Set(name, value)
+	}
+	res, err := m.get(ctx, m.base+"/api/manifest?"+query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var manifest []GalleryItem
+	if err := json.NewDecoder(res).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+func (m *httpMirror) Open(ctx context.Context, item GalleryItem) (io.ReadCloser, error) {
+	return m.get(ctx, fmt.Sprintf("%s/file/%d", m.base, item.ID))
+}
+
+func (m *httpMirror) get(ctx context.Context, u string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, &StatusError{URL: u, StatusCode: res.StatusCode}
+	}
+	return res.Body, nil
+}
+
+// sshMirror reads a library on another machine over ssh
+type sshMirror struct {
+	url     *url.URL
+	command string
+	args    []string
+}
+
+func (m *sshMirror) Manifest(ctx context.Context) ([]GalleryItem, error) {
+	remote := m.command + " mirror --manifest"
+	for _, arg := range m.args {
+		remote += " " + shellQuote(arg)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := m.ssh(ctx, remote)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to list the remote library: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var manifest []GalleryItem
+	if err := json.Unmarshal(stdout.Bytes(), &manifest); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+func (m *sshMirror) Open(ctx context.Context, item GalleryItem) (io.ReadCloser, error) {
+	cmd := m.ssh(ctx, "cat -- "+shellQuote(item.Path))
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to run ssh: %w", err)
+	}
+	return &commandReader{ReadCloser: stdout, cmd: cmd}, nil
+}
+
+// ssh returns the command running remote on the host of the mirror
+func (m *sshMirror) ssh(ctx context.Context, remote string) *exec.Cmd {
+	args := []string{"-o", "BatchMode=yes"}
+	if port := m.url.Port(); port != "" {
+		args = append(args, "-p", port)
+	}
+	host := m.url.Hostname()
+	if m.url.User != nil {
+		host = m.url.User.Username() + "@" + host
+	}
+	return exec.CommandContext(ctx, "ssh", append(args, host, remote)...)
+}
+
+// commandReader reads the output of a command, and reports its failure on Close
+type commandReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func (r *commandReader) Close() error {
+	io.Copy(io.Discard, r.ReadCloser)
+	return r.cmd.Wait()
+}
+
+// shellQuote quotes s for the POSIX shell ssh runs remote commands with
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// MirrorOptions configure Mirror
+type MirrorOptions struct {
+	Dir    string // folder new wallpapers are saved into, under <game>/<type>
+	DryRun bool   // only report what would be copied
+	Verify bool   // hash the local files instead of trusting the checksums of the library
+}
+
+// MirrorReport summarizes a Mirror run
+type MirrorReport struct {
+	Checked  int
+	Copied   int      // wallpapers missing from the library or from the disk
+	Changed  int      // wallpapers whose file differs, the previous one kept as a revision
+	Local    int      // of those, copied from an identical file of the library instead of the remote
+	Bytes    int64    // bytes transferred from the remote
+	Failed   []string // wallpapers that could not be copied, with the reason
+	UpToDate int
+}
+
+// Mirror copies the wallpapers of src that are missing from the library, or whose
+// file differs by checksum, and records them with the metadata of src. Each copied
+// file is verified against the checksum of the remote before being recorded.
+func Mirror(ctx context.Context, db *sql.DB, src MirrorSource, opts MirrorOptions) (MirrorReport, error) {
+	var report MirrorReport
+	manifest, err := src.Manifest(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	for _, remote := range manifest {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		report.Checked++
+		name := fmt.Sprintf("%s/%s %s", remote.Game, remote.IdGallery, remote.FileName)
+
+		local, err := GetGalleryItem(db, remote.Game, remote.Region, remote.IdGallery, remote.Type)
+		if err != nil && err != sql.ErrNoRows {
+			return report, fmt.Errorf("failed to look up %s: %w", name, err)
+		}
+		onDisk := false
+		if local.Path != "" {
+			_, err := os.Stat(local.Path)
+			onDisk = err == nil
+		}
+		if onDisk && opts.Verify {
+			if local.SHA256, _, err = HashFile(local.Path); err != nil {
+				return report, err
+			}
+		}
+		if onDisk && local.SHA256 == remote.SHA256 {
+			report.UpToDate++
+			continue
+		}
+		changed := onDisk && local.SHA256 != ""
+
+		dst := local.Path
+		if dst == "" {
+			dst = filepath.Join(opts.Dir, remote.Game, remote.Type, filepath.Base(remote.Path))
+		}
+		if opts.DryRun {
+			if changed {
+				report.Changed++
+			} else {
+				report.Copied++
+			}
+			logger.Printf("Would copy %s to %s", name, dst)
+			continue
+		}
+
+		// The previous file is archived once the new one is verified
+		tmp, n, fromLocal, err := mirrorFile(ctx, db, src, remote, dst)
+		if err == nil && changed {
+			if _, err = ArchiveRevision(db, remote.Game, remote.Region, remote.IdGallery, remote.Type); err != nil {
+				os.Remove(tmp)
+			}
+		}
+		if err == nil {
+			err = os.Rename(tmp, dst)
+		}
+		if err != nil {
+			logger.Printf("Error copying %s: %v", name, err)
+			report.Failed = append(report.Failed, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		report.Bytes += n
+		if fromLocal {
+			report.Local++
+		}
+
+		item := remote
+		item.ID, item.ItemID, item.DuplicateOf = 0, 0, 0
+		item.Path, item.Cataloged = dst, false
+		if err := SaveGalleryItem(db, item); err != nil {
+			return report, fmt.Errorf("failed to record %s: %w", name, err)
+		}
+		if changed {
+			report.Changed++
+		} else {
+			report.Copied++
+		}
+		logger.Printf("-> mirrored %s <-", name)
+	}
+	return report, nil
+}
+
+// mirrorFile copies the file of a remote wallpaper next to dst, from an identical file
+// of the library when there is one, and verifies its checksum. It returns the path of
+// the copy, to be renamed to dst, and the number of bytes transferred from src.
+func mirrorFile(ctx context.Context, db *sql.DB, src MirrorSource, remote GalleryItem, dst string) (string, int64, bool, error) {
+	if err := makeDirs(filepath.Dir(dst)); err != nil {
+		return "", 0, false, fmt.Errorf("failed to create folder: %w", err)
+	}
+	tmp := dst + ".part"
+
+	var localPath string
+	err := db.QueryRow("SELECT path FROM files WHERE sha256 = ? AND path != '' LIMIT 1", remote.SHA256).Scan(&localPath)
+	if err != nil && err != sql.ErrNoRows {
+		return "", 0, false, err
+	}
+	if localPath = resolvePath(localPath); localPath != "" {
+		if _, err := os.Stat(localPath); err == nil {
+			if err := copyVerified(tmp, remote.SHA256, func() (io.ReadCloser, error) { return os.Open(localPath) }); err == nil {
+				return tmp, 0, true, nil
+			}
+		}
+	}
+
+	var n int64
+	err = copyVerified(tmp, remote.SHA256, func() (io.ReadCloser, error) {
+		r, err := src.Open(ctx, remote)
+		if err != nil {
+			return nil, err
+		}
+		return &countingReader{ReadCloser: r, n: &n}, nil
+	})
+	return tmp, n, false, err
+}
+
+// copyVerified writes the content of open to tmp, which is removed unless its SHA-256
+// checksum is sum
+func copyVerified(tmp, sum string, open func() (io.ReadCloser, error)) error {
+	r, err := open()
+	if err != nil {
+		return err
+	}
+
+	out, err := createFile(tmp)
+	if err != nil {
+		r.Close()
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, h), r)
+	err = errors.Join(err, r.Close(), out.Close())
+	if err == nil && hex.EncodeToString(h.Sum(nil)) != sum {
+		err = fmt.Errorf("checksum mismatch, expected %s", sum)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	io.ReadCloser
+	n *int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	*r.n += int64(n)
+	return n, err
+}
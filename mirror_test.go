@@ -0,0 +1,83 @@
+package crawal
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeMirror is a remote library holding files by gallery ID
+type fakeMirror struct {
+	items []GalleryItem
+	files map[string]string
+}
+
+func (m *fakeMirror) Manifest(ctx context.Context) ([]GalleryItem, error) {
+	return m.items, nil
+}
+
+func (m *fakeMirror) Open(ctx context.Context, item GalleryItem) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(m.files[item.IdGallery])), nil
+}
+
+func TestMirror(t *testing.T) {
+	SetLogger(nil)
+	db := newPageTestDB(t, 0)
+	dir := t.TempDir()
+	for id, content := range map[string]string{"2": "same", "3": "old", "9": "shared"} {
+		p := filepath.Join(dir, id+".png")
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := SaveGalleryItem(db, GalleryItem{Game: "azur_lane", IdGallery: id, Type: "wallpaper", FileName: id, Path: p}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	src := &fakeMirror{files: map[string]string{"1": "new", "2": "same", "3": "changed", "4": "shared", "5": "corrupted"}}
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		sum := sha256Hex([]byte(src.files[id]))
+		if id == "5" {
+			sum = sha256Hex([]byte("intact"))
+		}
+		src.items = append(src.items, GalleryItem{Game: "azur_lane", IdGallery: id, Type: "wallpaper", FileName: id, Title: "remote " + id,
+			Path: "/remote/" + id + ".png", SHA256: sum})
+	}
+
+	report, err := Mirror(context.Background(), db, src, MirrorOptions{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Checked != 5 || report.Copied != 2 || report.Changed != 1 || report.UpToDate != 1 || report.Local != 1 || len(report.Failed) != 1 {
+		t.Errorf("report %+v, want 2 copied, 1 changed, 1 up to date, 1 from the library and 1 failed", report)
+	}
+	if want := int64(len("new") + len("changed")); report.Bytes != want {
+		t.Errorf("%d bytes transferred, want %d", report.Bytes, want)
+	}
+
+	for id, content := range map[string]string{"1": "new", "3": "changed", "4": "shared"} {
+		item, err := GetGalleryItem(db, "azur_lane", "", id, "wallpaper")
+		if err != nil {
+			t.Fatalf("%s not recorded: %v", id, err)
+		}
+		if b, err := os.ReadFile(item.Path); err != nil || string(b) != content {
+			t.Errorf("%s holds %q (%v), want %q", id, b, err, content)
+		}
+		if item.Title != "remote "+id {
+			t.Errorf("%s has the title %q, want the one of the remote", id, item.Title)
+		}
+	}
+	item, _ := GetGalleryItem(db, "azur_lane", "", "3", "wallpaper")
+	if revisions, err := ListRevisions(db, item.ID); err != nil || len(revisions) != 1 {
+		t.Errorf("%d revisions of the changed file (%v), want 1", len(revisions), err)
+	}
+	if _, err := GetGalleryItem(db, "azur_lane", "", "5", "wallpaper"); err == nil {
+		t.Error("file failing its checksum recorded")
+	}
+	if parts, _ := filepath.Glob(filepath.Join(dir, "*", "*", "*.part")); len(parts) > 0 {
+		t.Errorf("partial copies left: %v", parts)
+	}
+}
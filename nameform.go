@@ -0,0 +1,86 @@
+package crawal
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Unicode normalization forms of file names. macOS writes names decomposed (NFD)
+// while Linux and Windows keep them as given, usually composed (NFC), so the same
+// title can end up as two names in a library synced between them.
+const (
+	NameFormNFC  = "nfc"  // composed, e.g. "é" as one character
+	NameFormNFD  = "nfd"  // decomposed, e.g. "é" as "e" and a combining accent
+	NameFormNone = "none" // names are kept as the API gives them
+)
+
+// nameForm is the normalization form of new file names, read once per file name so
+// that it can be changed while downloads run
+var nameForm atomic.Value // string
+
+func init() {
+	nameForm.Store(NameFormNFC)
+}
+
+// CheckNameForm returns an error if form is not one of the name forms
+func CheckNameForm(form string) error {
+	switch form {
+	case NameFormNFC, NameFormNFD, NameFormNone:
+		return nil
+	}
+	return fmt.Errorf("unknown name form %q", form)
+}
+
+// SetNameForm sets the Unicode normalization form of new file names, NFC by
+// default. The names given from then on are in form.
+func SetNameForm(form string) error {
+	if err := CheckNameForm(form); err != nil {
+		return err
+	}
+	nameForm.Store(form)
+	return nil
+}
+
+// NormalizeName returns name in the form set by SetNameForm
+func NormalizeName(name string) string {
+	switch nameForm.Load().(string) {
+	case NameFormNFC:
+		return norm.NFC.String(name)
+	case NameFormNFD:
+		return norm.NFD.String(name)
+	}
+	return name
+}
+
+// findNormalized returns p, or the path of the same file with its name in another
+// normalization form when only that one exists, as after a sync with macOS
+func findNormalized(p string) string {
+	if isASCII(p) {
+		return p
+	}
+	if _, err := os.Lstat(p); err == nil {
+		return p
+	}
+	for _, alt := range []string{norm.NFC.String(p), norm.NFD.String(p)} {
+		if alt == p {
+			continue
+		}
+		if _, err := os.Lstat(alt); err == nil {
+			return alt
+		}
+	}
+	return p
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package crawal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+func TestNormalizeName(t *testing.T) {
+	t.Cleanup(func() { SetNameForm(NameFormNFC) })
+	composed, decomposed := "Café_ポケモン", norm.NFD.String("Café_ポケモン")
+	if composed == decomposed {
+		t.Fatal("test name has no decomposable character")
+	}
+	tests := []struct {
+		form string
+		name string
+		want string
+	}{
+		{NameFormNFC, composed, composed},
+		{NameFormNFC, decomposed, composed},
+		{NameFormNFD, composed, decomposed},
+		{NameFormNFD, decomposed, decomposed},
+		{NameFormNone, composed, composed},
+		{NameFormNone, decomposed, decomposed},
+	}
+	for _, tt := range tests {
+		if err := SetNameForm(tt.form); err != nil {
+			t.Fatal(err)
+		}
+		if got := NormalizeName(tt.name); got != tt.want {
+			t.Errorf("%s: NormalizeName(%+q) = %+q, want %+q", tt.form, tt.name, got, tt.want)
+		}
+	}
+	if err := SetNameForm("nfkc"); err == nil {
+		t.Error("SetNameForm(nfkc) succeeded, want an unknown form")
+	}
+}
+
+// TestFindNormalized checks that a file stored with its name in the other form, as
+// after a sync with macOS, is found
+func TestFindNormalized(t *testing.T) {
+	dir := t.TempDir()
+	composed := filepath.Join(dir, "Café.png")
+	decomposed := filepath.Join(dir, norm.NFD.String("Café.png"))
+	if err := os.WriteFile(decomposed, []byte("image"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(composed); err == nil {
+		t.Skip("the file system normalizes names")
+	}
+	if got := findNormalized(composed); got != decomposed {
+		t.Errorf("findNormalized(composed) = %+q, want %+q", got, decomposed)
+	}
+	if got := findNormalized(decomposed); got != decomposed {
+		t.Errorf("findNormalized(decomposed) = %+q, want it unchanged", got)
+	}
+	missing := filepath.Join(dir, "Noël.png")
+	if got := findNormalized(missing); got != missing {
+		t.Errorf("findNormalized(missing) = %+q, want it unchanged", got)
+	}
+}
@@ -0,0 +1,52 @@
+package crawal
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// NameTemplate names the downloaded images of an item from its fields, e.g.
+// "{id}_{ascii}": {game}, {id}, {title}, {artist}, {romaji} for the title with its
+// kana in romaji, and {ascii} for its romaji with what is left outside ASCII
+// dropped. The empty template names them Title(Artist), or as the crawler does.
+type NameTemplate string
+
+var (
+	namePlaceholder = regexp.MustCompile(`\{[^{}]*\}`)
+	// nameEdges are the separators left at either end by empty placeholders
+	nameEdges = regexp.MustCompile(`^[\s_.-]+|[\s_.-]+$`)
+)
+
+// ParseNameTemplate checks the placeholders of a name template
+func ParseNameTemplate(s string) (NameTemplate, error) {
+	for _, p := range namePlaceholder.FindAllString(s, -1) {
+		switch p {
+		case "{game}", "{id}", "{title}", "{artist}", "{romaji}", "{ascii}":
+		default:
+			return "", fmt.Errorf("unknown placeholder %s in name template", p)
+		}
+	}
+	return NameTemplate(s), nil
+}
+
+// fileName returns the name of the downloaded images of it, its ID when the
+// template leaves it empty
+func (t NameTemplate) fileName(it Item) string {
+	if t == "" {
+		return it.fileName()
+	}
+	name := strings.NewReplacer(
+		"{game}", it.Game,
+		"{id}", it.ID,
+		"{title}", it.Title,
+		"{artist}", it.Artist,
+		"{romaji}", Romaji(it.Title),
+		"{ascii}", ASCIIName(it.Title),
+	).Replace(string(t))
+	name = nameEdges.ReplaceAllString(emptyBrackets.ReplaceAllString(name, ""), "")
+	if name == "" {
+		return it.ID
+	}
+	return name
+}
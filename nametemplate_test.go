@@ -0,0 +1,95 @@
+package crawal
+
+import "testing"
+
+func TestParseNameTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		ok       bool
+	}{
+		{"", true},
+		{"wallpaper", true},
+		{"{game}/{id}_{title}({artist})", true},
+		{"{romaji} {ascii}", true},
+		{"{name}", false},
+		{"{ID}", false},
+		{"{id}_{}", false},
+	}
+	for _, tt := range tests {
+		if _, err := ParseNameTemplate(tt.template); (err == nil) != tt.ok {
+			t.Errorf("ParseNameTemplate(%q) = %v, want ok %v", tt.template, err, tt.ok)
+		}
+	}
+}
+
+func TestNameTemplateFileName(t *testing.T) {
+	item := Item{Game: "azur_lane", ID: "42", Title: "さくら", Artist: "Yostar"}
+	kanji := Item{Game: "azur_lane", ID: "7", Title: "桜"}
+	tests := []struct {
+		template NameTemplate
+		item     Item
+		want     string
+	}{
+		{"", item, "さくら(Yostar)"},
+		{"", Item{ID: "1", Title: "さくら"}, "さくら"},
+		{"", Item{ID: "1", Title: "さくら", FileName: "sakura_1"}, "sakura_1"},
+		{"{game}_{id}", item, "azur_lane_42"},
+		{"{title}({artist})", item, "さくら(Yostar)"},
+		{"{romaji}", item, "sakura"},
+		{"{id}_{ascii}", item, "42_sakura"},
+		{"{ascii}", Item{ID: "2", Title: "Ünïcödé"}, "Unicode"},
+
+		// Placeholders left empty drop their brackets and the separators at the ends
+		{"{title}({artist})", kanji, "桜"},
+		{"{ascii}_{id}", kanji, "7"},
+		{"[{artist}] {title}", kanji, "桜"},
+		{"{ascii}", Item{ID: "3", Title: "Ver.桜"}, "Ver"},
+
+		// Names left empty fall back to the ID
+		{"{ascii}", kanji, "7"},
+		{"{artist}", kanji, "7"},
+		{"({ascii})", kanji, "7"},
+		{"_-_", kanji, "7"},
+	}
+	for _, tt := range tests {
+		if got := tt.template.fileName(tt.item); got != tt.want {
+			t.Errorf("%q named %q %q, want %q", tt.template, tt.item.Title, got, tt.want)
+		}
+	}
+}
+
+// TestNameTemplateCollisions checks that titles given the same name by a template
+// are numbered when downloaded into the same folder
+func TestNameTemplateCollisions(t *testing.T) {
+	db := newPageTestDB(t, 0)
+	dir := t.TempDir()
+	var pending pendingNames
+
+	template := NameTemplate("{ascii}")
+	tests := []struct {
+		item Item
+		want string
+	}{
+		{Item{ID: "1", Title: "Ver.桜"}, "Ver"},
+		{Item{ID: "2", Title: "Ver.梅"}, "Ver_(2)"},
+		{Item{ID: "3", Title: "ver・菊"}, "ver_(3)"},
+		{Item{ID: "4", Title: "桜"}, "4"},
+		{Item{ID: "5", Title: "梅"}, "5"},
+		{Item{ID: "1", Title: "Ver.桜"}, "Ver"},
+	}
+	for _, tt := range tests {
+		item := GalleryItem{
+			IdGallery: tt.item.ID,
+			Game:      "azur_lane",
+			Type:      "wallpaper",
+			FileName:  template.fileName(tt.item),
+		}
+		got, err := uniqueFileName(db, item, dir, &pending)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s %q is named %q, want %q", tt.item.ID, tt.item.Title, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+//go:build linux
+
+package crawal
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultInterface returns the network interface of the default route with the
+// lowest metric, empty when there is none
+func defaultInterface() string {
+	data, err := os.ReadFile("/proc/net/route")
+	if err != nil {
+		return ""
+	}
+	iface, best := "", -1
+	// Iface Destination Gateway Flags RefCnt Use Metric Mask ...
+	for _, line := range strings.Split(string(data), "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 8 || fields[1] != "00000000" || fields[7] != "00000000" {
+			continue
+		}
+		metric, err := strconv.Atoi(fields[6])
+		if err != nil {
+			continue
+		}
+		if best < 0 || metric < best {
+			iface, best = fields[0], metric
+		}
+	}
+	return iface
+}
+
+// networkManagerMetered reports whether NetworkManager reports the connection of
+// iface as metered, or guesses it is, as for a phone hotspot
+func networkManagerMetered(iface string) bool {
+	if _, err := exec.LookPath("nmcli"); err != nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "nmcli", "--get-values", "GENERAL.METERED", "device", "show", iface).Output()
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(strings.TrimSpace(string(out)), "yes")
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package crawal
+
+// defaultInterface returns no interface, the routes being only read on Linux
+func defaultInterface() string {
+	return ""
+}
+
+// networkManagerMetered reports false, NetworkManager being only asked on Linux
+func networkManagerMetered(iface string) bool {
+	return false
+}
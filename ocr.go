@@ -0,0 +1,82 @@
+package crawal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// OCR recognizes the text printed on a wallpaper, such as event names or anniversary text
+type OCR interface {
+	// Name identifies the recognizer as the source of the text
+	Name() string
+	Recognize(ctx context.Context, item GalleryItem) (string, error)
+}
+
+// CommandOCR runs an external OCR command on each image and reads the text from its output,
+// e.g. `tesseract {file} stdout -l eng+jpn`. Placeholders work as for CommandTagger.
+type CommandOCR struct {
+	Command string
+	Timeout time.Duration
+}
+
+// NewCommandOCR parses an OCR command line
+func NewCommandOCR(command string) (*CommandOCR, error) {
+	if _, err := splitCommand(command); err != nil {
+		return nil, err
+	}
+	return &CommandOCR{Command: command, Timeout: defaultCommandTimeout}, nil
+}
+
+func (o *CommandOCR) Name() string {
+	args, _ := splitCommand(o.Command)
+	return args[0]
+}
+
+func (o *CommandOCR) Recognize(ctx context.Context, item GalleryItem) (string, error) {
+	out, err := runCommand(ctx, o.Command, o.Timeout, map[string]string{"file": item.Path})
+	if err != nil {
+		return "", fmt.Errorf("OCR failed: %w", err)
+	}
+	// collapse the layout of the recognized text into a single searchable line
+	return strings.Join(strings.Fields(string(out)), " "), nil
+}
+
+// RecognizeGalleryItem runs OCR on a downloaded wallpaper and stores the recognized text,
+// replacing the text of a previous upload
+func RecognizeGalleryItem(ctx context.Context, db *sql.DB, o OCR, item GalleryItem) (string, error) {
+	if item.ID == 0 {
+		saved, err := GetGalleryItem(db, item.Game, item.Region, item.IdGallery, item.Type)
+		if err != nil {
+			return "", fmt.Errorf("failed to look up wallpaper: %w", err)
+		}
+		item = saved
+	}
+	if item.Path == "" {
+		return "", errors.New("wallpaper has no file to recognize")
+	}
+
+	text, err := o.Recognize(ctx, item)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = db.Exec("INSERT OR REPLACE INTO ocr_text(gallery_id, text, source) VALUES (?, ?, ?)", item.ID, text, o.Name())
+	if err != nil {
+		return "", fmt.Errorf("failed to store text: %w", err)
+	}
+	return text, nil
+}
+
+// GetOCRText returns the text recognized on a wallpaper, if any
+func GetOCRText(db *sql.DB, galleryID int64) (string, error) {
+	var text string
+	err := db.QueryRow("SELECT text FROM ocr_text WHERE gallery_id = ?", galleryID).Scan(&text)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return text, err
+}
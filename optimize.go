@@ -0,0 +1,108 @@
+package crawal
+
+import (
+	"context"
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// OptimizeBuiltin selects the built-in optimizer, which recompresses PNG files
+const OptimizeBuiltin = "builtin"
+
+// Optimizer shrinks a downloaded image file in place without losing pixels
+type Optimizer interface {
+	Optimize(ctx context.Context, p string) error
+}
+
+// NewOptimizer returns the built-in optimizer for OptimizeBuiltin, or one running
+// the command line, e.g. `oxipng -o 4 {file}`, otherwise
+func NewOptimizer(target string) (Optimizer, error) {
+	if target == OptimizeBuiltin {
+		return pngOptimizer{}, nil
+	}
+	if _, err := splitCommand(target); err != nil {
+		return nil, err
+	}
+	return commandOptimizer{command: target}, nil
+}
+
+// pngOptimizer re-encodes PNG files at the best compression level and keeps the result
+// when smaller. Pixels are kept exactly; ancillary chunks, such as text or color
+// profiles, are dropped. Other formats are left alone, since they cannot be recompressed
+// losslessly with the standard library.
+type pngOptimizer struct{}
+
+func (pngOptimizer) Optimize(ctx context.Context, p string) error {
+	if !strings.EqualFold(filepath.Ext(p), ".png") {
+		return nil
+	}
+	img, err := decodeImage(p)
+	if err != nil {
+		return err
+	}
+	before, err := os.Stat(p)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".optimize-*.png")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer trackTemp(tmp.Name())()
+	enc := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := enc.Encode(tmp, img); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to encode %s: %w", p, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	after, err := os.Stat(tmp.Name())
+	if err != nil {
+		return err
+	}
+	if after.Size() >= before.Size() {
+		return nil
+	}
+	if err := os.Chmod(tmp.Name(), before.Mode()); err != nil {
+		return err
+	}
+	if err := fileOwner.Load().chown(tmp.Name()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+// commandOptimizer runs an external optimizer on the file, e.g. oxipng or jpegtran
+type commandOptimizer struct {
+	command string
+}
+
+func (o commandOptimizer) Optimize(ctx context.Context, p string) error {
+	if _, err := runCommand(ctx, o.command, defaultCommandTimeout, map[string]string{"file": p}); err != nil {
+		return fmt.Errorf("optimizer failed: %w", err)
+	}
+	return nil
+}
+
+// optimizeFile runs o on the file at p and returns its size before and after
+func optimizeFile(ctx context.Context, o Optimizer, p string) (int64, int64, error) {
+	before, err := os.Stat(p)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := o.Optimize(ctx, p); err != nil {
+		return before.Size(), before.Size(), err
+	}
+	after, err := os.Stat(p)
+	if err != nil {
+		return before.Size(), before.Size(), err
+	}
+	return before.Size(), after.Size(), nil
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package crawal
+
+import "errors"
+
+// umask is 0, the modes of files meaning little here
+const umask = 0
+
+// lookupOwner returns -1 for the owner and group, which cannot be changed here
+func lookupOwner(owner, group string) (int, int, error) {
+	if owner != "" || group != "" {
+		return 0, 0, errors.New("the owner and group of files can only be set on Unix")
+	}
+	return -1, -1, nil
+}
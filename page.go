@@ -0,0 +1,164 @@
+package crawal
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Page limits
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+// pageSorts are the orders of the pages of wallpapers, with the expression each
+// sorts on. Timestamps are compared as stored, in their text form.
+var pageSorts = map[string]string{
+	"id":         "id",
+	"title":      "title",
+	"size":       "size",
+	"published":  "COALESCE(CAST(published_at AS TEXT), '')",
+	"downloaded": "CAST(created_at AS TEXT)",
+}
+
+// PageSorts returns the names of the orders PageGalleryItems sorts on
+func PageSorts() []string {
+	names := make([]string, 0, len(pageSorts))
+	for name := range pageSorts {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Errors of PageGalleryItems for invalid pages
+var (
+	ErrUnknownSort   = errors.New("unknown sort")
+	ErrInvalidCursor = errors.New("invalid cursor") // not returned for the same order
+)
+
+// Page selects a page of wallpapers
+type Page struct {
+	Sort   string // one of PageSorts, id when empty
+	Desc   bool
+	Limit  int    // 100 when 0, at most 1000
+	Cursor string // returned with the previous page, empty for the first
+}
+
+// pageCursor is the position after the last wallpaper of a page: its sort key, with
+// its ID to break ties
+type pageCursor struct {
+	Order string `json:"o"`
+	Key   any    `json:"k"`
+	ID    int64  `json:"id"`
+}
+
+// PageGalleryItems returns a page of the wallpapers matching the filter, with the
+// cursor of the next page, empty after the last. Pages are found by their position
+// in the order rather than an offset, so paging through the whole library stays
+// fast and rows added meanwhile are neither skipped nor repeated.
+func PageGalleryItems(db *sql.DB, f Filter, p Page) ([]GalleryItem, string, error) {
+	if p.Sort == "" {
+		p.Sort = "id"
+	}
+	expr, ok := pageSorts[p.Sort]
+	if !ok {
+		return nil, "", fmt.Errorf("%w %q, expected one of %s", ErrUnknownSort, p.Sort, strings.Join(PageSorts(), ", "))
+	}
+	if p.Limit <= 0 {
+		p.Limit = defaultPageLimit
+	}
+	p.Limit = min(p.Limit, maxPageLimit)
+	order, cmp, dir := p.Sort, ">", "ASC"
+	if p.Desc {
+		order, cmp, dir = "-"+p.Sort, "<", "DESC"
+	}
+
+	where, args := f.where()
+	if p.Cursor != "" {
+		c, err := decodeCursor(p.Cursor)
+		if err != nil || c.Order != order {
+			return nil, "", ErrInvalidCursor
+		}
+		where += fmt.Sprintf(" AND (%s %s ? OR (%s = ? AND id %s ?))", expr, cmp, expr, cmp)
+		args = append(args, c.Key, c.Key, c.ID)
+	}
+	// one more row tells whether there is a next page
+	args = append(args, p.Limit+1)
+	rows, err := db.Query(`SELECT `+galleryColumns+`, `+expr+` FROM gallery WHERE `+where+
+		fmt.Sprintf(` ORDER BY %s %s, id %s LIMIT ?`, expr, dir, dir), args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var items []GalleryItem
+	var keys []any
+	for rows.Next() {
+		var key any
+		item, err := scanGalleryItem(extraScanner{rows, []any{&key}})
+		if err != nil {
+			return nil, "", err
+		}
+		items = append(items, item)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+	if len(items) <= p.Limit {
+		return items, "", nil
+	}
+
+	items = items[:p.Limit]
+	next, err := encodeCursor(pageCursor{Order: order, Key: keys[p.Limit-1], ID: items[p.Limit-1].ID})
+	return items, next, err
+}
+
+// extraScanner reads the columns selected after galleryColumns into extra
+type extraScanner struct {
+	rowScanner
+	extra []any
+}
+
+func (s extraScanner) Scan(dest ...any) error {
+	return s.rowScanner.Scan(append(dest, s.extra...)...)
+}
+
+func encodeCursor(c pageCursor) (string, error) {
+	if b, ok := c.Key.([]byte); ok {
+		c.Key = string(b)
+	}
+	body, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(body), nil
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	var c pageCursor
+	body, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	// numbers stay integers, which sqlite compares with the integer columns
+	dec := json.NewDecoder(strings.NewReader(string(body)))
+	dec.UseNumber()
+	if err := dec.Decode(&c); err != nil {
+		return c, err
+	}
+	if n, ok := c.Key.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			c.Key = i
+		} else if f, err := n.Float64(); err == nil {
+			c.Key = f
+		}
+	}
+	return c, nil
+}
@@ -0,0 +1,177 @@
+package crawal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// newPageTestDB returns a library of n cataloged wallpapers, whose titles and sizes
+// repeat every three so that the orders have ties
+func newPageTestDB(t *testing.T, n int) *sql.DB {
+	t.Helper()
+	db, err := openDatabase(filepath.Join(t.TempDir(), "yostar-gallery.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	for i := 1; i <= n; i++ {
+		addPageTestItem(t, db, i)
+	}
+	return db
+}
+
+func addPageTestItem(t *testing.T, db *sql.DB, i int) {
+	t.Helper()
+	err := SaveGalleryItem(db, GalleryItem{
+		IdGallery: fmt.Sprint(i),
+		Game:      "azur_lane",
+		Type:      "wallpaper",
+		FileName:  fmt.Sprintf("wallpaper %d", i),
+		URL:       fmt.Sprintf("https://cdn.example/%d.png", i),
+		Title:     fmt.Sprintf("title %d", i%3),
+		Size:      int64(i%3) * 1000,
+		Cataloged: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// pageAll pages through the library with p, returning the IDs in the order listed
+func pageAll(t *testing.T, db *sql.DB, p Page) []int64 {
+	t.Helper()
+	var ids []int64
+	for pages := 0; ; pages++ {
+		if pages > 100 {
+			t.Fatal("paging does not end")
+		}
+		items, next, err := PageGalleryItems(db, Filter{}, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range items {
+			ids = append(ids, item.ID)
+		}
+		if next == "" {
+			return ids
+		}
+		p.Cursor = next
+	}
+}
+
+func TestPageGalleryItems(t *testing.T) {
+	db := newPageTestDB(t, 10)
+	all, _, err := PageGalleryItems(db, Filter{}, Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byID := map[int64]GalleryItem{}
+	var ids []int64
+	for _, item := range all {
+		byID[item.ID] = item
+		ids = append(ids, item.ID)
+	}
+	if len(ids) != 10 || !slices.IsSorted(ids) {
+		t.Fatalf("first page of the library is %v, want its 10 wallpapers by ID", ids)
+	}
+
+	tests := []struct {
+		name string
+		page Page
+		less func(a, b GalleryItem) bool // of the expected order, ties broken by ID
+	}{
+		{"id", Page{Limit: 3}, func(a, b GalleryItem) bool { return a.ID < b.ID }},
+		{"id desc", Page{Desc: true, Limit: 3}, func(a, b GalleryItem) bool { return a.ID > b.ID }},
+		{"title", Page{Sort: "title", Limit: 2}, func(a, b GalleryItem) bool {
+			return a.Title < b.Title || a.Title == b.Title && a.ID < b.ID
+		}},
+		{"size desc", Page{Sort: "size", Desc: true, Limit: 4}, func(a, b GalleryItem) bool {
+			return a.Size > b.Size || a.Size == b.Size && a.ID > b.ID
+		}},
+		{"one page", Page{Sort: "downloaded", Limit: 10}, func(a, b GalleryItem) bool {
+			return a.CreatedAt.Before(b.CreatedAt) || a.CreatedAt.Equal(b.CreatedAt) && a.ID < b.ID
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pageAll(t, db, tt.page)
+			want := slices.Clone(ids)
+			slices.SortFunc(want, func(a, b int64) int {
+				if tt.less(byID[a], byID[b]) {
+					return -1
+				}
+				return 1
+			})
+			if !slices.Equal(got, want) {
+				t.Errorf("paged %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// TestPageGalleryItemsAdded checks that the wallpapers added while paging are
+// listed once, when they come after the page read
+func TestPageGalleryItemsAdded(t *testing.T) {
+	db := newPageTestDB(t, 4)
+	items, next, err := PageGalleryItems(db, Filter{}, Page{Limit: 2})
+	if err != nil || len(items) != 2 || next == "" {
+		t.Fatalf("first page is %d wallpapers, cursor %q, %v", len(items), next, err)
+	}
+	addPageTestItem(t, db, 5)
+
+	ids := pageAll(t, db, Page{Limit: 2, Cursor: next})
+	if len(ids) != 3 {
+		t.Errorf("paged %v after the first page, want the 2 left and the one added", ids)
+	}
+}
+
+func TestPageGalleryItemsErrors(t *testing.T) {
+	db := newPageTestDB(t, 3)
+	_, idCursor, err := PageGalleryItems(db, Filter{}, Page{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		page Page
+		want error
+	}{
+		{"unknown sort", Page{Sort: "path"}, ErrUnknownSort},
+		{"garbage cursor", Page{Cursor: "not a cursor"}, ErrInvalidCursor},
+		{"cursor of another sort", Page{Sort: "title", Cursor: idCursor}, ErrInvalidCursor},
+		{"cursor of the other order", Page{Desc: true, Cursor: idCursor}, ErrInvalidCursor},
+	}
+	for _, tt := range tests {
+		if _, _, err := PageGalleryItems(db, Filter{}, tt.page); !errors.Is(err, tt.want) {
+			t.Errorf("%s: PageGalleryItems returned %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestPageLimit(t *testing.T) {
+	db := newPageTestDB(t, 3)
+	tests := []struct {
+		limit, want int
+		next        bool
+	}{
+		{0, 3, false},
+		{-1, 3, false},
+		{2, 2, true},
+		{3, 3, false},
+		{maxPageLimit + 1, 3, false},
+	}
+	for _, tt := range tests {
+		items, next, err := PageGalleryItems(db, Filter{}, Page{Limit: tt.limit})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != tt.want || (next != "") != tt.next {
+			t.Errorf("limit %d: %d wallpapers, cursor %q; want %d, a cursor %v", tt.limit, len(items), next, tt.want, tt.next)
+		}
+	}
+}
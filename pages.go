@@ -0,0 +1,77 @@
+package crawal
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// PageURL returns rawURL with its page query parameter set to page
+func PageURL(rawURL, param string, page int) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid API URL: %w", err)
+	}
+	q := u.Query()
+	q.Set(param, strconv.Itoa(page))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// FetchPages fetches the pages from to last of a paginated API, numbered by the page
+// query parameter of rawURL, workers at a time. The bodies are returned in page order
+// whatever order they arrive in, so the rows merged from them are always in the same
+// order.
+func FetchPages(client *http.Client, rawURL, param string, from, last, workers int) ([][]byte, error) {
+	return fetchPages(client, rawURL, "", param, from, last, workers)
+}
+
+// FetchRemainingPages fetches the rows left out of the first page of a paginated API,
+// truncated to size of the count rows it announced. rawURL, the URL of that page, is
+// asked for pages of size rows with its sizeParam query parameter, and the pages from
+// 2 on are fetched as by FetchPages, in locale when not empty.
+func FetchRemainingPages(client *http.Client, rawURL, locale, param, sizeParam string, size, count, workers int) ([][]byte, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid page size %d", size)
+	}
+	sized, err := PageURL(rawURL, sizeParam, size)
+	if err != nil {
+		return nil, err
+	}
+	return fetchPages(client, sized, locale, param, 2, (count+size-1)/size, workers)
+}
+
+// fetchPages implements FetchPages, in locale when not empty
+func fetchPages(client *http.Client, rawURL, locale, param string, from, last, workers int) ([][]byte, error) {
+	if last < from {
+		return nil, nil
+	}
+	bodies := make([][]byte, last-from+1)
+	errs := make([]error, len(bodies))
+
+	urls := make([]string, len(bodies))
+	for i := range urls {
+		pageURL, err := PageURL(rawURL, param, from+i)
+		if err != nil {
+			return nil, err
+		}
+		urls[i] = pageURL
+	}
+
+	parallel(len(urls), workers, func(i int) {
+		body, err := FetchApiLocale(client, urls[i], locale)
+		if err != nil {
+			errs[i] = fmt.Errorf("page %d: %w", from+i, err)
+			return
+		}
+		bodies[i] = body
+	})
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return bodies, nil
+}
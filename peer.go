@@ -0,0 +1,72 @@
+package crawal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// peerFilePath is the endpoint of yostar-wallpaper serve sharing the downloaded files
+// of its library by their origin URL
+const peerFilePath = "/api/file"
+
+// GetDownloadedItemByURL looks up the downloaded wallpaper whose image was listed at
+// url or downloaded from it, for the libraries sharing their files with peers
+func GetDownloadedItemByURL(db *sql.DB, url string) (GalleryItem, error) {
+	return scanGalleryItem(db.QueryRow(`
+		SELECT `+galleryColumns+`
+		FROM gallery WHERE (url = ? OR source_url = ?) AND path != '' AND cataloged = 0
+		ORDER BY id DESC LIMIT 1`, url, url))
+}
+
+// PeerFileURL returns the URL of the file listed at origin in the library served at peer
+func PeerFileURL(peer, origin string) string {
+	return strings.TrimSuffix(peer, "/") + peerFilePath + "?url=" + url.QueryEscape(origin)
+}
+
+// downloadPeer downloads the image listed at origin from the library served at peer,
+// instead of the CDN, as fileName into dir. It returns an empty path when the peer does not have it or cannot be
+// reached, so that the image is downloaded from the CDN, and ErrConflictSkipped when
+// the image is not wanted anymore.
+func downloadPeer(peer, origin, fileName, dir string) (string, error) {
+	if peer == "" {
+		return "", nil
+	}
+	p, err := DownloadFile(PeerFileURL(peer, origin), fileName, dir)
+	if errors.Is(err, ErrConflictSkipped) {
+		return "", err
+	}
+	if err != nil {
+		// the CDN has the image too, and its download is quarantined if need be
+		var corrupt *CorruptError
+		if errors.As(err, &corrupt) && corrupt.Path != "" {
+			os.Remove(corrupt.Path)
+		}
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+			logger.Printf("Error downloading %s from %s, using the CDN: %v", fileName, peer, err)
+		}
+		return "", nil
+	}
+	logger.Printf(`-> "%s" copied from %s <-`, fileName, peer)
+	return p, nil
+}
+
+// CheckPeer reports whether peer can be used as QueueOptions.Peer
+func CheckPeer(peer string) error {
+	if peer == "" {
+		return nil
+	}
+	u, err := url.Parse(peer)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("peer %q must be the http:// URL of yostar-wallpaper serve", peer)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package crawal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+)
+
+// FileOptions set the permissions and owner of the files and folders written into
+// the library, e.g. so that a daemon run as root writes files its user can read
+type FileOptions struct {
+	FileMode os.FileMode // mode of the files, left to the umask when 0
+	DirMode  os.FileMode // mode of the folders, 0755 less the umask when 0
+
+	// Owner and Group own the files and folders, as names or numeric IDs. They are
+	// left to the process when empty, and only supported on Unix.
+	Owner string
+	Group string
+}
+
+// ownerOptions are the options set with SetFileOptions, with the owner and group
+// resolved to IDs, -1 when unset
+type ownerOptions struct {
+	FileOptions
+	uid, gid int
+}
+
+// fileOwner holds the ownerOptions of the library. Each file or folder written
+// loads them once, so that SetFileOptions can be called while downloads run.
+var fileOwner atomic.Pointer[ownerOptions]
+
+func init() {
+	fileOwner.Store(&ownerOptions{uid: -1, gid: -1})
+}
+
+// SetFileOptions applies opts to the files and folders written into the library
+// from then on, looking up the owner and group
+func SetFileOptions(opts FileOptions) error {
+	uid, gid, err := lookupOwner(opts.Owner, opts.Group)
+	if err != nil {
+		return err
+	}
+	fileOwner.Store(&ownerOptions{FileOptions: opts, uid: uid, gid: gid})
+	return nil
+}
+
+// ParseFileMode parses an octal mode such as 0640 or 750, 0 when empty
+func ParseFileMode(s string) (os.FileMode, error) {
+	if s == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("%q is not an octal mode such as 0644", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// makeDirs creates the folder dir and its missing parents, with the mode and owner
+// set by SetFileOptions
+func makeDirs(dir string) error {
+	// find the folders about to be created, the deepest first
+	var created []string
+	for p := filepath.Clean(dir); ; p = filepath.Dir(p) {
+		if _, err := os.Stat(p); err == nil || filepath.Dir(p) == p {
+			break
+		}
+		created = append(created, p)
+	}
+
+	if err := os.MkdirAll(dir, defaultPerms); err != nil {
+		return err
+	}
+	owner := fileOwner.Load()
+	var err error
+	for _, p := range created {
+		if owner.DirMode != 0 {
+			err = errors.Join(err, os.Chmod(p, owner.DirMode))
+		}
+		err = errors.Join(err, owner.chown(p))
+	}
+	return err
+}
+
+// ownFile gives the file at p the mode and owner set by SetFileOptions
+func ownFile(p string) error {
+	owner := fileOwner.Load()
+	if owner.FileMode != 0 {
+		if err := os.Chmod(p, owner.FileMode); err != nil {
+			return err
+		}
+	}
+	return owner.chown(p)
+}
+
+// createFile creates or truncates the file at p, with the mode and owner set by
+// SetFileOptions
+func createFile(p string) (*os.File, error) {
+	f, err := os.Create(p)
+	if err != nil {
+		return nil, err
+	}
+	if err := ownFile(p); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// createTemp creates a new file in dir as os.CreateTemp does, with the mode of
+// os.Create rather than a private one: 0666 less the umask
+func createTemp(dir, pattern string) (*os.File, error) {
+	f, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Chmod(0666 &^ umask); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
+
+// chown gives the file or folder at p the owner and group of o
+func (o *ownerOptions) chown(p string) error {
+	if o.uid == -1 && o.gid == -1 {
+		return nil
+	}
+	return os.Lchown(p, o.uid, o.gid)
+}
@@ -0,0 +1,61 @@
+package crawal
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// TestFileModes checks that the temporary files of downloads get the mode of
+// os.Create, and the files and folders written the mode set by SetFileOptions
+func TestFileModes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no Unix modes")
+	}
+	t.Cleanup(func() { SetFileOptions(FileOptions{}) })
+	dir := t.TempDir()
+
+	f, err := createTemp(dir, ".download-*.part")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if name := filepath.Base(f.Name()); !strings.HasPrefix(name, ".download-") || !strings.HasSuffix(name, ".part") {
+		t.Errorf("temporary file named %s, want the pattern", name)
+	}
+	checkMode(t, f.Name(), 0666&^umask)
+
+	if err := SetFileOptions(FileOptions{FileMode: 0640, DirMode: 0750}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ownFile(f.Name()); err != nil {
+		t.Fatal(err)
+	}
+	checkMode(t, f.Name(), 0640)
+	sub := filepath.Join(dir, "AzurLane", "skins")
+	if err := makeDirs(sub); err != nil {
+		t.Fatal(err)
+	}
+	checkMode(t, filepath.Dir(sub), os.ModeDir|0750)
+	checkMode(t, sub, os.ModeDir|0750)
+	created, err := createFile(filepath.Join(sub, "wallpaper.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	created.Close()
+	checkMode(t, created.Name(), 0640)
+}
+
+// checkMode fails when the file at p does not have mode
+func checkMode(t *testing.T, p string, mode os.FileMode) {
+	t.Helper()
+	info, err := os.Stat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode() != mode {
+		t.Errorf("%s has the mode %v, want %v", filepath.Base(p), info.Mode(), mode)
+	}
+}
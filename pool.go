@@ -0,0 +1,25 @@
+package crawal
+
+import "sync"
+
+// parallel calls fn for each index below n, workers at a time, and returns once
+// every call returned. It is the worker pool of the tasks that are not download
+// jobs, such as fetching pages or hashing files.
+func parallel(n, workers int, fn func(i int)) {
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(max(workers, 1), n); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
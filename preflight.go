@@ -0,0 +1,160 @@
+package crawal
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// preflightTimeout bounds each HEAD request of Preflight
+const preflightTimeout = 30 * time.Second
+
+// PreflightReport summarizes the HEAD requests sent for the queued jobs
+type PreflightReport struct {
+	Checked    int
+	TotalBytes int64 // sum of the sizes announced by the servers
+	Unknown    int   // jobs whose size could not be learned
+	Dead       []Job // jobs whose URL answered 404 or 410, marked failed
+	ErrorPages []Job // jobs whose URL answered a page instead of an image, marked failed
+}
+
+// Preflight sends HEAD requests for every queued job, workers at a time. The size
+// announced for each job is recorded for the progress of the downloads, and jobs
+// whose URL is gone, or answers an HTML or text page, are marked failed instead of
+// being downloaded.
+func Preflight(db *sql.DB, workers int) (PreflightReport, error) {
+	var report PreflightReport
+	jobs, err := ListJobs(db, JobQueued)
+	if err != nil {
+		return report, err
+	}
+
+	client := &http.Client{Timeout: preflightTimeout, Transport: downloadTransport.Load(), CheckRedirect: checkRedirect}
+	sem := make(chan struct{}, max(workers, 1))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(job Job) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			size, status, contentType, err := headURL(client, job.URL)
+			var pageErr error
+			if err == nil {
+				pageErr = errorPage(nil, contentType)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checked++
+			switch {
+			case isGone(status):
+				msg := fmt.Sprintf("dead link: %d %s", status, http.StatusText(status))
+				_, err := db.Exec("UPDATE download_jobs SET state = ?, error = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", JobFailed, msg, job.ID)
+				if err != nil {
+					logger.Printf("Error marking %s dead: %v", job.FileName, err)
+				}
+				if err := recordGoneLink(db, job, status); err != nil {
+					logger.Printf("Error recording the dead link of %s: %v", job.FileName, err)
+				}
+				report.Dead = append(report.Dead, job)
+			case pageErr != nil:
+				_, err := db.Exec("UPDATE download_jobs SET state = ?, error = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", JobFailed, pageErr.Error(), job.ID)
+				if err != nil {
+					logger.Printf("Error marking %s failed: %v", job.FileName, err)
+				}
+				report.ErrorPages = append(report.ErrorPages, job)
+			case err != nil || size <= 0:
+				report.Unknown++
+			default:
+				report.TotalBytes += size
+				if err := updateJob(db, job.ID, "size = ?", size); err != nil {
+					logger.Printf("Error recording the size of %s: %v", job.FileName, err)
+				}
+			}
+		}(job)
+	}
+	wg.Wait()
+	return report, nil
+}
+
+// headURL returns the size and type announced for url and the status of the HEAD
+// request
+func headURL(client *http.Client, url string) (int64, int, string, error) {
+	res, err := client.Head(url)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return 0, res.StatusCode, "", fmt.Errorf("HEAD %s: %s", url, res.Status)
+	}
+	return res.ContentLength, res.StatusCode, res.Header.Get("Content-Type"), nil
+}
+
+// progress tracks the downloads of a drained queue to log how far along they are
+type progress struct {
+	mu        sync.Mutex
+	start     time.Time
+	jobs      int
+	bytes     int64 // announced size of the jobs, 0 when any is unknown
+	doneJobs  int
+	doneBytes int64
+}
+
+// newProgress starts tracking the jobs currently queued
+func newProgress(db *sql.DB) (*progress, error) {
+	p := &progress{start: time.Now()}
+	var unknown int
+	err := db.QueryRow("SELECT COUNT(*), COALESCE(SUM(size), 0), COUNT(*) FILTER (WHERE size = 0) FROM download_jobs WHERE state = ? AND paused = 0",
+		JobQueued).Scan(&p.jobs, &p.bytes, &unknown)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count download jobs: %w", err)
+	}
+	if unknown > 0 {
+		p.bytes = 0
+	}
+	return p, nil
+}
+
+// done records a finished job and logs the progress with an estimate of the time left,
+// by bytes when all sizes are known and by images otherwise
+func (p *progress) done(job Job) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.doneJobs++
+	p.doneBytes += job.Size
+	if p.jobs == 0 || p.doneJobs > p.jobs {
+		return
+	}
+
+	ratio := float64(p.doneJobs) / float64(p.jobs)
+	sizes := ""
+	if p.bytes > 0 {
+		ratio = float64(p.doneBytes) / float64(p.bytes)
+		sizes = fmt.Sprintf(", %s of %s", FormatBytes(p.doneBytes), FormatBytes(p.bytes))
+	}
+	eta := "unknown"
+	if ratio > 0 {
+		elapsed := time.Since(p.start)
+		eta = (time.Duration(float64(elapsed)/ratio) - elapsed).Round(time.Second).String()
+	}
+	logger.Printf("Progress: %d/%d images%s, ETA %s", p.doneJobs, p.jobs, sizes, eta)
+}
+
+// FormatBytes prints a size with a binary unit, e.g. 12.3 MiB
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,138 @@
+package crawal
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ResponseLog records the SHA-256 of every response of the API of a game fetched
+// during a crawler run, so that the files downloaded in the run can be traced back
+// to the listing they were found in
+type ResponseLog struct {
+	db           *sql.DB
+	game, region string
+	Run          string // ID of the run, given to SyncOptions.Run
+}
+
+// NewResponseLog returns the response log of a new run of the crawler of game
+func NewResponseLog(db *sql.DB, game, region string) *ResponseLog {
+	return &ResponseLog{db: db, game: game, region: region, Run: time.Now().UTC().Format("20060102T150405.000000000Z")}
+}
+
+// Transport wraps next so that the checksum of every response of the API is recorded
+func (l *ResponseLog) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return responseLogTransport{log: l, next: next}
+}
+
+// responseLogTransport records the responses it passes through
+type responseLogTransport struct {
+	log  *ResponseLog
+	next http.RoundTripper
+}
+
+func (t responseLogTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		return res, err
+	}
+
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	_, err = t.log.db.Exec("INSERT INTO api_responses(run, game, region, url, status, size, sha256) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		t.log.Run, t.log.game, t.log.region, req.URL.String(), res.StatusCode, len(body), sha256Hex(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to record response: %w", err)
+	}
+	return res, nil
+}
+
+// sha256Hex returns the hex SHA-256 of b
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Provenance traces the file of a wallpaper back to its source: its checksum, when
+// and from where it was downloaded, and the API responses of the run that listed
+// it then, with the archived snapshot of each when kept with --archive=db
+type Provenance struct {
+	ID           int64                `json:"id"`
+	Game         string               `json:"game"`
+	IdGallery    string               `json:"id_gallery"`
+	Type         string               `json:"type"`
+	URL          string               `json:"url"`
+	SourceURL    string               `json:"source_url,omitempty"`   // alternate of URL it was downloaded from
+	ResolvedURL  string               `json:"resolved_url,omitempty"` // once redirected, normalized
+	Path         string               `json:"path"`
+	SHA256       string               `json:"sha256"`
+	Size         int64                `json:"size"`
+	DownloadedAt *time.Time           `json:"downloaded_at"` // nil for cataloged wallpapers
+	Run          string               `json:"run,omitempty"`
+	Responses    []ProvenanceResponse `json:"responses"`
+}
+
+// ProvenanceResponse is an API response of the run that listed a wallpaper
+type ProvenanceResponse struct {
+	APIResponse
+	Region     string `json:"region"`
+	SnapshotID int64  `json:"snapshot_id,omitempty"` // archived response with the same checksum
+}
+
+// GetProvenance returns the provenance of the file of a wallpaper. Files downloaded
+// before the responses were recorded have no run.
+func GetProvenance(db *sql.DB, item GalleryItem) (Provenance, error) {
+	p := Provenance{
+		ID:          item.ID,
+		Game:        item.Game,
+		IdGallery:   item.IdGallery,
+		Type:        item.Type,
+		URL:         item.URL,
+		SourceURL:   item.SourceURL,
+		ResolvedURL: item.ResolvedURL,
+		Path:        item.Path,
+		SHA256:      item.SHA256,
+		Size:        item.Size,
+		Responses:   []ProvenanceResponse{},
+	}
+	var downloaded sql.NullTime
+	if err := db.QueryRow("SELECT downloaded_at, listed_run FROM files WHERE id = ?", item.ID).Scan(&downloaded, &p.Run); err != nil {
+		return p, err
+	}
+	if downloaded.Valid {
+		p.DownloadedAt = &downloaded.Time
+	}
+	if p.Run == "" {
+		return p, nil
+	}
+
+	rows, err := db.Query(`
+		SELECT r.url, r.status, r.size, r.sha256, r.fetched_at, r.region,
+			COALESCE((SELECT MAX(s.id) FROM api_snapshots s WHERE s.url = r.url AND s.sha256 = r.sha256), 0)
+		FROM api_responses r WHERE r.run = ? AND r.game = ? ORDER BY r.id`, p.Run, p.Game)
+	if err != nil {
+		return p, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r ProvenanceResponse
+		if err := rows.Scan(&r.URL, &r.Status, &r.Size, &r.SHA256, &r.FetchedAt, &r.Region, &r.SnapshotID); err != nil {
+			return p, err
+		}
+		p.Responses = append(p.Responses, r)
+	}
+	return p, rows.Err()
+}
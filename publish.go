@@ -0,0 +1,76 @@
+package crawal
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// publishedAtFormat is the ISO-8601 layout publication dates are stored with, in UTC
+const publishedAtFormat = "2006-01-02T15:04:05Z"
+
+// epochMillis is the smallest epoch in milliseconds told apart from one in seconds,
+// which would be past the year 5000
+const epochMillis = 100_000_000_000
+
+// publishLayouts are the layouts of the date strings of the game APIs, tried in order
+var publishLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006/01/02 15:04:05",
+	"2006-01-02",
+	"2006/01/02",
+}
+
+// regionLocations are the time zones the APIs of a region write dates without an
+// offset in. The sites of Japan and Korea run on their local time, the global ones on UTC.
+var regionLocations = map[string]*time.Location{
+	RegionGlobal: time.UTC,
+	RegionJP:     time.FixedZone("JST", 9*60*60),
+	RegionKR:     time.FixedZone("KST", 9*60*60),
+}
+
+// RegionLocation returns the time zone of the dates without an offset of the APIs of
+// region, UTC for unknown regions
+func RegionLocation(region string) *time.Location {
+	if loc, ok := regionLocations[region]; ok {
+		return loc
+	}
+	return time.UTC
+}
+
+// ParsePublishTime parses the publication date of a row of a game API, whatever the
+// API gives: epoch seconds or milliseconds, as a JSON number or string, or a date
+// string with or without an offset, read in loc when it has none. It returns the date
+// in UTC, zero when the API gives none (null, empty or 0).
+func ParsePublishTime(raw json.RawMessage, loc *time.Location) (time.Time, error) {
+	s := strings.TrimSpace(string(raw))
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = strings.TrimSpace(unquoted)
+	}
+	if s == "" || s == "null" || s == "0" {
+		return time.Time{}, nil
+	}
+
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		if n < 0 {
+			return time.Time{}, fmt.Errorf("negative publication date %s", s)
+		}
+		if n >= epochMillis {
+			return time.UnixMilli(int64(n)).UTC(), nil
+		}
+		return time.Unix(int64(n), 0).UTC(), nil
+	}
+
+	for _, layout := range publishLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown publication date format %q", s)
+}
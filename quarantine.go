@@ -0,0 +1,193 @@
+package crawal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// quarantineDir is the folder, next to where a download would have been saved, that
+// keeps the files failing its checks out of the library
+const quarantineDir = ".quarantine"
+
+// Bounds of the size of a sound image. Smaller files are error stubs unless they
+// decode, as the tiny images of some games do.
+const (
+	minImageSize = 1 << 10
+	maxImageSize = 1 << 30
+)
+
+// errImplausibleSize is the reason of the files out of the bounds of the size of
+// an image, which downloading again doesn't change
+var errImplausibleSize = errors.New("implausible size")
+
+// Quarantined is a download kept out of the library, as it fails the checks of
+// the images
+type Quarantined struct {
+	ID        int64
+	JobID     int64 // 0 when it was not downloaded by a queue
+	Game      string
+	IdGallery string
+	Type      string
+	URL       string
+	Path      string
+	Reason    string
+	At        time.Time
+}
+
+// errErrorPage is the reason of the HTML or text pages served with a 200 instead of
+// an image, as the error pages of some CDNs
+var errErrorPage = errors.New("page served instead of an image")
+
+// pageTitle matches the title of an HTML page
+var pageTitle = regexp.MustCompile(`(?is)<title[^>]*>\s*(.*?)\s*</title>`)
+
+// suspiciousDownload returns why the file downloaded at p, of size bytes and served
+// as contentType, is no image of the library: an HTML or text page such as the error
+// page of a CDN, an image failing to decode, or an implausible size: over
+// maxImageSize, or under minImageSize without being an image that decodes
+func suspiciousDownload(p, contentType string, size int64) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	header := make([]byte, 4096)
+	n, _ := io.ReadFull(f, header)
+	f.Close()
+	header = header[:n]
+	if err := errorPage(header, contentType); err != nil {
+		return err
+	}
+
+	if size > maxImageSize {
+		return fmt.Errorf("%w, %s", errImplausibleSize, FormatBytes(size))
+	}
+	if err := checkImage(p); err != nil {
+		return err
+	}
+	// checkImage passes what it cannot decode, which a small file has to be
+	if _, err := sniffDecoder(header); err != nil && size < minImageSize {
+		return fmt.Errorf("%w, %s and no image", errImplausibleSize, FormatBytes(size))
+	}
+	return nil
+}
+
+// errorPage returns an error wrapping errErrorPage when the body starting with
+// header, served as contentType, is a page rather than an image. The body wins over
+// the Content-Type, which some servers get wrong for images. header is empty for the
+// responses to HEAD requests.
+func errorPage(header []byte, contentType string) error {
+	if _, ok := sniffFormat(header); ok {
+		return nil
+	}
+	detected := ""
+	if len(header) > 0 {
+		detected, _, _ = mime.ParseMediaType(http.DetectContentType(header))
+	}
+	served, _, _ := mime.ParseMediaType(contentType)
+	for _, t := range []string{detected, served} {
+		if !strings.HasPrefix(t, "text/") && t != "application/json" && t != "application/xml" {
+			continue
+		}
+		if m := pageTitle.FindSubmatch(header); m != nil && len(m[1]) > 0 {
+			title := []rune(strings.Join(strings.Fields(string(m[1])), " "))
+			if len(title) > 80 {
+				title = append(title[:80], '…')
+			}
+			return fmt.Errorf("%s %w: %q", t, errErrorPage, string(title))
+		}
+		return fmt.Errorf("%s %w", t, errErrorPage)
+	}
+	return nil
+}
+
+// quarantineFile moves the file at tmp into the quarantine folder of dir, named
+// name, and returns its path
+func quarantineFile(tmp, dir, name string) (string, error) {
+	qdir := filepath.Join(dir, quarantineDir)
+	if err := makeDirs(qdir); err != nil {
+		return "", fmt.Errorf("failed to create quarantine folder: %w", err)
+	}
+	p := filepath.Join(qdir, name)
+	if _, err := os.Stat(p); err == nil {
+		p = freePath(p)
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		return "", fmt.Errorf("failed to quarantine file: %w", err)
+	}
+	return p, nil
+}
+
+// quarantineJob records the file of a job quarantined by the download
+func quarantineJob(db *sql.DB, job Job, corrupt *CorruptError) error {
+	_, err := db.Exec("INSERT INTO quarantine(job_id, game, id_gallery, type, url, path, reason) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		job.ID, job.Game, job.IdGallery, job.Type, job.URL, storedPath(corrupt.Path), corrupt.Err.Error())
+	if err != nil {
+		return fmt.Errorf("failed to record quarantined file: %w", err)
+	}
+	return nil
+}
+
+// ListQuarantined returns the files in quarantine of game, or of all games when
+// empty, latest first
+func ListQuarantined(db *sql.DB, game string) ([]Quarantined, error) {
+	rows, err := db.Query(`SELECT id, job_id, game, id_gallery, type, url, path, reason, at FROM quarantine
+		WHERE ? = '' OR game = ? ORDER BY id DESC`, game, game)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list quarantined files: %w", err)
+	}
+	defer rows.Close()
+	var list []Quarantined
+	for rows.Next() {
+		var q Quarantined
+		if err := rows.Scan(&q.ID, &q.JobID, &q.Game, &q.IdGallery, &q.Type, &q.URL, &q.Path, &q.Reason, &q.At); err != nil {
+			return nil, err
+		}
+		q.Path = resolvePath(q.Path)
+		list = append(list, q)
+	}
+	return list, rows.Err()
+}
+
+// DeleteQuarantined deletes the file in quarantine id and forgets it
+func DeleteQuarantined(db *sql.DB, id int64) error {
+	var p string
+	if err := db.QueryRow("SELECT path FROM quarantine WHERE id = ?", id).Scan(&p); err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("no quarantined file %d", id)
+		}
+		return err
+	}
+	if err := os.Remove(resolvePath(p)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	_, err := db.Exec("DELETE FROM quarantine WHERE id = ?", id)
+	return err
+}
+
+// RetryQuarantined deletes the file in quarantine id and queues its failed job
+// again, for a later download
+func RetryQuarantined(db *sql.DB, id int64) error {
+	var jobID int64
+	if err := db.QueryRow("SELECT job_id FROM quarantine WHERE id = ?", id).Scan(&jobID); err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("no quarantined file %d", id)
+		}
+		return err
+	}
+	if jobID == 0 {
+		return fmt.Errorf("quarantined file %d was not downloaded by a queue", id)
+	}
+	if err := RetryJob(db, jobID); err != nil {
+		return err
+	}
+	return DeleteQuarantined(db, id)
+}
@@ -0,0 +1,140 @@
+package crawal
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testJPEG returns a JPEG of noise, well over minImageSize
+func testJPEG(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 128, 128))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i * 7919 >> 3)
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// testPNG returns a PNG of a single pixel, under minImageSize
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, 1, 1))
+	img.Set(0, 0, color.White)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSuspiciousDownload(t *testing.T) {
+	full := testJPEG(t)
+	tests := []struct {
+		name        string
+		body        []byte
+		contentType string
+		want        error // nil, errErrorPage, errImplausibleSize or any other error
+		wantAny     bool
+	}{
+		{"jpeg", full, "image/jpeg", nil, false},
+		{"tiny png", testPNG(t), "image/png", nil, false},
+		{"truncated jpeg", full[:len(full)/2], "image/jpeg", nil, true},
+		{"html page", []byte("<!DOCTYPE html><html><head><title>Access Denied</title></head></html>"), "image/jpeg", errErrorPage, false},
+		{"json error", []byte(`{"error": "rate limited"}`), "application/json", errErrorPage, false},
+		{"tiny stub", []byte("\x00\x01 not an image"), "image/png", errImplausibleSize, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := filepath.Join(t.TempDir(), "download")
+			if err := os.WriteFile(p, tt.body, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			err := suspiciousDownload(p, tt.contentType, int64(len(tt.body)))
+			switch {
+			case tt.wantAny:
+				if err == nil || errors.Is(err, errErrorPage) || errors.Is(err, errImplausibleSize) {
+					t.Errorf("error %v, want a decoding error", err)
+				}
+			case tt.want == nil && err != nil:
+				t.Errorf("error %v, want none", err)
+			case !errors.Is(err, tt.want):
+				t.Errorf("error %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// a truncated JPEG still sniffs as one, and is named after it
+	p := filepath.Join(t.TempDir(), "download")
+	if err := os.WriteFile(p, full[:len(full)/2], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if format, ok := sniffFile(p); !ok || !format.hasExt(".jpg") {
+		t.Errorf("sniffFile of a truncated JPEG = %v, %v, want JPEG", format.exts, ok)
+	}
+}
+
+// TestDownloadQuarantine checks that suspicious downloads are downloaded again,
+// except for those of an implausible size, and that the file of the last attempt
+// is kept in quarantine out of the library
+func TestDownloadQuarantine(t *testing.T) {
+	SetLogger(nil)
+	corruptRetryDelay = 0
+	t.Cleanup(func() { corruptRetryDelay = 2 * time.Second })
+	full := testJPEG(t)
+	tests := []struct {
+		name         string
+		body         []byte
+		contentType  string
+		wantRequests int
+	}{
+		{"truncated jpeg", full[:len(full)/2], "image/jpeg", corruptRetries + 1},
+		{"html page", []byte("<html><head><title>502 Bad Gateway</title></head></html>"), "text/html", corruptRetries + 1},
+		{"tiny stub", []byte("\x00\x01 not an image"), "image/jpeg", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Write(tt.body)
+			}))
+			defer srv.Close()
+
+			dir := t.TempDir()
+			_, err := DownloadFile(srv.URL+"/wallpaper.jpg", "wallpaper", dir)
+			var corrupt *CorruptError
+			if !errors.As(err, &corrupt) {
+				t.Fatalf("error %v, want a CorruptError", err)
+			}
+			if got := int(requests.Load()); got != tt.wantRequests {
+				t.Errorf("%d requests, want %d", got, tt.wantRequests)
+			}
+			if want := filepath.Join(dir, quarantineDir, "wallpaper.jpg"); corrupt.Path != want {
+				t.Errorf("quarantined at %q, want %q", corrupt.Path, want)
+			}
+			quarantined, _ := os.ReadDir(filepath.Join(dir, quarantineDir))
+			if len(quarantined) != 1 {
+				t.Errorf("%d files in quarantine, want the last attempt only", len(quarantined))
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+				t.Errorf("%d entries in the library, want the quarantine folder only", len(entries))
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package crawal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// redownloadSuffix names the file a wallpaper is downloaded again into, next to its
+// current file, until both are compared
+const redownloadSuffix = "_redownload"
+
+// RedownloadGalleryItem downloads the file of a wallpaper again from its URL, such as
+// after the game replaced a low resolution upload. A file that differs from the
+// current one replaces it, the current file being archived as a revision, and is
+// checked for duplicates according to mode; an identical one is dropped. It
+// reports whether the file was replaced.
+func RedownloadGalleryItem(db *sql.DB, item *GalleryItem, mode string) (bool, error) {
+	if item.Cataloged || item.Path == "" {
+		return false, errors.New("wallpaper is not downloaded")
+	}
+	if item.URL == "" {
+		return false, errors.New("wallpaper has no URL to download")
+	}
+
+	dir := filepath.Dir(item.Path)
+	name := strings.TrimSuffix(filepath.Base(item.Path), filepath.Ext(item.Path))
+	p, err := DownloadFile(item.URL, name+redownloadSuffix, dir)
+	if err != nil {
+		return false, err
+	}
+	sum, _, err := HashFile(p)
+	if err != nil {
+		os.Remove(p)
+		return false, err
+	}
+	if sum == item.SHA256 {
+		return false, os.Remove(p)
+	}
+
+	// Keep the replaced file as a revision, the new one taking its name; the
+	// extension follows the format downloaded
+	if _, err := ArchiveRevision(db, item.Game, item.Region, item.IdGallery, item.Type); err != nil {
+		os.Remove(p)
+		return false, fmt.Errorf("failed to archive revision: %w", err)
+	}
+	os.Remove(ThumbnailPath(item.Path))
+	target := filepath.Join(dir, name+filepath.Ext(p))
+	if err := os.Rename(p, target); err != nil {
+		return false, fmt.Errorf("failed to replace file: %w", err)
+	}
+
+	item.Path = target
+	item.SHA256, item.Size, item.OriginalSize = "", 0, 0
+	item.PHash, item.DuplicateOf = "", 0
+	item.DominantColor, item.Color, item.Brightness = "", "", -1
+	item.Width, item.Height, item.Aspect = 0, 0, 0
+
+	// the file is recorded even when the duplicate check fails
+	_, dupErr := DedupeItem(db, item, mode)
+	if err := SaveGalleryItem(db, *item); err != nil {
+		return true, err
+	}
+	return true, dupErr
+}
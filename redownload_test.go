@@ -0,0 +1,64 @@
+package crawal
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestRedownloadGalleryItem checks that a changed upload replaces the file, which
+// is kept as a revision, and that an identical one is dropped
+func TestRedownloadGalleryItem(t *testing.T) {
+	SetLogger(nil)
+	db := newPageTestDB(t, 0)
+	dir := t.TempDir()
+	// the upload served again is the same image with a comment segment added
+	old, served := testJPEG(t), testJPEG(t)
+	served = append(served[:len(served)-2:len(served)-2], 0xff, 0xfe, 0, 4, 'v', '2', 0xff, 0xd9)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(served)
+	}))
+	defer srv.Close()
+
+	p := filepath.Join(dir, "wallpaper.jpg")
+	if err := os.WriteFile(p, old, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveGalleryItem(db, GalleryItem{Game: "azur_lane", IdGallery: "1", Type: "wallpaper", FileName: "wallpaper", URL: srv.URL + "/wallpaper.jpg", Path: p}); err != nil {
+		t.Fatal(err)
+	}
+	item, err := GetGalleryItem(db, "azur_lane", "", "1", "wallpaper")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replaced, err := RedownloadGalleryItem(db, &item, DedupeOff)
+	if err != nil || !replaced {
+		t.Fatalf("RedownloadGalleryItem = %v, %v, want the file replaced", replaced, err)
+	}
+	if b, _ := os.ReadFile(p); !bytes.Equal(b, served) {
+		t.Error("file not replaced by the download")
+	}
+	revisions, err := ListRevisions(db, item.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 1 {
+		t.Fatalf("%d revisions, want the replaced file", len(revisions))
+	}
+	if b, _ := os.ReadFile(revisions[0].Path); !bytes.Equal(b, old) {
+		t.Error("revision does not hold the replaced file")
+	}
+
+	item, _ = GetGalleryItem(db, "azur_lane", "", "1", "wallpaper")
+	if replaced, err := RedownloadGalleryItem(db, &item, DedupeOff); err != nil || replaced {
+		t.Errorf("RedownloadGalleryItem of the same upload = %v, %v, want it dropped", replaced, err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*"+redownloadSuffix+"*")); len(matches) > 0 {
+		t.Errorf("download left at %v", matches)
+	}
+}
@@ -0,0 +1,299 @@
+package crawal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// RelocateOptions configure Relocate
+type RelocateOptions struct {
+	To     string // new root of the library
+	From   string // current root, by default the deepest folder containing every file
+	DryRun bool   // only report what would be moved
+}
+
+// RelocateReport summarizes a Relocate run
+type RelocateReport struct {
+	From     string
+	To       string
+	Moved    int   // files moved, revisions included
+	Bytes    int64 // size of the files moved
+	Verified int   // moved files whose checksum was verified
+	Missing  []string
+	Outside  []string // files outside From, left in place
+	Corrupt  []string // moved files whose checksum no longer matches
+}
+
+// Relocate moves every file of the library, with its thumbnail and revisions, from
+// its root to a new one, keeping the folders below it, and rewrites the stored paths
+// and the folders of pending downloads. Files are renamed when both roots are on the
+// same drive, and copied then deleted otherwise. The paths are stored absolute while
+// the files move, each rewritten as soon as its file is moved, so an interrupted run
+// can be resumed with the same From. The root of the library moves along when it is
+// under From. The moved files are verified against their checksums afterward.
+func Relocate(db *sql.DB, opts RelocateOptions) (RelocateReport, error) {
+	report := RelocateReport{To: opts.To}
+	paths, sums, err := libraryPaths(db)
+	if err != nil {
+		return report, err
+	}
+
+	from := opts.From
+	if from == "" {
+		for _, p := range paths {
+			abs, err := filepath.Abs(p)
+			if err != nil {
+				return report, err
+			}
+			from = commonDir(from, filepath.Dir(abs))
+		}
+	}
+	if from == "" {
+		return report, fmt.Errorf("the library has no files")
+	}
+	if from, err = filepath.Abs(from); err != nil {
+		return report, err
+	}
+	to, err := filepath.Abs(opts.To)
+	if err != nil {
+		return report, err
+	}
+	if to == from {
+		return report, fmt.Errorf("the library is already in %s", from)
+	}
+	report.From = from
+
+	root := libraryRoot
+	if !opts.DryRun {
+		if err := RebaseLibrary(db, ""); err != nil {
+			return report, err
+		}
+	}
+
+	moved := make(map[string]string) // checksums by new path
+	for _, p := range paths {
+		rel, ok := relativePath(from, p)
+		if !ok {
+			report.Outside = append(report.Outside, p)
+			continue
+		}
+		dst := filepath.Join(opts.To, rel)
+		info, err := os.Stat(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			report.Missing = append(report.Missing, p)
+		} else if err != nil {
+			return report, err
+		}
+		if opts.DryRun {
+			if info != nil {
+				report.Moved++
+				report.Bytes += info.Size()
+			}
+			continue
+		}
+
+		if info != nil {
+			if err := moveFile(p, dst, sums[p]); err != nil {
+				return report, fmt.Errorf("failed to move %s: %w", p, err)
+			}
+			if thumb := ThumbnailPath(p); fileExists(thumb) {
+				if err := moveFile(thumb, ThumbnailPath(dst), ""); err != nil {
+					logger.Printf("Error moving the thumbnail of %s: %v", p, err)
+				}
+			}
+			report.Moved++
+			report.Bytes += info.Size()
+			moved[dst] = sums[p]
+		}
+		if err := rewritePath(db, storedPath(p), storedPath(dst)); err != nil {
+			return report, err
+		}
+	}
+	if opts.DryRun {
+		return report, nil
+	}
+
+	if err := rewriteJobDirs(db, from, opts.To); err != nil {
+		return report, err
+	}
+	removeEmptyDirs(from, paths)
+
+	newRoot := root
+	if root == "" {
+		newRoot = opts.To
+	} else if rel, ok := relativePath(from, root); ok {
+		newRoot = filepath.Join(opts.To, rel)
+	}
+	if err := RebaseLibrary(db, newRoot); err != nil {
+		return report, err
+	}
+
+	for p, sum := range moved {
+		if sum == "" {
+			continue
+		}
+		got, _, err := HashFile(p)
+		if err != nil || got != sum {
+			report.Corrupt = append(report.Corrupt, p)
+		}
+		report.Verified++
+	}
+	sort.Strings(report.Corrupt)
+	return report, nil
+}
+
+// libraryPaths returns the distinct paths of the files and revisions of the library,
+// resolved, with the checksums of the files
+func libraryPaths(db *sql.DB) ([]string, map[string]string, error) {
+	rows, err := db.Query(`
+		SELECT path, MAX(sha256) FROM files WHERE path != '' GROUP BY path
+		UNION ALL
+		SELECT path, '' FROM revisions WHERE path != '' GROUP BY path`)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list files: %w", err)
+	}
+	defer rows.Close()
+
+	var paths []string
+	sums := make(map[string]string)
+	for rows.Next() {
+		var p, sum string
+		if err := rows.Scan(&p, &sum); err != nil {
+			return nil, nil, err
+		}
+		p = resolvePath(p)
+		if _, ok := sums[p]; !ok {
+			paths = append(paths, p)
+		}
+		if sum != "" || sums[p] == "" {
+			sums[p] = sum
+		}
+	}
+	return paths, sums, rows.Err()
+}
+
+// relativePath returns the path of p relative to the absolute folder root, and whether
+// p is inside it
+func relativePath(root, p string) (string, bool) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// moveFile moves the file at src to dst, which must not exist, copying it across
+// drives. A copy is only kept, and src deleted, when it matches the checksum sum,
+// if known.
+func moveFile(src, dst, sum string) error {
+	if fileExists(dst) {
+		return fmt.Errorf("%s already exists", dst)
+	}
+	if err := makeDirs(filepath.Dir(dst)); err != nil {
+		return fmt.Errorf("failed to create folder: %w", err)
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	tmp := dst + ".part"
+	if sum != "" {
+		if err := copyVerified(tmp, sum, func() (io.ReadCloser, error) { return os.Open(src) }); err != nil {
+			return err
+		}
+	} else if err := copyFile(src, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// fileExists reports whether there is a file at p
+func fileExists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+// rewritePath replaces the path of the files and revisions stored at p with dst
+func rewritePath(db *sql.DB, p, dst string) error {
+	for _, table := range []string{"files", "revisions"} {
+		if _, err := db.Exec("UPDATE "+table+" SET path = ? WHERE path = ?", dst, p); err != nil {
+			return fmt.Errorf("failed to rewrite the path of %s: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// rewriteJobDirs moves the folders of the pending downloads under from to the same
+// folders under to
+func rewriteJobDirs(db *sql.DB, from, to string) error {
+	rows, err := db.Query("SELECT DISTINCT dir FROM download_jobs WHERE dir != '' AND state != ?", JobDone)
+	if err != nil {
+		return fmt.Errorf("failed to list download folders: %w", err)
+	}
+	var dirs []string
+	for rows.Next() {
+		var dir string
+		if err := rows.Scan(&dir); err != nil {
+			rows.Close()
+			return err
+		}
+		dirs = append(dirs, dir)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, dir := range dirs {
+		rel, ok := relativePath(from, resolvePath(dir))
+		if !ok {
+			continue
+		}
+		_, err := db.Exec("UPDATE download_jobs SET dir = ? WHERE dir = ? AND state != ?", storedPath(filepath.Join(to, rel)), dir, JobDone)
+		if err != nil {
+			return fmt.Errorf("failed to rewrite download folder %s: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// removeEmptyDirs removes the folders of the moved paths under root, thumbnail and
+// revision folders included, that are left empty
+func removeEmptyDirs(root string, paths []string) {
+	seen := make(map[string]bool)
+	dirs := []string{filepath.Join(root, thumbnailsDir)}
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			continue
+		}
+		for dir := filepath.Dir(abs); dir != root && !seen[dir]; dir = filepath.Dir(dir) {
+			if _, ok := relativePath(root, dir); !ok {
+				break
+			}
+			seen[dir] = true
+			dirs = append(dirs, dir, filepath.Join(dir, thumbnailsDir))
+		}
+	}
+	// the deepest folders first, so that their parents can be empty
+	sort.Slice(dirs, func(i, j int) bool { return len(dirs[i]) > len(dirs[j]) })
+	for _, dir := range dirs {
+		os.Remove(dir)
+	}
+}
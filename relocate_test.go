@@ -0,0 +1,76 @@
+package crawal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestRelocateRelative checks that relative From and To are taken from the working
+// directory, and that the stored paths follow the moved files
+func TestRelocateRelative(t *testing.T) {
+	SetLogger(nil)
+	db := newPageTestDB(t, 0)
+	root, previous := t.TempDir(), LibraryRoot()
+	if err := RebaseLibrary(db, root); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { libraryRoot = previous })
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(root); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	files := map[string]string{"1": filepath.Join("lib", "AzurLane", "a.png"), "2": filepath.Join("lib", "AzurLane", "skins", "b.png")}
+	for id, p := range files {
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("image "+id), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := SaveGalleryItem(db, GalleryItem{Game: "azur_lane", IdGallery: id, Type: "wallpaper", FileName: filepath.Base(p), Path: p}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := Relocate(db, RelocateOptions{From: "lib", To: "moved"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.From != filepath.Join(root, "lib") || report.Moved != 2 || report.Verified != 2 || len(report.Corrupt) != 0 {
+		t.Errorf("report %+v, want 2 files moved and verified from %s", report, filepath.Join(root, "lib"))
+	}
+	if LibraryRoot() != root {
+		t.Errorf("library root %s, want %s kept", LibraryRoot(), root)
+	}
+	for id, p := range files {
+		want, _ := filepath.Rel("lib", p)
+		want = filepath.Join("moved", want)
+		var stored string
+		if err := db.QueryRow("SELECT f.path FROM files f JOIN items i ON i.id = f.item_id WHERE i.id_gallery = ?", id).Scan(&stored); err != nil {
+			t.Fatal(err)
+		}
+		if stored != filepath.ToSlash(want) {
+			t.Errorf("%s stored as %q, want %q relative to the root", id, stored, filepath.ToSlash(want))
+		}
+		item, err := GetGalleryItem(db, "azur_lane", "", id, "wallpaper")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.Path != filepath.Join(root, want) {
+			t.Errorf("%s resolves to %s, want %s", id, item.Path, filepath.Join(root, want))
+		}
+		if _, err := os.Stat(item.Path); err != nil {
+			t.Error(err)
+		}
+	}
+	// the folders emptied below From are removed, From itself is kept
+	if _, err := os.Stat(filepath.Join("lib", "AzurLane")); !os.IsNotExist(err) {
+		t.Errorf("emptied folder left behind: %v", err)
+	}
+}
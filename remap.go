@@ -0,0 +1,296 @@
+package crawal
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Ways a renumbered entry is recognized
+const (
+	RemapURL      = "url"      // an image is listed at the URL of the entry
+	RemapChecksum = "checksum" // the images downloaded again are identical to those of the entry
+)
+
+// Remap is a gallery entry of the library that the API of its game now lists under
+// another ID, after the site was migrated
+type Remap struct {
+	Game string
+	From string // gallery ID in the library
+	To   string // gallery ID listed by the API
+	By   string // RemapURL or RemapChecksum
+
+	itemID int64 // item with the ID From
+	newID  int64 // item already recorded with the ID To, 0 when there is none
+}
+
+// detectRemaps finds the items of an API listing whose ID is new to the library while
+// an image is listed at the URL of an entry of the same game and region that the listing
+// no longer has, so that the entry is renamed rather than downloaded again as new
+func detectRemaps(db *sql.DB, items []Item) ([]Remap, error) {
+	listed := make(map[string]bool)
+	for _, it := range items {
+		listed[it.Game+"\x00"+it.ID] = true
+	}
+
+	var remaps []Remap
+	claimed := make(map[int64]bool)
+	for _, it := range items {
+		known, err := itemExists(db, it.Game, it.ID)
+		if err != nil {
+			return nil, err
+		}
+		if known {
+			continue
+		}
+
+		for _, v := range it.Variants {
+			if v.URL == "" {
+				continue
+			}
+			var r Remap
+			err := db.QueryRow(`
+				SELECT i.id, i.id_gallery FROM files f
+				JOIN items i ON i.id = f.item_id
+				JOIN games g ON g.id = i.game_id
+				WHERE g.name = ? AND i.region = COALESCE(NULLIF(?, ''), 'global') AND f.type = ? AND f.url = ?
+				ORDER BY i.id LIMIT 1`, it.Game, it.Region, v.Kind, v.URL).Scan(&r.itemID, &r.From)
+			if err == sql.ErrNoRows {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to look up %s: %w", v.URL, err)
+			}
+			if listed[it.Game+"\x00"+r.From] || claimed[r.itemID] {
+				continue
+			}
+			claimed[r.itemID] = true
+			r.Game, r.To, r.By = it.Game, it.ID, RemapURL
+			remaps = append(remaps, r)
+			break
+		}
+	}
+	return remaps, nil
+}
+
+// itemExists reports whether the library has the gallery entry of game with the ID
+func itemExists(db *sql.DB, game, idGallery string) (bool, error) {
+	var n int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM items i JOIN games g ON g.id = i.game_id
+		WHERE g.name = ? AND i.id_gallery = ?`, game, idGallery).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up %s/%s: %w", game, idGallery, err)
+	}
+	return n > 0, nil
+}
+
+// FindRemaps finds the entries of game, or of every game when empty, that were
+// downloaded again under a new ID after their API renumbered them: entries of the
+// same game and region that were no longer listed once the new one was, whose files
+// are all identical by checksum or URL to files of the old entry.
+func FindRemaps(db *sql.DB, game string) ([]Remap, error) {
+	rows, err := db.Query(`
+		SELECT g.name, o.id, o.id_gallery, n.id, n.id_gallery,
+			MAX(nf.url = f.url) AS by_url,
+			COUNT(DISTINCT nf.id) = (SELECT COUNT(*) FROM files WHERE item_id = n.id AND cataloged = 0) AS all_files
+		FROM files nf
+		JOIN items n ON n.id = nf.item_id
+		JOIN files f ON f.id != nf.id AND (f.url = nf.url OR (nf.sha256 != '' AND f.sha256 = nf.sha256))
+		JOIN items o ON o.id = f.item_id
+		JOIN games g ON g.id = n.game_id
+		WHERE o.id != n.id AND o.game_id = n.game_id AND o.region = n.region
+			AND nf.cataloged = 0 AND (? = '' OR g.name = ?)
+			AND COALESCE(o.listed_at, o.created_at) < n.created_at
+		GROUP BY o.id, n.id
+		ORDER BY g.name, n.id, o.id`, game, game)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up renumbered entries: %w", err)
+	}
+	defer rows.Close()
+
+	var remaps []Remap
+	claimed := make(map[int64]bool)
+	for rows.Next() {
+		var r Remap
+		var byURL, allFiles bool
+		if err := rows.Scan(&r.Game, &r.itemID, &r.From, &r.newID, &r.To, &byURL, &allFiles); err != nil {
+			return nil, err
+		}
+		// an entry only matching some files of another is a new one sharing images
+		if !allFiles || claimed[r.itemID] || claimed[r.newID] {
+			continue
+		}
+		claimed[r.itemID], claimed[r.newID] = true, true
+		r.By = RemapChecksum
+		if byURL {
+			r.By = RemapURL
+		}
+		remaps = append(remaps, r)
+	}
+	return remaps, rows.Err()
+}
+
+// ApplyRemap renames the gallery entry From to To, keeping its files, tags, OCR text
+// and revisions. When the entry To was already recorded, its files identical to those
+// of From are dropped, deleting copies that are not shared, and the rest are moved to
+// the renamed entry, which takes its metadata.
+func ApplyRemap(db *sql.DB, r Remap) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var remove []string
+	if r.newID != 0 {
+		if remove, err = mergeItem(tx, r.newID, r.itemID); err != nil {
+			return fmt.Errorf("failed to merge %s/%s into %s: %w", r.Game, r.To, r.From, err)
+		}
+	}
+	if _, err := tx.Exec("UPDATE items SET id_gallery = ?, listed_at = CURRENT_TIMESTAMP WHERE id = ?", r.To, r.itemID); err != nil {
+		return fmt.Errorf("failed to rename %s/%s to %s: %w", r.Game, r.From, r.To, err)
+	}
+	// jobs left would record the entry under its old ID again, unless also queued under the new one
+	_, err = tx.Exec(`
+		UPDATE OR IGNORE download_jobs SET id_gallery = ?
+		WHERE game = ? AND id_gallery = ? AND state IN (?, ?)`, r.To, r.Game, r.From, JobQueued, JobFailed)
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM download_jobs WHERE game = ? AND id_gallery = ? AND state IN (?, ?)", r.Game, r.From, JobQueued, JobFailed)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to rename the jobs of %s/%s: %w", r.Game, r.From, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, p := range remove {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			logger.Printf("Error removing %s: %v", p, err)
+		}
+		os.Remove(ThumbnailPath(p))
+	}
+	return nil
+}
+
+// mergeItem moves the files of the item from into the item into, dropping those that
+// have an identical file there, and deletes from after giving its metadata to into.
+// It returns the paths of the dropped files no longer used by the library.
+func mergeItem(tx *sql.Tx, from, into int64) ([]string, error) {
+	rows, err := tx.Query(`
+		SELECT nf.id, nf.path, COALESCE((
+			SELECT f.id FROM files f
+			WHERE f.item_id = ?1 AND f.type = nf.type AND (f.url = nf.url OR (nf.sha256 != '' AND f.sha256 = nf.sha256))
+		), (
+			SELECT f.id FROM files f
+			WHERE f.item_id = ?1 AND (f.url = nf.url OR (nf.sha256 != '' AND f.sha256 = nf.sha256))
+			ORDER BY f.id LIMIT 1
+		))
+		FROM files nf WHERE nf.item_id = ?2`, into, from)
+	if err != nil {
+		return nil, err
+	}
+	type file struct {
+		id   int64
+		path string
+		of   sql.NullInt64
+	}
+	var files []file
+	for rows.Next() {
+		var f file
+		if err := rows.Scan(&f.id, &f.path, &f.of); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var remove []string
+	for _, f := range files {
+		if !f.of.Valid {
+			// a type the old entry does not have, unless it has one of the same type
+			if _, err := tx.Exec("UPDATE OR IGNORE files SET item_id = ? WHERE id = ?", into, f.id); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		// the identical file takes the URL listed now, so that it is not downloaded again
+		for _, stmt := range []string{
+			"UPDATE files SET url = (SELECT url FROM files WHERE id = ?2) WHERE id = ?1",
+			"UPDATE files SET duplicate_of = ?1 WHERE duplicate_of = ?2",
+			"UPDATE OR IGNORE tags SET gallery_id = ?1 WHERE gallery_id = ?2",
+		} {
+			if _, err := tx.Exec(stmt, f.of.Int64, f.id); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := tx.Exec("DELETE FROM ocr_text WHERE gallery_id = ?", f.id); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec("DELETE FROM files WHERE id = ?", f.id); err != nil {
+			return nil, err
+		}
+		if f.path == "" {
+			continue
+		}
+		var used int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM files WHERE path = ?", f.path).Scan(&used); err != nil {
+			return nil, err
+		}
+		if used == 0 {
+			remove = append(remove, resolvePath(f.path))
+		}
+	}
+
+	// files of a type the old entry already has stay with the new one, which is kept
+	var left int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM files WHERE item_id = ?", from).Scan(&left); err != nil {
+		return nil, err
+	}
+	if left > 0 {
+		return nil, fmt.Errorf("%d files differ from those of the entry", left)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE items SET (title, description, artist_id, published_at, metadata) = (
+			SELECT n.title, n.description, COALESCE(n.artist_id, items.artist_id),
+				COALESCE(n.published_at, items.published_at), n.metadata
+			FROM items n WHERE n.id = ?
+		) WHERE id = ?`, from, into)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("UPDATE OR IGNORE item_titles SET item_id = ? WHERE item_id = ?", into, from); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("DELETE FROM items WHERE id = ?", from); err != nil {
+		return nil, err
+	}
+	return remove, nil
+}
+
+// RemapItems detects the entries of an API listing renumbered since the last sync,
+// by the URLs of their images, and renames them in the library
+func RemapItems(db *sql.DB, items []Item) error {
+	remaps, err := detectRemaps(db, items)
+	if err != nil {
+		return err
+	}
+	var renamed []string
+	for _, r := range remaps {
+		if err := ApplyRemap(db, r); err != nil {
+			return err
+		}
+		renamed = append(renamed, r.From+" -> "+r.To)
+	}
+	if len(renamed) > 0 {
+		logger.Printf("Remapped %d entries renumbered by the API: %s", len(renamed), strings.Join(renamed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package crawal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestRemapItems checks that an entry the API lists under a new ID, by the URL of
+// its image, is renamed with its file, unless the old ID is still listed
+func TestRemapItems(t *testing.T) {
+	SetLogger(nil)
+	db := newPageTestDB(t, 0)
+	dir := t.TempDir()
+	for _, id := range []string{"1", "2"} {
+		p := filepath.Join(dir, id+".png")
+		if err := os.WriteFile(p, []byte("image "+id), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		err := SaveGalleryItem(db, GalleryItem{Game: "azur_lane", IdGallery: id, Type: "wallpaper", FileName: id, URL: "https://cdn.example/" + id + ".png", Path: p})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	variant := func(id string) []Variant {
+		return []Variant{{Kind: "wallpaper", URL: "https://cdn.example/" + id + ".png"}}
+	}
+	listed := []Item{
+		{Game: "azur_lane", ID: "101", Title: "1", Variants: variant("1")},
+		{Game: "azur_lane", ID: "2", Title: "2", Variants: variant("2")},
+		// a new entry sharing the image of one still listed is no renumbering
+		{Game: "azur_lane", ID: "102", Title: "2 again", Variants: variant("2")},
+	}
+	if err := RemapItems(db, listed); err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := GetGalleryItem(db, "azur_lane", "", "101", "wallpaper")
+	if err != nil {
+		t.Fatalf("1 not renamed to 101: %v", err)
+	}
+	if item.Path != filepath.Join(dir, "1.png") {
+		t.Errorf("101 has the file %s, want the file of 1", item.Path)
+	}
+	for id, want := range map[string]bool{"1": false, "2": true, "102": false} {
+		if ok, err := itemExists(db, "azur_lane", id); err != nil || ok != want {
+			t.Errorf("%s exists %v (%v), want %v", id, ok, err, want)
+		}
+	}
+}
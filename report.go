@@ -0,0 +1,241 @@
+package crawal
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Report formats written by WriteReport
+const (
+	ReportMarkdown = "md"
+	ReportHTML     = "html"
+)
+
+// reportEntry is a gallery entry of a report, with the files of all its image types
+type reportEntry struct {
+	Title       string
+	Artist      string
+	Description string
+	PublishedAt time.Time
+	Files       []GalleryItem
+	Thumbnail   string // path of the thumbnail, empty when no file is downloaded
+	Image       string // thumbnail, relative to the report or as data URI, or URL shown in its place
+}
+
+// reportGame is the section of a game in a report
+type reportGame struct {
+	Game    string
+	Entries []*reportEntry
+}
+
+// WriteReport writes a Markdown or HTML report of the wallpapers matching the filter
+// that the games published in the month starting at month, per game, to out. The
+// thumbnails of downloaded wallpapers are created if needed, embedded in HTML reports
+// and copied next to Markdown ones; the official image is shown for the others.
+// It returns the number of entries reported.
+func WriteReport(db *sql.DB, f Filter, month time.Time, format, out string) (int, error) {
+	if format != ReportMarkdown && format != ReportHTML {
+		return 0, fmt.Errorf("unknown report format %q", format)
+	}
+	f.PublishedSince = month
+	f.PublishedUntil = month.AddDate(0, 1, 0)
+	items, err := FindGalleryItems(db, f)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query wallpapers: %w", err)
+	}
+
+	games, n := groupReport(items)
+	for _, g := range games {
+		for _, e := range g.Entries {
+			if e.Image, err = reportImage(e, format, out); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	file, err := os.Create(out)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create report: %w", err)
+	}
+	defer file.Close()
+
+	data := struct {
+		Month string
+		Games []reportGame
+	}{month.Format("January 2006"), games}
+	if format == ReportHTML {
+		err = reportTemplate.Execute(file, data)
+	} else {
+		err = writeMarkdownReport(file, data.Month, games)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to write report: %w", err)
+	}
+	return n, file.Close()
+}
+
+// groupReport groups the files of the items by game and gallery entry, ordered by
+// publication date
+func groupReport(items []GalleryItem) ([]reportGame, int) {
+	byGame := make(map[string]*reportGame)
+	byItem := make(map[int64]*reportEntry)
+	var names []string
+	for _, item := range items {
+		e := byItem[item.ItemID]
+		if e == nil {
+			e = &reportEntry{Title: item.Title, Artist: item.Artist, Description: item.Description, PublishedAt: item.PublishedAt.Local()}
+			byItem[item.ItemID] = e
+			g := byGame[item.Game]
+			if g == nil {
+				g = &reportGame{Game: item.Game}
+				byGame[item.Game] = g
+				names = append(names, item.Game)
+			}
+			g.Entries = append(g.Entries, e)
+		}
+		e.Files = append(e.Files, item)
+		if e.Thumbnail == "" && item.Path != "" {
+			if _, err := os.Stat(item.Path); err == nil {
+				e.Thumbnail = ThumbnailPath(item.Path)
+				if err := ensureThumbnail(item.Path); err != nil {
+					logger.Printf("Error creating the thumbnail of %s: %v", item.FileName, err)
+					e.Thumbnail = ""
+				}
+			}
+		}
+	}
+
+	sort.Strings(names)
+	games := make([]reportGame, 0, len(names))
+	for _, name := range names {
+		g := byGame[name]
+		sort.SliceStable(g.Entries, func(i, j int) bool { return g.Entries[i].PublishedAt.Before(g.Entries[j].PublishedAt) })
+		games = append(games, *g)
+	}
+	return games, len(byItem)
+}
+
+// ensureThumbnail creates the thumbnail of the wallpaper file at p unless it exists
+func ensureThumbnail(p string) error {
+	if _, err := os.Stat(ThumbnailPath(p)); err == nil {
+		return nil
+	}
+	img, err := decodeImage(p)
+	if err != nil {
+		return err
+	}
+	return writeThumbnail(img, ThumbnailPath(p))
+}
+
+// reportImage returns the image shown for an entry of a report written to out
+func reportImage(e *reportEntry, format, out string) (string, error) {
+	if e.Thumbnail == "" {
+		return e.Files[0].URL, nil
+	}
+	data, err := os.ReadFile(e.Thumbnail)
+	if err != nil {
+		return "", fmt.Errorf("failed to read thumbnail: %w", err)
+	}
+	if format == ReportHTML {
+		return "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(data), nil
+	}
+
+	// Markdown reports link the thumbnails copied into <report>_thumbs
+	dir := strings.TrimSuffix(out, filepath.Ext(out)) + "_thumbs"
+	if err := os.MkdirAll(dir, defaultPerms); err != nil {
+		return "", fmt.Errorf("failed to create thumbnails folder: %w", err)
+	}
+	name := fmt.Sprintf("%s-%s.jpg", e.Files[0].Game, SanitizeFileName(e.Files[0].IdGallery))
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+		return "", fmt.Errorf("failed to copy thumbnail: %w", err)
+	}
+	return filepath.ToSlash(filepath.Join(filepath.Base(dir), name)), nil
+}
+
+// writeMarkdownReport writes the entries of a report as Markdown
+func writeMarkdownReport(w io.Writer, month string, games []reportGame) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Official art of %s\n", month)
+	if len(games) == 0 {
+		b.WriteString("\nNo wallpapers were published this month.\n")
+	}
+	for _, g := range games {
+		fmt.Fprintf(&b, "\n## %s (%d)\n", markdownEscape(g.Game), len(g.Entries))
+		for _, e := range g.Entries {
+			fmt.Fprintf(&b, "\n### %s\n\n", markdownEscape(e.Title))
+			fmt.Fprintf(&b, "[![%s](%s)](%s)\n\n", markdownEscape(e.Title), e.Image, e.Files[0].URL)
+
+			var details []string
+			if e.Artist != "" {
+				details = append(details, "Artist: "+markdownEscape(e.Artist))
+			}
+			details = append(details, "Published "+e.PublishedAt.Format("2006-01-02"))
+			for _, file := range e.Files {
+				details = append(details, fmt.Sprintf("[%s](%s)", file.Type, file.URL))
+			}
+			b.WriteString(strings.Join(details, " · ") + "\n")
+			if e.Description != "" {
+				fmt.Fprintf(&b, "\n%s\n", markdownEscape(e.Description))
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// markdownEscape escapes the characters of s that Markdown would format
+func markdownEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "<", "&lt;", "#", `\#`).Replace(s)
+}
+
+// reportTemplate renders HTML reports
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	// Only the embedded thumbnails are trusted, the URLs of the API are sanitized
+	"imageURL": func(s string) any {
+		if strings.HasPrefix(s, "data:image/jpeg;base64,") {
+			return template.URL(s)
+		}
+		return s
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Official art of {{.Month}}</title>
+<style>
+body { font-family: sans-serif; max-width: 960px; margin: auto; }
+.entries { display: grid; grid-template-columns: repeat(auto-fill, minmax(300px, 1fr)); gap: 1em; }
+.entry img { width: 100%; }
+.entry p { margin: .3em 0; }
+</style>
+</head>
+<body>
+<h1>Official art of {{.Month}}</h1>
+{{- range .Games}}
+<h2>{{.Game}} ({{len .Entries}})</h2>
+<div class="entries">
+{{- range .Entries}}
+<div class="entry">
+<a href="{{(index .Files 0).URL}}"><img src="{{imageURL .Image}}" alt="{{.Title}}"></a>
+<p><strong>{{.Title}}</strong></p>
+<p>{{if .Artist}}Artist: {{.Artist}} · {{end}}Published {{.PublishedAt.Format "2006-01-02"}}{{range .Files}} · <a href="{{.URL}}">{{.Type}}</a>{{end}}</p>
+{{- if .Description}}
+<p>{{.Description}}</p>
+{{- end}}
+</div>
+{{- end}}
+</div>
+{{- else}}
+<p>No wallpapers were published this month.</p>
+{{- end}}
+</body>
+</html>
+`))
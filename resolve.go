@@ -0,0 +1,94 @@
+package crawal
+
+import (
+	"errors"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// defaultResolveTTL is how long the listing of a URLResolver is used before the API
+// is asked again, shorter than the expiry of the signed URLs of CDNs
+const defaultResolveTTL = 10 * time.Minute
+
+// ErrNotListed is returned by a URLResolver for an image the API no longer lists
+var ErrNotListed = errors.New("not listed by the API anymore")
+
+// URLResolver returns the URL of the image of a job as the API lists it now, for the
+// sources handing out signed URLs that expire
+type URLResolver func(job Job) (string, error)
+
+// IsSignedURL reports whether raw has the query parameters of a signed URL, which
+// expires, see NormalizeURL
+func IsSignedURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	for name := range u.Query() {
+		if isSigningParam(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// storableURL returns the URL an image listed at raw is recorded with: raw itself,
+// or without its signature when signed, so that a new signature is not taken for a
+// new image. Signed images are downloaded from the URL resolved again through the
+// API, see QueueOptions.Resolve.
+func storableURL(raw string) string {
+	if IsSignedURL(raw) {
+		return NormalizeURL(raw)
+	}
+	return raw
+}
+
+// NewItemResolver returns a URLResolver looking the images up in items, as listed by
+// the API, and in the items returned by fetch once they are older than ttl (10
+// minutes when 0)
+func NewItemResolver(items []Item, fetch func() ([]Item, error), ttl time.Duration) URLResolver {
+	if ttl <= 0 {
+		ttl = defaultResolveTTL
+	}
+	r := &itemResolver{fetch: fetch, ttl: ttl}
+	r.index(items)
+	return r.resolve
+}
+
+// itemResolver implements the URLResolver of NewItemResolver
+type itemResolver struct {
+	mu        sync.Mutex
+	fetch     func() ([]Item, error)
+	ttl       time.Duration
+	urls      map[[3]string]string // by game, ID and variant kind
+	fetchedAt time.Time
+}
+
+// index replaces the listing with items
+func (r *itemResolver) index(items []Item) {
+	r.urls = make(map[[3]string]string)
+	for _, it := range items {
+		for _, v := range it.Variants {
+			r.urls[[3]string{it.Game, it.ID, v.Kind}] = v.URL
+		}
+	}
+	r.fetchedAt = time.Now()
+}
+
+func (r *itemResolver) resolve(job Job) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.fetchedAt) > r.ttl {
+		items, err := r.fetch()
+		if err != nil {
+			return "", err
+		}
+		r.index(items)
+	}
+	u, ok := r.urls[[3]string{job.Game, job.IdGallery, job.Type}]
+	if !ok || u == "" {
+		return "", ErrNotListed
+	}
+	return u, nil
+}
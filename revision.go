@@ -0,0 +1,182 @@
+package crawal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// revisionsDir is the folder, next to the wallpaper, that keeps replaced files
+const revisionsDir = ".revisions"
+
+// Revision represents an archived version of a wallpaper that was replaced by a newer upload
+type Revision struct {
+	ID        int64
+	GalleryID int64
+	Revision  int
+	FileName  string
+	URL       string
+	Path      string
+	CreatedAt time.Time
+}
+
+// ArchiveRevision moves the current file of a wallpaper into the revisions folder
+// and records it in the revisions table, so it can be restored later with RevertRevision.
+// Wallpapers downloaded before paths were tracked only get their URL recorded.
+func ArchiveRevision(db *sql.DB, game, region, idGallery, typ string) (Revision, error) {
+	item, err := GetGalleryItem(db, game, region, idGallery, typ)
+	if err != nil {
+		return Revision{}, fmt.Errorf("failed to look up wallpaper: %w", err)
+	}
+
+	rev := Revision{
+		GalleryID: item.ID,
+		FileName:  item.FileName,
+		URL:       item.URL,
+	}
+	err = db.QueryRow("SELECT COALESCE(MAX(revision), 0) + 1 FROM revisions WHERE gallery_id = ?", item.ID).Scan(&rev.Revision)
+	if err != nil {
+		return Revision{}, fmt.Errorf("failed to number revision: %w", err)
+	}
+
+	if item.Path != "" {
+		if _, err := os.Stat(item.Path); err == nil {
+			rev.Path = revisionPath(item.Path, rev.Revision)
+			if err := makeDirs(filepath.Dir(rev.Path)); err != nil {
+				return Revision{}, fmt.Errorf("failed to create revisions folder: %w", err)
+			}
+			if err := os.Rename(item.Path, rev.Path); err != nil {
+				return Revision{}, fmt.Errorf("failed to archive file: %w", err)
+			}
+		}
+	}
+
+	res, err := db.Exec("INSERT INTO revisions(gallery_id, revision, file_name, url, path) VALUES (?, ?, ?, ?, ?)",
+		rev.GalleryID, rev.Revision, rev.FileName, rev.URL, storedPath(rev.Path))
+	if err != nil {
+		return Revision{}, fmt.Errorf("failed to insert revision: %w", err)
+	}
+	rev.ID, _ = res.LastInsertId()
+
+	return rev, nil
+}
+
+// ListRevisions returns the archived revisions of a wallpaper, oldest first
+func ListRevisions(db *sql.DB, galleryID int64) ([]Revision, error) {
+	rows, err := db.Query(`
+		SELECT id, gallery_id, revision, file_name, url, path, created_at
+		FROM revisions WHERE gallery_id = ? ORDER BY revision`, galleryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []Revision
+	for rows.Next() {
+		var rev Revision
+		if err := rows.Scan(&rev.ID, &rev.GalleryID, &rev.Revision, &rev.FileName, &rev.URL, &rev.Path, &rev.CreatedAt); err != nil {
+			return nil, err
+		}
+		rev.Path = resolvePath(rev.Path)
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, rows.Err()
+}
+
+// RevertRevision restores an archived revision of a wallpaper. The current file is
+// archived as a new revision first, so reverting never loses history. The restored
+// file is pinned: syncs no longer replace it with the upload the API lists, until
+// PinFile unpins it.
+func RevertRevision(db *sql.DB, game, region, idGallery, typ string, revision int) error {
+	item, err := GetGalleryItem(db, game, region, idGallery, typ)
+	if err != nil {
+		return fmt.Errorf("failed to look up wallpaper: %w", err)
+	}
+	if item.Path == "" {
+		return errors.New("the current file location is unknown, re-download the wallpaper first")
+	}
+
+	var rev Revision
+	err = db.QueryRow("SELECT id, file_name, url, path FROM revisions WHERE gallery_id = ? AND revision = ?", item.ID, revision).
+		Scan(&rev.ID, &rev.FileName, &rev.URL, &rev.Path)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("revision %d not found", revision)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up revision: %w", err)
+	}
+	rev.Path = resolvePath(rev.Path)
+	if rev.Path == "" {
+		return fmt.Errorf("revision %d has no archived file", revision)
+	}
+
+	if _, err := ArchiveRevision(db, game, region, idGallery, typ); err != nil {
+		return err
+	}
+
+	restored := strings.TrimSuffix(item.Path, filepath.Ext(item.Path)) + filepath.Ext(rev.Path)
+	if err := copyFile(rev.Path, restored); err != nil {
+		return fmt.Errorf("failed to restore file: %w", err)
+	}
+
+	// The restored file is hashed and analyzed again, its checksum, dimensions and
+	// colors being those of the revision rather than of the replaced file
+	item.FileName, item.URL, item.SourceURL, item.ResolvedURL, item.Path = rev.FileName, rev.URL, "", "", restored
+	item.SHA256, item.Size, item.OriginalSize = "", 0, 0
+	item.PHash, item.DuplicateOf = "", 0
+	item.DominantColor, item.Color, item.Brightness = "", "", -1
+	item.Width, item.Height, item.Aspect = 0, 0, 0
+	os.Remove(ThumbnailPath(restored))
+	if err := analyzeImage(&item); err != nil {
+		logger.Printf("Error analyzing %s: %v", item.FileName, err)
+	}
+	if err := SaveGalleryItem(db, item); err != nil {
+		return fmt.Errorf("failed to update wallpaper: %w", err)
+	}
+	return PinFile(db, item.ID, true)
+}
+
+// PinFile pins or unpins the file with this ID. A pinned file is kept whatever the
+// API lists, the syncs queuing none of its uploads.
+func PinFile(db *sql.DB, id int64, pinned bool) error {
+	res, err := db.Exec("UPDATE files SET pinned = ? WHERE id = ?", pinned, id)
+	if err != nil {
+		return fmt.Errorf("failed to pin file: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("file %d not found", id)
+	}
+	return nil
+}
+
+// revisionPath returns where revision n of the file at p is archived
+func revisionPath(p string, n int) string {
+	ext := filepath.Ext(p)
+	name := strings.TrimSuffix(filepath.Base(p), ext)
+	return filepath.Join(filepath.Dir(p), revisionsDir, fmt.Sprintf("%s.r%d%s", name, n, ext))
+}
+
+// copyFile copies the file at src to dst, replacing dst if it exists
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := createFile(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,58 @@
+package crawal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestRevertPinned checks that a sync listing the upload a revert replaced keeps
+// the restored file, until it is unpinned
+func TestRevertPinned(t *testing.T) {
+	SetLogger(nil)
+	db := newPageTestDB(t, 0)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "wallpaper.png")
+	save := func(url, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		err := SaveGalleryItem(db, GalleryItem{Game: "azur_lane", IdGallery: "1", Type: "wallpaper", FileName: "wallpaper.png", URL: url, Path: path})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	save("https://cdn.example/old.png", "old upload")
+	if _, err := ArchiveRevision(db, "azur_lane", "", "1", "wallpaper"); err != nil {
+		t.Fatal(err)
+	}
+	save("https://cdn.example/new.png", "new upload")
+	if err := RevertRevision(db, "azur_lane", "", "1", "wallpaper", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	listed := []Item{{Game: "azur_lane", ID: "1", Title: "wallpaper", Variants: []Variant{{Kind: "wallpaper", URL: "https://cdn.example/new.png"}}}}
+	if err := SyncItems(db, listed, SyncOptions{Dir: dir}); err != nil {
+		t.Fatal(err)
+	}
+	if jobs, err := ListJobs(db); err != nil || len(jobs) != 0 {
+		t.Errorf("sync queued %d jobs over the reverted file (%v)", len(jobs), err)
+	}
+	item, err := GetGalleryItem(db, "azur_lane", "", "1", "wallpaper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, err := os.ReadFile(item.Path); err != nil || string(content) != "old upload" || item.URL != "https://cdn.example/old.png" || !item.Pinned {
+		t.Errorf("got %s %q pinned %t (%v), want the reverted file pinned", item.URL, content, item.Pinned, err)
+	}
+
+	if err := PinFile(db, item.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	queued, err := EnqueueJob(db, Job{Game: "azur_lane", IdGallery: "1", Type: "wallpaper", FileName: "wallpaper", URL: "https://cdn.example/new.png"})
+	if err != nil || !queued {
+		t.Errorf("new upload not queued once unpinned (%v)", err)
+	}
+}
@@ -0,0 +1,129 @@
+package crawal
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// kana are the Hepburn romanizations of the hiragana, katakana being mapped to
+// them first
+var kana = map[rune]string{
+	'あ': "a", 'い': "i", 'う': "u", 'え': "e", 'お': "o",
+	'か': "ka", 'き': "ki", 'く': "ku", 'け': "ke", 'こ': "ko",
+	'が': "ga", 'ぎ': "gi", 'ぐ': "gu", 'げ': "ge", 'ご': "go",
+	'さ': "sa", 'し': "shi", 'す': "su", 'せ': "se", 'そ': "so",
+	'ざ': "za", 'じ': "ji", 'ず': "zu", 'ぜ': "ze", 'ぞ': "zo",
+	'た': "ta", 'ち': "chi", 'つ': "tsu", 'て': "te", 'と': "to",
+	'だ': "da", 'ぢ': "ji", 'づ': "zu", 'で': "de", 'ど': "do",
+	'な': "na", 'に': "ni", 'ぬ': "nu", 'ね': "ne", 'の': "no",
+	'は': "ha", 'ひ': "hi", 'ふ': "fu", 'へ': "he", 'ほ': "ho",
+	'ば': "ba", 'び': "bi", 'ぶ': "bu", 'べ': "be", 'ぼ': "bo",
+	'ぱ': "pa", 'ぴ': "pi", 'ぷ': "pu", 'ぺ': "pe", 'ぽ': "po",
+	'ま': "ma", 'み': "mi", 'む': "mu", 'め': "me", 'も': "mo",
+	'や': "ya", 'ゆ': "yu", 'よ': "yo",
+	'ら': "ra", 'り': "ri", 'る': "ru", 'れ': "re", 'ろ': "ro",
+	'わ': "wa", 'ゐ': "i", 'ゑ': "e", 'を': "o", 'ん': "n", 'ゔ': "vu",
+	'ぁ': "a", 'ぃ': "i", 'ぅ': "u", 'ぇ': "e", 'ぉ': "o",
+	'ゃ': "ya", 'ゅ': "yu", 'ょ': "yo", 'ゎ': "wa",
+}
+
+// punctuation maps the Japanese punctuation and brackets to ASCII
+var punctuation = strings.NewReplacer(
+	"　", " ", "、", ",", "。", ".", "・", " ", "〜", "~",
+	"「", "[", "」", "]", "『", "[", "』", "]", "【", "[", "】", "]",
+	"〈", "<", "〉", ">", "《", "<", "》", ">", "〔", "(", "〕", ")",
+)
+
+// emptyBrackets are the brackets left empty once their characters are dropped
+var emptyBrackets = regexp.MustCompile(`\(\s*\)|\[\s*\]|<\s*>`)
+
+// Romaji returns s with its kana transliterated to Hepburn romaji, its full-width
+// letters and Japanese punctuation to ASCII. Kanji, whose reading depends on the
+// word, are kept, as the other characters.
+func Romaji(s string) string {
+	runes := []rune(punctuation.Replace(s))
+	var b strings.Builder
+	// sokuon is set after a small tsu, doubling the next consonant
+	sokuon := false
+	for i := 0; i < len(runes); i++ {
+		r := hiragana(runes[i])
+		switch {
+		case r == 'っ':
+			sokuon = true
+			continue
+		case r == 'ー':
+			// the long vowel mark repeats the vowel before it
+			if out := b.String(); out != "" && strings.ContainsRune("aiueo", rune(out[len(out)-1])) {
+				b.WriteByte(out[len(out)-1])
+			}
+			continue
+		case r >= '！' && r <= '～':
+			b.WriteRune(r - '！' + '!')
+			continue
+		}
+		syllable, ok := kana[r]
+		if !ok {
+			sokuon = false
+			b.WriteRune(runes[i])
+			continue
+		}
+
+		if i+1 < len(runes) {
+			next := hiragana(runes[i+1])
+			switch {
+			case strings.ContainsRune("ゃゅょ", next) && strings.HasSuffix(syllable, "i") && len(syllable) > 1:
+				// yōon, e.g. kya, sha, cho
+				stem := strings.TrimSuffix(syllable, "i")
+				if !strings.HasSuffix(stem, "h") && stem != "j" {
+					stem += "y"
+				}
+				syllable = stem + kana[next][1:]
+				i++
+			case strings.ContainsRune("ぁぃぅぇぉ", next) && len(syllable) > 1 || r == 'う' && strings.ContainsRune("ぃぇぉ", next):
+				// the extended katakana, e.g. fa, ti, che, wi
+				stem := syllable[:len(syllable)-1]
+				if r == 'う' {
+					stem = "w"
+				}
+				syllable = stem + kana[next]
+				i++
+			}
+		}
+		if sokuon {
+			if strings.HasPrefix(syllable, "ch") {
+				b.WriteByte('t')
+			} else if c := syllable[0]; !strings.ContainsRune("aiueon", rune(c)) {
+				b.WriteByte(c)
+			}
+			sokuon = false
+		}
+		b.WriteString(syllable)
+	}
+	return b.String()
+}
+
+// hiragana returns the hiragana of a katakana, r itself otherwise
+func hiragana(r rune) rune {
+	if r >= 'ァ' && r <= 'ヴ' {
+		return r - 'ァ' + 'ぁ'
+	}
+	return r
+}
+
+// ASCIIName returns the romaji of s with its accents dropped, e.g. "é" as "e", and
+// the characters left outside ASCII removed, such as kanji or hangul, with the
+// brackets they leave empty
+func ASCIIName(s string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(Romaji(s)) {
+		if r < unicode.MaxASCII && (unicode.IsPrint(r) || r == ' ') {
+			b.WriteRune(r)
+		} else if !unicode.Is(unicode.Mn, r) {
+			b.WriteByte(' ')
+		}
+	}
+	return strings.Join(strings.Fields(emptyBrackets.ReplaceAllString(b.String(), " ")), " ")
+}
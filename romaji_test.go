@@ -0,0 +1,50 @@
+package crawal
+
+import "testing"
+
+func TestRomaji(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"さくら", "sakura"},
+		{"サクラ", "sakura"},
+		{"しゃしん", "shashin"},
+		{"きょう", "kyou"},
+		{"ちょっと", "chotto"},
+		{"マッチ", "matchi"},
+		{"かっ", "ka"},
+		{"コーヒー", "koohii"},
+		{"ーあ", "a"},
+		{"ファイル", "fairu"},
+		{"ティー", "tii"},
+		{"ウィ", "wi"},
+		{"ヴァ", "va"},
+		{"ｒｅ：ゼロ", "re:zero"},
+		{"こんにちは、世界。", "konnichiha,世界."},
+		{"「水着」ver.", "[水着]ver."},
+		{"Café", "Café"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Romaji(tt.in); got != tt.want {
+			t.Errorf("Romaji(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestASCIIName(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"アズールレーン", "azuurureen"},
+		{"Ünïcödé", "Unicode"},
+		{"こんにちは、世界。", "konnichiha, ."},
+		{"【限定】夏の思い出", "no i"},
+		{"Ver.桜", "Ver."},
+		{"(桜)", ""},
+		{"桜", ""},
+		{"벚꽃", ""},
+		{"っ", ""},
+	}
+	for _, tt := range tests {
+		if got := ASCIIName(tt.in); got != tt.want {
+			t.Errorf("ASCIIName(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
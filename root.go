@@ -0,0 +1,170 @@
+package crawal
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+)
+
+// rootSetting keeps the folder the paths of the library are stored relative to
+const rootSetting = "library_root"
+
+// libraryRoot is the root of the library opened last, loaded by OpenDB. Files under
+// it are stored relative to it, so that the database stays valid when the library is
+// moved or mounted elsewhere; files outside it are stored with their absolute path.
+var libraryRoot string
+
+// LibraryRoot returns the folder the paths of the library are relative to
+func LibraryRoot() string {
+	return libraryRoot
+}
+
+// SetLibraryRoot sets the folder the library is found in now, e.g. where a NAS share
+// or a docker volume is mounted. The stored paths are kept, so the files under the
+// previous root are looked up under root.
+func SetLibraryRoot(db *sql.DB, root string) error {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	if err := SetSetting(db, rootSetting, abs); err != nil {
+		return fmt.Errorf("failed to set library root: %w", err)
+	}
+	libraryRoot = abs
+	return nil
+}
+
+// RebaseLibrary rewrites the stored paths of the files, revisions and pending
+// downloads relative to root, which becomes the root of the library. An empty root
+// stores every path as absolute.
+func RebaseLibrary(db *sql.DB, root string) error {
+	if root != "" {
+		var err error
+		if root, err = filepath.Abs(root); err != nil {
+			return err
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// rows are rewritten by ID, as a rebased path can be the stored form of another
+	for _, column := range []struct{ table, name string }{
+		{"files", "path"},
+		{"revisions", "path"},
+		{"download_jobs", "dir"},
+		{"quarantine", "path"},
+	} {
+		rows, err := tx.Query(fmt.Sprintf("SELECT id, %s FROM %s WHERE %[1]s != ''", column.name, column.table))
+		if err != nil {
+			return fmt.Errorf("failed to list %s paths: %w", column.table, err)
+		}
+		rebased := make(map[int64]string)
+		for rows.Next() {
+			var id int64
+			var p string
+			if err := rows.Scan(&id, &p); err != nil {
+				rows.Close()
+				return err
+			}
+			if r := relativeTo(root, resolvePath(p)); r != p {
+				rebased[id] = r
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for id, p := range rebased {
+			if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET %s = ? WHERE id = ?", column.table, column.name), p, id); err != nil {
+				return fmt.Errorf("failed to rebase %s: %w", p, err)
+			}
+		}
+	}
+	if _, err := tx.Exec("INSERT OR REPLACE INTO settings(key, value) VALUES (?, ?)", rootSetting, root); err != nil {
+		return fmt.Errorf("failed to set library root: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	libraryRoot = root
+	return nil
+}
+
+// loadLibraryRoot reads the root of the library. Libraries from before roots are given
+// the folder of the database when it contains every file, or else the folder containing
+// them, and their paths are rebased on it. Their relative paths were relative to the
+// folder the crawlers ran in, taken to be the one of the database as by default.
+func loadLibraryRoot(db *sql.DB) error {
+	var root string
+	err := db.QueryRow("SELECT value FROM settings WHERE key = ?", rootSetting).Scan(&root)
+	if err == nil {
+		libraryRoot = root
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return fmt.Errorf("failed to read library root: %w", err)
+	}
+
+	root, err = filepath.Abs(filepath.Dir(dbPath))
+	if err != nil {
+		return err
+	}
+	libraryRoot = root
+	paths, _, err := libraryPaths(db)
+	if err != nil {
+		return err
+	}
+	var common string
+	inside := true
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return err
+		}
+		common = commonDir(common, filepath.Dir(abs))
+		if _, ok := relativePath(root, abs); !ok {
+			inside = false
+		}
+	}
+	if !inside {
+		root = common
+	}
+	return RebaseLibrary(db, root)
+}
+
+// storedPath returns how the file at p is stored: relative to the root of the
+// library when it is inside it, with slashes, and absolute otherwise
+func storedPath(p string) string {
+	return relativeTo(libraryRoot, p)
+}
+
+// relativeTo returns p relative to root when it is inside it, with slashes, and
+// absolute otherwise
+func relativeTo(root, p string) string {
+	if p == "" {
+		return ""
+	}
+	if root != "" {
+		if rel, ok := relativePath(root, p); ok {
+			return filepath.ToSlash(rel)
+		}
+	}
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return p
+	}
+	return abs
+}
+
+// resolvePath returns the path of a file of the library stored as p
+func resolvePath(p string) string {
+	if p == "" || filepath.IsAbs(p) || libraryRoot == "" {
+		return findNormalized(p)
+	}
+	return findNormalized(filepath.Join(libraryRoot, filepath.FromSlash(p)))
+}
@@ -0,0 +1,92 @@
+package crawal
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// rotationSetting names the collection exported to the active rotation folder
+const rotationSetting = "rotation_collection"
+
+// Rotation returns the collection exported to the active rotation folder, or nil
+// when there is none
+func Rotation(db *sql.DB) (*Collection, error) {
+	name, err := GetSetting(db, rotationSetting, "")
+	if err != nil || name == "" {
+		return nil, err
+	}
+	c, err := GetCollection(db, name)
+	if errors.Is(err, ErrNoCollection) {
+		return nil, nil // deleted since
+	}
+	return &c, err
+}
+
+// SetRotation makes a collection the one exported to the active rotation folder:
+// a single flat folder that Wallpaper Engine, Lively or a Plasma slideshow point
+// at, kept up to date with the collection like any export. The files exported by
+// the previous rotation collection are removed, so that the folder only holds the
+// wallpapers of the new one. An empty folder keeps the folder of the rotation.
+func SetRotation(db *sql.DB, name, folder, mode string) (*Collection, CollectionUpdate, error) {
+	c, err := GetCollection(db, name)
+	if err != nil {
+		return nil, CollectionUpdate{}, err
+	}
+	if err := CheckExportMode(mode); err != nil {
+		return nil, CollectionUpdate{}, err
+	}
+	previous, err := Rotation(db)
+	if err != nil {
+		return nil, CollectionUpdate{}, err
+	}
+
+	var deleted int
+	if previous != nil {
+		if folder == "" {
+			folder = resolvePath(previous.Folder)
+		}
+		if previous.ID != c.ID {
+			if deleted, err = unexportCollection(db, *previous); err != nil {
+				return nil, CollectionUpdate{}, err
+			}
+		}
+	}
+	if folder == "" {
+		folder = resolvePath(c.Folder)
+	}
+	if folder == "" {
+		return nil, CollectionUpdate{}, errors.New("no folder for the rotation")
+	}
+
+	update, err := ExportCollection(db, &c, folder, mode)
+	update.Deleted += deleted
+	if err != nil {
+		return nil, update, err
+	}
+	return &c, update, SetSetting(db, rotationSetting, c.Name)
+}
+
+// StopRotation removes the files of the active rotation folder, which is no longer
+// updated
+func StopRotation(db *sql.DB) (int, error) {
+	c, err := Rotation(db)
+	if err != nil || c == nil {
+		return 0, err
+	}
+	deleted, err := unexportCollection(db, *c)
+	if err != nil {
+		return deleted, err
+	}
+	return deleted, SetSetting(db, rotationSetting, "")
+}
+
+// unexportCollection removes the files exported to the folder of a collection and
+// forgets the folder
+func unexportCollection(db *sql.DB, c Collection) (int, error) {
+	deleted, err := removeExported(db, c, nil)
+	if err != nil {
+		return deleted, err
+	}
+	_, err = db.Exec("UPDATE collections SET folder = '', export_mode = '' WHERE id = ?", c.ID)
+	return deleted, err
+}
@@ -0,0 +1,149 @@
+package crawal
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ruleSeparator joins the conditions of rules
+var ruleSeparator = regexp.MustCompile(`(?i)\s+AND\s+`)
+
+// ruleOperators are the operators of conditions, longest first so that ">=" is not
+// read as ">"
+var ruleOperators = []string{">=", "<=", "≥", "≤", "=", "~", ">", "<"}
+
+// ParseRules parses the rules of a smart collection into a filter: conditions
+// joined by AND, e.g. "game=arknight AND artist=X AND aspect>=16:9".
+//
+//   - game, region, type, artist, color and tag are compared with =
+//   - title and text contain the value, with = or ~
+//   - aspect is compared with =, >= or <=, the value written as W:H or decimal
+//   - brightness is compared with >= or <=, between 0 and 1
+//   - published and downloaded are compared with >= or < to a date (YYYY-MM-DD)
+func ParseRules(rules string) (Filter, error) {
+	var f Filter
+	if strings.TrimSpace(rules) == "" {
+		return f, fmt.Errorf("no rules")
+	}
+	for _, cond := range splitConditions(strings.TrimSpace(rules)) {
+		if err := f.applyRule(cond); err != nil {
+			return Filter{}, fmt.Errorf("rule %q: %w", cond, err)
+		}
+	}
+	return f, nil
+}
+
+// applyRule narrows the filter with a condition of rules
+func (f *Filter) applyRule(cond string) error {
+	field, op, value, err := splitRule(cond)
+	if err != nil {
+		return err
+	}
+	op = strings.NewReplacer("≥", ">=", "≤", "<=").Replace(op)
+
+	switch field {
+	case "game", "region", "type", "artist", "color", "tag":
+		if op != "=" {
+			return fmt.Errorf("%s is compared with =", field)
+		}
+		*map[string]*string{
+			"game": &f.Game, "region": &f.Region, "type": &f.Type,
+			"artist": &f.Artist, "color": &f.Color, "tag": &f.Tag,
+		}[field] = value
+	case "title", "text":
+		if op != "=" && op != "~" {
+			return fmt.Errorf("%s is compared with = or ~", field)
+		}
+		if field == "title" {
+			f.Title = value
+		} else {
+			f.Text = value
+		}
+	case "aspect":
+		aspect, err := ParseAspect(value)
+		if err != nil {
+			return fmt.Errorf("invalid aspect ratio: %w", err)
+		}
+		switch op {
+		case "=":
+			f.Aspect, f.AspectTolerance = aspect, 0.02
+		case ">=":
+			f.MinAspect = aspect
+		case "<=":
+			f.MaxAspect = aspect
+		default:
+			return fmt.Errorf("aspect is compared with =, >= or <=")
+		}
+	case "brightness":
+		brightness, err := strconv.ParseFloat(value, 64)
+		if err != nil || brightness < 0 || brightness > 1 {
+			return fmt.Errorf("brightness must be between 0 and 1")
+		}
+		switch op {
+		case ">=":
+			f.MinBrightness = brightness
+		case "<=":
+			f.MaxBrightness = brightness
+		default:
+			return fmt.Errorf("brightness is compared with >= or <=")
+		}
+	case "published", "downloaded":
+		date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return fmt.Errorf("invalid date: %w", err)
+		}
+		since, until := &f.PublishedSince, &f.PublishedUntil
+		if field == "downloaded" {
+			since, until = &f.Since, &f.Until
+		}
+		switch op {
+		case ">=":
+			*since = date
+		case "<":
+			*until = date
+		default:
+			return fmt.Errorf("%s is compared with >= or <", field)
+		}
+	default:
+		return fmt.Errorf("unknown field %q", field)
+	}
+	return nil
+}
+
+// splitConditions splits rules on the AND not within a quoted value
+func splitConditions(rules string) []string {
+	var conds []string
+	start := 0
+	for _, loc := range ruleSeparator.FindAllStringIndex(rules, -1) {
+		if strings.Count(rules[:loc[0]], `"`)%2 == 1 {
+			continue
+		}
+		conds = append(conds, rules[start:loc[0]])
+		start = loc[1]
+	}
+	return append(conds, rules[start:])
+}
+
+// splitRule splits a condition into its field, operator and value, unquoting the
+// value when quoted
+func splitRule(cond string) (field, op, value string, err error) {
+	for i := 0; i < len(cond); i++ {
+		for _, o := range ruleOperators {
+			if strings.HasPrefix(cond[i:], o) {
+				field = strings.ToLower(strings.TrimSpace(cond[:i]))
+				value = strings.TrimSpace(cond[i+len(o):])
+				if unquoted, err := strconv.Unquote(value); err == nil {
+					value = unquoted
+				}
+				if field == "" || value == "" {
+					return "", "", "", fmt.Errorf("expected field, operator and value")
+				}
+				return field, o, value, nil
+			}
+		}
+	}
+	return "", "", "", fmt.Errorf("no operator")
+}
@@ -0,0 +1,66 @@
+package crawal
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRules(t *testing.T) {
+	date := func(s string) time.Time {
+		d, _ := time.ParseInLocation("2006-01-02", s, time.Local)
+		return d
+	}
+	tests := []struct {
+		rules string
+		want  Filter
+	}{
+		{"game=arknight", Filter{Game: "arknight"}},
+		{"game = arknight and ARTIST = X", Filter{Game: "arknight", Artist: "X"}},
+		{"aspect>=16:9 AND aspect<=21:9", Filter{MinAspect: 16.0 / 9, MaxAspect: 21.0 / 9}},
+		{"aspect=16:9", Filter{Aspect: 16.0 / 9, AspectTolerance: 0.02}},
+		{"brightness≥0.5 AND brightness≤0.9", Filter{MinBrightness: 0.5, MaxBrightness: 0.9}},
+		{"title~Summer AND text=夏", Filter{Title: "Summer", Text: "夏"}},
+		{`title="Rock AND Roll" AND tag=music`, Filter{Title: "Rock AND Roll", Tag: "music"}},
+		{"published>=2024-01-01 AND published<2025-01-01", Filter{PublishedSince: date("2024-01-01"), PublishedUntil: date("2025-01-01")}},
+		{"downloaded>=2024-06-01", Filter{Since: date("2024-06-01")}},
+	}
+	for _, tt := range tests {
+		got, err := ParseRules(tt.rules)
+		if err != nil {
+			t.Errorf("ParseRules(%q): %v", tt.rules, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseRules(%q) = %+v, want %+v", tt.rules, got, tt.want)
+		}
+	}
+}
+
+func TestParseRulesInvalid(t *testing.T) {
+	tests := []struct {
+		rules string
+		err   string
+	}{
+		{"", "no rules"},
+		{"game", "no operator"},
+		{"=arknight", "expected field, operator and value"},
+		{"game=", "expected field, operator and value"},
+		{"game~ark", "game is compared with ="},
+		{"size>=100", `unknown field "size"`},
+		{"aspect>16:9", "aspect is compared with =, >= or <="},
+		{"aspect=wide", "invalid aspect ratio"},
+		{"brightness>=2", "brightness must be between 0 and 1"},
+		{"brightness=0.5", "brightness is compared with >= or <="},
+		{"published<=2024-01-01", "published is compared with >= or <"},
+		{"published>=yesterday", "invalid date"},
+		{"game=arknight AND colour=blue", `rule "colour=blue": unknown field "colour"`},
+	}
+	for _, tt := range tests {
+		_, err := ParseRules(tt.rules)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("ParseRules(%q) = %v, want an error containing %q", tt.rules, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package crawal
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults of the scaling of the workers of a queue
+const (
+	scaleInterval     = 10 * time.Second // between two adjustments
+	scaleFailureRatio = 0.2              // of failed downloads halving the workers
+	scaleSlowdown     = 0.9              // of the throughput undoing the last added worker
+)
+
+// workerScaler adapts the number of workers of a queue running jobs to the observed
+// throughput and failures, AIMD style: one more at each interval the throughput
+// holds, half as many when downloads fail, as when the CDN throttles
+type workerScaler struct {
+	min, max int
+	active   atomic.Int32 // workers allowed to run jobs
+
+	mu       sync.Mutex
+	bytes    int64 // downloaded since the last adjustment
+	jobs     int
+	failures int
+	lastRate float64 // bytes per second before the last adjustment
+	grew     bool    // whether the last adjustment added a worker
+}
+
+// set makes the scaler run between low and high workers, starting again with start.
+// Equal bounds fix the number of workers.
+func (s *workerScaler) set(start, low, high int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.min, s.max = low, high
+	s.active.Store(int32(clamp(start, low, high)))
+	s.bytes, s.jobs, s.failures = 0, 0, 0
+	s.lastRate, s.grew = 0, false
+}
+
+// allows reports whether the worker numbered i may run jobs
+func (s *workerScaler) allows(i int) bool {
+	return i < int(s.active.Load())
+}
+
+// record counts a finished job, with the bytes it downloaded
+func (s *workerScaler) record(bytes int64, failed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs++
+	s.bytes += bytes
+	if failed {
+		s.failures++
+	}
+}
+
+// adjust changes the number of workers from the jobs finished during elapsed
+func (s *workerScaler) adjust(elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.jobs == 0 {
+		return
+	}
+
+	rate := float64(s.bytes) / elapsed.Seconds()
+	before := int(s.active.Load())
+	after := before
+	switch {
+	case float64(s.failures) >= scaleFailureRatio*float64(s.jobs):
+		after = before / 2
+	case s.grew && rate < s.lastRate*scaleSlowdown:
+		after = before - 1
+	default:
+		after = before + 1
+	}
+	after = clamp(after, s.min, s.max)
+	if after != before {
+		logger.Printf("Workers: %d -> %d (%s/s, %d of %d downloads failed)", before, after, FormatBytes(int64(rate)), s.failures, s.jobs)
+	}
+	s.active.Store(int32(after))
+
+	s.grew = after > before
+	s.lastRate = rate
+	s.bytes, s.jobs, s.failures = 0, 0, 0
+}
+
+// run adjusts the workers at every interval until done is closed
+func (s *workerScaler) run(done <-chan struct{}) {
+	ticker := time.NewTicker(scaleInterval)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case now := <-ticker.C:
+			s.adjust(now.Sub(last))
+			last = now
+		case <-done:
+			return
+		}
+	}
+}
+
+func clamp(n, low, high int) int {
+	return max(low, min(n, high))
+}
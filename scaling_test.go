@@ -0,0 +1,61 @@
+package crawal
+
+import (
+	"testing"
+	"time"
+)
+
+// TestWorkerScaler checks the additive increase while the throughput holds, the
+// step back when it drops after an increase, and the halving on failures, within
+// the bounds
+func TestWorkerScaler(t *testing.T) {
+	SetLogger(nil)
+	var s workerScaler
+	s.set(2, 1, 8)
+
+	steps := []struct {
+		name   string
+		jobs   int
+		failed int
+		bytes  int64 // per job
+		want   int
+	}{
+		{"no jobs", 0, 0, 0, 2},
+		{"first rate", 4, 0, 1 << 20, 3},
+		{"rate holds", 4, 0, 1 << 20, 4},
+		{"rate grows", 4, 0, 2 << 20, 5},
+		{"rate drops after an increase", 4, 0, 1 << 20, 4},
+		{"rate holds after a decrease", 4, 0, 1 << 20, 5},
+		{"a fifth fail", 5, 1, 1 << 20, 2},
+		{"all fail", 4, 4, 0, 1},
+		{"all fail at the minimum", 4, 4, 0, 1},
+		{"recovers", 4, 0, 1 << 20, 2},
+	}
+	for _, step := range steps {
+		for i := 0; i < step.jobs; i++ {
+			s.record(step.bytes, i < step.failed)
+		}
+		s.adjust(time.Second)
+		if got := int(s.active.Load()); got != step.want {
+			t.Fatalf("%s: %d workers, want %d", step.name, got, step.want)
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		s.record(1<<20, false)
+		s.adjust(time.Second)
+	}
+	if got := int(s.active.Load()); got != 8 {
+		t.Errorf("%d workers after growing for long, want the maximum 8", got)
+	}
+	if !s.allows(7) || s.allows(8) {
+		t.Errorf("allows(7) = %v, allows(8) = %v with 8 workers", s.allows(7), s.allows(8))
+	}
+
+	s.set(12, 3, 3)
+	s.record(1<<20, false)
+	s.adjust(time.Second)
+	if got := int(s.active.Load()); got != 3 {
+		t.Errorf("%d workers with equal bounds of 3, want 3", got)
+	}
+}
@@ -0,0 +1,85 @@
+package crawal
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// RowSchema describes the rows of a game API expected by DecodeRows
+type RowSchema struct {
+	Game     string
+	Required []string // JSON keys every row must have, with a non-null and non-empty value
+
+	// Strict fails on the first row not matching the schema instead of skipping it
+	Strict bool
+	// Paginated tells that the rows left out of a truncated response were fetched page
+	// by page, see FetchRemainingPages
+	Paginated bool
+}
+
+// DecodeRows decodes the raw rows of an API response one by one, so that a change of
+// the API schema does not zero-fill fields of every row. A row with a field of an
+// unexpected type or a required field missing or empty is logged with its raw JSON and
+// skipped, or fails the decoding with Strict.
+func DecodeRows[T any](raw []json.RawMessage, schema RowSchema) ([]T, error) {
+	rows := make([]T, 0, len(raw))
+	for i, r := range raw {
+		row, err := decodeRow[T](r, schema.Required)
+		if err != nil {
+			if schema.Strict {
+				return nil, fmt.Errorf("row %d of %s does not match the expected schema: %w", i, schema.Game, err)
+			}
+			logger.Printf("Skipping row %d of %s not matching the expected schema: %v: %s", i, schema.Game, err, r)
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// decodeRow decodes a single row, checking that it has the required keys
+func decodeRow[T any](raw json.RawMessage, required []string) (T, error) {
+	var row T
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return row, err
+	}
+	for _, key := range required {
+		switch v, ok := fields[key]; {
+		case !ok || string(v) == "null":
+			return row, fmt.Errorf("missing field %q", key)
+		case string(v) == `""`:
+			return row, fmt.Errorf("empty field %q", key)
+		}
+	}
+	err := json.Unmarshal(raw, &row)
+	return row, err
+}
+
+// CheckCount compares the number of rows of a response with the count it announces.
+// A mismatch is logged, or fails with Strict; a response without any row while it
+// announces some always fails, as nothing could be crawled from it.
+func (s RowSchema) CheckCount(count, rows int) error {
+	if count == rows {
+		return nil
+	}
+	if rows == 0 {
+		return fmt.Errorf("%s API listed no rows while announcing %d", s.Game, count)
+	}
+	if s.Strict {
+		return fmt.Errorf("%s API listed %d rows while announcing %d", s.Game, rows, count)
+	}
+	if Truncated(count, rows) && !s.Paginated {
+		logger.Printf("WARNING: %s API listed only %d of the %d rows it announced, its response looks truncated and %d wallpapers are left out; run with --paginate to fetch them page by page",
+			s.Game, rows, count, count-rows)
+		return nil
+	}
+	logger.Printf("WARNING: %s API listed %d rows while announcing %d", s.Game, rows, count)
+	return nil
+}
+
+// Truncated reports whether a response of rows rows, announcing count, left some out,
+// such as a server capping the size of its pages
+func Truncated(count, rows int) bool {
+	return rows > 0 && rows < count
+}
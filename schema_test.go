@@ -0,0 +1,184 @@
+package crawal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type schemaRow struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+}
+
+func TestDecodeRows(t *testing.T) {
+	raw := []json.RawMessage{
+		json.RawMessage(`{"id": 1, "title": "ok"}`),
+		json.RawMessage(`{"id": "2", "title": "wrong type"}`),
+		json.RawMessage(`{"id": 3}`),
+		json.RawMessage(`{"id": 4, "title": ""}`),
+		json.RawMessage(`{"id": 5, "title": null}`),
+	}
+	schema := RowSchema{Game: "test", Required: []string{"id", "title"}}
+
+	rows, err := DecodeRows[schemaRow](raw, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].ID != 1 {
+		t.Errorf("got %+v, want only the first row", rows)
+	}
+
+	schema.Strict = true
+	if _, err := DecodeRows[schemaRow](raw, schema); err == nil {
+		t.Error("strict decoding accepted rows not matching the schema")
+	}
+}
+
+func TestCheckCount(t *testing.T) {
+	schema := RowSchema{Game: "test"}
+	if err := schema.CheckCount(2, 2); err != nil {
+		t.Error(err)
+	}
+	if err := schema.CheckCount(3, 2); err != nil {
+		t.Errorf("mismatch failed without strict: %v", err)
+	}
+	if err := schema.CheckCount(3, 0); err == nil {
+		t.Error("empty response accepted")
+	}
+
+	schema.Strict = true
+	if err := schema.CheckCount(3, 2); err == nil {
+		t.Error("mismatch accepted with strict")
+	}
+}
+
+// createDatabaseAt creates the database at p as the first n migrations left it
+func createDatabaseAt(t *testing.T, p string, n int) *sql.DB {
+	t.Helper()
+	db, err := sql.Open(sqliteDriver, databaseDSN(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := createGalleryTable(db); err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range migrations[:n] {
+		if _, err := db.Exec(m); err != nil {
+			t.Fatalf("migration %d: %v", i+1, err)
+		}
+	}
+	if _, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", n)); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// migrationIndex returns the index of the first migration starting with prefix
+func migrationIndex(t *testing.T, prefix string) int {
+	t.Helper()
+	for i, m := range migrations {
+		if strings.HasPrefix(m, prefix) {
+			return i
+		}
+	}
+	t.Fatalf("no migration starts with %q", prefix)
+	return 0
+}
+
+// openMigrated opens the database at p with OpenDB, checking that it is migrated
+// to the latest version
+func openMigrated(t *testing.T, p string) *sql.DB {
+	t.Helper()
+	SetLogger(nil)
+	defer SetDatabasePath(DatabasePath())
+	SetDatabasePath(p)
+	db, err := OpenDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version != len(migrations) {
+		t.Errorf("user_version %d, want %d", version, len(migrations))
+	}
+	return db
+}
+
+// TestMigrateGalleryTable checks that the wallpapers of the yostar_gallery table,
+// from before it was split into items and files, keep their IDs and paths
+func TestMigrateGalleryTable(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "yostar-gallery.db")
+	old := createDatabaseAt(t, p, migrationIndex(t, "CREATE TABLE IF NOT EXISTS items ("))
+	want := []GalleryItem{
+		{ID: 1, Game: "azur_lane", IdGallery: "10", Type: "wallpaper", FileName: "a.png", URL: "https://cdn.example/a.png"},
+		{ID: 2, Game: "azur_lane", IdGallery: "10", Type: "thumbnail", FileName: "a_thumb.png", URL: "https://cdn.example/a_thumb.png"},
+		{ID: 3, Game: "arknight", IdGallery: "10", Type: "wallpaper", FileName: "b.png", URL: "https://cdn.example/b.png"},
+	}
+	for i := range want {
+		want[i].Path = filepath.Join(dir, want[i].FileName)
+		if err := os.WriteFile(want[i].Path, []byte("image"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := old.Exec("INSERT INTO yostar_gallery(id, id_gallery, game, type, file_name, url, path) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			want[i].ID, want[i].IdGallery, want[i].Game, want[i].Type, want[i].FileName, want[i].URL, want[i].Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	old.Close()
+
+	db := openMigrated(t, p)
+	for _, w := range want {
+		got, err := GetGalleryItem(db, w.Game, "", w.IdGallery, w.Type)
+		if err != nil {
+			t.Errorf("%s %s %s: %v", w.Game, w.IdGallery, w.Type, err)
+			continue
+		}
+		if got.ID != w.ID || got.FileName != w.FileName || got.URL != w.URL || got.Path != w.Path {
+			t.Errorf("got %d %s %s %s, want %d %s %s %s", got.ID, got.FileName, got.URL, got.Path, w.ID, w.FileName, w.URL, w.Path)
+		}
+	}
+}
+
+// TestMigrateDuplicateJobs checks that the active jobs queued twice before the
+// download_jobs_active index are queued once after it, and that the others are kept
+func TestMigrateDuplicateJobs(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "yostar-gallery.db")
+	old := createDatabaseAt(t, p, migrationIndex(t, "DELETE FROM download_jobs WHERE state IN ('queued', 'running')"))
+	for _, job := range []struct{ idGallery, state string }{
+		{"1", JobQueued}, {"1", JobRunning}, {"1", JobQueued}, {"1", JobFailed}, {"2", JobQueued},
+	} {
+		_, err := old.Exec("INSERT INTO download_jobs(game, id_gallery, type, file_name, url, state) VALUES ('azur_lane', ?, 'wallpaper', ?, ?, ?)",
+			job.idGallery, "wallpaper "+job.idGallery, "https://cdn.example/"+job.idGallery+".png", job.state)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	old.Close()
+
+	db := openMigrated(t, p)
+	jobs, err := ListJobs(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, job := range jobs {
+		got = append(got, fmt.Sprintf("%d %s %s %s", job.ID, job.IdGallery, job.State, job.Region))
+	}
+	slices.Sort(got)
+	want := []string{"1 1 queued global", "4 1 failed global", "5 2 queued global"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got jobs %q, want %q", got, want)
+	}
+}
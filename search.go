@@ -0,0 +1,74 @@
+package crawal
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// searchTriggers keep the full-text index of builds with sqlite_fts5 up to date
+var searchTriggers = []string{
+	"search_files_insert", "search_files_delete", "search_items_update",
+	"search_artists_update", "search_tags_insert", "search_tags_delete",
+	"search_titles_insert", "search_titles_update", "search_locale_update",
+}
+
+// searchColumns are the fields of a wallpaper searched by SearchGalleryItems
+var searchColumns = []string{"title", "description", "artist", "tags"}
+
+// SearchGalleryItems returns up to limit wallpapers matching f whose title,
+// description, artist or tags contain every word of the query, best matches first.
+// Built with the sqlite_fts5 tag, the search uses a full-text index.
+func SearchGalleryItems(db *sql.DB, query string, f Filter, limit int) ([]GalleryItem, error) {
+	terms := strings.Fields(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	matches, args := searchMatches(terms)
+	where, whereArgs := f.where()
+	args = append(args, whereArgs...)
+	rows, err := db.Query(`
+		SELECT `+prefixed("g.", galleryColumns)+`
+		FROM gallery g JOIN (`+matches+`) m ON m.id = g.id
+		WHERE g.id IN (SELECT id FROM gallery WHERE `+where+`)
+		ORDER BY m.rank, g.id LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []GalleryItem
+	for rows.Next() {
+		item, err := scanGalleryItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// likeTerms builds a condition matching rows where every term is contained in one of
+// the given column expressions
+func likeTerms(terms []string, columns []string) (string, []any) {
+	var conds []string
+	var args []any
+	for _, term := range terms {
+		var ors []string
+		for _, col := range columns {
+			ors = append(ors, col+" LIKE ?")
+			args = append(args, "%"+term+"%")
+		}
+		conds = append(conds, "("+strings.Join(ors, " OR ")+")")
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// prefixed qualifies every column of a comma separated list with prefix
+func prefixed(prefix, columns string) string {
+	cols := strings.Split(columns, ", ")
+	for i, col := range cols {
+		cols[i] = prefix + col
+	}
+	return strings.Join(cols, ", ")
+}
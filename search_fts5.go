@@ -0,0 +1,91 @@
+//go:build sqlite_fts5 || fts5 || lite
+
+package crawal
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// FullTextSearch reports whether SearchGalleryItems searches a full-text index, in
+// builds with the sqlite_fts5 tag, rather than scanning the library with LIKE
+const FullTextSearch = true
+
+// searchIndex selects the searchable fields of the wallpapers matching a condition,
+// as stored in the search table
+const searchIndex = `
+	SELECT id, title, description, artist, COALESCE((SELECT group_concat(tag, ' ') FROM tags WHERE gallery_id = gallery.id), '')
+	FROM gallery WHERE `
+
+// reindex returns the statements refreshing the search rows of the wallpapers matching cond
+func reindex(cond string) string {
+	return fmt.Sprintf(`
+		DELETE FROM search WHERE rowid IN (SELECT id FROM gallery WHERE %s);
+		INSERT INTO search(rowid, title, description, artist, tags) %s %s;`, cond, searchIndex, cond)
+}
+
+// setupSearch creates the full-text index of the library and the triggers keeping
+// it up to date. The trigram tokenizer matches substrings, which suits CJK titles.
+// The index is rebuilt whenever a trigger is missing.
+func setupSearch(db *sql.DB) error {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'search_%'").Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n == len(searchTriggers) {
+		return nil
+	}
+
+	var stmts []string
+	for _, name := range searchTriggers {
+		stmts = append(stmts, "DROP TRIGGER IF EXISTS "+name)
+	}
+	stmts = append(stmts,
+		`CREATE VIRTUAL TABLE IF NOT EXISTS search USING fts5(title, description, artist, tags, tokenize = 'trigram')`,
+		`DELETE FROM search`,
+		`INSERT INTO search(rowid, title, description, artist, tags) `+searchIndex+`1 = 1`,
+		`CREATE TRIGGER search_files_insert AFTER INSERT ON files BEGIN`+reindex("id = new.id")+` END`,
+		`CREATE TRIGGER search_files_delete AFTER DELETE ON files BEGIN DELETE FROM search WHERE rowid = old.id; END`,
+		`CREATE TRIGGER search_items_update AFTER UPDATE ON items BEGIN`+reindex("item_id = new.id")+` END`,
+		`CREATE TRIGGER search_artists_update AFTER UPDATE ON artists BEGIN`+
+			reindex("item_id IN (SELECT id FROM items WHERE artist_id = new.id)")+` END`,
+		`CREATE TRIGGER search_tags_insert AFTER INSERT ON tags BEGIN`+reindex("id = new.gallery_id")+` END`,
+		`CREATE TRIGGER search_tags_delete AFTER DELETE ON tags BEGIN`+reindex("id = old.gallery_id")+` END`,
+		`CREATE TRIGGER search_titles_insert AFTER INSERT ON item_titles BEGIN`+reindex("item_id = new.item_id")+` END`,
+		`CREATE TRIGGER search_titles_update AFTER UPDATE ON item_titles BEGIN`+reindex("item_id = new.item_id")+` END`,
+		`CREATE TRIGGER search_locale_update AFTER INSERT ON settings WHEN new.key = '`+titleLocaleSetting+`' BEGIN`+
+			reindex("1 = 1")+` END`,
+	)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to set up search index: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// searchMatches selects the IDs of the wallpapers matching every term from the index.
+// Terms shorter than a trigram cannot use MATCH and fall back to LIKE on the index.
+func searchMatches(terms []string) (string, []any) {
+	for _, term := range terms {
+		if utf8.RuneCountInString(term) < 3 {
+			cond, args := likeTerms(terms, searchColumns)
+			return "SELECT rowid AS id, 0 AS rank FROM search WHERE " + cond, args
+		}
+	}
+
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	return "SELECT rowid AS id, rank FROM search WHERE search MATCH ?", []any{strings.Join(quoted, " ")}
+}
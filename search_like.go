@@ -0,0 +1,38 @@
+//go:build !(sqlite_fts5 || fts5 || lite)
+
+package crawal
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+)
+
+// FullTextSearch reports whether SearchGalleryItems searches a full-text index, in
+// builds with the sqlite_fts5 tag, rather than scanning the library with LIKE
+const FullTextSearch = false
+
+// likeWarning warns, once, that the search of this build scans the library
+var likeWarning sync.Once
+
+// setupSearch removes the triggers of the full-text index left by a build with
+// sqlite_fts5, as they cannot run without the module. The index is rebuilt by the
+// next such build.
+func setupSearch(db *sql.DB) error {
+	for _, name := range searchTriggers {
+		if _, err := db.Exec("DROP TRIGGER IF EXISTS " + name); err != nil {
+			return fmt.Errorf("failed to drop search trigger: %w", err)
+		}
+	}
+	return nil
+}
+
+// searchMatches selects the IDs of the wallpapers matching every term with LIKE
+func searchMatches(terms []string) (string, []any) {
+	likeWarning.Do(func() {
+		logger.Printf("Search is running in LIKE mode, which matches CJK titles poorly: build with -tags sqlite_fts5, as make does, for the full-text index")
+	})
+	cond, args := likeTerms(terms, []string{"title", "description", "artist",
+		"(SELECT group_concat(tag, ' ') FROM tags WHERE gallery_id = gallery.id)"})
+	return "SELECT id, 0 AS rank FROM gallery WHERE " + cond, args
+}
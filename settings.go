@@ -0,0 +1,27 @@
+package crawal
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// GetSetting returns the value of a setting stored in the database, or def when it is not set
+func GetSetting(db *sql.DB, key, def string) (string, error) {
+	var value string
+	err := db.QueryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return def, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read setting %s: %w", key, err)
+	}
+	return value, nil
+}
+
+// SetSetting stores the value of a setting in the database
+func SetSetting(db *sql.DB, key, value string) error {
+	if _, err := db.Exec("INSERT OR REPLACE INTO settings(key, value) VALUES (?, ?)", key, value); err != nil {
+		return fmt.Errorf("failed to write setting %s: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package crawal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// Kinds of the entries of the skip list
+const (
+	SkipID    = "id"    // matches the ID of an item in the API of its game
+	SkipTitle = "title" // matches the titles of items, a path.Match pattern ignoring case
+)
+
+// SkipEntry is an entry of the skip list, the items that are never queued, such as
+// those known to be broken or unwanted
+type SkipEntry struct {
+	ID      int64
+	Game    string // empty for every game
+	Kind    string
+	Pattern string
+	Reason  string
+	At      time.Time
+}
+
+// AddSkip adds an entry to the skip list, returning its ID. An entry with the same
+// game, kind and pattern is updated with the reason instead.
+func AddSkip(db *sql.DB, e SkipEntry) (int64, error) {
+	switch e.Kind {
+	case SkipID:
+	case SkipTitle:
+		if _, err := path.Match(e.Pattern, ""); err != nil {
+			return 0, fmt.Errorf("invalid title pattern %q: %w", e.Pattern, err)
+		}
+	default:
+		return 0, fmt.Errorf("unknown kind %q of skip list entry, id or title expected", e.Kind)
+	}
+	if e.Pattern == "" {
+		return 0, errors.New("empty skip list entry")
+	}
+
+	var id int64
+	err := db.QueryRow(`
+		INSERT INTO skip_list(game, kind, pattern, reason) VALUES (?, ?, ?, ?)
+		ON CONFLICT (game, kind, pattern) DO UPDATE SET reason = excluded.reason
+		RETURNING id`, e.Game, e.Kind, e.Pattern, e.Reason).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add to the skip list: %w", err)
+	}
+	return id, nil
+}
+
+// RemoveSkip removes the entry id from the skip list, its items being queued again
+// by the next sync
+func RemoveSkip(db *sql.DB, id int64) error {
+	res, err := db.Exec("DELETE FROM skip_list WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to remove from the skip list: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("no skip list entry %d", id)
+	}
+	return nil
+}
+
+// ListSkips returns the entries of the skip list applying to game, or all of them
+// when empty, oldest first
+func ListSkips(db *sql.DB, game string) ([]SkipEntry, error) {
+	rows, err := db.Query(`SELECT id, game, kind, pattern, reason, at FROM skip_list
+		WHERE ? = '' OR game = '' OR game = ? ORDER BY id`, game, game)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the skip list: %w", err)
+	}
+	defer rows.Close()
+	var entries []SkipEntry
+	for rows.Next() {
+		var e SkipEntry
+		if err := rows.Scan(&e.ID, &e.Game, &e.Kind, &e.Pattern, &e.Reason, &e.At); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// skipList is the skip list of a game, loaded once per sync
+type skipList []SkipEntry
+
+// loadSkipList loads the entries of the skip list applying to game
+func loadSkipList(db *sql.DB, game string) (skipList, error) {
+	if game == "" {
+		return nil, nil
+	}
+	return ListSkips(db, game)
+}
+
+// match returns the entry matching it, by its ID or one of its titles
+func (l skipList) match(it Item) (SkipEntry, bool) {
+	for _, e := range l {
+		switch e.Kind {
+		case SkipID:
+			if e.Pattern == it.ID {
+				return e, true
+			}
+		case SkipTitle:
+			titles := []string{it.Title}
+			for _, t := range it.Titles {
+				titles = append(titles, t)
+			}
+			for _, t := range titles {
+				if ok, _ := path.Match(strings.ToLower(e.Pattern), strings.ToLower(t)); ok && t != "" {
+					return e, true
+				}
+			}
+		}
+	}
+	return SkipEntry{}, false
+}
@@ -0,0 +1,63 @@
+package crawal
+
+import "testing"
+
+func TestSkipList(t *testing.T) {
+	db := newPageTestDB(t, 0)
+	for _, e := range []SkipEntry{
+		{Game: "azur_lane", Kind: SkipID, Pattern: "7", Reason: "broken"},
+		{Game: "azur_lane", Kind: SkipTitle, Pattern: "*Swimsuit*"},
+		{Kind: SkipTitle, Pattern: "水着*"},
+		{Game: "arknights", Kind: SkipID, Pattern: "8"},
+	} {
+		if _, err := AddSkip(db, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the same entry again only updates its reason
+	if _, err := AddSkip(db, SkipEntry{Game: "azur_lane", Kind: SkipID, Pattern: "7", Reason: "gone"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []SkipEntry{
+		{Kind: "url", Pattern: "x"},
+		{Kind: SkipID},
+		{Kind: SkipTitle, Pattern: "[unclosed"},
+	} {
+		if _, err := AddSkip(db, e); err == nil {
+			t.Errorf("AddSkip(%+v) succeeded, want an error", e)
+		}
+	}
+
+	skips, err := loadSkipList(db, "azur_lane")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(skips) != 3 || skips[0].Reason != "gone" {
+		t.Fatalf("skip list of azur_lane %+v, want the 3 entries of the game and of every game", skips)
+	}
+	tests := []struct {
+		item Item
+		want bool
+	}{
+		{Item{ID: "7", Title: "Anything"}, true},
+		{Item{ID: "8", Title: "Anything"}, false}, // skipped for another game
+		{Item{ID: "9", Title: "Summer swimsuit (Azuma)"}, true},
+		{Item{ID: "10", Title: "Summer", Titles: map[string]string{"ja": "水着の夏"}}, true},
+		{Item{ID: "11", Title: "Winter", Titles: map[string]string{"ja": "冬"}}, false},
+	}
+	for _, tt := range tests {
+		if _, got := skips.match(tt.item); got != tt.want {
+			t.Errorf("%s %q skipped %v, want %v", tt.item.ID, tt.item.Title, got, tt.want)
+		}
+	}
+
+	if err := RemoveSkip(db, skips[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemoveSkip(db, skips[0].ID); err == nil {
+		t.Error("removing a removed entry succeeded")
+	}
+	if all, err := ListSkips(db, ""); err != nil || len(all) != 3 {
+		t.Errorf("%d entries left of every game (%v), want 3", len(all), err)
+	}
+}
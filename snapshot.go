@@ -0,0 +1,143 @@
+package crawal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SnapshotsInDB is the archive target storing API responses in the database
+const SnapshotsInDB = "db"
+
+// ResponseArchive keeps the raw responses of the game APIs, gzip-compressed, since
+// entries removed from a gallery are otherwise lost
+type ResponseArchive struct {
+	db  *sql.DB
+	dir string // folder the responses are written to, empty to store them in db
+}
+
+// NewResponseArchive returns an archive storing responses in the database when target
+// is SnapshotsInDB, or in the target folder otherwise
+func NewResponseArchive(db *sql.DB, target string) *ResponseArchive {
+	if target == SnapshotsInDB {
+		return &ResponseArchive{db: db}
+	}
+	return &ResponseArchive{dir: target}
+}
+
+// Save archives the body of a response of the API of game
+func (a *ResponseArchive) Save(game, region, url string, body []byte) error {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Name = url
+	if _, err := zw.Write(body); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	if a.dir == "" {
+		_, err := a.db.Exec("INSERT INTO api_snapshots(game, region, url, body, sha256) VALUES (?, ?, ?, ?, ?)", game, region, url, buf.Bytes(), sha256Hex(body))
+		if err != nil {
+			return fmt.Errorf("failed to archive response: %w", err)
+		}
+		return nil
+	}
+
+	dir := filepath.Join(a.dir, game, region)
+	if err := makeDirs(dir); err != nil {
+		return fmt.Errorf("failed to create folder: %w", err)
+	}
+	p := filepath.Join(dir, time.Now().UTC().Format("20060102T150405.000000000Z")+".json.gz")
+	if err := os.WriteFile(p, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return ownFile(p)
+}
+
+// Transport wraps next so that every successful response of the API of game is archived
+func (a *ResponseArchive) Transport(next http.RoundTripper, game, region string) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return archivingTransport{archive: a, next: next, game: game, region: region}
+}
+
+// archivingTransport archives the responses it passes through
+type archivingTransport struct {
+	archive      *ResponseArchive
+	next         http.RoundTripper
+	game, region string
+}
+
+func (t archivingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.next.RoundTrip(req)
+	if err != nil || res.StatusCode != http.StatusOK {
+		return res, err
+	}
+
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	if err := t.archive.Save(t.game, t.region, req.URL.String(), body); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Snapshot is an API response archived in the database
+type Snapshot struct {
+	ID        int64
+	Game      string
+	Region    string
+	URL       string
+	Size      int // compressed size in bytes
+	FetchedAt time.Time
+}
+
+// ListSnapshots returns the API responses archived in the database, newest first,
+// only those of game when not empty
+func ListSnapshots(db *sql.DB, game string) ([]Snapshot, error) {
+	rows, err := db.Query(`
+		SELECT id, game, region, url, LENGTH(body), fetched_at FROM api_snapshots
+		WHERE ? = '' OR game = ? ORDER BY id DESC`, game, game)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []Snapshot
+	for rows.Next() {
+		var s Snapshot
+		if err := rows.Scan(&s.ID, &s.Game, &s.Region, &s.URL, &s.Size, &s.FetchedAt); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, rows.Err()
+}
+
+// ReadSnapshot returns the decompressed body of an API response archived in the database
+func ReadSnapshot(db *sql.DB, id int64) ([]byte, error) {
+	var body []byte
+	if err := db.QueryRow("SELECT body FROM api_snapshots WHERE id = ?", id).Scan(&body); err != nil {
+		return nil, err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
@@ -1,24 +1,549 @@
 package crawal
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"log"
-
-	_ "github.com/mattn/go-sqlite3"
+	"os"
+	"path/filepath"
 )
 
-var db *sql.DB
+// dbPath is the database shared by all the games, yostar-gallery.db unless the
+// YOSTAR_DB environment variable names another file
+var dbPath = databasePath()
+
+// databasePath returns the path of the database from the environment
+func databasePath() string {
+	if p := os.Getenv("YOSTAR_DB"); p != "" {
+		return p
+	}
+	return "yostar-gallery.db"
+}
 
-const dbPath = "yostar-gallery.db"
+// DatabasePath returns the path of the database
+func DatabasePath() string {
+	return dbPath
+}
 
-func init() {
-	var err error
-	db, err = sql.Open("sqlite3", dbPath)
+// SetDatabasePath makes OpenDB open the database at p, for a program not started
+// with YOSTAR_DB in its environment
+func SetDatabasePath(p string) {
+	dbPath = p
+}
+
+// migrations are applied in order on top of the base schema. The index of the
+// last applied migration is tracked with PRAGMA user_version, so new entries
+// must only ever be appended.
+var migrations = []string{
+	`ALTER TABLE yostar_gallery ADD COLUMN path VARCHAR(255) NOT NULL DEFAULT ''`,
+	`CREATE TABLE IF NOT EXISTS revisions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		gallery_id INTEGER NOT NULL,
+		revision INTEGER NOT NULL,
+		file_name VARCHAR(255) NOT NULL,
+		url VARCHAR(255) NOT NULL,
+		path VARCHAR(255) NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`ALTER TABLE yostar_gallery ADD COLUMN sha256 VARCHAR(64) NOT NULL DEFAULT ''`,
+	`ALTER TABLE yostar_gallery ADD COLUMN size INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE yostar_gallery ADD COLUMN phash VARCHAR(16) NOT NULL DEFAULT ''`,
+	`ALTER TABLE yostar_gallery ADD COLUMN duplicate_of INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE yostar_gallery ADD COLUMN dominant_color VARCHAR(7) NOT NULL DEFAULT ''`,
+	`ALTER TABLE yostar_gallery ADD COLUMN color VARCHAR(32) NOT NULL DEFAULT ''`,
+	`ALTER TABLE yostar_gallery ADD COLUMN brightness REAL NOT NULL DEFAULT -1`,
+	`ALTER TABLE yostar_gallery ADD COLUMN width INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE yostar_gallery ADD COLUMN height INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE yostar_gallery ADD COLUMN aspect REAL NOT NULL DEFAULT 0`,
+	`CREATE TABLE IF NOT EXISTS tags (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		gallery_id INTEGER NOT NULL,
+		tag VARCHAR(255) NOT NULL,
+		source VARCHAR(255) NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (gallery_id, tag)
+	)`,
+	`CREATE TABLE IF NOT EXISTS ocr_text (
+		gallery_id INTEGER PRIMARY KEY,
+		text TEXT NOT NULL,
+		source VARCHAR(255) NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`ALTER TABLE yostar_gallery ADD COLUMN cataloged INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE yostar_gallery ADD COLUMN metadata TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE IF NOT EXISTS download_queue (
+		gallery_id INTEGER PRIMARY KEY,
+		priority INTEGER NOT NULL DEFAULT 0,
+		paused INTEGER NOT NULL DEFAULT 0,
+		status VARCHAR(16) NOT NULL DEFAULT 'queued',
+		error TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE TABLE IF NOT EXISTS settings (
+		key VARCHAR(255) PRIMARY KEY,
+		value TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS download_jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		game VARCHAR(255) NOT NULL,
+		id_gallery VARCHAR(255) NOT NULL,
+		type VARCHAR(255) NOT NULL,
+		file_name VARCHAR(255) NOT NULL,
+		url VARCHAR(255) NOT NULL,
+		dir VARCHAR(255) NOT NULL DEFAULT '',
+		metadata TEXT NOT NULL DEFAULT '',
+		replace_file INTEGER NOT NULL DEFAULT 0,
+		priority INTEGER NOT NULL DEFAULT 0,
+		paused INTEGER NOT NULL DEFAULT 0,
+		state VARCHAR(16) NOT NULL DEFAULT 'queued',
+		error TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`INSERT INTO download_jobs(game, id_gallery, type, file_name, url, metadata, priority, paused, state, error, created_at)
+		SELECT g.game, g.id_gallery, g.type, g.file_name, g.url, g.metadata, q.priority, q.paused,
+			CASE q.status WHEN 'failed' THEN 'failed' ELSE 'queued' END, q.error, q.created_at
+		FROM download_queue q JOIN yostar_gallery g ON g.id = q.gallery_id`,
+	`DROP TABLE download_queue`,
+	`DELETE FROM download_jobs WHERE state IN ('queued', 'running') AND id NOT IN (
+		SELECT MIN(id) FROM download_jobs WHERE state IN ('queued', 'running') GROUP BY game, id_gallery, type
+	)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS download_jobs_active ON download_jobs(game, id_gallery, type)
+		WHERE state IN ('queued', 'running')`,
+	`ALTER TABLE download_jobs DROP COLUMN replace_file`,
+	`CREATE TABLE IF NOT EXISTS items (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		game VARCHAR(255) NOT NULL,
+		id_gallery VARCHAR(255) NOT NULL,
+		title VARCHAR(255) NOT NULL DEFAULT '',
+		artist VARCHAR(255) NOT NULL DEFAULT '',
+		published_at TIMESTAMP,
+		metadata TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (game, id_gallery)
+	)`,
+	`CREATE TABLE IF NOT EXISTS files (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		item_id INTEGER NOT NULL REFERENCES items(id),
+		type VARCHAR(255) NOT NULL,
+		file_name VARCHAR(255) NOT NULL,
+		url VARCHAR(255) NOT NULL,
+		path VARCHAR(255) NOT NULL DEFAULT '',
+		sha256 VARCHAR(64) NOT NULL DEFAULT '',
+		size INTEGER NOT NULL DEFAULT 0,
+		phash VARCHAR(16) NOT NULL DEFAULT '',
+		duplicate_of INTEGER NOT NULL DEFAULT 0,
+		dominant_color VARCHAR(7) NOT NULL DEFAULT '',
+		color VARCHAR(32) NOT NULL DEFAULT '',
+		brightness REAL NOT NULL DEFAULT -1,
+		width INTEGER NOT NULL DEFAULT 0,
+		height INTEGER NOT NULL DEFAULT 0,
+		aspect REAL NOT NULL DEFAULT 0,
+		cataloged INTEGER NOT NULL DEFAULT 0,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (item_id, type)
+	)`,
+	// titles and artists of older entries are recovered from the API metadata when possible
+	`INSERT INTO items(game, id_gallery, title, artist, metadata, created_at)
+		SELECT game, id_gallery,
+			CASE WHEN json_valid(metadata) THEN COALESCE(json_extract(metadata, '$.title'), '') ELSE '' END,
+			CASE WHEN json_valid(metadata) THEN COALESCE(json_extract(metadata, '$.artist'), json_extract(metadata, '$.artistName'),
+				json_extract(metadata, '$.creator'), '') ELSE '' END,
+			metadata, created_at
+		FROM (
+			SELECT game, id_gallery, MAX(metadata) AS metadata, MIN(created_at) AS created_at
+			FROM yostar_gallery GROUP BY game, id_gallery
+		)`,
+	// file IDs are kept so tags, OCR text and revisions stay linked; the latest row wins
+	`INSERT OR IGNORE INTO files(id, item_id, type, file_name, url, path, sha256, size, phash, duplicate_of,
+			dominant_color, color, brightness, width, height, aspect, cataloged, created_at)
+		SELECT g.id, i.id, g.type, g.file_name, g.url, g.path, g.sha256, g.size, g.phash, g.duplicate_of,
+			g.dominant_color, g.color, g.brightness, g.width, g.height, g.aspect, g.cataloged, g.created_at
+		FROM yostar_gallery g JOIN items i ON i.game = g.game AND i.id_gallery = g.id_gallery
+		ORDER BY g.id DESC`,
+	`DROP TABLE yostar_gallery`,
+	`CREATE VIEW IF NOT EXISTS gallery AS
+		SELECT f.id, f.item_id, i.id_gallery, i.game, f.type, f.file_name, f.url, f.path, f.sha256, f.size, f.phash, f.duplicate_of,
+			f.dominant_color, f.color, f.brightness, f.width, f.height, f.aspect, f.cataloged,
+			i.title, i.artist, i.published_at, i.metadata, f.created_at
+		FROM files f JOIN items i ON i.id = f.item_id`,
+	`CREATE TABLE IF NOT EXISTS games (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name VARCHAR(255) NOT NULL UNIQUE
+	)`,
+	`CREATE TABLE IF NOT EXISTS artists (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name VARCHAR(255) NOT NULL UNIQUE
+	)`,
+	`INSERT OR IGNORE INTO games(name) SELECT DISTINCT game FROM items ORDER BY game`,
+	`INSERT OR IGNORE INTO artists(name) SELECT DISTINCT artist FROM items WHERE artist != '' ORDER BY artist`,
+	// items is rebuilt to reference games and artists, the view depending on it first
+	`DROP VIEW gallery`,
+	`CREATE TABLE items_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		game_id INTEGER NOT NULL REFERENCES games(id),
+		id_gallery VARCHAR(255) NOT NULL,
+		title VARCHAR(255) NOT NULL DEFAULT '',
+		artist_id INTEGER REFERENCES artists(id),
+		published_at TIMESTAMP,
+		metadata TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (game_id, id_gallery)
+	)`,
+	`INSERT INTO items_new(id, game_id, id_gallery, title, artist_id, published_at, metadata, created_at)
+		SELECT i.id, g.id, i.id_gallery, i.title, a.id, i.published_at, i.metadata, i.created_at
+		FROM items i JOIN games g ON g.name = i.game LEFT JOIN artists a ON a.name = i.artist`,
+	`DROP TABLE items`,
+	`ALTER TABLE items_new RENAME TO items`,
+	// tags of files that no longer exist are dropped with the rebuild
+	`CREATE TABLE tags_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		gallery_id INTEGER NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+		tag VARCHAR(255) NOT NULL,
+		source VARCHAR(255) NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (gallery_id, tag)
+	)`,
+	`INSERT INTO tags_new SELECT * FROM tags WHERE gallery_id IN (SELECT id FROM files)`,
+	`DROP TABLE tags`,
+	`ALTER TABLE tags_new RENAME TO tags`,
+	`CREATE VIEW gallery AS
+		SELECT f.id, f.item_id, i.id_gallery, g.name AS game, f.type, f.file_name, f.url, f.path, f.sha256, f.size, f.phash, f.duplicate_of,
+			f.dominant_color, f.color, f.brightness, f.width, f.height, f.aspect, f.cataloged,
+			i.title, COALESCE(a.name, '') AS artist, i.published_at, i.metadata, f.created_at
+		FROM files f
+		JOIN items i ON i.id = f.item_id
+		JOIN games g ON g.id = i.game_id
+		LEFT JOIN artists a ON a.id = i.artist_id`,
+	`ALTER TABLE items ADD COLUMN description TEXT NOT NULL DEFAULT ''`,
+	`UPDATE items SET description = COALESCE(json_extract(metadata, '$.description'), '') WHERE json_valid(metadata)`,
+	`DROP VIEW gallery`,
+	`CREATE VIEW gallery AS
+		SELECT f.id, f.item_id, i.id_gallery, g.name AS game, f.type, f.file_name, f.url, f.path, f.sha256, f.size, f.phash, f.duplicate_of,
+			f.dominant_color, f.color, f.brightness, f.width, f.height, f.aspect, f.cataloged,
+			i.title, i.description, COALESCE(a.name, '') AS artist, i.published_at, i.metadata, f.created_at
+		FROM files f
+		JOIN items i ON i.id = f.item_id
+		JOIN games g ON g.id = i.game_id
+		LEFT JOIN artists a ON a.id = i.artist_id`,
+	`CREATE TABLE IF NOT EXISTS item_titles (
+		item_id INTEGER NOT NULL REFERENCES items(id) ON DELETE CASCADE,
+		locale VARCHAR(16) NOT NULL,
+		title VARCHAR(255) NOT NULL,
+		PRIMARY KEY (item_id, locale)
+	)`,
+	// the title is shown in the preferred locale when the item has one
+	`DROP VIEW gallery`,
+	`CREATE VIEW gallery AS
+		SELECT f.id, f.item_id, i.id_gallery, g.name AS game, f.type, f.file_name, f.url, f.path, f.sha256, f.size, f.phash, f.duplicate_of,
+			f.dominant_color, f.color, f.brightness, f.width, f.height, f.aspect, f.cataloged,
+			COALESCE((
+				SELECT t.title FROM item_titles t
+				WHERE t.item_id = i.id AND t.locale = (SELECT value FROM settings WHERE key = 'title_locale')
+			), i.title) AS title,
+			i.description, COALESCE(a.name, '') AS artist, i.published_at, i.metadata, f.created_at
+		FROM files f
+		JOIN items i ON i.id = f.item_id
+		JOIN games g ON g.id = i.game_id
+		LEFT JOIN artists a ON a.id = i.artist_id`,
+	`ALTER TABLE games ADD COLUMN region VARCHAR(16) NOT NULL DEFAULT 'global'`,
+	`ALTER TABLE items ADD COLUMN region VARCHAR(16) NOT NULL DEFAULT 'global'`,
+	`DROP VIEW gallery`,
+	`CREATE VIEW gallery AS
+		SELECT f.id, f.item_id, i.id_gallery, g.name AS game, i.region, f.type, f.file_name, f.url, f.path, f.sha256, f.size, f.phash, f.duplicate_of,
+			f.dominant_color, f.color, f.brightness, f.width, f.height, f.aspect, f.cataloged,
+			COALESCE((
+				SELECT t.title FROM item_titles t
+				WHERE t.item_id = i.id AND t.locale = (SELECT value FROM settings WHERE key = 'title_locale')
+			), i.title) AS title,
+			i.description, COALESCE(a.name, '') AS artist, i.published_at, i.metadata, f.created_at
+		FROM files f
+		JOIN items i ON i.id = f.item_id
+		JOIN games g ON g.id = i.game_id
+		LEFT JOIN artists a ON a.id = i.artist_id`,
+	`ALTER TABLE games ADD COLUMN endpoint VARCHAR(255) NOT NULL DEFAULT ''`,
+	`CREATE TABLE IF NOT EXISTS api_snapshots (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		game VARCHAR(255) NOT NULL,
+		region VARCHAR(16) NOT NULL,
+		url VARCHAR(255) NOT NULL,
+		body BLOB NOT NULL,
+		fetched_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`ALTER TABLE download_jobs ADD COLUMN size INTEGER NOT NULL DEFAULT 0`,
+	`CREATE TABLE IF NOT EXISTS dead_links (
+		url VARCHAR(255) PRIMARY KEY,
+		game VARCHAR(255) NOT NULL,
+		id_gallery VARCHAR(255) NOT NULL,
+		type VARCHAR(255) NOT NULL,
+		file_name VARCHAR(255) NOT NULL,
+		status INTEGER NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		dead INTEGER NOT NULL DEFAULT 0,
+		first_seen TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		last_seen TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`ALTER TABLE files ADD COLUMN source_url VARCHAR(255) NOT NULL DEFAULT ''`,
+	`ALTER TABLE download_jobs ADD COLUMN candidates TEXT NOT NULL DEFAULT ''`,
+	`DROP VIEW gallery`,
+	`CREATE VIEW gallery AS
+		SELECT f.id, f.item_id, i.id_gallery, g.name AS game, i.region, f.type, f.file_name, f.url, f.source_url, f.path, f.sha256, f.size, f.phash, f.duplicate_of,
+			f.dominant_color, f.color, f.brightness, f.width, f.height, f.aspect, f.cataloged,
+			COALESCE((
+				SELECT t.title FROM item_titles t
+				WHERE t.item_id = i.id AND t.locale = (SELECT value FROM settings WHERE key = 'title_locale')
+			), i.title) AS title,
+			i.description, COALESCE(a.name, '') AS artist, i.published_at, i.metadata, f.created_at
+		FROM files f
+		JOIN items i ON i.id = f.item_id
+		JOIN games g ON g.id = i.game_id
+		LEFT JOIN artists a ON a.id = i.artist_id`,
+	`ALTER TABLE files ADD COLUMN original_size INTEGER NOT NULL DEFAULT 0`,
+	`DROP VIEW gallery`,
+	`CREATE VIEW gallery AS
+		SELECT f.id, f.item_id, i.id_gallery, g.name AS game, i.region, f.type, f.file_name, f.url, f.source_url, f.path, f.sha256, f.size, f.original_size,
+			f.phash, f.duplicate_of, f.dominant_color, f.color, f.brightness, f.width, f.height, f.aspect, f.cataloged,
+			COALESCE((
+				SELECT t.title FROM item_titles t
+				WHERE t.item_id = i.id AND t.locale = (SELECT value FROM settings WHERE key = 'title_locale')
+			), i.title) AS title,
+			i.description, COALESCE(a.name, '') AS artist, i.published_at, i.metadata, f.created_at
+		FROM files f
+		JOIN items i ON i.id = f.item_id
+		JOIN games g ON g.id = i.game_id
+		LEFT JOIN artists a ON a.id = i.artist_id`,
+	// publication dates were stored as given: epochs, or strings with the offset of the crawler
+	`UPDATE items SET published_at = CASE
+			WHEN published_at IN (0, '') THEN NULL
+			WHEN typeof(published_at) = 'text' THEN COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', published_at), published_at)
+			WHEN published_at >= 100000000000 THEN strftime('%Y-%m-%dT%H:%M:%SZ', published_at / 1000, 'unixepoch')
+			ELSE strftime('%Y-%m-%dT%H:%M:%SZ', published_at, 'unixepoch')
+		END
+		WHERE published_at IS NOT NULL`,
+	// when an API last listed the item, to tell the entries it renumbered
+	`ALTER TABLE items ADD COLUMN listed_at TIMESTAMP`,
+	// query is the JSON of the filter of the collection, empty when its members are
+	// added by hand only
+	`CREATE TABLE IF NOT EXISTS collections (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name VARCHAR(255) NOT NULL UNIQUE,
+		query TEXT NOT NULL DEFAULT '',
+		folder VARCHAR(255) NOT NULL DEFAULT '',
+		export_mode VARCHAR(16) NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE TABLE IF NOT EXISTS collection_items (
+		collection_id INTEGER NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+		gallery_id INTEGER NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+		source VARCHAR(16) NOT NULL,
+		added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (collection_id, gallery_id)
+	)`,
+	// the files exported for wallpapers deleted since are removed at the next update
+	`CREATE TABLE IF NOT EXISTS collection_files (
+		collection_id INTEGER NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+		gallery_id INTEGER NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		PRIMARY KEY (collection_id, gallery_id)
+	)`,
+	`ALTER TABLE collections ADD COLUMN rules TEXT NOT NULL DEFAULT ''`,
+	// sha256 is that of the file of the library when converted, to convert it again
+	// once changed
+	`CREATE TABLE IF NOT EXISTS conversions (
+		gallery_id INTEGER NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+		folder VARCHAR(255) NOT NULL,
+		ext VARCHAR(16) NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		sha256 VARCHAR(64) NOT NULL DEFAULT '',
+		converted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (gallery_id, folder, ext)
+	)`,
+	// the checksums of the API responses of each crawler run, and the run that listed
+	// an item, trace a downloaded file back to the listing it was found in
+	`CREATE TABLE IF NOT EXISTS api_responses (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		run VARCHAR(32) NOT NULL,
+		game VARCHAR(255) NOT NULL,
+		region VARCHAR(16) NOT NULL,
+		url VARCHAR(255) NOT NULL,
+		status INTEGER NOT NULL,
+		size INTEGER NOT NULL,
+		sha256 VARCHAR(64) NOT NULL,
+		fetched_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS api_responses_run ON api_responses(run)`,
+	`ALTER TABLE api_snapshots ADD COLUMN sha256 VARCHAR(64) NOT NULL DEFAULT ''`,
+	`ALTER TABLE items ADD COLUMN listed_run VARCHAR(32) NOT NULL DEFAULT ''`,
+	`ALTER TABLE files ADD COLUMN listed_run VARCHAR(32) NOT NULL DEFAULT ''`,
+	`ALTER TABLE files ADD COLUMN downloaded_at TIMESTAMP`,
+	`UPDATE files SET downloaded_at = created_at WHERE cataloged = 0 AND path != ''`,
+	// the normalized URL the file was served from, once redirected
+	`ALTER TABLE files ADD COLUMN resolved_url VARCHAR(255) NOT NULL DEFAULT ''`,
+	`DROP VIEW gallery`,
+	`CREATE VIEW gallery AS
+		SELECT f.id, f.item_id, i.id_gallery, g.name AS game, i.region, f.type, f.file_name, f.url, f.source_url, f.resolved_url, f.path, f.sha256, f.size,
+			f.original_size, f.phash, f.duplicate_of, f.dominant_color, f.color, f.brightness, f.width, f.height, f.aspect, f.cataloged,
+			COALESCE((
+				SELECT t.title FROM item_titles t
+				WHERE t.item_id = i.id AND t.locale = (SELECT value FROM settings WHERE key = 'title_locale')
+			), i.title) AS title,
+			i.description, COALESCE(a.name, '') AS artist, i.published_at, i.metadata, f.created_at
+		FROM files f
+		JOIN items i ON i.id = f.item_id
+		JOIN games g ON g.id = i.game_id
+		LEFT JOIN artists a ON a.id = i.artist_id`,
+	// the actions taken through the web UI and its API, for history --audit
+	`CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		source VARCHAR(255) NOT NULL,
+		action VARCHAR(64) NOT NULL,
+		target VARCHAR(255) NOT NULL DEFAULT '',
+		error TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS audit_log_at ON audit_log(at)`,
+	// the downloads failing the checks of the images, kept out of the library
+	`CREATE TABLE IF NOT EXISTS quarantine (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		job_id INTEGER NOT NULL DEFAULT 0,
+		game VARCHAR(255) NOT NULL,
+		id_gallery VARCHAR(255) NOT NULL,
+		type VARCHAR(255) NOT NULL,
+		url TEXT NOT NULL,
+		path TEXT NOT NULL,
+		reason TEXT NOT NULL,
+		at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`,
+	// the items never queued, by ID or title pattern, see AddSkip
+	`CREATE TABLE IF NOT EXISTS skip_list (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		game VARCHAR(255) NOT NULL DEFAULT '',
+		kind VARCHAR(16) NOT NULL,
+		pattern TEXT NOT NULL,
+		reason TEXT NOT NULL DEFAULT '',
+		at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (game, kind, pattern)
+	)`,
+	// the same gallery ID is a different entry in each region of a game, items is
+	// rebuilt with the region in its key and the jobs are queued per region. The
+	// copy is not renamed back, which the search triggers on the view would fail.
+	`DROP VIEW gallery`,
+	`CREATE TABLE items_old AS SELECT * FROM items`,
+	`DROP TABLE items`,
+	`CREATE TABLE items (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		game_id INTEGER NOT NULL REFERENCES games(id),
+		region VARCHAR(16) NOT NULL DEFAULT 'global',
+		id_gallery VARCHAR(255) NOT NULL,
+		title VARCHAR(255) NOT NULL DEFAULT '',
+		description TEXT NOT NULL DEFAULT '',
+		artist_id INTEGER REFERENCES artists(id),
+		published_at TIMESTAMP,
+		metadata TEXT NOT NULL DEFAULT '',
+		listed_at TIMESTAMP,
+		listed_run VARCHAR(32) NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (game_id, region, id_gallery)
+	)`,
+	`INSERT INTO items(id, game_id, region, id_gallery, title, description, artist_id, published_at, metadata, listed_at, listed_run, created_at)
+		SELECT id, game_id, region, id_gallery, title, description, artist_id, published_at, metadata, listed_at, listed_run, created_at
+		FROM items_old`,
+	`DROP TABLE items_old`,
+	`CREATE VIEW gallery AS
+		SELECT f.id, f.item_id, i.id_gallery, g.name AS game, i.region, f.type, f.file_name, f.url, f.source_url, f.resolved_url, f.path, f.sha256, f.size,
+			f.original_size, f.phash, f.duplicate_of, f.dominant_color, f.color, f.brightness, f.width, f.height, f.aspect, f.cataloged,
+			COALESCE((
+				SELECT t.title FROM item_titles t
+				WHERE t.item_id = i.id AND t.locale = (SELECT value FROM settings WHERE key = 'title_locale')
+			), i.title) AS title,
+			i.description, COALESCE(a.name, '') AS artist, i.published_at, i.metadata, f.created_at
+		FROM files f
+		JOIN items i ON i.id = f.item_id
+		JOIN games g ON g.id = i.game_id
+		LEFT JOIN artists a ON a.id = i.artist_id`,
+	`ALTER TABLE download_jobs ADD COLUMN region VARCHAR(16) NOT NULL DEFAULT 'global'`,
+	`DROP INDEX download_jobs_active`,
+	`CREATE UNIQUE INDEX download_jobs_active ON download_jobs(game, region, id_gallery, type)
+		WHERE state IN ('queued', 'running')`,
+	// files restored by a revert are kept until unpinned, whatever the API lists
+	`ALTER TABLE files ADD COLUMN pinned INTEGER NOT NULL DEFAULT 0`,
+	`DROP VIEW gallery`,
+	`CREATE VIEW gallery AS
+		SELECT f.id, f.item_id, i.id_gallery, g.name AS game, i.region, f.type, f.file_name, f.url, f.source_url, f.resolved_url, f.path, f.sha256, f.size,
+			f.original_size, f.phash, f.duplicate_of, f.dominant_color, f.color, f.brightness, f.width, f.height, f.aspect, f.cataloged, f.pinned,
+			COALESCE((
+				SELECT t.title FROM item_titles t
+				WHERE t.item_id = i.id AND t.locale = (SELECT value FROM settings WHERE key = 'title_locale')
+			), i.title) AS title,
+			i.description, COALESCE(a.name, '') AS artist, i.published_at, i.metadata, f.created_at
+		FROM files f
+		JOIN items i ON i.id = f.item_id
+		JOIN games g ON g.id = i.game_id
+		LEFT JOIN artists a ON a.id = i.artist_id`,
+}
+
+// OpenDB opens the database shared by all the games, creating and migrating it as
+// needed. Close it with CloseDB.
+func OpenDB() (*sql.DB, error) {
+	db, err := openDatabase(dbPath)
 	if err != nil {
-		log.Fatalf("failed to open database: %v", err)
+		return nil, err
 	}
+	if err = mergeLegacyDatabases(db, filepath.Dir(dbPath)); err != nil {
+		logger.Printf("Error merging legacy databases: %v", err)
+	}
+	if err = loadLibraryRoot(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	logger.Printf("Opened database %s", dbPath)
+	return db, nil
+}
+
+// CloseDB checkpoints the write-ahead log of the database, if it uses one, so that
+// everything is in the database file, then closes it
+func CloseDB(db *sql.DB) error {
+	if _, err := db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		db.Close()
+		return fmt.Errorf("failed to checkpoint database: %w", err)
+	}
+	return db.Close()
+}
 
+// openDatabase opens the database at p, creating and migrating its schema as needed
+func openDatabase(p string) (*sql.DB, error) {
+	db, err := sql.Open(sqliteDriver, databaseDSN(p))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	var version int
+	if err = db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	// New databases start from the original schema and go through every migration
+	if version == 0 {
+		if err = createGalleryTable(db); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to create table: %w", err)
+		}
+	}
+
+	if err = migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+	if err = setupSearch(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// createGalleryTable creates the original yostar_gallery table the migrations start from
+func createGalleryTable(db *sql.DB) error {
 	createTable := `
 		CREATE TABLE IF NOT EXISTS yostar_gallery (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -30,14 +555,50 @@ func init() {
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		);
 	`
-	_, err = db.Exec(createTable)
+	_, err := db.Exec(createTable)
+	return err
+}
+
+// migrate applies every migration newer than the database's user_version.
+// Foreign keys are not enforced while migrating so that tables can be rebuilt.
+func migrate(db *sql.DB) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
 	if err != nil {
-		db.Close()
-		log.Fatalf("failed to create table: %v", err)
+		return err
+	}
+	defer conn.Close()
+
+	var version int
+	if err := conn.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if version == len(migrations) {
+		return nil
 	}
-	fmt.Println("=======DB created=======")
-}
 
-func GetSqliteDb() *sql.DB {
-	return db
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err = tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		// PRAGMA does not accept bound parameters
+		if _, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
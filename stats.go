@@ -0,0 +1,162 @@
+package crawal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// statsSetting keeps the totals of the last LibraryStats recorded with RecordStats
+const statsSetting = "last_stats"
+
+// Stats summarizes the library
+type Stats struct {
+	At      time.Time   `json:"at"`
+	Games   []GameStats `json:"games"`
+	Total   GameStats   `json:"total"`
+	Artists []Count     `json:"artists"` // entries per artist, most first
+	Months  []Count     `json:"months"`  // entries added per month (YYYY-MM), oldest first
+
+	// Growth is the difference with the stats recorded last, nil the first time
+	Growth *StatsGrowth `json:"growth,omitempty"`
+}
+
+// GameStats are the totals of a game, or of the whole library
+type GameStats struct {
+	Game      string `json:"game,omitempty"`
+	Items     int    `json:"items"`     // gallery entries
+	Files     int    `json:"files"`     // downloaded images
+	Cataloged int    `json:"cataloged"` // images listed but not downloaded
+	Bytes     int64  `json:"bytes"`     // size of the downloaded images, duplicates counted once
+}
+
+// Count is a number of entries by name
+type Count struct {
+	Name  string `json:"name"`
+	Items int    `json:"items"`
+}
+
+// StatsGrowth is the difference of the totals since the stats recorded at Since
+type StatsGrowth struct {
+	Since time.Time   `json:"since"`
+	Games []GameStats `json:"games"` // games that changed
+	Total GameStats   `json:"total"`
+}
+
+// LibraryStats computes the stats of the library, and their growth since the stats
+// last recorded with RecordStats
+func LibraryStats(db *sql.DB) (Stats, error) {
+	s := Stats{At: time.Now(), Games: []GameStats{}}
+
+	rows, err := db.Query(`
+		SELECT game, COUNT(DISTINCT item_id),
+			COUNT(*) FILTER (WHERE cataloged = 0 AND path != ''),
+			COUNT(*) FILTER (WHERE cataloged = 1),
+			COALESCE(SUM(size) FILTER (WHERE cataloged = 0 AND path != '' AND duplicate_of = 0), 0)
+		FROM gallery GROUP BY game ORDER BY game`)
+	if err != nil {
+		return s, fmt.Errorf("failed to count wallpapers: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var g GameStats
+		if err := rows.Scan(&g.Game, &g.Items, &g.Files, &g.Cataloged, &g.Bytes); err != nil {
+			return s, err
+		}
+		s.Games = append(s.Games, g)
+		s.Total.add(g, 1)
+	}
+	if err := rows.Err(); err != nil {
+		return s, err
+	}
+
+	if s.Artists, err = countItems(db, `
+		SELECT a.name, COUNT(*) FROM items i JOIN artists a ON a.id = i.artist_id
+		GROUP BY a.id ORDER BY COUNT(*) DESC, a.name`); err != nil {
+		return s, fmt.Errorf("failed to count artists: %w", err)
+	}
+	if s.Months, err = countItems(db, `
+		SELECT strftime('%Y-%m', created_at) AS month, COUNT(*) FROM items
+		WHERE created_at IS NOT NULL GROUP BY month ORDER BY month`); err != nil {
+		return s, fmt.Errorf("failed to count months: %w", err)
+	}
+
+	last, err := GetSetting(db, statsSetting, "")
+	if err != nil || last == "" {
+		return s, err
+	}
+	var prev Stats
+	if err := json.Unmarshal([]byte(last), &prev); err != nil {
+		logger.Printf("Error reading the last stats, growth is not shown: %v", err)
+		return s, nil
+	}
+	s.Growth = growth(prev, s)
+	return s, nil
+}
+
+// RecordStats stores the totals of s, to compute the growth of the next stats
+func RecordStats(db *sql.DB, s Stats) error {
+	data, err := json.Marshal(Stats{At: s.At, Games: s.Games, Total: s.Total})
+	if err != nil {
+		return err
+	}
+	return SetSetting(db, statsSetting, string(data))
+}
+
+// countItems reads the name and count rows of query
+func countItems(db *sql.DB, query string) ([]Count, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []Count{}
+	for rows.Next() {
+		var c Count
+		if err := rows.Scan(&c.Name, &c.Items); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// growth returns the difference of the totals of cur since prev
+func growth(prev, cur Stats) *StatsGrowth {
+	g := &StatsGrowth{Since: prev.At, Games: []GameStats{}}
+	g.Total.add(cur.Total, 1)
+	g.Total.add(prev.Total, -1)
+
+	diffs := make(map[string]*GameStats)
+	var order []string
+	for _, s := range [][]GameStats{cur.Games, prev.Games} {
+		for _, game := range s {
+			if diffs[game.Game] == nil {
+				diffs[game.Game] = &GameStats{Game: game.Game}
+				order = append(order, game.Game)
+			}
+		}
+	}
+	for _, game := range cur.Games {
+		diffs[game.Game].add(game, 1)
+	}
+	for _, game := range prev.Games {
+		diffs[game.Game].add(game, -1)
+	}
+	for _, name := range order {
+		if d := *diffs[name]; d != (GameStats{Game: name}) {
+			g.Games = append(g.Games, d)
+		}
+	}
+	return g
+}
+
+// add adds the totals of o, times sign, to g
+func (g *GameStats) add(o GameStats, sign int) {
+	g.Items += sign * o.Items
+	g.Files += sign * o.Files
+	g.Cataloged += sign * o.Cataloged
+	g.Bytes += int64(sign) * o.Bytes
+}
@@ -0,0 +1,140 @@
+package crawal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Tagger computes tags, such as character or series names, for a downloaded wallpaper
+type Tagger interface {
+	// Name identifies the tagger as the source of its tags
+	Name() string
+	Tag(ctx context.Context, item GalleryItem) ([]string, error)
+}
+
+// CommandTagger runs an external command, e.g. a local ONNX model, on each image.
+// The "{file}" placeholder in the arguments is replaced by the image path, which is
+// appended when there is no placeholder. The command prints one tag per line.
+type CommandTagger struct {
+	Command string
+	Timeout time.Duration
+}
+
+// NewCommandTagger parses a command line such as `python wd14.py --threshold 0.4 {file}`
+func NewCommandTagger(command string) (*CommandTagger, error) {
+	if _, err := splitCommand(command); err != nil {
+		return nil, err
+	}
+	return &CommandTagger{Command: command, Timeout: defaultCommandTimeout}, nil
+}
+
+func (t *CommandTagger) Name() string {
+	args, _ := splitCommand(t.Command)
+	return args[0]
+}
+
+func (t *CommandTagger) Tag(ctx context.Context, item GalleryItem) ([]string, error) {
+	out, err := runCommand(ctx, t.Command, t.Timeout, map[string]string{"file": item.Path})
+	if err != nil {
+		return nil, fmt.Errorf("tagger failed: %w", err)
+	}
+
+	var tags []string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if tag := strings.TrimSpace(scanner.Text()); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, scanner.Err()
+}
+
+// TagGalleryItem runs the tagger on a downloaded wallpaper and stores the tags it returns
+func TagGalleryItem(ctx context.Context, db *sql.DB, t Tagger, item GalleryItem) ([]string, error) {
+	if item.ID == 0 {
+		saved, err := GetGalleryItem(db, item.Game, item.Region, item.IdGallery, item.Type)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up wallpaper: %w", err)
+		}
+		item = saved
+	}
+	if item.Path == "" {
+		return nil, errors.New("wallpaper has no file to tag")
+	}
+
+	tags, err := t.Tag(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	if err = AddTags(db, item.ID, t.Name(), tags...); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// storeTags stores the tags t gave a wallpaper before it was recorded
+func storeTags(db *sql.DB, t Tagger, item GalleryItem, tags []string) error {
+	if item.ID == 0 {
+		saved, err := GetGalleryItem(db, item.Game, item.Region, item.IdGallery, item.Type)
+		if err != nil {
+			return fmt.Errorf("failed to look up wallpaper: %w", err)
+		}
+		item = saved
+	}
+	return AddTags(db, item.ID, t.Name(), tags...)
+}
+
+// AddTags attaches tags to a wallpaper, ignoring the ones it already has
+func AddTags(db *sql.DB, galleryID int64, source string, tags ...string) error {
+	for _, tag := range tags {
+		_, err := db.Exec("INSERT OR IGNORE INTO tags(gallery_id, tag, source) VALUES (?, ?, ?)", galleryID, tag, source)
+		if err != nil {
+			return fmt.Errorf("failed to add tag %q: %w", tag, err)
+		}
+	}
+	return nil
+}
+
+// GetTags returns the tags of a wallpaper in alphabetical order
+func GetTags(db *sql.DB, galleryID int64) ([]string, error) {
+	rows, err := db.Query("SELECT tag FROM tags WHERE gallery_id = ? ORDER BY tag", galleryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// ListTags returns every tag of the library in alphabetical order
+func ListTags(db *sql.DB) ([]string, error) {
+	rows, err := db.Query("SELECT DISTINCT tag FROM tags ORDER BY tag")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
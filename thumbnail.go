@@ -0,0 +1,134 @@
+package crawal
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Thumbnail settings
+const (
+	thumbnailsDir    = ".thumbnails"
+	thumbnailWidth   = 320
+	thumbnailQuality = 80
+	resizedQuality   = 85
+)
+
+// ThumbnailPath returns where the thumbnail of the wallpaper file at p is stored
+func ThumbnailPath(p string) string {
+	name := strings.TrimSuffix(filepath.Base(p), filepath.Ext(p))
+	return filepath.Join(filepath.Dir(p), thumbnailsDir, name+".jpg")
+}
+
+// writeThumbnail scales a decoded wallpaper down to thumbnailWidth and saves it as JPEG
+func writeThumbnail(img image.Image, p string) error {
+	b := img.Bounds()
+	if b.Dx() == 0 || b.Dy() == 0 {
+		return fmt.Errorf("empty image")
+	}
+	w := min(thumbnailWidth, b.Dx())
+	h := max(b.Dy()*w/b.Dx(), 1)
+
+	if err := makeDirs(filepath.Dir(p)); err != nil {
+		return fmt.Errorf("failed to create thumbnails folder: %w", err)
+	}
+	f, err := createFile(p)
+	if err != nil {
+		return fmt.Errorf("failed to create thumbnail: %w", err)
+	}
+	if err = jpeg.Encode(f, resizeImage(img, w, h), &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	return f.Close()
+}
+
+// ResizedJPEG decodes the wallpaper file at p and returns it scaled down to width,
+// encoded as JPEG, for serving screens smaller than the file. Images narrower than
+// width keep their size.
+func ResizedJPEG(p string, width int) ([]byte, error) {
+	img, err := decodeImage(p)
+	if err != nil {
+		return nil, err
+	}
+	b := img.Bounds()
+	if b.Dx() == 0 || b.Dy() == 0 {
+		return nil, fmt.Errorf("empty image")
+	}
+	w := min(width, b.Dx())
+	h := max(b.Dy()*w/b.Dx(), 1)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, resizeImage(img, w, h), &jpeg.Options{Quality: resizedQuality}); err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", p, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// resizeImage scales an image to w x h, averaging a grid of samples for each pixel
+func resizeImage(img image.Image, w, h int) *image.RGBA {
+	const grid = 3
+
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var r, g, bl, a uint32
+			for sy := 0; sy < grid; sy++ {
+				for sx := 0; sx < grid; sx++ {
+					px := b.Min.X + (x*grid+sx)*b.Dx()/(w*grid)
+					py := b.Min.Y + (y*grid+sy)*b.Dy()/(h*grid)
+					pr, pg, pb, pa := img.At(px, py).RGBA()
+					r, g, bl, a = r+pr, g+pg, bl+pb, a+pa
+				}
+			}
+
+			const n = grid * grid
+			i := dst.PixOffset(x, y)
+			dst.Pix[i+0] = uint8(r / n >> 8)
+			dst.Pix[i+1] = uint8(g / n >> 8)
+			dst.Pix[i+2] = uint8(bl / n >> 8)
+			dst.Pix[i+3] = uint8(a / n >> 8)
+		}
+	}
+	return dst
+}
+
+// EnsureThumbnails creates the missing thumbnails of the wallpapers matching the filter.
+// It returns the number of thumbnails created and of files that could not be decoded.
+func EnsureThumbnails(db *sql.DB, f Filter) (int, int, error) {
+	items, err := FindGalleryItems(db, f)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to query wallpapers: %w", err)
+	}
+
+	var created, failed int
+	for _, item := range items {
+		if item.Path == "" {
+			continue
+		}
+		if _, err := os.Stat(ThumbnailPath(item.Path)); err == nil {
+			continue
+		}
+		if _, err := os.Stat(item.Path); err != nil {
+			continue
+		}
+
+		img, err := decodeImage(item.Path)
+		if err == nil {
+			err = writeThumbnail(img, ThumbnailPath(item.Path))
+		}
+		if err != nil {
+			failed++
+			continue
+		}
+		created++
+	}
+
+	return created, failed, nil
+}
@@ -0,0 +1,113 @@
+package crawal
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// torrentPieceLength is the piece size of generated torrents
+const torrentPieceLength = 256 * 1024
+
+// CreateTorrent writes a single-file .torrent for the file at p next to it and
+// returns its path. The first tracker is used as the announce URL.
+func CreateTorrent(p string, trackers []string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", p, err)
+	}
+	defer f.Close()
+
+	var pieces bytes.Buffer
+	var length int64
+	buf := make([]byte, torrentPieceLength)
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			sum := sha1.Sum(buf[:n])
+			pieces.Write(sum[:])
+			length += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to hash %s: %w", p, err)
+		}
+	}
+
+	meta := map[string]any{
+		"created by":    "yostar-wallpaper",
+		"creation date": time.Now().Unix(),
+		"info": map[string]any{
+			"name":         filepath.Base(p),
+			"length":       length,
+			"piece length": int64(torrentPieceLength),
+			"pieces":       pieces.Bytes(),
+		},
+	}
+	if len(trackers) > 0 {
+		meta["announce"] = trackers[0]
+		tiers := make([]any, 0, len(trackers))
+		for _, tracker := range trackers {
+			tiers = append(tiers, []any{tracker})
+		}
+		meta["announce-list"] = tiers
+	}
+
+	var out bytes.Buffer
+	if err = bencode(&out, meta); err != nil {
+		return "", err
+	}
+
+	torrentPath := p + ".torrent"
+	if err = os.WriteFile(torrentPath, out.Bytes(), 0644); err != nil {
+		return "", fmt.Errorf("failed to write torrent: %w", err)
+	}
+	return torrentPath, nil
+}
+
+// bencode writes v in the bencoding used by .torrent files
+func bencode(w *bytes.Buffer, v any) error {
+	switch v := v.(type) {
+	case string:
+		fmt.Fprintf(w, "%d:%s", len(v), v)
+	case []byte:
+		fmt.Fprintf(w, "%d:", len(v))
+		w.Write(v)
+	case int64:
+		fmt.Fprintf(w, "i%de", v)
+	case []any:
+		w.WriteByte('l')
+		for _, e := range v {
+			if err := bencode(w, e); err != nil {
+				return err
+			}
+		}
+		w.WriteByte('e')
+	case map[string]any:
+		// dictionary keys must be sorted
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		w.WriteByte('d')
+		for _, k := range keys {
+			bencode(w, k)
+			if err := bencode(w, v[k]); err != nil {
+				return err
+			}
+		}
+		w.WriteByte('e')
+	default:
+		return fmt.Errorf("cannot bencode %T", v)
+	}
+	return nil
+}
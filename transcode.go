@@ -0,0 +1,43 @@
+package crawal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// transcodedFormats are the formats converted by QueueOptions.Transcode, which
+// older wallpaper tools and image viewers cannot read
+var transcodedFormats = map[string]bool{"avif": true, "jxl": true}
+
+// transcodeFile converts the downloaded file at p with codec when it holds one of
+// transcodedFormats, replacing it, and returns the path of the file kept
+func transcodeFile(ctx context.Context, codec Codec, p string) (string, error) {
+	format, ok := sniffFile(p)
+	if !ok || !transcodedFormats[format.name] {
+		return p, nil
+	}
+
+	// converted next to its final path, which may be taken by another file
+	tmp, err := createTemp(filepath.Dir(p), ".transcode-*"+codec.Ext())
+	if err != nil {
+		return p, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	defer trackTemp(tmp.Name())()
+	if err := codec.Convert(ctx, p, tmp.Name()); err != nil {
+		return p, fmt.Errorf("failed to transcode %s: %w", format.name, err)
+	}
+
+	dst, err := conflicts.place(tmp.Name(), strings.TrimSuffix(p, filepath.Ext(p))+codec.Ext())
+	if err != nil {
+		return p, err
+	}
+	if dst != p {
+		os.Remove(p)
+	}
+	return dst, nil
+}
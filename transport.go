@@ -0,0 +1,145 @@
+package crawal
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// NetworkOptions work around networks where the CDN or the APIs behave badly
+type NetworkOptions struct {
+	DisableHTTP2 bool // talk HTTP/1.1 only, for edges with broken HTTP/2
+	ForceIPv4    bool // dial IPv4 addresses only, for networks with broken IPv6 routes
+
+	// DNS is the server resolving the hosts, an IP address with an optional port or the
+	// URL of a DNS-over-HTTPS JSON API, for resolvers blocking the CDN. The system
+	// resolver is used when empty. Check it with CheckDNSServer.
+	DNS string
+
+	// Bind is the local IP address or the network interface, such as the tun0 of a VPN,
+	// connections are made from. Check it with CheckBind.
+	Bind string
+}
+
+// downloadTransport is shared by all downloads, so that the workers reuse their
+// connections to the CDN. Each download loads it once, so that SetNetworkOptions
+// can be called while downloads run.
+var downloadTransport atomic.Pointer[http.Transport]
+
+// networkOptions are the options last set, for the API clients of the crawlers
+var networkOptions atomic.Pointer[NetworkOptions]
+
+func init() {
+	SetNetworkOptions(NetworkOptions{})
+}
+
+// SetNetworkOptions applies opts to the downloads of the library started from then
+// on, and to the API clients of the crawlers run from then on
+func SetNetworkOptions(opts NetworkOptions) {
+	networkOptions.Store(&opts)
+	downloadTransport.Store(newDownloadTransport(opts))
+}
+
+// NewTransport returns a transport for the API calls. It negotiates HTTP/2 over TLS
+// unless disabled and asks for gzip-compressed responses, decompressed transparently.
+// Brotli is not offered, since the standard library has no decoder for it. Hosts are
+// resolved once for all its connections, until their addresses expire.
+func NewTransport(opts NetworkOptions) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.ForceAttemptHTTP2 = !opts.DisableHTTP2
+	if opts.DisableHTTP2 {
+		// A non-nil empty map disables HTTP/2
+		t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	family := ""
+	if opts.ForceIPv4 {
+		family = "tcp4"
+	}
+	var local net.IP
+	if opts.Bind != "" {
+		var err error
+		local, err = bindAddress(opts.Bind, opts.ForceIPv4)
+		if err != nil {
+			// Fail the connections rather than bypass the VPN
+			t.DialContext = func(context.Context, string, string) (net.Conn, error) {
+				return nil, fmt.Errorf("failed to bind to %s: %w", opts.Bind, err)
+			}
+			return t
+		}
+		dialer.LocalAddr = &net.TCPAddr{IP: local}
+		family = ipFamily(local)
+	}
+	t.DialContext = newDNSCache(opts.DNS, local).dialContext(dialer, family)
+	return t
+}
+
+// newDownloadTransport returns the transport of the image downloads. Images are
+// compressed already, so they are asked as is, which also keeps the sizes announced
+// to Preflight exact.
+func newDownloadTransport(opts NetworkOptions) *http.Transport {
+	t := NewTransport(opts)
+	t.DisableCompression = true
+	t.MaxIdleConnsPerHost = 16
+	return t
+}
+
+// CheckBind reports whether bind can be used as NetworkOptions.Bind, with an IPv4
+// address when ipv4
+func CheckBind(bind string, ipv4 bool) error {
+	if bind == "" {
+		return nil
+	}
+	_, err := bindAddress(bind, ipv4)
+	return err
+}
+
+// bindAddress returns the IP address bind is, or the address of the interface it names,
+// IPv4 ones first. Only IPv4 addresses are returned when ipv4.
+func bindAddress(bind string, ipv4 bool) (net.IP, error) {
+	if ip := net.ParseIP(bind); ip != nil {
+		if ipv4 && ip.To4() == nil {
+			return nil, fmt.Errorf("%s is not an IPv4 address", bind)
+		}
+		return ip, nil
+	}
+
+	iface, err := net.InterfaceByName(bind)
+	if err != nil {
+		return nil, fmt.Errorf("%q is neither an IP address nor a network interface", bind)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the addresses of %s: %w", bind, err)
+	}
+	var v6 net.IP
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || ipnet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if ipnet.IP.To4() != nil {
+			return ipnet.IP, nil
+		}
+		if v6 == nil {
+			v6 = ipnet.IP
+		}
+	}
+	if v6 == nil || ipv4 {
+		return nil, fmt.Errorf("network interface %s has no usable address", bind)
+	}
+	return v6, nil
+}
+
+// ipFamily returns the network of the connections from ip, tcp4 or tcp6
+func ipFamily(ip net.IP) string {
+	if ip.To4() != nil {
+		return "tcp4"
+	}
+	return "tcp6"
+}
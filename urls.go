@@ -0,0 +1,74 @@
+package crawal
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// maxRedirects is the number of redirects a download follows, through the signed
+// URLs some CDN links redirect to
+const maxRedirects = 5
+
+// ErrTooManyRedirects is returned by downloads redirected more than maxRedirects times
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+// checkRedirect is the CheckRedirect of the download clients
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > maxRedirects {
+		return fmt.Errorf("%w: stopped after %d", ErrTooManyRedirects, maxRedirects)
+	}
+	return nil
+}
+
+// signingParams are the query parameters of signed CDN URLs that change with every
+// signature, by lowercase name, with the prefixes of those of S3 and GCS
+var signingParams = []string{"expires", "signature", "key-pair-id", "policy", "token", "auth_key", "x-amz-", "x-goog-", "x-oss-"}
+
+// NormalizeURL returns a canonical form of a URL, for URLs resolved through
+// redirects to be compared across downloads: the scheme and host are lowercase,
+// default ports, dot segments and the fragment are dropped, and so are the
+// parameters of signed URLs, which expire. The other parameters are sorted. URLs
+// that do not parse are returned as is.
+func NormalizeURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return raw
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if port := u.Port(); (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		u.Host = u.Hostname()
+	}
+	if u.Path != "" {
+		cleaned := path.Clean(u.Path)
+		if strings.HasSuffix(u.Path, "/") && cleaned != "/" {
+			cleaned += "/"
+		}
+		u.Path, u.RawPath = cleaned, ""
+	}
+	u.Fragment, u.RawFragment = "", ""
+
+	query := u.Query()
+	for name := range query {
+		if isSigningParam(name) {
+			query.Del(name)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// isSigningParam reports whether the query parameter name is one of signingParams
+func isSigningParam(name string) bool {
+	name = strings.ToLower(name)
+	for _, p := range signingParams {
+		if name == p || (strings.HasSuffix(p, "-") && strings.HasPrefix(name, p)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package crawal
+
+import (
+	"errors"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// Results of verifying a file
+const (
+	VerifyOK      = "ok"
+	VerifyMissing = "missing" // the file no longer exists
+	VerifyCorrupt = "corrupt" // its checksum changed
+	VerifyFailed  = "failed"  // it could not be read
+)
+
+// VerifyResult is the result of verifying the file of a wallpaper
+type VerifyResult struct {
+	Game      string `json:"game"`
+	IdGallery string `json:"id"`
+	Type      string `json:"type"`
+	Path      string `json:"path"`
+	Status    string `json:"status"`
+	Expected  string `json:"expected_sha256"`
+	Actual    string `json:"actual_sha256,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// VerifyReport summarizes a verification, with the results of the files that did
+// not verify
+type VerifyReport struct {
+	Checked  int            `json:"checked"`
+	OK       int            `json:"ok"`
+	Bytes    int64          `json:"bytes"`
+	Problems []VerifyResult `json:"problems"`
+	Duration time.Duration  `json:"duration_ns"`
+}
+
+// VerifyProgress is told about each file verified, with the totals so far
+type VerifyProgress func(done, total int, bytes int64)
+
+// VerifyItems hashes the files of the wallpapers with a checksum, workers at a
+// time, and compares them with their recorded checksums. Problems are reported in
+// the order of items.
+func VerifyItems(items []GalleryItem, workers int, progress VerifyProgress) VerifyReport {
+	start := time.Now()
+	var checked []GalleryItem
+	for _, item := range items {
+		if item.Path != "" && item.SHA256 != "" {
+			checked = append(checked, item)
+		}
+	}
+
+	results := make([]VerifyResult, len(checked))
+	var mu sync.Mutex
+	var done int
+	var bytes int64
+	parallel(len(checked), workers, func(i int) {
+		item := checked[i]
+		r := VerifyResult{Game: item.Game, IdGallery: item.IdGallery, Type: item.Type, Path: item.Path, Expected: item.SHA256}
+		sum, size, err := HashFile(item.Path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			r.Status = VerifyMissing
+		case err != nil:
+			r.Status, r.Error = VerifyFailed, err.Error()
+		case sum != item.SHA256:
+			r.Status, r.Actual = VerifyCorrupt, sum
+		default:
+			r.Status = VerifyOK
+		}
+		results[i] = r
+
+		mu.Lock()
+		defer mu.Unlock()
+		done++
+		bytes += size
+		if progress != nil {
+			progress(done, len(checked), bytes)
+		}
+	})
+
+	report := VerifyReport{Checked: len(checked), Bytes: bytes, Problems: []VerifyResult{}}
+	for _, r := range results {
+		if r.Status == VerifyOK {
+			report.OK++
+		} else {
+			report.Problems = append(report.Problems, r)
+		}
+	}
+	report.Duration = time.Since(start)
+	return report
+}
@@ -0,0 +1,109 @@
+package crawal
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// WatchLibrary publishes an item_added event for every wallpaper other processes
+// download into the library, such as the crawlers run by yostar-wallpaper sync,
+// checking it every interval until ctx is done. The downloads of the queues of this
+// process publish their own events, which are not repeated unless they are seen in
+// the database first.
+func WatchLibrary(ctx context.Context, db *sql.DB, interval time.Duration) error {
+	// downloaded_at is a CURRENT_TIMESTAMP, to the second: the files of the last
+	// second seen are remembered so that they are not published again
+	var since string
+	if err := db.QueryRow("SELECT COALESCE(MAX(CAST(downloaded_at AS TEXT)), '') FROM files").Scan(&since); err != nil {
+		return err
+	}
+	seen := make(map[int64]bool)
+	current, err := downloadedSince(db, since)
+	if err != nil {
+		return err
+	}
+	for _, d := range current {
+		seen[d.id] = true
+	}
+
+	var mu sync.Mutex
+	own := make(map[int64]bool)
+	defer Subscribe(func(e Event) {
+		if e.Kind == EventItemAdded {
+			mu.Lock()
+			own[e.ID] = true
+			mu.Unlock()
+		}
+	})()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		added, err := downloadedSince(db, since)
+		if err != nil {
+			logger.Printf("Error watching the library: %v", err)
+			continue
+		}
+		for _, a := range added {
+			if a.at > since {
+				since, seen = a.at, make(map[int64]bool)
+			}
+			if seen[a.id] {
+				continue
+			}
+			seen[a.id] = true
+
+			mu.Lock()
+			published := own[a.id]
+			delete(own, a.id)
+			mu.Unlock()
+			if published {
+				continue
+			}
+			item, err := GetGalleryItemByID(db, a.id)
+			if err != nil {
+				logger.Printf("Error watching the library: %v", err)
+				continue
+			}
+			publish(Event{Kind: EventItemAdded, Game: item.Game, IdGallery: item.IdGallery, Type: item.Type,
+				FileName: item.FileName, URL: item.URL, Path: item.Path, Size: item.Size, ID: item.ID})
+			mu.Lock()
+			delete(own, a.id) // recorded by the subscription above
+			mu.Unlock()
+		}
+	}
+}
+
+// download is a file downloaded at a CURRENT_TIMESTAMP
+type download struct {
+	id int64
+	at string
+}
+
+// downloadedSince returns the files downloaded at or after since, oldest first
+func downloadedSince(db *sql.DB, since string) ([]download, error) {
+	rows, err := db.Query(`SELECT id, CAST(downloaded_at AS TEXT) FROM files
+		WHERE CAST(downloaded_at AS TEXT) >= ? ORDER BY downloaded_at, id`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var added []download
+	for rows.Next() {
+		var d download
+		if err := rows.Scan(&d.id, &d.at); err != nil {
+			return nil, err
+		}
+		added = append(added, d)
+	}
+	return added, rows.Err()
+}
@@ -0,0 +1,54 @@
+package crawal
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// waybackSaveURL is the Save Page Now endpoint of the Internet Archive
+const waybackSaveURL = "https://web.archive.org/save/"
+
+// Wayback submits URLs to the Internet Archive, so that wallpapers stay publicly
+// available even when the game CDN removes them
+type Wayback struct {
+	Client   *http.Client
+	Interval time.Duration // pause between submissions, as the save API is rate limited
+}
+
+// NewWayback returns a Wayback submitting a URL every few seconds
+func NewWayback() *Wayback {
+	return &Wayback{
+		Client:   &http.Client{Timeout: 2 * time.Minute},
+		Interval: 5 * time.Second,
+	}
+}
+
+// Submit asks the Internet Archive to save url
+func (w *Wayback) Submit(url string) error {
+	res, err := w.Client.Get(waybackSaveURL + url)
+	if err != nil {
+		return fmt.Errorf("failed to submit %s: %w", url, err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to submit %s: %s", url, res.Status)
+	}
+	return nil
+}
+
+// SubmitAll submits the URLs one after the other, logging those that fail
+func (w *Wayback) SubmitAll(urls []string) {
+	var n int
+	for i, url := range urls {
+		if i > 0 {
+			time.Sleep(w.Interval)
+		}
+		if err := w.Submit(url); err != nil {
+			logger.Printf("Wayback: %v", err)
+			continue
+		}
+		n++
+	}
+	logger.Printf("Wayback: submitted %d of %d new images", n, len(urls))
+}
@@ -0,0 +1,145 @@
+package crawal
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMeteredInterfaces are the network interfaces of mobile broadband and USB
+// tethering, usually metered
+var DefaultMeteredInterfaces = []string{"wwan*", "ppp*", "rmnet*", "usb*"}
+
+// meteredCheckInterval is how long the metered check of the network is reused
+const meteredCheckInterval = time.Minute
+
+// DownloadWindow holds the downloads of a queue back during quiet hours or on a
+// metered network. Downloads already running finish.
+type DownloadWindow struct {
+	QuietHours QuietHours
+
+	// UnmeteredOnly holds downloads back while the network of the default route
+	// is metered: its interface matches one of MeteredInterfaces, path.Match
+	// patterns such as DefaultMeteredInterfaces, or NetworkManager reports its
+	// connection as metered. It is detected on Linux only.
+	UnmeteredOnly     bool
+	MeteredInterfaces []string
+}
+
+// Hold returns why downloads wait at t, empty when they may run
+func (w DownloadWindow) Hold(t time.Time) string {
+	if until, ok := w.QuietHours.Until(t); ok {
+		return "quiet hours until " + until.Format("15:04")
+	}
+	if w.UnmeteredOnly {
+		if iface, ok := meteredNetwork(w.MeteredInterfaces); ok {
+			return "metered network on " + iface
+		}
+	}
+	return ""
+}
+
+// QuietHours are the times of day downloads wait for. A window ending before it
+// starts spans midnight.
+type QuietHours []quietWindow
+
+// quietWindow is a window of quiet hours, as durations since midnight
+type quietWindow struct {
+	start, end time.Duration
+}
+
+// ParseQuietHours parses comma separated windows of local time such as
+// "09:00-18:00,23:30-01:00"
+func ParseQuietHours(s string) (QuietHours, error) {
+	var q QuietHours
+	for _, window := range strings.Split(s, ",") {
+		window = strings.TrimSpace(window)
+		if window == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(window, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid quiet hours %q, expected HH:MM-HH:MM", window)
+		}
+		start, err := parseClock(from)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClock(to)
+		if err != nil {
+			return nil, err
+		}
+		if start == end {
+			return nil, fmt.Errorf("invalid quiet hours %q, it ends when it starts", window)
+		}
+		q = append(q, quietWindow{start, end})
+	}
+	return q, nil
+}
+
+// parseClock parses a time of day as HH:MM
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", strings.TrimSpace(s))
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Until reports whether t is in quiet hours, and when they end
+func (q QuietHours) Until(t time.Time) (time.Time, bool) {
+	clock := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	// the end is a time of day on the clock, which is not as long after midnight
+	// on the days daylight saving time starts or ends
+	day := func(days int, at time.Duration) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day()+days, int(at/time.Hour), int(at%time.Hour/time.Minute), 0, 0, t.Location())
+	}
+	for _, w := range q {
+		switch {
+		case w.start < w.end && clock >= w.start && clock < w.end:
+			return day(0, w.end), true
+		case w.start > w.end && clock >= w.start:
+			return day(1, w.end), true
+		case w.start > w.end && clock < w.end:
+			return day(0, w.end), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// metered is the last metered check of the network
+var metered struct {
+	sync.Mutex
+	checked  time.Time
+	patterns string
+	iface    string
+	metered  bool
+}
+
+// meteredNetwork reports whether the network of the default route is metered, with
+// its interface. The check is reused for meteredCheckInterval.
+func meteredNetwork(patterns []string) (string, bool) {
+	metered.Lock()
+	defer metered.Unlock()
+	key := strings.Join(patterns, ",")
+	if key == metered.patterns && time.Since(metered.checked) < meteredCheckInterval {
+		return metered.iface, metered.metered
+	}
+
+	iface := defaultInterface()
+	isMetered := false
+	if iface != "" {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, iface); ok {
+				isMetered = true
+				break
+			}
+		}
+		isMetered = isMetered || networkManagerMetered(iface)
+	}
+	metered.checked, metered.patterns = time.Now(), key
+	metered.iface, metered.metered = iface, isMetered
+	return iface, isMetered
+}
@@ -0,0 +1,108 @@
+package crawal
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // the zones of the daylight saving time tests
+)
+
+func TestParseQuietHours(t *testing.T) {
+	tests := []struct {
+		s       string
+		windows int
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"09:00-18:00", 1, false},
+		{" 09:00 - 18:00 , 23:30-01:00 ,", 2, false},
+		{"22:00-07:00", 1, false},
+		{"00:00-23:59", 1, false},
+		{"09:00-09:00", 0, true}, // start == end
+		{"09:00", 0, true},
+		{"9-18", 0, true},
+		{"09:00-24:00", 0, true},
+		{"25:00-01:00", 0, true},
+		{"09:00-18:00,bad", 0, true},
+	}
+	for _, tt := range tests {
+		q, err := ParseQuietHours(tt.s)
+		if (err != nil) != tt.wantErr || len(q) != tt.windows {
+			t.Errorf("ParseQuietHours(%q) = %v, %v; want %d windows, error %v", tt.s, q, err, tt.windows, tt.wantErr)
+		}
+	}
+}
+
+func TestQuietHoursUntil(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(loc *time.Location, month time.Month, day, hour, min int) time.Time {
+		return time.Date(2024, month, day, hour, min, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name  string
+		hours string
+		t     time.Time
+		until time.Time // zero when not quiet
+	}{
+		{"before a day window", "09:00-18:00", at(time.UTC, 6, 10, 8, 59), time.Time{}},
+		{"start of a day window", "09:00-18:00", at(time.UTC, 6, 10, 9, 0), at(time.UTC, 6, 10, 18, 0)},
+		{"in a day window", "09:00-18:00", at(time.UTC, 6, 10, 17, 59), at(time.UTC, 6, 10, 18, 0)},
+		{"end of a day window", "09:00-18:00", at(time.UTC, 6, 10, 18, 0), time.Time{}},
+
+		{"before midnight", "22:00-07:00", at(time.UTC, 6, 10, 23, 0), at(time.UTC, 6, 11, 7, 0)},
+		{"start before midnight", "22:00-07:00", at(time.UTC, 6, 10, 22, 0), at(time.UTC, 6, 11, 7, 0)},
+		{"midnight", "22:00-07:00", at(time.UTC, 6, 11, 0, 0), at(time.UTC, 6, 11, 7, 0)},
+		{"after midnight", "22:00-07:00", at(time.UTC, 6, 11, 6, 59), at(time.UTC, 6, 11, 7, 0)},
+		{"end after midnight", "22:00-07:00", at(time.UTC, 6, 11, 7, 0), time.Time{}},
+		{"day between", "22:00-07:00", at(time.UTC, 6, 11, 12, 0), time.Time{}},
+		{"end of month", "22:00-07:00", at(time.UTC, 6, 30, 23, 0), at(time.UTC, 7, 1, 7, 0)},
+		{"end of year", "23:30-00:30", time.Date(2024, 12, 31, 23, 45, 0, 0, time.UTC), time.Date(2025, 1, 1, 0, 30, 0, 0, time.UTC)},
+
+		{"first of two windows", "01:00-03:00,12:00-13:00", at(time.UTC, 6, 10, 2, 0), at(time.UTC, 6, 10, 3, 0)},
+		{"second of two windows", "01:00-03:00,12:00-13:00", at(time.UTC, 6, 10, 12, 30), at(time.UTC, 6, 10, 13, 0)},
+		{"between two windows", "01:00-03:00,12:00-13:00", at(time.UTC, 6, 10, 4, 0), time.Time{}},
+		{"no window", "", at(time.UTC, 6, 10, 12, 0), time.Time{}},
+
+		// Berlin moves from 02:00 to 03:00 on March 31 2024, and from 03:00 back to
+		// 02:00 on October 27 2024; the windows follow the clock
+		{"day window when the clocks go forward", "09:00-18:00", at(berlin, 3, 31, 10, 0), at(berlin, 3, 31, 18, 0)},
+		{"day window when the clocks go back", "09:00-18:00", at(berlin, 10, 27, 10, 0), at(berlin, 10, 27, 18, 0)},
+		{"night window over the clocks going forward", "22:00-07:00", at(berlin, 3, 30, 23, 0), at(berlin, 3, 31, 7, 0)},
+		{"night window over the clocks going back", "22:00-07:00", at(berlin, 10, 26, 23, 0), at(berlin, 10, 27, 7, 0)},
+		{"after the clocks went forward", "01:00-05:00", at(berlin, 3, 31, 4, 0), at(berlin, 3, 31, 5, 0)},
+		{"after the clocks went back", "01:00-05:00", at(berlin, 10, 27, 1, 30), at(berlin, 10, 27, 5, 0)},
+		{"window ending in the skipped hour", "01:00-02:30", at(berlin, 3, 31, 1, 30), at(berlin, 3, 31, 3, 30)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := ParseQuietHours(tt.hours)
+			if err != nil {
+				t.Fatal(err)
+			}
+			until, quiet := q.Until(tt.t)
+			if quiet != !tt.until.IsZero() || !until.Equal(tt.until) {
+				t.Errorf("Until(%v) = %v, %v; want %v", tt.t, until, quiet, tt.until)
+			}
+			if quiet && !until.After(tt.t) {
+				t.Errorf("Until(%v) = %v, which is not later", tt.t, until)
+			}
+		})
+	}
+}
+
+func TestDownloadWindowHold(t *testing.T) {
+	q, err := ParseQuietHours("22:00-07:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := DownloadWindow{QuietHours: q}
+	if got := w.Hold(time.Date(2024, 6, 10, 23, 0, 0, 0, time.UTC)); got != "quiet hours until 07:00" {
+		t.Errorf("Hold in quiet hours = %q", got)
+	}
+	if got := w.Hold(time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)); got != "" {
+		t.Errorf("Hold out of quiet hours = %q", got)
+	}
+}